@@ -147,6 +147,20 @@ func GetPointer(spec wiring.WiringSpec, name string) *PointerDef {
 	return ptr
 }
 
+// Returns the name of the outermost server-side node of the pointer.
+//
+// Plugins that instantiate the server side of a pointer more than once, such as the replicas plugin,
+// can use this as the destination of additional pointers.
+func (ptr *PointerDef) Dst() string {
+	return ptr.dstHead
+}
+
+// Removes the uniqueness check that [CreatePointer] applies to the destination of the pointer,
+// so that the server side of the pointer can be instantiated in more than one namespace.
+func (ptr *PointerDef) DisableUniqueness(spec wiring.WiringSpec) {
+	DisableUniqueness(spec, ptr.dstModifiers[len(ptr.dstModifiers)-1])
+}
+
 // Appends a modifier node called modifierName to the client side modifiers of a pointer.
 //
 // Plugins use this method if they want to wrap the client side of a service, for example
@@ -1,6 +1,8 @@
 package pointer
 
 import (
+	"strings"
+
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/blueprint"
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/ir"
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/wiring"
@@ -72,3 +74,16 @@ func RequireUniqueness(spec wiring.WiringSpec, alias string, visibility any) {
 
 	spec.Alias(alias, checkName)
 }
+
+// Removes a uniqueness check that was applied to alias by [RequireUniqueness], so that the aliased
+// node can be instantiated in more than one namespace.  Has no effect if alias does not have a
+// uniqueness check.
+func DisableUniqueness(spec wiring.WiringSpec, alias string) {
+	checkName, is_alias := spec.GetAlias(alias)
+	if !is_alias {
+		return
+	}
+	if name, is_check := strings.CutSuffix(checkName, ".uniqueness_check"); is_check {
+		spec.Alias(alias, name)
+	}
+}
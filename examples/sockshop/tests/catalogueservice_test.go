@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/blueprint-uservices/blueprint/examples/sockshop/workflow/catalogue"
+	"github.com/blueprint-uservices/blueprint/runtime/core/migrate"
 	"github.com/blueprint-uservices/blueprint/runtime/core/registry"
 	"github.com/blueprint-uservices/blueprint/runtime/plugins/sqlitereldb"
 	"github.com/stretchr/testify/require"
@@ -23,6 +24,9 @@ func init() {
 		if err != nil {
 			return nil, err
 		}
+		if err := migrate.Run(ctx, "catalogue_db", db, "catalogue", "sqlite", nil); err != nil {
+			return nil, err
+		}
 
 		return catalogue.NewCatalogueService(ctx, db)
 	})
@@ -31,7 +35,7 @@ func init() {
 	// // To run using mysql, start a mysql docker container with:
 	// //   docker run -p 3306:3306 --env MYSQL_ROOT_PASSWORD=pass
 	// catalogueRegistry.Register("mysql", func(ctx context.Context) (catalogue.CatalogueService, error) {
-	// 	db, err := mysql.NewMySqlDB(ctx, "localhost:3306", "catalogue_db", "root", "pass")
+	// 	db, err := mysql.NewMySqlDB(ctx, "localhost:3306", "catalogue_db", "root", "pass", "catalogue")
 	// 	if err != nil {
 	// 		return nil, err
 	// 	}
@@ -44,7 +44,7 @@ func makeBasicSpec(spec wiring.WiringSpec) ([]string, error) {
 	order_db := simple.NoSQLDB(spec, "order_db")
 	order_service := workflow.Service[order.OrderService](spec, "order_service", user_service, cart_service, payment_service, shipping_service, order_db)
 
-	catalogue_db := simple.RelationalDB(spec, "catalogue_db")
+	catalogue_db := simple.RelationalDB(spec, "catalogue_db", simple.RelationalDBOptions{Migrations: "catalogue"})
 	catalogue_service := workflow.Service[catalogue.CatalogueService](spec, "catalogue_service", catalogue_db)
 
 	frontend_service := workflow.Service[frontend.Frontend](spec, "frontend", user_service, catalogue_service, cart_service, order_service)
@@ -35,7 +35,7 @@ import (
 // All services are instrumented with OpenTelemetry and traces are exported to Zipkin
 //
 // The user, cart, shipping, and orders services using separate MongoDB instances to store their data.
-// The catalogue service uses MySQL to store catalogue data.
+// The catalogue service uses MySQL to store catalogue data; its tables are created by the catalogue's migrations.
 // The shipping service and queue master service run within the same process.
 var Docker = cmdbuilder.SpecOption{
 	Name:        "docker",
@@ -92,7 +92,7 @@ func makeDockerSpec(spec wiring.WiringSpec) ([]string, error) {
 	order_service := workflow.Service[order.OrderService](spec, "order_service", user_service, cart_service, payment_service, shipping_service, order_db)
 	applyDockerDefaults(order_service)
 
-	catalogue_db := mysql.Container(spec, "catalogue_db")
+	catalogue_db := mysql.Container(spec, "catalogue_db", mysql.ContainerOptions{Migrations: "catalogue"})
 	catalogue_service := workflow.Service[catalogue.CatalogueService](spec, "catalogue_service", catalogue_db)
 	applyDockerDefaults(catalogue_service)
 
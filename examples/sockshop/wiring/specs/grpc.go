@@ -77,7 +77,7 @@ func makeGrpcSpec(spec wiring.WiringSpec) ([]string, error) {
 	order_service := workflow.Service[order.OrderService](spec, "order_service", user_service, cart_service, payment_service, shipping_service, order_db)
 	applyDefaults(order_service)
 
-	catalogue_db := simple.RelationalDB(spec, "catalogue_db")
+	catalogue_db := simple.RelationalDB(spec, "catalogue_db", simple.RelationalDBOptions{Migrations: "catalogue"})
 	catalogue_service := workflow.Service[catalogue.CatalogueService](spec, "catalogue_service", catalogue_db)
 	applyDefaults(catalogue_service)
 
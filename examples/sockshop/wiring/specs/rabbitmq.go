@@ -29,7 +29,7 @@ import (
 // All RPC calls are retried up to 3 times.  RPC clients use a client pool with 10 clients.
 // All services are instrumented with OpenTelemetry and traces are exported to Zipkin
 // The user, cart, shipping, and orders services using separate MongoDB instances to store their data.
-// The catalogue service uses MySQL to store catalogue data.
+// The catalogue service uses MySQL to store catalogue data; its tables are created by the catalogue's migrations.
 var DockerRabbit = cmdbuilder.SpecOption{
 	Name:        "rabbit",
 	Description: "Deploys each service in a separate container with gRPC, and uses mongodb as NoSQL database backends and rabbitmq as the queue backend.",
@@ -79,7 +79,7 @@ func makeDockerRabbitSpec(spec wiring.WiringSpec) ([]string, error) {
 	order_service := workflow.Service[order.OrderService](spec, "order_service", user_service, cart_service, payment_service, shipping_service, order_db)
 	applyDockerDefaults(order_service)
 
-	catalogue_db := mysql.Container(spec, "catalogue_db")
+	catalogue_db := mysql.Container(spec, "catalogue_db", mysql.ContainerOptions{Migrations: "catalogue"})
 	catalogue_service := workflow.Service[catalogue.CatalogueService](spec, "catalogue_service", catalogue_db)
 	applyDockerDefaults(catalogue_service)
 
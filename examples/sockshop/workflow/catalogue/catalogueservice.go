@@ -3,9 +3,11 @@ package catalogue
 
 import (
 	"context"
+	"embed"
 	"strings"
 
 	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+	"github.com/blueprint-uservices/blueprint/runtime/core/migrate"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 )
@@ -80,16 +82,27 @@ var baseQuery = `SELECT sock.sock_id,
 				JOIN sock_tag ON sock.sock_id=sock_tag.sock_id
 				JOIN tag ON tag.tag_id=sock_tag.tag_id`
 
+// The migrations that create the catalogue's tables.  They are registered as "catalogue", and must be
+// applied to the database before the service is created, e.g. by the Migrations option of the database
+// in the wiring spec.
+//
+//go:embed migrations
+var migrations embed.FS
+
+func init() {
+	migrate.Register("catalogue", migrations, "migrations")
+}
+
 // Implementation of [CatalogueService].  Method implementations are pulled directly from the original
 // SockShop implementation, which was written in golang.
 type catalogueImpl struct {
 	db backend.RelationalDB
 }
 
-// Creates a [CatalogueService] instance that stores the item catalogue in the provided relational database
+// Creates a [CatalogueService] instance that stores the item catalogue in the provided relational database.
+// The catalogue's migrations must have been applied to the database.
 func NewCatalogueService(ctx context.Context, db backend.RelationalDB) (CatalogueService, error) {
-	c := &catalogueImpl{db: db}
-	return c, c.createTables(ctx)
+	return &catalogueImpl{db: db}, nil
 }
 
 // List implements CatalogueService.
@@ -299,50 +312,3 @@ func (s *catalogueImpl) addTags(ctx context.Context, tags ...string) ([]int, err
 
 	return tagIds, nil
 }
-
-// Creates database tables if they don't already exist
-func (c *catalogueImpl) createTables(ctx context.Context) (err error) {
-	if _, err = c.db.Exec(ctx, createSockTable); err != nil {
-		return errors.Wrap(err, "unable to create sock table")
-	}
-	if _, err = c.db.Exec(ctx, createTagTable); err != nil {
-		if _, err = c.db.Exec(ctx, createTagTable2); err != nil {
-			return errors.Wrap(err, "unable to create Tag table")
-		}
-	}
-	if _, err = c.db.Exec(ctx, createSockTagTable); err != nil {
-		return errors.Wrap(err, "unable to create socktag table")
-	}
-	return nil
-}
-
-var createSockTable = `CREATE TABLE IF NOT EXISTS sock (
-	sock_id varchar(40) NOT NULL, 
-	name varchar(20), 
-	description varchar(200), 
-	price float, 
-	quantity int, 
-	image_url_1 varchar(40), 
-	image_url_2 varchar(40), 
-	PRIMARY KEY(sock_id)
-);`
-
-// AUTOINCREMENT should be AUTO_INCREMENT in mysql
-var createTagTable = `CREATE TABLE IF NOT EXISTS tag (
-	tag_id INTEGER PRIMARY KEY AUTO_INCREMENT, 
-	name varchar(20)
-);`
-
-var createTagTable2 = `CREATE TABLE IF NOT EXISTS tag (
-	tag_id INTEGER PRIMARY KEY AUTOINCREMENT, 
-	name varchar(20)
-);`
-
-var createSockTagTable = `CREATE TABLE IF NOT EXISTS sock_tag (
-	sock_id varchar(40), 
-	tag_id INTEGER, 
-	FOREIGN KEY (sock_id) 
-		REFERENCES sock(sock_id), 
-	FOREIGN KEY(tag_id)
-		REFERENCES tag(tag_id)
-);`
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS sock_tag;
+DROP TABLE IF EXISTS tag;
+DROP TABLE IF EXISTS sock;
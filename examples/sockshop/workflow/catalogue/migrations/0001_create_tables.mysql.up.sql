@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS sock (
+	sock_id varchar(40) NOT NULL,
+	name varchar(20),
+	description varchar(200),
+	price float,
+	quantity int,
+	image_url_1 varchar(40),
+	image_url_2 varchar(40),
+	PRIMARY KEY(sock_id)
+);
+
+CREATE TABLE IF NOT EXISTS tag (
+	tag_id INTEGER PRIMARY KEY AUTO_INCREMENT,
+	name varchar(20)
+);
+
+CREATE TABLE IF NOT EXISTS sock_tag (
+	sock_id varchar(40),
+	tag_id INTEGER,
+	FOREIGN KEY (sock_id)
+		REFERENCES sock(sock_id),
+	FOREIGN KEY(tag_id)
+		REFERENCES tag(tag_id)
+);
@@ -10,23 +10,20 @@ import (
 	"golang.org/x/exp/slog"
 )
 
-func generateClient(builder golang.ModuleBuilder, wrapped *gocode.ServiceInterface, outputPackage string, MinReqs int64, FailureRate float64, Interval string) error {
+func generateClient(builder golang.ModuleBuilder, wrapped *gocode.ServiceInterface, outputPackage string) error {
 	pkg, err := builder.CreatePackage(outputPackage)
 	if err != nil {
 		return err
 	}
 
 	client := clientArgs{
-		Package:     pkg,
-		Service:     wrapped,
-		Name:        wrapped.BaseName + "_CircuitBreakerClient",
-		MinReqs:     MinReqs,
-		FailureRate: FailureRate,
-		Interval:    Interval,
-		Imports:     gogen.NewImports(pkg.Name),
+		Package: pkg,
+		Service: wrapped,
+		Name:    wrapped.BaseName + "_CircuitBreakerClient",
+		Imports: gogen.NewImports(pkg.Name),
 	}
 
-	client.Imports.AddPackages("context", "time", "github.com/mercari/go-circuitbreaker")
+	client.Imports.AddPackages("context", "github.com/blueprint-uservices/blueprint/runtime/plugins/circuitbreaker")
 
 	slog.Info(fmt.Sprintf("Generating %v/%v", client.Package.PackageName, wrapped.BaseName+"CircuitBreakerClient"))
 	outputFile := filepath.Join(client.Package.Path, wrapped.BaseName+"_CircuitBreakerClient.go")
@@ -34,13 +31,10 @@ func generateClient(builder golang.ModuleBuilder, wrapped *gocode.ServiceInterfa
 }
 
 type clientArgs struct {
-	Package     golang.PackageInfo
-	Service     *gocode.ServiceInterface
-	Name        string
-	MinReqs     int64
-	FailureRate float64
-	Interval    string
-	Imports     *gogen.Imports
+	Package golang.PackageInfo
+	Service *gocode.ServiceInterface
+	Name    string
+	Imports *gogen.Imports
 }
 
 var clientTemplate = `// Blueprint: Auto-generated by CircuitBreaker Plugin
@@ -52,28 +46,24 @@ type {{.Name}} struct {
 	Client {{.Imports.NameOf .Service.UserType}}
 	MinReqs int64
 	FailureRate float64
-	cb *circuitbreaker.CircuitBreaker
+	cb *circuitbreaker.Breakers
 }
 
-func New_{{.Name}} (ctx context.Context, client {{.Imports.NameOf .Service.UserType}}) (*{{.Name}}, error) {
+func New_{{.Name}} (ctx context.Context, client {{.Imports.NameOf .Service.UserType}}, name string, min_reqs string, failure_rate string, interval string, open_duration string, half_open_probes string, per_method string) (*{{.Name}}, error) {
+	config, err := circuitbreaker.ParseConfig(min_reqs, failure_rate, interval, open_duration, half_open_probes)
+	if err != nil {
+		return nil, err
+	}
+
 	handler := &{{.Name}}{}
 	handler.Client = client
-	handler.MinReqs = {{.MinReqs}}
-	handler.FailureRate = {{.FailureRate}}
-
-	dur, err := time.ParseDuration("{{.Interval}}")
+	handler.MinReqs = config.MinRequests
+	handler.FailureRate = config.FailureRate
+	handler.cb, err = circuitbreaker.NewBreakers(ctx, name, config, per_method == "true")
 	if err != nil {
 		return nil, err
 	}
 
-	cb := circuitbreaker.New(
-		circuitbreaker.WithFailOnContextCancel(true),
-		circuitbreaker.WithFailOnContextDeadline(true),
-		circuitbreaker.WithCounterResetInterval(dur),
-		circuitbreaker.WithTripFunc(circuitbreaker.NewTripFuncFailureRate(handler.MinReqs,handler.FailureRate)),
-	)
-	handler.cb = cb
-
 	return handler, nil
 }
 
@@ -81,11 +71,11 @@ func New_{{.Name}} (ctx context.Context, client {{.Imports.NameOf .Service.UserT
 {{$receiver := .Name -}}
 {{ range $_, $f := .Service.Methods }}
 func (client *{{$receiver}}) {{$f.Name -}} ({{ArgVarsAndTypes $f "ctx context.Context"}}) ({{RetVarsAndTypes $f "err error"}}) {
-	if !client.cb.Ready() {
-		err = circuitbreaker.ErrOpen
+	done, err := client.cb.Allow("{{$f.Name}}")
+	if err != nil {
 		return
 	}
-	defer func() { err = client.cb.Done(ctx, err)}()
+	defer func() { done(err) }()
 	return client.Client.{{$f.Name}}({{ArgVars $f "ctx"}})
 }
 {{end}}
@@ -3,6 +3,8 @@ package circuitbreaker
 import (
 	"fmt"
 	"reflect"
+	"strconv"
+	"time"
 
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/blueprint"
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/service"
@@ -24,6 +26,8 @@ type CircuitBreakerClient struct {
 	Min_Reqs      int64
 	FailureRate   float64
 	Interval      string
+	Options       Options
+	Args          []ir.IRNode // The breaker's name, used to label its metrics, followed by its Options as strings
 }
 
 func (node *CircuitBreakerClient) ImplementsGolangNode() {}
@@ -36,19 +40,40 @@ func (node *CircuitBreakerClient) String() string {
 	return node.Name() + " = CircuitBreaker(" + node.Wrapped.Name() + ")"
 }
 
-func newCircuitBreakerClient(name string, server ir.IRNode, min_reqs int64, failure_rate float64, interval string) (*CircuitBreakerClient, error) {
+func newCircuitBreakerClient(name string, server ir.IRNode, options Options) (*CircuitBreakerClient, error) {
 	serverNode, is_callable := server.(golang.Service)
 	if !is_callable {
 		return nil, blueprint.Errorf("circuitbreaker client wrapper requires %s to be a golang service but got %s", server.Name(), reflect.TypeOf(server).String())
 	}
+	if _, err := time.ParseDuration(options.Interval); err != nil {
+		return nil, blueprint.Errorf("circuitbreaker %s has invalid interval %s: %s", name, options.Interval, err.Error())
+	}
+	if options.OpenDuration == "" {
+		options.OpenDuration = options.Interval
+	} else if _, err := time.ParseDuration(options.OpenDuration); err != nil {
+		return nil, blueprint.Errorf("circuitbreaker %s has invalid open duration %s: %s", name, options.OpenDuration, err.Error())
+	}
+	if options.HalfOpenProbes <= 0 {
+		options.HalfOpenProbes = 1
+	}
 
 	node := &CircuitBreakerClient{}
 	node.InstanceName = name
 	node.Wrapped = serverNode
 	node.outputPackage = "cb"
-	node.Min_Reqs = min_reqs
-	node.FailureRate = failure_rate
-	node.Interval = interval
+	node.Min_Reqs = options.MinReqs
+	node.FailureRate = options.FailureRate
+	node.Interval = options.Interval
+	node.Options = options
+	node.Args = []ir.IRNode{
+		&ir.IRValue{Value: name},
+		&ir.IRValue{Value: strconv.FormatInt(options.MinReqs, 10)},
+		&ir.IRValue{Value: strconv.FormatFloat(options.FailureRate, 'g', -1, 64)},
+		&ir.IRValue{Value: options.Interval},
+		&ir.IRValue{Value: options.OpenDuration},
+		&ir.IRValue{Value: strconv.FormatInt(options.HalfOpenProbes, 10)},
+		&ir.IRValue{Value: strconv.FormatBool(options.PerMethod)},
+	}
 
 	return node, nil
 }
@@ -71,7 +96,7 @@ func (node *CircuitBreakerClient) GenerateFuncs(builder golang.ModuleBuilder) er
 		return err
 	}
 
-	return generateClient(builder, iface, node.outputPackage, node.Min_Reqs, node.FailureRate, node.Interval)
+	return generateClient(builder, iface, node.outputPackage)
 }
 
 func (node *CircuitBreakerClient) AddInstantiation(builder golang.NamespaceBuilder) error {
@@ -91,9 +116,16 @@ func (node *CircuitBreakerClient) AddInstantiation(builder golang.NamespaceBuild
 			Arguments: []gocode.Variable{
 				{Name: "ctx", Type: &gocode.UserType{Package: "context", Name: "Context"}},
 				{Name: "client", Type: iface},
+				{Name: "name", Type: &gocode.BasicType{Name: "string"}},
+				{Name: "min_reqs", Type: &gocode.BasicType{Name: "string"}},
+				{Name: "failure_rate", Type: &gocode.BasicType{Name: "string"}},
+				{Name: "interval", Type: &gocode.BasicType{Name: "string"}},
+				{Name: "open_duration", Type: &gocode.BasicType{Name: "string"}},
+				{Name: "half_open_probes", Type: &gocode.BasicType{Name: "string"}},
+				{Name: "per_method", Type: &gocode.BasicType{Name: "string"}},
 			},
 		},
 	}
 
-	return builder.DeclareConstructor(node.InstanceName, constructor, []ir.IRNode{node.Wrapped})
+	return builder.DeclareConstructor(node.InstanceName, constructor, append([]ir.IRNode{node.Wrapped}, node.Args...))
 }
@@ -1,6 +1,35 @@
 // Package circuitbreaker provides a Blueprint modifier for the client side of service calls.
 //
-// The plugin wraps clients with a circuitbreaker that blocks any new requests from being sent out over a connection if the failure rate exceeds a provided number in a fixed duration. The block is removed after the completion of the fixed duration interval.
+// The plugin wraps clients with a circuit breaker that rejects calls to a service while the service is failing,
+// instead of sending them.  [AddCircuitBreaker] adds a breaker with the basic settings, and
+// [AddCircuitBreakerWithOptions] configures all of the breaker's [Options].
+//
+// A circuit breaker is in one of three states:
+//   - closed: calls are sent to the service, and their outcomes are counted over a fixed Interval, after which
+//     the counters are reset.  Once at least MinReqs calls have been made in an interval and at least FailureRate
+//     of them have failed, the breaker opens.
+//   - open: calls fail immediately with the runtime's ErrOpen error, without being sent.  After OpenDuration,
+//     the breaker becomes half-open.
+//   - half-open: up to HalfOpenProbes calls are sent to the service as probes, and other calls fail with ErrOpen.
+//     If every probe succeeds, the breaker closes; if any probe fails, it opens again for another OpenDuration.
+//
+// A call fails if it returns an error, including transport errors such as timeouts.  By default, all methods of
+// a service share one breaker; with PerMethod, each method has its own breaker, so that a failing method does not
+// block calls to the others.
+//
+// The breakers of a client emit OpenTelemetry metrics using the meter returned by [backend.Meter] for the client's
+// name, e.g. "serviceA.client.cb":
+//   - circuitbreaker.transitions counts state transitions, with the attributes client, method, from and to
+//   - circuitbreaker.state reports the state of each breaker, with the attributes client and method, as 0
+//     (closed), 1 (half-open) or 2 (open)
+//
+// The method of a breaker shared by all methods is "*".  If the application has no metric collector, the
+// breakers still work, but do not emit metrics.
+//
+// The generated client uses the code in the [runtime/plugins/circuitbreaker] package.
+//
+// [backend.Meter]: https://github.com/Blueprint-uServices/blueprint/tree/main/runtime/core/backend
+// [runtime/plugins/circuitbreaker]: https://github.com/Blueprint-uServices/blueprint/tree/main/runtime/plugins/circuitbreaker
 package circuitbreaker
 
 import (
@@ -20,6 +49,45 @@ import (
 //
 //	AddCircuitBreaker(spec, "serviceA", 1000, 0.1, "1s")
 func AddCircuitBreaker(spec wiring.WiringSpec, serviceName string, min_reqs int64, failure_rate float64, interval string) {
+	AddCircuitBreakerWithOptions(spec, serviceName, Options{MinReqs: min_reqs, FailureRate: failure_rate, Interval: interval})
+}
+
+// Configures the circuit breakers added by [AddCircuitBreakerWithOptions]
+type Options struct {
+	// Minimum number of requests within an interval for the circuit to break
+	MinReqs int64
+
+	// Fraction of failed requests within an interval, between 0 and 1, at which the circuit breaks
+	FailureRate float64
+
+	// Duration after which the counters of a closed circuit breaker are reset, e.g. "1s"
+	Interval string
+
+	// How long a broken circuit stays open before probing, e.g. "5s".  Defaults to Interval.
+	OpenDuration string
+
+	// Number of probe requests that must succeed for a half-open circuit to close.  Defaults to 1.
+	HalfOpenProbes int64
+
+	// If true, each method of the service has its own circuit breaker.  Otherwise, all methods share a breaker.
+	PerMethod bool
+}
+
+// Adds circuit breaker functionality to all clients of the specified service.
+// Uses a [blueprint.WiringSpec].
+// Like [AddCircuitBreaker], but additionally configures the open duration, the number of half-open probes,
+// and whether each method has its own breaker.
+// Usage:
+//
+//	AddCircuitBreakerWithOptions(spec, "serviceA", circuitbreaker.Options{
+//		MinReqs:        100,
+//		FailureRate:    0.1,
+//		Interval:       "1s",
+//		OpenDuration:   "5s",
+//		HalfOpenProbes: 3,
+//		PerMethod:      true,
+//	})
+func AddCircuitBreakerWithOptions(spec wiring.WiringSpec, serviceName string, options Options) {
 	clientWrapper := serviceName + ".client.cb"
 
 	ptr := pointer.GetPointer(spec, serviceName)
@@ -30,13 +98,13 @@ func AddCircuitBreaker(spec wiring.WiringSpec, serviceName string, min_reqs int6
 
 	clientNext := ptr.AddSrcModifier(spec, clientWrapper)
 
-	spec.Define(clientWrapper, &CircuitBreakerClient{Min_Reqs: min_reqs, FailureRate: failure_rate}, func(ns wiring.Namespace) (ir.IRNode, error) {
+	spec.Define(clientWrapper, &CircuitBreakerClient{Min_Reqs: options.MinReqs, FailureRate: options.FailureRate}, func(ns wiring.Namespace) (ir.IRNode, error) {
 		var wrapped golang.Service
 
 		if err := ns.Get(clientNext, &wrapped); err != nil {
 			return nil, blueprint.Errorf("CircuitBreaker %s expected %s to be a golang.Service, but encountered %s", clientWrapper, clientNext, err)
 		}
 
-		return newCircuitBreakerClient(clientWrapper, wrapped, min_reqs, failure_rate, interval)
+		return newCircuitBreakerClient(clientWrapper, wrapped, options)
 	})
 }
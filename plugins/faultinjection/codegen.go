@@ -0,0 +1,73 @@
+package faultinjection
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/blueprint-uservices/blueprint/plugins/golang"
+	"github.com/blueprint-uservices/blueprint/plugins/golang/gocode"
+	"github.com/blueprint-uservices/blueprint/plugins/golang/gogen"
+	"golang.org/x/exp/slog"
+)
+
+// code generation function called from the ir.go file.
+func generateServerWrapper(builder golang.ModuleBuilder, wrapped *gocode.ServiceInterface, outputPackage string) error {
+	pkg, err := builder.CreatePackage(outputPackage)
+	if err != nil {
+		return err
+	}
+
+	server := serverArgs{
+		Package: pkg,
+		Service: wrapped,
+		Name:    wrapped.BaseName + "_FaultInjector",
+		Imports: gogen.NewImports(pkg.Name),
+	}
+
+	server.Imports.AddPackages("context", "github.com/blueprint-uservices/blueprint/runtime/plugins/faultinjection")
+	slog.Info(fmt.Sprintf("Generating %v/%v", server.Package.PackageName, wrapped.BaseName+"_FaultInjector"))
+	outputFile := filepath.Join(server.Package.Path, wrapped.BaseName+"_FaultInjector.go")
+
+	return gogen.ExecuteTemplateToFile("FaultInjector", serverTemplate, server, outputFile)
+}
+
+type serverArgs struct {
+	Package golang.PackageInfo
+	Service *gocode.ServiceInterface
+	Name    string
+	Imports *gogen.Imports
+}
+
+var serverTemplate = `// Blueprint: Auto-generated by FaultInjector Plugin
+package {{.Package.ShortName}}
+
+{{.Imports}}
+
+type {{.Name}} struct {
+	Server {{.Imports.NameOf .Service.UserType}}
+	Injector *faultinjection.Injector
+}
+
+func New_{{.Name}} (ctx context.Context, server {{.Imports.NameOf .Service.UserType}}, name string, faults string, adminAddr string) (*{{.Name}}, error) {
+	handler := &{{.Name}}{}
+	handler.Server = server
+	injector, err := faultinjection.NewInjector(name, faults)
+	if err != nil {
+		return nil, err
+	}
+	handler.Injector = injector
+	faultinjection.ServeAdmin(adminAddr)
+	return handler, nil
+}
+
+{{$service := .Service.Name -}}
+{{$receiver := .Name -}}
+{{ range $_, $f := .Service.Methods }}
+func (server *{{$receiver}}) {{$f.Name -}} ({{ArgVarsAndTypes $f "ctx context.Context"}}) ({{RetVarsAndTypes $f "err error"}}) {
+	if err = server.Injector.Inject(ctx, "{{$f.Name}}"); err != nil {
+		return
+	}
+	return server.Server.{{$f.Name}}({{ArgVars $f "ctx"}})
+}
+{{end}}
+`
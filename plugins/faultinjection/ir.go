@@ -0,0 +1,186 @@
+package faultinjection
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/blueprint"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/address"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/service"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/ir"
+	"github.com/blueprint-uservices/blueprint/plugins/golang"
+	"github.com/blueprint-uservices/blueprint/plugins/golang/gocode"
+)
+
+// Blueprint IR Node representing a server side fault injector
+type FaultInjectorWrapper struct {
+	golang.Service
+	golang.GeneratesFuncs
+	golang.Instantiable
+
+	InstanceName  string
+	Wrapped       golang.Service
+	outputPackage string
+	Faults        []Fault
+	NameValue     *ir.IRValue
+	FaultsValue   *ir.IRValue
+	FaultsConfig  *FaultsConfig       // Not a constructor argument; the runtime reads it from the environment
+	AdminBind     *address.BindConfig // The address of the admin endpoint
+}
+
+// Blueprint IR config node that, when set, overrides the compiled faults of an injector.
+//
+// The config is optional, so deployers pass it through from the calling environment if it is set there.
+// Its name is the injector's name, so the environment variable is the one read by the runtime injector,
+// e.g. MY_SERVICE_SERVER_FAULTS.
+type FaultsConfig struct {
+	Key string
+}
+
+func newFaultInjectorWrapper(name string, injectorName string, server ir.IRNode, faults []Fault) (*FaultInjectorWrapper, error) {
+	serverNode, is_callable := server.(golang.Service)
+	if !is_callable {
+		return nil, blueprint.Errorf("fault injector wrapper requires %s to be a golang service but got %s", server.Name(), reflect.TypeOf(server).String())
+	}
+
+	var specs []string
+	for _, fault := range faults {
+		if err := fault.validate(); err != nil {
+			return nil, blueprint.Errorf("invalid fault for %s: %s", name, err.Error())
+		}
+		specs = append(specs, fault.String())
+	}
+
+	node := &FaultInjectorWrapper{}
+	node.InstanceName = name
+	node.Wrapped = serverNode
+	node.outputPackage = "faultinjector"
+	node.Faults = faults
+	node.NameValue = &ir.IRValue{Value: injectorName}
+	node.FaultsValue = &ir.IRValue{Value: strings.Join(specs, ",")}
+	return node, nil
+}
+
+func (fault Fault) validate() error {
+	if fault.Method == "" || strings.ContainsAny(fault.Method, ":,") {
+		return fmt.Errorf("invalid method name %q", fault.Method)
+	}
+	switch fault.Kind {
+	case "error", "hang", "panic", "crash":
+	default:
+		return fmt.Errorf("unknown fault kind %q", fault.Kind)
+	}
+	if fault.Probability < 0 || fault.Probability > 1 {
+		return fmt.Errorf("probability of %v must be between 0 and 1", fault.Probability)
+	}
+	return nil
+}
+
+// Returns the fault in the method:kind:probability form expected by the runtime
+func (fault Fault) String() string {
+	return fault.Method + ":" + fault.Kind + ":" + strconv.FormatFloat(fault.Probability, 'g', -1, 64)
+}
+
+// Implements [ir.IRNode]
+func (conf *FaultsConfig) Name() string {
+	return conf.Key
+}
+
+// Implements [ir.IRNode]
+func (conf *FaultsConfig) String() string {
+	return conf.Key + " = FaultsConfig()"
+}
+
+// Implements [ir.IRConfig]
+func (conf *FaultsConfig) Optional() bool {
+	return true
+}
+
+// Implements [ir.IRConfig]
+func (conf *FaultsConfig) HasValue() bool {
+	return false
+}
+
+// Implements [ir.IRConfig]
+func (conf *FaultsConfig) Value() string {
+	return ""
+}
+
+// Implements [ir.IRConfig]
+func (conf *FaultsConfig) ImplementsIRConfig() {}
+
+// Implements [ir.IRNode]
+func (node *FaultInjectorWrapper) ImplementsGolangNode() {}
+
+// Implements [golang.Service]
+func (node *FaultInjectorWrapper) ImplementsGolangService() {}
+
+// Implements [ir.IRNode]
+func (node *FaultInjectorWrapper) Name() string {
+	return node.InstanceName
+}
+
+// Implements [ir.IRNode]
+func (node *FaultInjectorWrapper) String() string {
+	return node.Name() + " = FaultInjector(" + node.Wrapped.Name() + ", " + node.FaultsValue.String() + ", " + node.FaultsConfig.Name() + ", " + node.AdminBind.Name() + ")"
+}
+
+// Implements [golang.Service]
+func (node *FaultInjectorWrapper) AddInterfaces(builder golang.ModuleBuilder) error {
+	return node.Wrapped.AddInterfaces(builder)
+}
+
+// Implements [golang.Service]
+func (node *FaultInjectorWrapper) GetInterface(ctx ir.BuildContext) (service.ServiceInterface, error) {
+	return node.Wrapped.GetInterface(ctx)
+}
+
+// Implements [golang.GeneratesFuncs]
+func (node *FaultInjectorWrapper) GenerateFuncs(builder golang.ModuleBuilder) error {
+	if builder.Visited(node.InstanceName + ".generateFuncs") {
+		return nil
+	}
+
+	iface, err := golang.GetGoInterface(builder, node)
+	if err != nil {
+		return err
+	}
+
+	for _, fault := range node.Faults {
+		if _, exists := iface.Methods[fault.Method]; !exists && fault.Method != "*" {
+			return blueprint.Errorf("fault injector %s targets method %s, which %s does not have", node.InstanceName, fault.Method, iface.Name)
+		}
+	}
+
+	return generateServerWrapper(builder, iface, node.outputPackage)
+}
+
+// Implements golang.Instantiable
+func (node *FaultInjectorWrapper) AddInstantiation(builder golang.NamespaceBuilder) error {
+	if builder.Visited(node.InstanceName) {
+		return nil
+	}
+
+	iface, err := golang.GetGoInterface(builder, node.Wrapped)
+	if err != nil {
+		return err
+	}
+
+	constructor := &gocode.Constructor{
+		Package: builder.Module().Info().Name + "/" + node.outputPackage,
+		Func: gocode.Func{
+			Name: fmt.Sprintf("New_%v_FaultInjector", iface.BaseName),
+			Arguments: []gocode.Variable{
+				{Name: "ctx", Type: &gocode.UserType{Package: "context", Name: "Context"}},
+				{Name: "server", Type: iface},
+				{Name: "name", Type: &gocode.BasicType{Name: "string"}},
+				{Name: "faults", Type: &gocode.BasicType{Name: "string"}},
+				{Name: "admin_addr", Type: &gocode.BasicType{Name: "string"}},
+			},
+		},
+	}
+
+	return builder.DeclareConstructor(node.InstanceName, constructor, []ir.IRNode{node.Wrapped, node.NameValue, node.FaultsValue, node.AdminBind})
+}
@@ -0,0 +1,104 @@
+// Package faultinjection provides a Blueprint modifier for the server side of service calls.
+//
+// The plugin wraps the server side of a service so that, per method and with a configurable probability,
+// calls fail with a synthetic error, hang until the caller's context is done, panic, or terminate the process.
+//
+// # Wiring Spec Usage
+//
+//	faultinjection.Add(spec, "my_service",
+//		faultinjection.Fault{Method: "ReadPost", Kind: "error", Probability: 0.1},
+//		faultinjection.Fault{Method: "*", Kind: "hang", Probability: 0.01},
+//	)
+//
+// The method "*" matches every method of the service.  Valid kinds are "error", "hang", "panic" and "crash".
+//
+// # Runtime Control
+//
+// Faults can be toggled or replaced at runtime, without recompiling, in two ways:
+//
+//   - The optional config variable my_service.server.faults, i.e. the environment variable
+//     MY_SERVICE_SERVER_FAULTS, is read when the service starts.  "off" disables the faults, and a spec
+//     such as "ReadPost:error:0.5,*:crash:0.001" replaces them.  Deployers such as docker-compose pass
+//     it through from the calling environment.
+//
+//   - The process serves an HTTP admin endpoint on the bind address my_service.server.faults.admin_addr,
+//     which is assigned a port and exposed like any other server address.  For example:
+//
+//     curl -X POST -d off localhost:9100/faults/my_service.server.faults
+//
+// # Artifacts Generated
+//
+// During compilation, the plugin generates a server-side wrapper class.  The plugin also utilizes
+// some code in the [runtime/plugins/faultinjection] package.
+//
+// [runtime/plugins/faultinjection]: https://github.com/Blueprint-uServices/blueprint/tree/main/runtime/plugins/faultinjection
+package faultinjection
+
+import (
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/blueprint"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/address"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/pointer"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/ir"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/wiring"
+	"github.com/blueprint-uservices/blueprint/plugins/golang"
+	"golang.org/x/exp/slog"
+)
+
+// A Fault to inject into calls to a method of a service
+type Fault struct {
+	// The name of the method, or "*" for all methods
+	Method string
+
+	// One of "error", "hang", "panic" or "crash"
+	Kind string
+
+	// The probability, between 0 and 1, that a call to Method is subjected to the fault
+	Probability float64
+}
+
+// Adds fault injection on the server side of the specified service.
+// Uses a [blueprint.WiringSpec].
+// Modifies the given service such that calls are subjected to the provided `faults`.  For each call, faults are
+// considered in order and at most one fault is injected.
+// Usage:
+//
+//	Add(spec, "my_service", faultinjection.Fault{Method: "ReadPost", Kind: "error", Probability: 0.1})
+func Add(spec wiring.WiringSpec, serviceName string, faults ...Fault) {
+	serverWrapper := serviceName + ".server.faultinjector"
+	injectorName := serviceName + ".server.faults"
+	adminAddr := injectorName + ".admin_addr"
+	ptr := pointer.GetPointer(spec, serviceName)
+	if ptr == nil {
+		slog.Error("Unable to add fault injection to " + serviceName + " as it is not a pointer")
+		return
+	}
+
+	serverNext := ptr.AddDstModifier(spec, serverWrapper)
+
+	// The config that overrides the faults at runtime; it is named after the injector
+	spec.Define(injectorName, &ir.ApplicationNode{}, func(ns wiring.Namespace) (ir.IRNode, error) {
+		return &FaultsConfig{Key: injectorName}, nil
+	})
+
+	address.Define[*FaultInjectorWrapper](spec, adminAddr, serverWrapper)
+
+	spec.Define(serverWrapper, &FaultInjectorWrapper{}, func(ns wiring.Namespace) (ir.IRNode, error) {
+		var wrapped golang.Service
+
+		if err := ns.Get(serverNext, &wrapped); err != nil {
+			return nil, blueprint.Errorf("FaultInjector %s expected %s to be a golang.Service, but encountered %s", serverWrapper, serverNext, err)
+		}
+
+		node, err := newFaultInjectorWrapper(serverWrapper, injectorName, wrapped, faults)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := ns.Get(injectorName, &node.FaultsConfig); err != nil {
+			return nil, err
+		}
+
+		err = address.Bind[*FaultInjectorWrapper](ns, adminAddr, node, &node.AdminBind)
+		return node, err
+	})
+}
@@ -106,6 +106,18 @@ type (
 		AddInstantiation(NamespaceBuilder) error
 	}
 
+	// An [Instantiable] node should implement Migratable if instantiating it applies schema migrations to a
+	// database, e.g. a relational database client that is configured with migrations.  A process that is
+	// started with the --migrate flag instantiates only the nodes that apply migrations, so that no servers
+	// are started.
+	Migratable interface {
+		Node
+		Instantiable
+
+		// Reports whether instantiating the node applies schema migrations
+		AppliesMigrations() bool
+	}
+
 	// A [Node] should implement ProvidesInterface if it wants to modify or extend any service interfaces,
 	// particularly those that are defined by other nodes.  For example, a tracing plugin might extend all methods
 	// of an interface to add trace contexts.
@@ -93,9 +93,13 @@ func (node *Process) GenerateArtifacts(workspaceDir string) error {
 		}
 	}
 
-	// Require the arg nodes
+	// Require the arg nodes, except for optional config
 	for _, node := range node.Edges {
-		namespaceBuilder.RequiredArg(node.Name(), fmt.Sprintf("Argument generated by Blueprint IR: %v", node))
+		if conf, isConfig := node.(ir.IRConfig); isConfig && conf.Optional() {
+			namespaceBuilder.OptionalArg(node.Name(), fmt.Sprintf("Argument generated by Blueprint IR: %v", node))
+		} else {
+			namespaceBuilder.RequiredArg(node.Name(), fmt.Sprintf("Argument generated by Blueprint IR: %v", node))
+		}
 	}
 
 	// For now, instantiate all contained nodes
@@ -44,6 +44,13 @@ func GenerateMain(
 		mainArgs.Instantiate = append(mainArgs.Instantiate, node.Name())
 	}
 
+	// When migrating, only instantiate the nodes that apply migrations
+	for _, node := range ir.Filter[golang.Migratable](nodesToInstantiate) {
+		if node.AppliesMigrations() {
+			mainArgs.Migrate = append(mainArgs.Migrate, node.Name())
+		}
+	}
+
 	// Materialize any configuration
 	for _, node := range ir.Filter[ir.IRConfig](nodesToInstantiate) {
 		if !node.HasValue() {
@@ -69,6 +76,7 @@ type mainTemplateArgs struct {
 	Args                 []mainArg
 	Config               map[string]string
 	Instantiate          []string
+	Migrate              []string // Nodes that apply migrations
 }
 
 var mainTemplate = `// {{.Name}} runs the {{.Name}} Golang process.
@@ -87,6 +95,12 @@ var mainTemplate = `// {{.Name}} runs the {{.Name}} Golang process.
 //       {{$arg.Doc}}
 {{- end }}
 //
+{{- if .Migrate}}
+// To run a database migration command instead of serving requests, also pass:
+//
+//   --migrate=up|down|down:<steps>|status
+//
+{{- end}}
 // {{.Name}} will instantiate the following IR nodes:
 {{- range $_, $name := .Instantiate }}
 //   {{$name}}
@@ -95,18 +109,40 @@ package main
 
 import (
 	"context"
+{{- if .Migrate}}
+	"flag"
+{{- end}}
 	"os"
 
-	"golang.org/x/exp/slog"
+{{if .Migrate}}	"github.com/blueprint-uservices/blueprint/runtime/core/migrate"
+{{end}}	"golang.org/x/exp/slog"
 )
-
+{{if .Migrate}}
+var migrateCommand = flag.String("migrate", "", "runs a migration command on the process's databases instead of serving requests, and then exits: up, down, down:<steps>, or status")
+{{end}}
 func main() {
 	slog.Info("Running {{.Name}}")
-	n, err := {{.NamespaceConstructor}}("{{.Name}}").Build(context.Background())
+	b := {{.NamespaceConstructor}}("{{.Name}}")
+{{- if .Migrate}}
+	flag.Parse()
+	if *migrateCommand != "" {
+		// Only the databases are instantiated, and they run the migration command when they are created
+		migrate.SetCommand(*migrateCommand)
+		b.InstantiateOnly({{range $i, $name := .Migrate}}{{if $i}}, {{end}}"{{$name}}"{{end}})
+	}
+{{- end}}
+	n, err := b.Build(context.Background())
 	if err != nil {
 		slog.Error(err.Error())
 		os.Exit(1)
 	}
+{{- if .Migrate}}
+	if *migrateCommand != "" {
+		n.Shutdown(true)
+		slog.Info("{{.Name}} exiting")
+		return
+	}
+{{- end}}
 	n.Await()
 	slog.Info("{{.Name}} exiting")
 }`
@@ -28,6 +28,7 @@ func GenerateClient(builder golang.ModuleBuilder, service *gocode.ServiceInterfa
 		"context", "time",
 		"google.golang.org/grpc",
 		"google.golang.org/grpc/credentials/insecure",
+		"github.com/blueprint-uservices/blueprint/runtime/plugins/deadline",
 	)
 
 	slog.Info(fmt.Sprintf("Generating %v/%v.go", client.Package.PackageName, client.Name))
@@ -83,8 +84,9 @@ func (client *{{$receiver}}) {{SignatureWithRetVars $f}} {
 	req := &{{$service}}_{{$f.Name}}_Request{}
 	req.marshall({{ArgVars $f}})
 
-	// Configure the client-side request timeout
-	ctx, cancel := context.WithTimeout(ctx, client.Timeout)
+	// Apply the client-side request timeout, or the caller's deadline if it is earlier.
+	// GRPC propagates the deadline to the server, which cancels its context when it expires.
+	ctx, cancel := deadline.WithTimeout(ctx, client.Timeout)
 	defer cancel()
 
 	// Make the remote call
@@ -0,0 +1,75 @@
+package hedging
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/blueprint-uservices/blueprint/plugins/golang"
+	"github.com/blueprint-uservices/blueprint/plugins/golang/gocode"
+	"github.com/blueprint-uservices/blueprint/plugins/golang/gogen"
+	"golang.org/x/exp/slog"
+)
+
+// code generation function called from the ir.go file.
+func generateClient(builder golang.ModuleBuilder, wrapped *gocode.ServiceInterface, outputPackage string) error {
+	pkg, err := builder.CreatePackage(outputPackage)
+	if err != nil {
+		return err
+	}
+
+	client := clientArgs{
+		Package: pkg,
+		Service: wrapped,
+		Name:    wrapped.BaseName + "_HedgingClient",
+		Imports: gogen.NewImports(pkg.Name),
+	}
+
+	client.Imports.AddPackages("context", "github.com/blueprint-uservices/blueprint/runtime/plugins/hedging")
+
+	slog.Info(fmt.Sprintf("Generating %v/%v", client.Package.PackageName, client.Name))
+	outputFile := filepath.Join(client.Package.Path, client.Name+".go")
+	return gogen.ExecuteTemplateToFile("Hedging", clientTemplate, client, outputFile)
+}
+
+type clientArgs struct {
+	Package golang.PackageInfo
+	Service *gocode.ServiceInterface
+	Name    string
+	Imports *gogen.Imports
+}
+
+// Each attempt stores its results in its own variables; only the winning attempt's commit func
+// copies them to the named return values.
+var clientTemplate = `// Blueprint: Auto-generated by Hedging Plugin
+package {{.Package.ShortName}}
+
+{{.Imports}}
+
+type {{.Name}} struct {
+	Client {{.Imports.NameOf .Service.UserType}}
+	hedgers *hedging.Hedgers
+}
+
+func New_{{.Name}} (ctx context.Context, client {{.Imports.NameOf .Service.UserType}}, delay string, percentile string) (*{{.Name}}, error) {
+	handler := &{{.Name}}{}
+	handler.Client = client
+	var err error
+	handler.hedgers, err = hedging.NewHedgers(delay, percentile)
+	if err != nil {
+		return nil, err
+	}
+	return handler, nil
+}
+
+{{$service := .Service.Name -}}
+{{$receiver := .Name -}}
+{{ range $_, $f := .Service.Methods }}
+func (client *{{$receiver}}) {{$f.Name -}} ({{ArgVarsAndTypes $f "ctx context.Context"}}) ({{RetVarsAndTypes $f "err error"}}) {
+	err = client.hedgers.Do(ctx, "{{$f.Name}}", func(ctx context.Context) (func(), error) {
+		{{range $i, $_ := $f.Returns}}hedged{{$i}}, {{end}}err := client.Client.{{$f.Name}}({{ArgVars $f "ctx"}})
+		return func() { {{- range $i, $_ := $f.Returns}} ret{{$i}} = hedged{{$i}}; {{- end}} }, err
+	})
+	return
+}
+{{end}}
+`
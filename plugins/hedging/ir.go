@@ -0,0 +1,112 @@
+package hedging
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/blueprint"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/service"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/ir"
+	"github.com/blueprint-uservices/blueprint/plugins/golang"
+	"github.com/blueprint-uservices/blueprint/plugins/golang/gocode"
+)
+
+// Blueprint IR node representing a client that hedges calls
+type HedgingClient struct {
+	golang.Service
+	golang.GeneratesFuncs
+	golang.Instantiable
+
+	InstanceName string
+	Wrapped      golang.Service
+
+	outputPackage string
+	Delay         string
+	Percentile    float64
+	Args          []ir.IRNode // Delay and Percentile as strings, parsed by the runtime's NewHedgers
+}
+
+func (node *HedgingClient) ImplementsGolangNode() {}
+
+func (node *HedgingClient) Name() string {
+	return node.InstanceName
+}
+
+func (node *HedgingClient) String() string {
+	return node.Name() + " = Hedger(" + node.Wrapped.Name() + ")"
+}
+
+func newHedgingClient(name string, server ir.IRNode, delay string, percentile float64) (*HedgingClient, error) {
+	serverNode, is_callable := server.(golang.Service)
+	if !is_callable {
+		return nil, blueprint.Errorf("hedging client wrapper requires %s to be a golang service but got %s", server.Name(), reflect.TypeOf(server).String())
+	}
+	if _, err := time.ParseDuration(delay); err != nil {
+		return nil, blueprint.Errorf("invalid hedging delay for %s: %s", name, err.Error())
+	}
+	if percentile < 0 || percentile > 100 {
+		return nil, blueprint.Errorf("invalid hedging percentile %v for %s; expected a value between 0 and 100", percentile, name)
+	}
+
+	node := &HedgingClient{}
+	node.InstanceName = name
+	node.Wrapped = serverNode
+	node.outputPackage = "hedging"
+	node.Delay = delay
+	node.Percentile = percentile
+	node.Args = []ir.IRNode{
+		&ir.IRValue{Value: delay},
+		&ir.IRValue{Value: strconv.FormatFloat(percentile, 'g', -1, 64)},
+	}
+
+	return node, nil
+}
+
+func (node *HedgingClient) AddInterfaces(builder golang.ModuleBuilder) error {
+	return node.Wrapped.AddInterfaces(builder)
+}
+
+func (node *HedgingClient) GetInterface(ctx ir.BuildContext) (service.ServiceInterface, error) {
+	return node.Wrapped.GetInterface(ctx)
+}
+
+func (node *HedgingClient) GenerateFuncs(builder golang.ModuleBuilder) error {
+	if builder.Visited(node.InstanceName + ".generateFuncs") {
+		return nil
+	}
+
+	iface, err := golang.GetGoInterface(builder, node)
+	if err != nil {
+		return err
+	}
+
+	return generateClient(builder, iface, node.outputPackage)
+}
+
+func (node *HedgingClient) AddInstantiation(builder golang.NamespaceBuilder) error {
+	if builder.Visited(node.InstanceName) {
+		return nil
+	}
+
+	iface, err := golang.GetGoInterface(builder, node.Wrapped)
+	if err != nil {
+		return err
+	}
+
+	constructor := &gocode.Constructor{
+		Package: builder.Module().Info().Name + "/" + node.outputPackage,
+		Func: gocode.Func{
+			Name: fmt.Sprintf("New_%v_HedgingClient", iface.BaseName),
+			Arguments: []gocode.Variable{
+				{Name: "ctx", Type: &gocode.UserType{Package: "context", Name: "Context"}},
+				{Name: "client", Type: iface},
+				{Name: "delay", Type: &gocode.BasicType{Name: "string"}},
+				{Name: "percentile", Type: &gocode.BasicType{Name: "string"}},
+			},
+		},
+	}
+
+	return builder.DeclareConstructor(node.InstanceName, constructor, append([]ir.IRNode{node.Wrapped}, node.Args...))
+}
@@ -0,0 +1,72 @@
+// Package hedging provides a Blueprint modifier for the client side of service calls.
+//
+// The plugin wraps clients with a hedger.  If a call has not completed after the hedging delay,
+// the hedger sends a duplicate of the request, uses whichever response succeeds first, and cancels
+// the other request.  Hedging trades extra load on the service for lower tail latency, so it should
+// only be applied to services whose methods are idempotent.
+//
+// The hedging delay is either fixed, or a percentile of the latencies recently observed by the client.
+// Usage:
+//
+//	import "github.com/blueprint-uservices/blueprint/plugins/hedging"
+//	hedging.Add(spec, "my_service", "20ms") // Hedges calls that take longer than 20ms
+//	hedging.AddPercentile(spec, "my_service", 95, "20ms") // Hedges calls slower than the p95 latency
+//
+// The generated hedger uses the code in the [runtime/plugins/hedging] package.
+//
+// [runtime/plugins/hedging]: https://github.com/Blueprint-uServices/blueprint/tree/main/runtime/plugins/hedging
+package hedging
+
+import (
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/blueprint"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/pointer"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/ir"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/wiring"
+	"github.com/blueprint-uservices/blueprint/plugins/golang"
+	"golang.org/x/exp/slog"
+)
+
+// Add hedging to all clients of the specified service.
+// Uses a [blueprint.WiringSpec]
+// Modifies the given service such that all clients to that service send a duplicate request
+// for any call that has not completed after `delay`, e.g. "20ms".
+// Usage:
+//
+//	Add(spec, "my_service", "20ms")
+func Add(spec wiring.WiringSpec, serviceName string, delay string) {
+	addHedging(spec, serviceName, delay, 0)
+}
+
+// Add percentile-based hedging to all clients of the specified service.
+// Uses a [blueprint.WiringSpec]
+// Modifies the given service such that all clients to that service send a duplicate request
+// for any call that has taken longer than the `percentile` (between 0 and 100) of recently
+// observed latencies.  Until enough latencies have been observed, `initialDelay` is used.
+// Usage:
+//
+//	AddPercentile(spec, "my_service", 95, "20ms")
+func AddPercentile(spec wiring.WiringSpec, serviceName string, percentile float64, initialDelay string) {
+	addHedging(spec, serviceName, initialDelay, percentile)
+}
+
+func addHedging(spec wiring.WiringSpec, serviceName string, delay string, percentile float64) {
+	clientWrapper := serviceName + ".client.hedger"
+
+	ptr := pointer.GetPointer(spec, serviceName)
+	if ptr == nil {
+		slog.Error("Unable to add hedging to " + serviceName + " as it is not a pointer")
+		return
+	}
+
+	clientNext := ptr.AddSrcModifier(spec, clientWrapper)
+
+	spec.Define(clientWrapper, &HedgingClient{}, func(ns wiring.Namespace) (ir.IRNode, error) {
+		var wrapped golang.Service
+
+		if err := ns.Get(clientNext, &wrapped); err != nil {
+			return nil, blueprint.Errorf("Hedging %s expected %s to be a golang.Service, but encountered %s", clientWrapper, clientNext, err)
+		}
+
+		return newHedgingClient(clientWrapper, wrapped, delay, percentile)
+	})
+}
@@ -10,8 +10,13 @@ import (
 	"golang.org/x/exp/slog"
 )
 
-// This function is used by the HTTP plugin to generate the client-side HTTP service
-func GenerateClient(builder golang.ModuleBuilder, service *gocode.ServiceInterface, outputPackage string) error {
+// This function is used by the HTTP plugin to generate the client-side HTTP service.
+//
+// name is the prefix of the name of the generated client; each deployment of a service has its own client,
+// because deployments of the same service can have different routes.  routes optionally overrides the HTTP
+// method and path of some of the service's methods; it must be the same as the routes used to generate the
+// server.
+func GenerateClient(builder golang.ModuleBuilder, service *gocode.ServiceInterface, outputPackage string, name string, routes map[string]Route) error {
 	pkg, err := builder.CreatePackage(outputPackage)
 	if err != nil {
 		return err
@@ -20,13 +25,26 @@ func GenerateClient(builder golang.ModuleBuilder, service *gocode.ServiceInterfa
 	client := &clientArgs{
 		Package: pkg,
 		Service: service,
-		Name:    service.BaseName + "_HTTPClient",
+		Name:    name + "_HTTPClient",
 		Imports: gogen.NewImports(pkg.Name),
 	}
+	if client.Routes, err = resolveRoutes(service, routes); err != nil {
+		return err
+	}
 
 	client.Imports.AddPackages(
-		"net/http", "encoding/json", "context", "time", "net/url", "fmt", "io",
+		"net/http", "encoding/json", "context", "time", "net/url", "io",
+		"github.com/blueprint-uservices/blueprint/runtime/plugins/deadline",
+		"github.com/blueprint-uservices/blueprint/runtime/plugins/httperrors",
 	)
+	for _, route := range client.Routes {
+		if len(route.BodyArgs) > 0 {
+			client.Imports.AddPackages("bytes")
+		}
+		if len(route.PathArgs) > 0 {
+			client.Imports.AddPackages("strings")
+		}
+	}
 
 	slog.Info(fmt.Sprintf("Generating %v/%v.go", client.Package.PackageName, client.Name))
 	outputFile := filepath.Join(client.Package.Path, client.Name+".go")
@@ -38,6 +56,7 @@ type clientArgs struct {
 	Package golang.PackageInfo
 	Service *gocode.ServiceInterface
 	Name    string
+	Routes  map[string]*methodRoute
 	Imports *gogen.Imports
 }
 
@@ -52,16 +71,13 @@ type {{.Name}} struct {
 	ServerAddress string
 }
 
-func New_{{.Name}}(ctx context.Context, serverAddress string) (*{{.Name}}, error) {
-	duration, err := time.ParseDuration("1s")
+func New_{{.Name}}(ctx context.Context, serverAddress string, timeout string) (*{{.Name}}, error) {
+	duration, err := time.ParseDuration(timeout)
 	if err != nil {
 		return nil, err
 	}
-	client := &http.Client{
-		Timeout: duration,
-	}
 	c := &{{.Name}}{}
-	c.Client = client
+	c.Client = &http.Client{}
 	c.Timeout = duration
 	c.ServerAddress = "http://" + serverAddress
 	return c, nil
@@ -69,11 +85,31 @@ func New_{{.Name}}(ctx context.Context, serverAddress string) (*{{.Name}}, error
 
 {{$service := .Service.Name -}}
 {{$receiver := .Name -}}
+{{$routes := .Routes -}}
 {{- range $_, $f := .Service.Methods }}
+{{- $route := index $routes $f.Name}}
 func (client *{{$receiver}}) {{SignatureWithRetVars $f}} {
+	encoded_path := "{{$route.Path}}"
+	{{- range $_, $arg := $route.PathArgs}}
+	{{if $arg.IsString -}}
+	encoded_path = strings.ReplaceAll(encoded_path, "{{$arg.Placeholder}}", url.PathEscape({{$arg.Name}}))
+	{{- else -}}
+	bytes_{{$arg.Name}}, err := json.Marshal({{$arg.Name}})
+	if err != nil {
+		return
+	}
+	encoded_path = strings.ReplaceAll(encoded_path, "{{$arg.Placeholder}}", url.PathEscape(string(bytes_{{$arg.Name}})))
+	{{- end}}
+	{{- end}}
+
+	encoded_url, err := url.Parse(client.ServerAddress + encoded_path)
+	if err != nil {
+		return
+	}
+	{{- if $route.QueryArgs}}
 	vals := url.Values{}
-	{{range $_, $arg := $f.Arguments}}
-	{{if eq (NameOf $arg.Type) "string" -}}
+	{{- range $_, $arg := $route.QueryArgs}}
+	{{if $arg.IsString -}}
 	vals.Add("{{$arg.Name}}", {{$arg.Name}})
 	{{- else -}}
 	bytes_{{$arg.Name}}, err := json.Marshal({{$arg.Name}})
@@ -82,22 +118,48 @@ func (client *{{$receiver}}) {{SignatureWithRetVars $f}} {
 	}
 	vals.Add("{{$arg.Name}}", string(bytes_{{$arg.Name}}))
 	{{- end}}
-	{{end}}
+	{{- end}}
+	encoded_url.RawQuery = vals.Encode()
+	{{- end}}
 
-	encoded_url, err := url.Parse(client.ServerAddress + "/{{$f.Name}}")
+	var request_body io.Reader
+	{{- if $route.BodyArgs}}
+	request_args := struct {
+		{{- range $_, $arg := $route.BodyArgs}}
+		Arg{{$arg.Index}} {{NameOf $arg.Type}} {{JsonField $arg.Name}}
+		{{- end}}
+	}{
+		{{- range $_, $arg := $route.BodyArgs}}
+		Arg{{$arg.Index}}: {{$arg.Name}},
+		{{- end}}
+	}
+	request_bytes, err := json.Marshal(&request_args)
 	if err != nil {
 		return
 	}
-	encoded_url.RawQuery = vals.Encode()
+	request_body = bytes.NewReader(request_bytes)
+	{{- end}}
+
+	// The caller's deadline applies instead of the timeout if it is earlier
+	ctx, cancel_timeout := deadline.WithTimeout(ctx, client.Timeout)
+	defer cancel_timeout()
 
-	resp, err := client.Client.Get(encoded_url.String())
+	http_request, err := http.NewRequestWithContext(ctx, "{{$route.Method}}", encoded_url.String(), request_body)
+	if err != nil {
+		return
+	}
+	deadline.SetHeader(ctx, http_request.Header)
+	{{- if $route.BodyArgs}}
+	http_request.Header.Set("Content-Type", "application/json")
+	{{- end}}
+	resp, err := client.Client.Do(http_request)
 	if err != nil {
 		return
 	}
 	defer resp.Body.Close()
 	statusOk := resp.StatusCode >= 200 && resp.StatusCode < 300
 	if !statusOk {
-		err = fmt.Errorf("StatusCode was %d", resp.StatusCode)
+		err = httperrors.Read(resp)
 		return
 	}
 	response := struct {
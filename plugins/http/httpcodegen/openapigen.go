@@ -0,0 +1,427 @@
+package httpcodegen
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/blueprint"
+	"github.com/blueprint-uservices/blueprint/plugins/golang"
+	"github.com/blueprint-uservices/blueprint/plugins/golang/gocode"
+	"github.com/blueprint-uservices/blueprint/plugins/golang/goparser"
+	"github.com/blueprint-uservices/blueprint/plugins/workflow/workflowspec"
+	"golang.org/x/exp/slog"
+)
+
+/*
+This function is used by the HTTP plugin to generate an OpenAPI 3 document describing the HTTP server
+of a service.  The document is written to <name>_openapi.json in outputPackage, where name is the prefix
+used for the deployment's generated server.
+
+Request and response schemas are derived from the Go types of the service's arguments and return
+values.  Structs are added as named component schemas, following the JSON encoding of their fields.
+Types that cannot be described, such as interfaces, are described by the empty schema.
+*/
+func GenerateOpenAPI(builder golang.ModuleBuilder, service *gocode.ServiceInterface, outputPackage string, name string, routes map[string]Route) error {
+	outputFile := outputPackage + "/" + name + "_openapi.json"
+	if builder.Visited(outputFile) {
+		return nil
+	}
+
+	pkg, err := builder.CreatePackage(outputPackage)
+	if err != nil {
+		return err
+	}
+
+	resolved, err := resolveRoutes(service, routes)
+	if err != nil {
+		return err
+	}
+
+	// Parse the current output code to get definitions that may have been generated by other plugins
+	modules := workflowspec.Get().Derive().Modules
+	if err := modules.AddWorkspace(builder.Workspace().Info().Path); err != nil {
+		return err
+	}
+
+	b := &openAPIBuilder{
+		code:    modules,
+		schemas: make(map[string]any),
+		names:   make(map[gocode.UserType]string),
+		visited: make(map[gocode.UserType]bool),
+	}
+	doc, err := b.document(service, resolved)
+	if err != nil {
+		return err
+	}
+	docBytes, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return blueprint.Errorf("unable to encode OpenAPI document of %v due to %v", service.BaseName, err)
+	}
+
+	slog.Info(fmt.Sprintf("Generating %v/%v_openapi.json", pkg.PackageName, name))
+	outputFilePath := filepath.Join(pkg.Path, name+"_openapi.json")
+	if err := os.WriteFile(outputFilePath, append(docBytes, '\n'), 0644); err != nil {
+		return blueprint.Errorf("unable to write OpenAPI document %v due to %v", outputFilePath, err)
+	}
+	return nil
+}
+
+type schema = map[string]any
+
+type openAPIBuilder struct {
+	code    *goparser.ParsedModuleSet
+	schemas map[string]any             // Component schemas, keyed by name
+	names   map[gocode.UserType]string // Component schema names of struct types
+	visited map[gocode.UserType]bool   // Non-struct types currently being resolved, to break cycles
+}
+
+func (b *openAPIBuilder) document(service *gocode.ServiceInterface, routes map[string]*methodRoute) (schema, error) {
+	b.schemas["Error"] = schema{
+		"type": "object",
+		"properties": schema{
+			"status": schema{"type": "integer", "format": "int32"},
+			"error":  schema{"type": "string"},
+		},
+	}
+
+	// Sort methods for a deterministic document
+	var methodNames []string
+	for name := range service.Methods {
+		methodNames = append(methodNames, name)
+	}
+	sort.Strings(methodNames)
+
+	paths := make(map[string]schema)
+	for _, name := range methodNames {
+		op, err := b.operation(service.Methods[name], routes[name])
+		if err != nil {
+			return nil, err
+		}
+		route := routes[name]
+		if _, exists := paths[route.Path]; !exists {
+			paths[route.Path] = make(schema)
+		}
+		paths[route.Path][strings.ToLower(route.Method)] = op
+	}
+
+	return schema{
+		"openapi": "3.0.3",
+		"info": schema{
+			"title":   service.BaseName,
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": schema{
+			"schemas": b.schemas,
+			"parameters": schema{
+				"Timeout": schema{
+					"name":        "X-Blueprint-Timeout",
+					"in":          "header",
+					"description": "The time remaining until the deadline of the request, in nanoseconds",
+					"schema":      schema{"type": "integer", "format": "int64"},
+				},
+			},
+		},
+	}, nil
+}
+
+func (b *openAPIBuilder) operation(f gocode.Func, route *methodRoute) (schema, error) {
+	parameters := []any{schema{"$ref": "#/components/parameters/Timeout"}}
+	for _, arg := range route.PathArgs {
+		param, err := b.parameter(arg, "path")
+		if err != nil {
+			return nil, err
+		}
+		parameters = append(parameters, param)
+	}
+	for _, arg := range route.QueryArgs {
+		param, err := b.parameter(arg, "query")
+		if err != nil {
+			return nil, err
+		}
+		parameters = append(parameters, param)
+	}
+
+	op := schema{
+		"operationId": f.Name,
+		"parameters":  parameters,
+	}
+
+	if len(route.BodyArgs) > 0 {
+		properties := make(schema)
+		for _, arg := range route.BodyArgs {
+			s, err := b.schemaOf(arg.Type)
+			if err != nil {
+				return nil, err
+			}
+			properties[arg.Name] = s
+		}
+		op["requestBody"] = schema{
+			"content": schema{
+				"application/json": schema{
+					"schema": schema{"type": "object", "properties": properties},
+				},
+			},
+		}
+	}
+
+	// The server encodes return values as the fields Ret0, Ret1, etc. of a JSON object
+	properties := make(schema)
+	for i, ret := range f.Returns {
+		s, err := b.schemaOf(ret.Type)
+		if err != nil {
+			return nil, err
+		}
+		properties[fmt.Sprintf("Ret%d", i)] = s
+	}
+	op["responses"] = schema{
+		"200": schema{
+			"description": "The return values of " + f.Name,
+			"content": schema{
+				"application/json": schema{
+					"schema": schema{"type": "object", "properties": properties},
+				},
+			},
+		},
+		"default": schema{
+			"description": "An error returned by " + f.Name,
+			"content": schema{
+				"application/json": schema{
+					"schema": schema{"$ref": "#/components/schemas/Error"},
+				},
+			},
+		},
+	}
+	return op, nil
+}
+
+// Path and query arguments that are not strings are JSON-encoded by the client
+func (b *openAPIBuilder) parameter(arg routeArg, in string) (schema, error) {
+	s, err := b.schemaOf(arg.Type)
+	if err != nil {
+		return nil, err
+	}
+	param := schema{
+		"name":     arg.Name,
+		"in":       in,
+		"required": in == "path",
+	}
+	switch s["type"] {
+	case "string", "integer", "number", "boolean":
+		param["schema"] = s
+	default:
+		param["content"] = schema{"application/json": schema{"schema": s}}
+	}
+	return param, nil
+}
+
+var basicSchemas = map[string]schema{
+	"bool":    {"type": "boolean"},
+	"string":  {"type": "string"},
+	"int":     {"type": "integer", "format": "int64"},
+	"int8":    {"type": "integer", "format": "int32"},
+	"int16":   {"type": "integer", "format": "int32"},
+	"int32":   {"type": "integer", "format": "int32"},
+	"int64":   {"type": "integer", "format": "int64"},
+	"uint":    {"type": "integer", "format": "int64", "minimum": 0},
+	"uint8":   {"type": "integer", "format": "int32", "minimum": 0},
+	"uint16":  {"type": "integer", "format": "int32", "minimum": 0},
+	"uint32":  {"type": "integer", "format": "int64", "minimum": 0},
+	"uint64":  {"type": "integer", "format": "int64", "minimum": 0},
+	"byte":    {"type": "integer", "format": "int32", "minimum": 0},
+	"rune":    {"type": "integer", "format": "int32"},
+	"float32": {"type": "number", "format": "float"},
+	"float64": {"type": "number", "format": "double"},
+}
+
+// Types from outside the workspace that have a custom JSON encoding
+var knownSchemas = map[gocode.UserType]schema{
+	{Package: "time", Name: "Time"}:     {"type": "string", "format": "date-time"},
+	{Package: "time", Name: "Duration"}: {"type": "integer", "format": "int64"},
+}
+
+// Returns the JSON schema of the encoding/json encoding of t
+func (b *openAPIBuilder) schemaOf(t gocode.TypeName) (schema, error) {
+	switch arg := t.(type) {
+	case *gocode.BasicType:
+		if s, ok := basicSchemas[arg.Name]; ok {
+			return copySchema(s), nil
+		}
+		return schema{}, nil
+	case *gocode.UserType:
+		return b.userTypeSchema(*arg)
+	case *gocode.Pointer:
+		s, err := b.schemaOf(arg.PointerTo)
+		if err != nil {
+			return nil, err
+		}
+		if _, isRef := s["$ref"]; isRef {
+			return schema{"allOf": []any{s}, "nullable": true}, nil
+		}
+		if len(s) > 0 {
+			s["nullable"] = true
+		}
+		return s, nil
+	case *gocode.Slice:
+		if elem, isBasic := arg.SliceOf.(*gocode.BasicType); isBasic && (elem.Name == "byte" || elem.Name == "uint8") {
+			return schema{"type": "string", "format": "byte"}, nil
+		}
+		items, err := b.schemaOf(arg.SliceOf)
+		if err != nil {
+			return nil, err
+		}
+		return schema{"type": "array", "items": items}, nil
+	case *gocode.Ellipsis:
+		items, err := b.schemaOf(arg.EllipsisOf)
+		if err != nil {
+			return nil, err
+		}
+		return schema{"type": "array", "items": items}, nil
+	case *gocode.Map:
+		values, err := b.schemaOf(arg.ValueType)
+		if err != nil {
+			return nil, err
+		}
+		return schema{"type": "object", "additionalProperties": values}, nil
+	default:
+		// Interfaces, generics, funcs and chans have no fixed schema
+		return schema{}, nil
+	}
+}
+
+func (b *openAPIBuilder) userTypeSchema(t gocode.UserType) (schema, error) {
+	if s, ok := knownSchemas[t]; ok {
+		return copySchema(s), nil
+	}
+	if name, exists := b.names[t]; exists {
+		return schema{"$ref": "#/components/schemas/" + name}, nil
+	}
+
+	pkg, err := b.code.GetPackage(t.Package)
+	if err != nil {
+		// Types from packages that are not in the workspace are left undescribed
+		slog.Warn(fmt.Sprintf("OpenAPI schema of %v is unknown: %v", t.String(), err))
+		return schema{}, nil
+	}
+
+	if struc, isStruct := pkg.Structs[t.Name]; isStruct {
+		name := t.Name
+		if _, taken := b.schemas[name]; taken {
+			name = pkg.ShortName + "_" + t.Name
+		}
+		b.names[t] = name
+		b.schemas[name] = schema{} // placeholder in case the struct is recursive
+
+		properties := make(schema)
+		if err := b.addFields(properties, struc); err != nil {
+			return nil, err
+		}
+		b.schemas[name] = schema{"type": "object", "properties": properties}
+		return schema{"$ref": "#/components/schemas/" + name}, nil
+	}
+
+	// Other declared types, e.g. enums, are described by the type they are declared as
+	if b.visited[t] {
+		return schema{}, nil
+	}
+	b.visited[t] = true
+	defer delete(b.visited, t)
+	for _, file := range pkg.Files {
+		for _, decl := range file.Ast.Decls {
+			gendecl, isGenDecl := decl.(*ast.GenDecl)
+			if !isGenDecl {
+				continue
+			}
+			for _, spec := range gendecl.Specs {
+				if typespec, isTypeSpec := spec.(*ast.TypeSpec); isTypeSpec && typespec.Name.Name == t.Name {
+					return b.schemaOf(file.ResolveType(typespec.Type))
+				}
+			}
+		}
+	}
+	return schema{}, nil
+}
+
+// Adds the JSON-encoded fields of struc to properties.  Fields of embedded structs are promoted, as
+// they are by encoding/json.
+func (b *openAPIBuilder) addFields(properties schema, struc *goparser.ParsedStruct) error {
+	for _, field := range struc.FieldsList {
+		jsonName, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+
+		if _, isNamed := struc.Fields[field.Name]; !isNamed && jsonName == "" {
+			if embedded := b.embeddedStruct(field.Type); embedded != nil {
+				if err := b.addFields(properties, embedded); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if !ast.IsExported(field.Name) {
+			continue
+		}
+		if jsonName == "" {
+			jsonName = field.Name
+		}
+		s, err := b.schemaOf(field.Type)
+		if err != nil {
+			return err
+		}
+		properties[jsonName] = s
+	}
+	return nil
+}
+
+func (b *openAPIBuilder) embeddedStruct(t gocode.TypeName) *goparser.ParsedStruct {
+	if ptr, isPointer := t.(*gocode.Pointer); isPointer {
+		t = ptr.PointerTo
+	}
+	userType, isUserType := t.(*gocode.UserType)
+	if !isUserType {
+		return nil
+	}
+	struc, err := b.code.FindStruct(userType.Package, userType.Name)
+	if err != nil {
+		return nil
+	}
+	return struc
+}
+
+// Returns the name of field from its json struct tag, or the empty string if the tag has no name.
+// Returns skip if the field is not encoded.
+func jsonFieldName(field *goparser.ParsedField) (name string, skip bool) {
+	if field.Ast == nil || field.Ast.Tag == nil {
+		return "", false
+	}
+	tag, err := strconv.Unquote(field.Ast.Tag.Value)
+	if err != nil {
+		return "", false
+	}
+	jsonTag, hasTag := reflect.StructTag(tag).Lookup("json")
+	if !hasTag {
+		return "", false
+	}
+	if jsonTag == "-" {
+		return "", true
+	}
+	name, _, _ = strings.Cut(jsonTag, ",")
+	return name, false
+}
+
+func copySchema(s schema) schema {
+	c := make(schema, len(s))
+	for k, v := range s {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,86 @@
+package httpcodegen
+
+import (
+	"testing"
+
+	"github.com/blueprint-uservices/blueprint/plugins/golang/gocode"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	str := &gocode.BasicType{Name: "string"}
+	num := &gocode.BasicType{Name: "int64"}
+	service := &gocode.ServiceInterface{
+		UserType: gocode.UserType{Package: "example.com/posts", Name: "PostService"},
+		BaseName: "PostService",
+		Methods: map[string]gocode.Func{
+			"ReadPost": {
+				Name:      "ReadPost",
+				Arguments: []gocode.Variable{{Name: "postID", Type: str}, {Name: "version", Type: num}},
+				Returns:   []gocode.Variable{{Name: "text", Type: str}},
+			},
+			"CreatePost": {
+				Name:      "CreatePost",
+				Arguments: []gocode.Variable{{Name: "author", Type: str}, {Name: "text", Type: str}},
+				Returns:   []gocode.Variable{{Name: "postID", Type: str}},
+			},
+		},
+	}
+	routes, err := resolveRoutes(service, map[string]Route{
+		"ReadPost": {Method: "GET", Path: "/posts/{postID}"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &openAPIBuilder{
+		schemas: make(map[string]any),
+		names:   make(map[gocode.UserType]string),
+		visited: make(map[gocode.UserType]bool),
+	}
+	doc, err := b.document(service, routes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := doc["paths"].(map[string]schema)
+
+	// The GET route has a path parameter and a query parameter, and no request body
+	get, exists := paths["/posts/{postID}"]["get"].(schema)
+	if !exists {
+		t.Fatalf("expected GET /posts/{postID} in %v", paths)
+	}
+	params := make(map[string]schema)
+	for _, p := range get["parameters"].([]any) {
+		param := p.(schema)
+		if name, hasName := param["name"].(string); hasName {
+			params[name] = param
+		}
+	}
+	if params["postID"]["in"] != "path" || params["postID"]["required"] != true {
+		t.Errorf("expected postID to be a required path parameter, got %v", params["postID"])
+	}
+	if params["version"]["in"] != "query" || params["version"]["schema"].(schema)["type"] != "integer" {
+		t.Errorf("expected version to be an integer query parameter, got %v", params["version"])
+	}
+	if _, hasBody := get["requestBody"]; hasBody {
+		t.Errorf("expected GET route to have no request body")
+	}
+
+	// The POST route has its arguments in a JSON request body
+	post, exists := paths["/CreatePost"]["post"].(schema)
+	if !exists {
+		t.Fatalf("expected POST /CreatePost in %v", paths)
+	}
+	body, hasBody := post["requestBody"].(schema)
+	if !hasBody {
+		t.Fatalf("expected POST route to have a request body")
+	}
+	properties := body["content"].(schema)["application/json"].(schema)["schema"].(schema)["properties"].(schema)
+	for _, arg := range []string{"author", "text"} {
+		if property, _ := properties[arg].(schema); property["type"] != "string" {
+			t.Errorf("expected request body property %v to be a string, got %v", arg, properties[arg])
+		}
+	}
+	if len(post["parameters"].([]any)) != 1 {
+		t.Errorf("expected POST route to have only the deadline parameter, got %v", post["parameters"])
+	}
+}
@@ -0,0 +1,100 @@
+package httpcodegen
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/blueprint-uservices/blueprint/plugins/golang/gocode"
+)
+
+// Overrides the HTTP method and path that a service method is served on
+type Route struct {
+	// The HTTP method; one of GET, POST, PUT, PATCH or DELETE.  Defaults to POST.
+	Method string
+
+	// The path, e.g. "/posts/{postID}".  Defaults to "/" followed by the name of the service method.
+	// Path variables in braces are filled from the arguments of the same name.
+	Path string
+}
+
+// The resolved route of a service method, used by the client and server templates
+type methodRoute struct {
+	Method    string
+	Path      string
+	PathArgs  []routeArg // Arguments that are path variables
+	QueryArgs []routeArg // Arguments that are query parameters
+	BodyArgs  []routeArg // Arguments that are fields of the JSON request body
+}
+
+type routeArg struct {
+	gocode.Variable
+	Index       int
+	IsString    bool
+	Placeholder string
+}
+
+var pathVar = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// Methods whose arguments are sent in the request body; for other methods, arguments are sent as query parameters
+var bodyMethods = map[string]bool{"POST": true, "PUT": true, "PATCH": true}
+
+// Resolves the route of every method of service, applying any overrides
+func resolveRoutes(service *gocode.ServiceInterface, overrides map[string]Route) (map[string]*methodRoute, error) {
+	for name := range overrides {
+		if _, exists := service.Methods[name]; !exists {
+			return nil, fmt.Errorf("cannot override the HTTP route of %v.%v because the method does not exist", service.BaseName, name)
+		}
+	}
+
+	routes := make(map[string]*methodRoute)
+	seen := make(map[string]string)
+	for name, f := range service.Methods {
+		route := &methodRoute{Method: "POST", Path: "/" + name}
+		if override, exists := overrides[name]; exists {
+			if override.Method != "" {
+				route.Method = strings.ToUpper(override.Method)
+			}
+			if override.Path != "" {
+				route.Path = override.Path
+			}
+		}
+
+		switch route.Method {
+		case "GET", "POST", "PUT", "PATCH", "DELETE":
+		default:
+			return nil, fmt.Errorf("unsupported HTTP method %v for %v.%v", route.Method, service.BaseName, name)
+		}
+		if !strings.HasPrefix(route.Path, "/") {
+			return nil, fmt.Errorf("HTTP path %v for %v.%v must begin with /", route.Path, service.BaseName, name)
+		}
+		key := route.Method + " " + pathVar.ReplaceAllString(route.Path, "{}")
+		if other, exists := seen[key]; exists {
+			return nil, fmt.Errorf("%v.%v and %v.%v are both served on %v %v", service.BaseName, other, service.BaseName, name, route.Method, route.Path)
+		}
+		seen[key] = name
+
+		inPath := make(map[string]bool)
+		for _, match := range pathVar.FindAllStringSubmatch(route.Path, -1) {
+			inPath[match[1]] = true
+		}
+		for i, arg := range f.Arguments {
+			basic, isBasic := arg.Type.(*gocode.BasicType)
+			rArg := routeArg{Variable: arg, Index: i, IsString: isBasic && basic.Name == "string", Placeholder: "{" + arg.Name + "}"}
+			switch {
+			case inPath[arg.Name]:
+				route.PathArgs = append(route.PathArgs, rArg)
+				delete(inPath, arg.Name)
+			case bodyMethods[route.Method]:
+				route.BodyArgs = append(route.BodyArgs, rArg)
+			default:
+				route.QueryArgs = append(route.QueryArgs, rArg)
+			}
+		}
+		for v := range inPath {
+			return nil, fmt.Errorf("HTTP path %v for %v.%v has variable {%v} but the method has no argument named %v", route.Path, service.BaseName, name, v, v)
+		}
+		routes[name] = route
+	}
+	return routes, nil
+}
@@ -12,8 +12,12 @@ import (
 
 /*
 This function is used by the HTTP plugin to generate the server-side HTTP service.
+
+name is the prefix of the name of the generated handler; each deployment of a service has its own handler,
+because deployments of the same service can have different routes.  routes optionally overrides the HTTP
+method and path of some of the service's methods.
 */
-func GenerateServerHandler(builder golang.ModuleBuilder, service *gocode.ServiceInterface, outputPackage string) error {
+func GenerateServerHandler(builder golang.ModuleBuilder, service *gocode.ServiceInterface, outputPackage string, name string, routes map[string]Route) error {
 	pkg, err := builder.CreatePackage(outputPackage)
 	if err != nil {
 		return err
@@ -22,14 +26,26 @@ func GenerateServerHandler(builder golang.ModuleBuilder, service *gocode.Service
 	server := &serverArgs{
 		Package: pkg,
 		Service: service,
-		Name:    service.BaseName + "_HTTPServerHandler",
+		Name:    name + "_HTTPServerHandler",
 		Imports: gogen.NewImports(pkg.Name),
 	}
+	if server.Routes, err = resolveRoutes(service, routes); err != nil {
+		return err
+	}
 
-	server.Imports.AddPackages("context", "encoding/json", "net/http", "github.com/gorilla/mux", "log")
+	server.Imports.AddPackages(
+		"context", "encoding/json", "net/http", "github.com/gorilla/mux", "log",
+		"github.com/blueprint-uservices/blueprint/runtime/plugins/deadline",
+		"github.com/blueprint-uservices/blueprint/runtime/plugins/httperrors",
+	)
+	for _, route := range server.Routes {
+		if len(route.BodyArgs) > 0 {
+			server.Imports.AddPackages("io", "errors")
+		}
+	}
 
-	slog.Info(fmt.Sprintf("Generating %v/%v_HTTPServer.go", server.Package.PackageName, service.BaseName))
-	outputFile := filepath.Join(server.Package.Path, service.BaseName+"_HTTPServer.go")
+	slog.Info(fmt.Sprintf("Generating %v/%v_HTTPServer.go", server.Package.PackageName, name))
+	outputFile := filepath.Join(server.Package.Path, name+"_HTTPServer.go")
 	return gogen.ExecuteTemplateToFile("HTTPServer", serverTemplate, server, outputFile)
 }
 
@@ -39,8 +55,9 @@ Arguments to the template code
 type serverArgs struct {
 	Package golang.PackageInfo
 	Service *gocode.ServiceInterface
-	Name    string         // Name of the generated wrapper class
-	Imports *gogen.Imports // Manages imports for us
+	Name    string                  // Name of the generated wrapper class
+	Routes  map[string]*methodRoute // The route of each method
+	Imports *gogen.Imports          // Manages imports for us
 }
 
 var serverTemplate = `// Blueprint: Auto-generated by HTTP Plugin
@@ -64,8 +81,10 @@ func New_{{.Name}}(ctx context.Context, service {{.Imports.NameOf .Service.UserT
 func (handler *{{.Name}}) Run(ctx context.Context) error {
 	router := mux.NewRouter()
 	// Add paths for the mux router
+	{{- $routes := .Routes}}
 	{{ range $_, $f := .Service.Methods }}
-	router.Path("/{{$f.Name}}").HandlerFunc(handler.{{$f.Name}})
+	{{- $route := index $routes $f.Name -}}
+	router.Methods("{{$route.Method}}").Path("{{$route.Path}}").HandlerFunc(handler.{{$f.Name}})
 	{{end}}
 	srv := &http.Server {
 		Addr: handler.Address,
@@ -85,12 +104,28 @@ func (handler *{{.Name}}) Run(ctx context.Context) error {
 {{$service := .Service.Name -}}
 {{$receiver := .Name -}}
 {{ range $_, $f := .Service.Methods }}
+{{- $route := index $routes $f.Name}}
 func (handler *{{$receiver}}) {{$f.Name -}}
 	(w http.ResponseWriter, r *http.Request) {
 	var err error
 	defer r.Body.Close()
-	{{range $_, $arg := $f.Arguments}}
-	{{if eq (NameOf $arg.Type) "string" -}}
+	{{- if $route.PathArgs}}
+	path_vars := mux.Vars(r)
+	{{- end}}
+	{{- range $_, $arg := $route.PathArgs}}
+	{{if $arg.IsString -}}
+	{{$arg.Name}} := path_vars["{{$arg.Name}}"]
+	{{- else -}}
+	var {{$arg.Name}} {{NameOf $arg.Type}}
+	err = json.Unmarshal([]byte(path_vars["{{$arg.Name}}"]), &{{$arg.Name}})
+	if err != nil {
+		httperrors.Write(w, httperrors.New(http.StatusBadRequest, err.Error()))
+		return
+	}
+	{{- end}}
+	{{- end}}
+	{{- range $_, $arg := $route.QueryArgs}}
+	{{if $arg.IsString -}}
 	{{$arg.Name}} := r.URL.Query().Get("{{$arg.Name}}")
 	{{- else -}}
 	request_{{$arg.Name}} := r.URL.Query().Get("{{$arg.Name}}")
@@ -98,18 +133,34 @@ func (handler *{{$receiver}}) {{$f.Name -}}
 	if request_{{$arg.Name}} != "" {
 		err = json.Unmarshal([]byte(request_{{$arg.Name}}), &{{$arg.Name}})
 		if err != nil {
-			log.Println(err.Error())
-			http.Error(w, err.Error(), 500)
+			httperrors.Write(w, httperrors.New(http.StatusBadRequest, err.Error()))
 			return
 		}
 	}
 	{{- end}}
-	{{end}}
-	ctx := context.Background()
+	{{- end}}
+	{{- if $route.BodyArgs}}
+	request_args := struct {
+		{{- range $_, $arg := $route.BodyArgs}}
+		Arg{{$arg.Index}} {{NameOf $arg.Type}} {{JsonField $arg.Name}}
+		{{- end}}
+	}{}
+	err = json.NewDecoder(r.Body).Decode(&request_args)
+	if err != nil && !errors.Is(err, io.EOF) {
+		httperrors.Write(w, httperrors.New(http.StatusBadRequest, err.Error()))
+		return
+	}
+	{{- range $_, $arg := $route.BodyArgs}}
+	{{$arg.Name}} := request_args.Arg{{$arg.Index}}
+	{{- end}}
+	{{- end}}
+	// The service context is cancelled if the client disconnects or its deadline expires
+	ctx, cancel_request := deadline.FromRequest(r)
+	defer cancel_request()
 	{{RetVars $f "err"}} {{HasNewReturnVars $f}} handler.Service.{{$f.Name}}({{ArgVars $f "ctx"}})
 	if err != nil {
 		log.Println(err.Error())
-		http.Error(w, err.Error(), 500)
+		httperrors.Write(w, err)
 		return
 	}
 	response := struct {
@@ -120,6 +171,7 @@ func (handler *{{$receiver}}) {{$f.Name -}}
 	{{range $i, $arg := $f.Returns}}
 	response.Ret{{$i}} = ret{{$i}}
 	{{end}}
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 {{end}}
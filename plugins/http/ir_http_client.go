@@ -2,7 +2,9 @@ package http
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/blueprint"
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/address"
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/service"
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/ir"
@@ -21,14 +23,22 @@ type GolangHttpClient struct {
 
 	InstanceName string
 	ServerAddr   *address.Address[*golangHttpServer]
+	Timeout      *ir.IRValue
+	Routes       map[string]httpcodegen.Route
 
 	outputPackage string
 }
 
-func newGolangHttpClient(name string, addr *address.Address[*golangHttpServer]) (*GolangHttpClient, error) {
+func newGolangHttpClient(name string, addr *address.Address[*golangHttpServer], options Options) (*GolangHttpClient, error) {
+	if _, err := time.ParseDuration(options.Timeout); err != nil {
+		return nil, blueprint.Errorf("invalid timeout for HTTP client %s: %s", name, err.Error())
+	}
+
 	node := &GolangHttpClient{}
 	node.InstanceName = name
 	node.ServerAddr = addr
+	node.Timeout = &ir.IRValue{Value: options.Timeout}
+	node.Routes = options.Routes
 	node.outputPackage = "http"
 
 	return node, nil
@@ -73,7 +83,7 @@ func (node *GolangHttpClient) GenerateFuncs(builder golang.ModuleBuilder) error
 		return err
 	}
 
-	return httpcodegen.GenerateClient(builder, iface, node.outputPackage)
+	return httpcodegen.GenerateClient(builder, iface, node.outputPackage, node.ServerAddr.Server.generatedName(iface), node.Routes)
 }
 
 func (node *GolangHttpClient) AddInstantiation(builder golang.NamespaceBuilder) error {
@@ -90,15 +100,16 @@ func (node *GolangHttpClient) AddInstantiation(builder golang.NamespaceBuilder)
 	constructor := &gocode.Constructor{
 		Package: builder.Module().Info().Name + "/" + node.outputPackage,
 		Func: gocode.Func{
-			Name: fmt.Sprintf("New_%v_HTTPClient", iface.BaseName),
+			Name: fmt.Sprintf("New_%v_HTTPClient", node.ServerAddr.Server.generatedName(iface)),
 			Arguments: []gocode.Variable{
 				{Name: "ctx", Type: &gocode.UserType{Package: "context", Name: "Context"}},
 				{Name: "addr", Type: &gocode.BasicType{Name: "string"}},
+				{Name: "timeout", Type: &gocode.BasicType{Name: "string"}},
 			},
 		},
 	}
 
-	return builder.DeclareConstructor(node.InstanceName, constructor, []ir.IRNode{node.ServerAddr.Dial})
+	return builder.DeclareConstructor(node.InstanceName, constructor, []ir.IRNode{node.ServerAddr.Dial, node.Timeout})
 }
 
 func (node *GolangHttpClient) ImplementsGolangNode()    {}
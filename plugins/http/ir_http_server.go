@@ -23,7 +23,9 @@ type golangHttpServer struct {
 	InstanceName string
 	Bind         *address.BindConfig
 	Wrapped      golang.Service
+	Routes       map[string]httpcodegen.Route
 
+	deployment    string // The name of the deployed service
 	outputPackage string
 }
 
@@ -41,7 +43,7 @@ func (i *HttpInterface) GetMethods() []service.Method {
 	return i.Wrapped.GetMethods()
 }
 
-func newGolangHttpServer(name string, wrapped ir.IRNode) (*golangHttpServer, error) {
+func newGolangHttpServer(name string, deployment string, wrapped ir.IRNode, options Options) (*golangHttpServer, error) {
 	service, is_service := wrapped.(golang.Service)
 	if !is_service {
 		return nil, blueprint.Errorf("HTTP server %s expected %s to be a golang service, but got %s", name, wrapped.Name(), reflect.TypeOf(wrapped).String())
@@ -50,6 +52,8 @@ func newGolangHttpServer(name string, wrapped ir.IRNode) (*golangHttpServer, err
 	node := &golangHttpServer{}
 	node.InstanceName = name
 	node.Wrapped = service
+	node.Routes = options.Routes
+	node.deployment = deployment
 	node.outputPackage = "http"
 	return node, nil
 }
@@ -62,18 +66,25 @@ func (n *golangHttpServer) Name() string {
 	return n.InstanceName
 }
 
-// Generates the HTTP Server handler
+// Generates the HTTP Server handler and its OpenAPI document
 func (node *golangHttpServer) GenerateFuncs(builder golang.ModuleBuilder) error {
 	iface, err := golang.GetGoInterface(builder, node.Wrapped)
 	if err != nil {
 		return err
 	}
 
-	err = httpcodegen.GenerateServerHandler(builder, iface, node.outputPackage)
+	err = httpcodegen.GenerateServerHandler(builder, iface, node.outputPackage, node.generatedName(iface), node.Routes)
 	if err != nil {
 		return err
 	}
-	return nil
+	return httpcodegen.GenerateOpenAPI(builder, iface, node.outputPackage, node.generatedName(iface), node.Routes)
+}
+
+// Returns the prefix of the names of the server handler, client and OpenAPI document generated for
+// this deployment.  Deployments of the same service can have different routes, so they can't share
+// generated code.
+func (node *golangHttpServer) generatedName(iface *gocode.ServiceInterface) string {
+	return iface.BaseName + "_" + ir.CleanName(node.deployment)
 }
 
 func (node *golangHttpServer) AddInstantiation(builder golang.NamespaceBuilder) error {
@@ -90,7 +101,7 @@ func (node *golangHttpServer) AddInstantiation(builder golang.NamespaceBuilder)
 	constructor := &gocode.Constructor{
 		Package: builder.Module().Info().Name + "/" + node.outputPackage,
 		Func: gocode.Func{
-			Name: fmt.Sprintf("New_%v_HTTPServerHandler", iface.BaseName),
+			Name: fmt.Sprintf("New_%v_HTTPServerHandler", node.generatedName(iface)),
 			Arguments: []gocode.Variable{
 				{Name: "ctx", Type: &gocode.UserType{Package: "context", Name: "Context"}},
 				{Name: "service", Type: iface},
@@ -1,5 +1,5 @@
 // Package http implements a Blueprint plugin that enables any Golang service to be deployed using a http server.
-
+//
 // To use the plugin in a Blueprint wiring spec, import this package and use the [Deploy] method, i.e.
 //
 //	import "github.com/blueprint-uservices/blueprint/plugins/http"
@@ -7,8 +7,38 @@
 //
 // See the documentation for [Deploy] for more information about its behavior.
 //
+// By default, each method of the service is served on POST /MethodName, with the method's arguments sent
+// as fields of a JSON request body.  [DeployWithOptions] can override the HTTP method and path of individual
+// methods, and the client timeout, e.g.
+//
+//	http.DeployWithOptions(spec, "post_service", http.Options{
+//		Timeout: "5s",
+//		Routes: map[string]http.Route{
+//			"ReadPost":   {Method: "GET", Path: "/posts/{postID}"},
+//			"DeletePost": {Method: "DELETE", Path: "/posts/{postID}"},
+//		},
+//	})
+//
+// Errors returned by the service are mapped to HTTP status codes, and clients convert the status codes
+// back into errors.  Services can return the typed errors in [runtime/plugins/httperrors], or errors
+// wrapping them, to respond with 4xx or 5xx status codes other than 500.
+//
+// Deadlines of client requests are propagated to the server in the X-Blueprint-Timeout header, as the
+// time remaining until the deadline.  The server derives the context passed to the service from the
+// HTTP request, so server-side work is cancelled when the deadline expires or the client disconnects.
+//
+// An OpenAPI 3 document describing the server is generated alongside the server handler, in the file
+// <Interface>_<service>_openapi.json of the generated http package, where <Interface> is the name of the
+// service's interface and <service> is the name of the deployed service.  Its schemas are derived from
+// the Go types of the service's arguments and return values.
+//
+// Each deployment has its own generated server, client and OpenAPI document, named after the service's
+// interface and the deployed service, because deployments of the same service can have different routes.
+//
 // The plugin implements a server-side handler and client-side
 // library that calls the server. This is implemented within the [httpcodegen] package.
+//
+// [runtime/plugins/httperrors]: https://github.com/Blueprint-uServices/blueprint/tree/main/runtime/plugins/httperrors
 package http
 
 import (
@@ -18,11 +48,29 @@ import (
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/ir"
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/wiring"
 	"github.com/blueprint-uservices/blueprint/plugins/golang"
+	"github.com/blueprint-uservices/blueprint/plugins/http/httpcodegen"
 	"golang.org/x/exp/slog"
 )
 
-//Deploys `serviceName` as a HTTP server.
+// Overrides the HTTP method and path that a service method is served on.
+//
+// For GET and DELETE, arguments that are not path variables are sent as query parameters.
+// For POST, PUT and PATCH, they are sent as fields of a JSON request body.
+type Route = httpcodegen.Route
+
+// Options for deploying a service with [DeployWithOptions]
+type Options struct {
+	// The timeout of client requests, e.g. "5s".  Defaults to "1s".  "0s" disables the timeout.
+	// If the context of a call has an earlier deadline, that deadline applies instead.
+	Timeout string
 
+	// Overrides the route of service methods, keyed by method name.  Methods without an
+	// override are served on POST /MethodName.
+	Routes map[string]Route
+}
+
+// Deploys `serviceName` as a HTTP server.
+//
 // Typcially serviceName should be the name of a workflow service that was initially defined using [workflow.Define].
 //
 // Like many other modifiers, HTTP modifier the service at the golang level, by generating
@@ -34,6 +82,16 @@ import (
 // Deploying a service with HTTP increases the visibility of the service within the application.
 // By default, any other service running in any other container or namespace can now contact this service.
 func Deploy(spec wiring.WiringSpec, serviceName string) {
+	DeployWithOptions(spec, serviceName, Options{})
+}
+
+// Deploys `serviceName` as a HTTP server, like [Deploy], using the provided options
+// to configure the client timeout and the routes of service methods.
+func DeployWithOptions(spec wiring.WiringSpec, serviceName string, options Options) {
+	if options.Timeout == "" {
+		options.Timeout = "1s"
+	}
+
 	// The nodes that we are defining
 	httpClient := serviceName + ".http_client"
 	httpServer := serviceName + ".http_server"
@@ -58,7 +116,7 @@ func Deploy(spec wiring.WiringSpec, serviceName string) {
 		if err != nil {
 			return nil, blueprint.Errorf("HTTP client %s expected %s to be an address, but encountered %s", httpClient, clientNext, err)
 		}
-		return newGolangHttpClient(httpClient, addr)
+		return newGolangHttpClient(httpClient, addr, options)
 	})
 
 	// Add the server-side modifier, which is an address that PointsTo the grpcServer
@@ -69,7 +127,7 @@ func Deploy(spec wiring.WiringSpec, serviceName string) {
 			return nil, blueprint.Errorf("HTTP server %s expected %s to be a golang.Service, but encountered %s", httpServer, serverNext, err)
 		}
 
-		server, err := newGolangHttpServer(httpServer, wrapped)
+		server, err := newGolangHttpServer(httpServer, serviceName, wrapped, options)
 		if err != nil {
 			return nil, err
 		}
@@ -68,3 +68,58 @@ func (server *{{$receiver}}) {{$f.Name -}} ({{ArgVarsAndTypes $f "ctx context.Co
 }
 {{end}}
 `
+
+// code generation function called from the ir.go file.
+func generateDistributionWrapper(builder golang.ModuleBuilder, wrapped *gocode.ServiceInterface, outputPackage string) error {
+	pkg, err := builder.CreatePackage(outputPackage)
+	if err != nil {
+		return err
+	}
+
+	server := serverArgs{
+		Package: pkg,
+		Service: wrapped,
+		Name:    wrapped.BaseName + "_LatencyDistribution",
+		Imports: gogen.NewImports(pkg.Name),
+	}
+
+	server.Imports.AddPackages("context", "github.com/blueprint-uservices/blueprint/runtime/plugins/latency")
+	slog.Info(fmt.Sprintf("Generating %v/%v", server.Package.PackageName, server.Name))
+	outputFile := filepath.Join(server.Package.Path, server.Name+".go")
+
+	return gogen.ExecuteTemplateToFile("LatencyDistribution", distributionTemplate, server, outputFile)
+}
+
+var distributionTemplate = `// Blueprint: Auto-generated by LatencyInjector Plugin
+package {{.Package.ShortName}}
+
+{{.Imports}}
+
+type {{.Name}} struct {
+	Server {{.Imports.NameOf .Service.UserType}}
+	Injector *latency.Injector
+}
+
+func New_{{.Name}} (ctx context.Context, server {{.Imports.NameOf .Service.UserType}}, distribution string, fraction string, methods string, seed string) (*{{.Name}}, error) {
+	injector, err := latency.ParseInjector(distribution, fraction, methods, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := &{{.Name}}{}
+	handler.Server = server
+	handler.Injector = injector
+	return handler, nil
+}
+
+{{$service := .Service.Name -}}
+{{$receiver := .Name -}}
+{{ range $_, $f := .Service.Methods }}
+func (server *{{$receiver}}) {{$f.Name -}} ({{ArgVarsAndTypes $f "ctx context.Context"}}) ({{RetVarsAndTypes $f "err error"}}) {
+	if err = server.Injector.Inject(ctx, "{{$f.Name}}"); err != nil {
+		return
+	}
+	return server.Server.{{$f.Name}}({{ArgVars $f "ctx"}})
+}
+{{end}}
+`
@@ -0,0 +1,148 @@
+package latency
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/blueprint"
+)
+
+// A Distribution from which [AddDistribution] samples injected latencies.
+//
+// Durations are strings such as "300ms" or "1.5s", as accepted by [time.ParseDuration].
+// Construct a Distribution with one of [Uniform], [Normal], [Exponential], [LogNormal],
+// [Pareto] or [Empirical]; errors in the provided arguments are reported when the wiring spec is built.
+type Distribution struct {
+	kind      string
+	durations []time.Duration
+	shape     float64
+	err       error
+}
+
+func newDistribution(kind string, shape float64, durations ...string) Distribution {
+	dist := Distribution{kind: kind, shape: shape}
+	for _, d := range durations {
+		parsed, err := time.ParseDuration(d)
+		if err != nil {
+			dist.err = err
+			return dist
+		}
+		dist.durations = append(dist.durations, parsed)
+	}
+	return dist
+}
+
+// Latencies uniformly distributed between min and max
+func Uniform(min string, max string) Distribution {
+	return newDistribution("Uniform", 0, min, max)
+}
+
+// Normally distributed latencies with the provided mean and standard deviation.
+// Negative samples are treated as zero.
+func Normal(mean string, stddev string) Distribution {
+	return newDistribution("Normal", 0, mean, stddev)
+}
+
+// Exponentially distributed latencies with the provided mean
+func Exponential(mean string) Distribution {
+	return newDistribution("Exponential", 0, mean)
+}
+
+// Log-normally distributed latencies with the provided median.  sigma is the
+// standard deviation of the logarithm of the latency.
+func LogNormal(median string, sigma float64) Distribution {
+	return newDistribution("LogNormal", sigma, median)
+}
+
+// Pareto distributed latencies with minimum latency scale and tail index shape.
+// Smaller shapes produce heavier tails.
+func Pareto(scale string, shape float64) Distribution {
+	return newDistribution("Pareto", shape, scale)
+}
+
+// Latencies drawn uniformly from the samples in a CSV file.
+//
+// Every cell of the file is a sample, either a duration string such as "12.5ms", or a bare
+// number that is interpreted as milliseconds.  A header row is permitted.
+// The file is read when the wiring spec is built and its samples are passed to the constructor
+// of the generated wrapper, so the file does not need to be present at runtime.
+func Empirical(csvFile string) Distribution {
+	dist := Distribution{kind: "Empirical"}
+	dist.durations, dist.err = readSamples(csvFile)
+	return dist
+}
+
+func readSamples(csvFile string) ([]time.Duration, error) {
+	f, err := os.Open(csvFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []time.Duration
+	for i, row := range rows {
+		for _, cell := range row {
+			cell = strings.TrimSpace(cell)
+			if cell == "" {
+				continue
+			}
+			if ms, err := strconv.ParseFloat(cell, 64); err == nil {
+				samples = append(samples, time.Duration(ms*float64(time.Millisecond)))
+			} else if d, err := time.ParseDuration(cell); err == nil {
+				samples = append(samples, d)
+			} else if i > 0 {
+				return nil, fmt.Errorf("%v line %v: invalid latency sample %v", csvFile, i+1, cell)
+			}
+		}
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("%v contains no latency samples", csvFile)
+	}
+	return samples, nil
+}
+
+// Returns the string form of the distribution that is parsed by the runtime's ParseDistribution
+func (dist Distribution) spec() (string, error) {
+	if dist.err != nil {
+		return "", dist.err
+	}
+	if dist.kind == "" {
+		return "", blueprint.Errorf("no latency distribution was specified")
+	}
+
+	var args []string
+	for _, d := range dist.durations {
+		args = append(args, d.String())
+	}
+	if dist.kind == "LogNormal" || dist.kind == "Pareto" {
+		args = append(args, strconv.FormatFloat(dist.shape, 'g', -1, 64))
+	}
+	return fmt.Sprintf("%v(%v)", dist.kind, strings.Join(args, ", ")), nil
+}
+
+// Implements fmt.Stringer
+func (dist Distribution) String() string {
+	var args []string
+	if dist.kind == "Empirical" {
+		args = append(args, fmt.Sprintf("%v samples", len(dist.durations)))
+	} else {
+		for _, d := range dist.durations {
+			args = append(args, d.String())
+		}
+		if dist.kind == "LogNormal" || dist.kind == "Pareto" {
+			args = append(args, strconv.FormatFloat(dist.shape, 'g', -1, 64))
+		}
+	}
+	return fmt.Sprintf("%v(%v)", dist.kind, strings.Join(args, ", "))
+}
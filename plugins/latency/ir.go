@@ -3,6 +3,8 @@ package latency
 import (
 	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
 
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/blueprint"
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/service"
@@ -102,3 +104,121 @@ func (node *LatencyInjectorWrapper) AddInstantiation(builder golang.NamespaceBui
 
 	return builder.DeclareConstructor(node.InstanceName, constructor, []ir.IRNode{node.Wrapped, node.LatencyValue})
 }
+
+// Blueprint IR Node representing a server side injector of latencies sampled from a distribution
+type LatencyDistributionWrapper struct {
+	golang.Service
+	golang.GeneratesFuncs
+	golang.Instantiable
+
+	InstanceName  string
+	Wrapped       golang.Service
+	outputPackage string
+	Distribution  Distribution
+	Options       Options
+	Args          []ir.IRNode // The distribution, Fraction, comma-separated Methods and Seed, as strings
+}
+
+func newLatencyDistributionWrapper(name string, server ir.IRNode, dist Distribution, options Options) (*LatencyDistributionWrapper, error) {
+	serverNode, is_callable := server.(golang.Service)
+	if !is_callable {
+		return nil, blueprint.Errorf("latency distribution wrapper requires %s to be a golang service but got %s", server.Name(), reflect.TypeOf(server).String())
+	}
+
+	distSpec, err := dist.spec()
+	if err != nil {
+		return nil, blueprint.Errorf("invalid latency distribution for %s: %s", name, err.Error())
+	}
+	if options.Fraction < 0 || options.Fraction > 1 {
+		return nil, blueprint.Errorf("latency distribution %s requires a fraction between 0 and 1 but got %v", name, options.Fraction)
+	}
+
+	node := &LatencyDistributionWrapper{}
+	node.InstanceName = name
+	node.Wrapped = serverNode
+	node.outputPackage = "latencyinjector"
+	node.Distribution = dist
+	node.Options = options
+	node.Args = []ir.IRNode{
+		&ir.IRValue{Value: distSpec},
+		&ir.IRValue{Value: strconv.FormatFloat(options.Fraction, 'g', -1, 64)},
+		&ir.IRValue{Value: strings.Join(options.Methods, ",")},
+		&ir.IRValue{Value: strconv.FormatInt(options.Seed, 10)},
+	}
+	return node, nil
+}
+
+// Implements [ir.IRNode]
+func (node *LatencyDistributionWrapper) ImplementsGolangNode() {}
+
+// Implements [golang.Service]
+func (node *LatencyDistributionWrapper) ImplementsGolangService() {}
+
+// Implements [ir.IRNode]
+func (node *LatencyDistributionWrapper) Name() string {
+	return node.InstanceName
+}
+
+// Implements [ir.IRNode]
+func (node *LatencyDistributionWrapper) String() string {
+	return node.Name() + " = LatencyDistribution(" + node.Wrapped.Name() + ", " + node.Distribution.String() + ")"
+}
+
+// Implements [golang.Service]
+func (node *LatencyDistributionWrapper) AddInterfaces(builder golang.ModuleBuilder) error {
+	return node.Wrapped.AddInterfaces(builder)
+}
+
+// Implements [golang.Service]
+func (node *LatencyDistributionWrapper) GetInterface(ctx ir.BuildContext) (service.ServiceInterface, error) {
+	return node.Wrapped.GetInterface(ctx)
+}
+
+// Implements [golang.GeneratesFuncs]
+func (node *LatencyDistributionWrapper) GenerateFuncs(builder golang.ModuleBuilder) error {
+	if builder.Visited(node.InstanceName + ".generateFuncs") {
+		return nil
+	}
+
+	iface, err := golang.GetGoInterface(builder, node)
+	if err != nil {
+		return err
+	}
+
+	for _, method := range node.Options.Methods {
+		if _, exists := iface.Methods[method]; !exists {
+			return blueprint.Errorf("latency distribution %s targets method %s, which %s does not have", node.InstanceName, method, iface.Name)
+		}
+	}
+
+	return generateDistributionWrapper(builder, iface, node.outputPackage)
+}
+
+// Implements golang.Instantiable
+func (node *LatencyDistributionWrapper) AddInstantiation(builder golang.NamespaceBuilder) error {
+	if builder.Visited(node.InstanceName) {
+		return nil
+	}
+
+	iface, err := golang.GetGoInterface(builder, node.Wrapped)
+	if err != nil {
+		return err
+	}
+
+	constructor := &gocode.Constructor{
+		Package: builder.Module().Info().Name + "/" + node.outputPackage,
+		Func: gocode.Func{
+			Name: fmt.Sprintf("New_%v_LatencyDistribution", iface.BaseName),
+			Arguments: []gocode.Variable{
+				{Name: "ctx", Type: &gocode.UserType{Package: "context", Name: "Context"}},
+				{Name: "server", Type: iface},
+				{Name: "distribution", Type: &gocode.BasicType{Name: "string"}},
+				{Name: "fraction", Type: &gocode.BasicType{Name: "string"}},
+				{Name: "methods", Type: &gocode.BasicType{Name: "string"}},
+				{Name: "seed", Type: &gocode.BasicType{Name: "string"}},
+			},
+		},
+	}
+
+	return builder.DeclareConstructor(node.InstanceName, constructor, append([]ir.IRNode{node.Wrapped}, node.Args...))
+}
@@ -1,20 +1,36 @@
 // Package latencyinjector provides a Blueprint modifier for the server side of service calls.
 //
-// The plugin configures the server side to inject a user-defined amount of latency.
-// Currently latency is injected for all requests and only a pre-defined duration is supported with no variance/noise added.
-// The plugin will generate a wrapper class that will sleep for a fixed amount of time (the specified latency to be injected)
-// before invoking the handler for handling the request.
+// The plugin configures the server side to inject a user-defined amount of latency before invoking the handler
+// for handling the request.  [AddFixed] injects the same latency into every request, with no variance/noise added.
 // Example Usage to add 100ms latency to each request:
-//    import "github.com/blueprint-uservices/blueprint/plugins/latency"
-//    latency.AddFixed(spec, "my_service", "100ms")
 //
-// TODO: Allow latency to be injected selectively to a subset of requests based using
-// random sampling or by matching attributes of a request.
-// TODO: Sample injected latency from a configurable distribution and support choosing
-// the distribution.
+//	import "github.com/blueprint-uservices/blueprint/plugins/latency"
+//	latency.AddFixed(spec, "my_service", "100ms")
 //
-// If you need the above feature(s) consider submitting a PR, raising a feature request,
-// or posting on the Blueprint slack/mailing list.
+// [AddDistribution] instead samples each injected latency from a [Distribution], constructed with one of:
+//   - [Uniform], between a minimum and a maximum latency
+//   - [Normal], with a mean and a standard deviation
+//   - [Exponential], with a mean
+//   - [LogNormal], with a median and the standard deviation of the latency's logarithm
+//   - [Pareto], with a minimum latency and a tail index
+//   - [Empirical], drawing from the samples in a CSV file
+//
+// Its [Options] select the requests that are delayed: Methods restricts the latency to the named methods of the
+// service, and Fraction to a random fraction of their requests.  A non-zero Seed makes the sampled requests and
+// latencies reproducible across runs.  A request that is delayed returns early with the caller's context error
+// if the caller's context is done before the latency elapses.
+// Example Usage to add exponentially distributed latency with a mean of 20ms to 10% of the calls to the
+// service's ReadPost method:
+//
+//	latency.AddDistribution(spec, "my_service", latency.Exponential("20ms"), latency.Options{
+//	    Methods:  []string{"ReadPost"},
+//	    Fraction: 0.1,
+//	    Seed:     42,
+//	})
+//
+// Latency distributions use the code in the [runtime/plugins/latency] package.
+//
+// [runtime/plugins/latency]: https://github.com/Blueprint-uServices/blueprint/tree/main/runtime/plugins/latency
 package latency
 
 import (
@@ -31,7 +47,8 @@ import (
 // Modifies the given service such that the server adds a fixed amount of `latency` while processing the request.
 // The `latency` string must be a sequence of decimal numbers, each with optional fraction and a unit suffix, such as "300ms", "1.5h" or "2h45m". Valid time units are "ns", "us" (or "µs"), "ms", "s", "m", "h". Negative signed values such as "-1.5h" would result in no explicit latency being added; although it might result in the go runtime re-scheduling the running goroutine.
 // Usage:
-//   AddFixed(spec, "my_service", "100ms")
+//
+//	AddFixed(spec, "my_service", "100ms")
 func AddFixed(spec wiring.WiringSpec, serviceName string, latency string) {
 	serverWrapper := serviceName + ".server.latency"
 	ptr := pointer.GetPointer(spec, serviceName)
@@ -51,3 +68,46 @@ func AddFixed(spec wiring.WiringSpec, serviceName string, latency string) {
 		return newLatencyInjectorWrapper(serverWrapper, wrapped, latency)
 	})
 }
+
+// Selects the requests that [AddDistribution] injects latency into
+type Options struct {
+	// Names of the service methods to inject latency into.  If empty, latency is injected into all methods.
+	Methods []string
+
+	// Fraction of the selected requests to inject latency into, sampled at random.
+	// Values of 0 and 1 inject latency into every selected request.
+	Fraction float64
+
+	// Seed of the random number generator used for sampling requests and latencies.
+	// A non-zero seed makes runs reproducible; if zero, a seed is chosen at startup.
+	Seed int64
+}
+
+// Adds latency sampled from a distribution on the server side during request processing for the specified service.
+// Uses a [blueprint.WiringSpec]
+// Modifies the given service such that, for requests selected by `options`, the server sleeps for a latency drawn
+// from `dist` before processing the request.  If the caller's context is done while sleeping, the request fails with
+// the context's error.
+// Usage:
+//
+//	AddDistribution(spec, "my_service", latency.LogNormal("10ms", 0.5), latency.Options{Fraction: 0.5})
+func AddDistribution(spec wiring.WiringSpec, serviceName string, dist Distribution, options Options) {
+	serverWrapper := serviceName + ".server.latency.distribution"
+	ptr := pointer.GetPointer(spec, serviceName)
+	if ptr == nil {
+		slog.Error("Unable to add a latency distribution to " + serviceName + " as it is not a pointer")
+		return
+	}
+
+	serverNext := ptr.AddDstModifier(spec, serverWrapper)
+
+	spec.Define(serverWrapper, &LatencyDistributionWrapper{}, func(ns wiring.Namespace) (ir.IRNode, error) {
+		var wrapped golang.Service
+
+		if err := ns.Get(serverNext, &wrapped); err != nil {
+			return nil, blueprint.Errorf("LatencyDistribution %s expected %s to be a golang.Service, but encountered %s", serverWrapper, serverNext, err)
+		}
+
+		return newLatencyDistributionWrapper(serverWrapper, wrapped, dist, options)
+	})
+}
@@ -21,6 +21,7 @@ type RunScript struct {
 	RunFuncs      map[string]string    // Function bodies provided by processes
 	AllNodes      map[string]ir.IRNode // All nodes seen by this run script
 	Args          map[string]ir.IRNode // Arguments that will be set in calling the environment
+	Optional      map[string]ir.IRNode // Optional config arguments that the calling environment may leave unset
 }
 
 /*
@@ -36,6 +37,7 @@ func NewRunScript(workspaceName, workspaceDir, fileName string) *RunScript {
 		RunFuncs:      make(map[string]string),
 		AllNodes:      make(map[string]ir.IRNode),
 		Args:          make(map[string]ir.IRNode),
+		Optional:      make(map[string]ir.IRNode),
 	}
 }
 
@@ -70,7 +72,11 @@ func (run *RunScript) GenerateRunScript() error {
 	for name, node := range run.AllNodes {
 		if _, hasRunFunc := run.RunFuncs[name]; !hasRunFunc {
 			// This node doesn't have a run func, so it must be an arg
-			run.Args[name] = node
+			if conf, isConfig := node.(ir.IRConfig); isConfig && conf.Optional() {
+				run.Optional[name] = node
+			} else {
+				run.Args[name] = node
+			}
 		}
 	}
 
@@ -93,7 +99,13 @@ usage() {
 	else
 		echo "    {{EnvVarName .Name}}=${{EnvVarName .Name}}"
 	fi
-	{{end}}	
+	{{end}}
+	{{- if .Optional}}
+	echo "  Optional environment variables:"
+	{{range $name, $arg := .Optional -}}
+	echo "    {{EnvVarName .Name}}=${{EnvVarName .Name}}"
+	{{end}}
+	{{- end}}	
 	exit 1; 
 }
 
@@ -129,6 +141,11 @@ run_all() {
 		return 1
 	fi
 
+	# Optional environment variables default to empty
+	{{- range $name, $arg := .Optional}}
+	{{EnvVarName .Name}}="${ {{- EnvVarName .Name}}:-}"
+	{{- end}}
+
 	{{range $name, $f := .RunFuncs -}}
 	{{RunFuncName $name}}
 	{{end}}
@@ -1,6 +1,10 @@
 package mongodb
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/address"
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/backend"
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/service"
@@ -9,11 +13,16 @@ import (
 	"github.com/blueprint-uservices/blueprint/plugins/golang/goparser"
 	"github.com/blueprint-uservices/blueprint/plugins/workflow/workflowspec"
 	"github.com/blueprint-uservices/blueprint/runtime/plugins/mongodb"
+	"golang.org/x/exp/slog"
 )
 
-// Blueprint IR Node that represents the server side docker container
+// Blueprint IR Node that represents the server side docker container.
+//
+// The container runs mongodb as a single-node replica set named rs0, so that change streams
+// and transactions are available.
 type MongoDBContainer struct {
 	docker.Container
+	docker.ProvidesContainerImage
 	docker.ProvidesContainerInstance
 	backend.NoSQLDB
 
@@ -65,8 +74,47 @@ func (m *MongoDBContainer) GetInterface(ctx ir.BuildContext) (service.ServiceInt
 	return &MongoInterface{Wrapped: iface}, nil
 }
 
+// The Dockerfile of the mongodb image, which extends the official image to run a replica set
+var dockerfile = `FROM mongo
+COPY replset.sh /usr/local/bin/replset.sh
+RUN chmod +x /usr/local/bin/replset.sh
+ENTRYPOINT ["replset.sh"]
+`
+
+// Starts mongod as a replica set, then initiates the replica set with mongod as its only member
+var replsetScript = `#!/bin/bash
+docker-entrypoint.sh mongod --replSet rs0 --bind_ip_all &
+pid=$!
+trap 'kill $pid' INT TERM
+until mongosh --quiet --eval 'try { rs.status().ok } catch (e) { rs.initiate({_id: "rs0", members: [{_id: 0, host: "localhost:27017"}]}).ok }' > /dev/null 2>&1; do
+  sleep 1
+done
+wait $pid
+`
+
+// Implements docker.ProvidesContainerImage
+func (node *MongoDBContainer) AddContainerArtifacts(target docker.ContainerWorkspace) error {
+	if target.Visited(node.InstanceName + ".artifacts") {
+		return nil
+	}
+
+	slog.Info(fmt.Sprintf("Creating container image %v", node.imageName()))
+	dir, err := target.CreateImageDir(node.imageName())
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte(dockerfile), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "replset.sh"), []byte(replsetScript), 0755)
+}
+
 // Implements docker.ProvidesContainerInstance
 func (node *MongoDBContainer) AddContainerInstance(target docker.ContainerWorkspace) error {
 	node.BindAddr.Port = 27017
-	return target.DeclarePrebuiltInstance(node.InstanceName, "mongo", node.BindAddr)
+	return target.DeclareLocalImage(node.InstanceName, node.imageName(), node.BindAddr)
+}
+
+func (node *MongoDBContainer) imageName() string {
+	return ir.CleanName(node.InstanceName)
 }
@@ -17,7 +17,12 @@ import (
 // Container generates the IRNodes for a mongodb server docker container that uses the latest mongodb image
 // and the clients needed by the generated application to communicate with the server.
 //
+// The server runs as a single-node replica set, so that [backend.NoSQLCollection.Watch] change streams
+// are available.
+//
 // The generated container has the name `dbName`.
+//
+// [backend.NoSQLCollection.Watch]: https://github.com/Blueprint-uServices/blueprint/tree/main/runtime/core/backend
 func Container(spec wiring.WiringSpec, dbName string) string {
 	// The nodes that we are defining
 	ctrName := dbName + ".ctr"
@@ -22,18 +22,20 @@ type MySQLDBGoClient struct {
 	Username     *ir.IRValue
 	Password     *ir.IRValue
 	DBVal        *ir.IRValue
+	Migrations   *ir.IRValue
 	Addr         *address.DialConfig
 
 	Spec *workflowspec.Service
 }
 
-func newMySQLDBGoClient(name string, addr *address.DialConfig, username *ir.IRValue, password *ir.IRValue, dbname *ir.IRValue) (*MySQLDBGoClient, error) {
+func newMySQLDBGoClient(name string, addr *address.DialConfig, username *ir.IRValue, password *ir.IRValue, dbname *ir.IRValue, migrations *ir.IRValue) (*MySQLDBGoClient, error) {
 	spec, err := workflowspec.GetService[mysql.MySqlDB]()
 	client := &MySQLDBGoClient{
 		InstanceName: name,
 		Username:     username,
 		Password:     password,
 		DBVal:        dbname,
+		Migrations:   migrations,
 		Addr:         addr,
 		Spec:         spec,
 	}
@@ -73,7 +75,12 @@ func (m *MySQLDBGoClient) AddInstantiation(builder golang.NamespaceBuilder) erro
 
 	slog.Info(fmt.Sprintf("Instantiating MySqlClient %v in %v/%v", m.InstanceName, builder.Info().Package.PackageName, builder.Info().FileName))
 
-	return builder.DeclareConstructor(m.InstanceName, m.Spec.Constructor.AsConstructor(), []ir.IRNode{m.Addr, m.DBVal, m.Username, m.Password})
+	return builder.DeclareConstructor(m.InstanceName, m.Spec.Constructor.AsConstructor(), []ir.IRNode{m.Addr, m.DBVal, m.Username, m.Password, m.Migrations})
+}
+
+// Implements golang.Migratable
+func (m *MySQLDBGoClient) AppliesMigrations() bool {
+	return m.Migrations.Value != ""
 }
 
 func (node *MySQLDBGoClient) ImplementsGolangNode()    {}
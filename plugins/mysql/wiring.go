@@ -4,9 +4,16 @@
 // and a go-client for connecting to the server.
 //
 // The applications must use a backend.RelationalDB (runtime/core/backend) as the interface in the workflow.
+//
+// The schema of the database can be managed by versioned migrations that a service registers with the
+// runtime/core/migrate package, e.g.
+//
+//	catalogue_db := mysql.Container(spec, "catalogue_db", mysql.ContainerOptions{Migrations: "catalogue"})
 package mysql
 
 import (
+	"strings"
+
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/blueprint"
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/address"
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/pointer"
@@ -17,9 +24,30 @@ import (
 var mysql_root_username = "root"
 var mysql_root_password = "pass"
 
+// Options for a mysql [Container]
+type ContainerOptions struct {
+	// The name with which the migrations to apply to the database are registered with migrate.Register.
+	// The package that registers them must be part of the processes that contain the database's clients,
+	// e.g. because it is the package of a service that uses the database.
+	Migrations string
+}
+
 // Container generate the IRNodes for a mysql server docker container that uses the latest mysql/mysql image
 // and the clients needed by the generated application to communicate with the server.
-func Container(spec wiring.WiringSpec, dbName string) string {
+//
+// If options are provided with a non-empty Migrations, the clients apply the migrations that haven't been
+// applied when their process starts; the process can also be started with the --migrate flag to roll back
+// migrations or print their status.
+func Container(spec wiring.WiringSpec, dbName string, options ...ContainerOptions) string {
+	var opts ContainerOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	if strings.ContainsAny(opts.Migrations, "\"\\\n") {
+		spec.AddError(blueprint.Errorf("invalid migrations name %q for mysql container %v", opts.Migrations, dbName))
+		return dbName
+	}
+
 	// The nodes that we are defining
 	ctrName := dbName + ".ctr"
 	clientName := dbName + ".client"
@@ -56,8 +84,9 @@ func Container(spec wiring.WiringSpec, dbName string) string {
 		user_val := &ir.IRValue{Value: mysql_root_username}
 		pwd_val := &ir.IRValue{Value: mysql_root_password}
 		db_val := &ir.IRValue{Value: dbName}
+		migrations_val := &ir.IRValue{Value: opts.Migrations}
 
-		return newMySQLDBGoClient(clientName, addr.Dial, user_val, pwd_val, db_val)
+		return newMySQLDBGoClient(clientName, addr.Dial, user_val, pwd_val, db_val, migrations_val)
 	})
 
 	return dbName
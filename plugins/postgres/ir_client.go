@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"fmt"
+
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/address"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/backend"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/service"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/ir"
+	"github.com/blueprint-uservices/blueprint/plugins/golang"
+	"github.com/blueprint-uservices/blueprint/plugins/workflow/workflowspec"
+	"github.com/blueprint-uservices/blueprint/runtime/plugins/postgres"
+	"golang.org/x/exp/slog"
+)
+
+// Blueprint IR Node that represents the generated client for the postgres container
+type PostgresGoClient struct {
+	golang.Service
+	backend.RelDB
+	clientArgs
+
+	InstanceName string
+	Addr         *address.DialConfig
+
+	Spec *workflowspec.Service
+}
+
+// The arguments of the client's constructor, other than its address
+type clientArgs struct {
+	Username        *ir.IRValue
+	Password        *ir.IRValue
+	DBVal           *ir.IRValue
+	MaxOpenConns    *ir.IRValue
+	MaxIdleConns    *ir.IRValue
+	ConnMaxLifetime *ir.IRValue
+	Migrations      *ir.IRValue
+}
+
+func newPostgresGoClient(name string, addr *address.DialConfig, args clientArgs) (*PostgresGoClient, error) {
+	spec, err := workflowspec.GetService[postgres.PostgresDB]()
+	client := &PostgresGoClient{
+		clientArgs:   args,
+		InstanceName: name,
+		Addr:         addr,
+		Spec:         spec,
+	}
+	return client, err
+}
+
+// Implements ir.IRNode
+func (p *PostgresGoClient) Name() string {
+	return p.InstanceName
+}
+
+// Implements ir.IRNode
+func (p *PostgresGoClient) String() string {
+	return p.InstanceName + " = PostgresClient(" + p.Addr.Name() + ")"
+}
+
+// Implements service.ServiceNode
+func (p *PostgresGoClient) GetInterface(ctx ir.BuildContext) (service.ServiceInterface, error) {
+	return p.Spec.Iface.ServiceInterface(ctx), nil
+}
+
+// Implements golang.ProvidesModule
+func (p *PostgresGoClient) AddToWorkspace(builder golang.WorkspaceBuilder) error {
+	return p.Spec.AddToWorkspace(builder)
+}
+
+// Implements golang.ProvidesInterface
+func (p *PostgresGoClient) AddInterfaces(builder golang.ModuleBuilder) error {
+	return p.Spec.AddToModule(builder)
+}
+
+// Implements golang.Instantiable
+func (p *PostgresGoClient) AddInstantiation(builder golang.NamespaceBuilder) error {
+	if builder.Visited(p.InstanceName) {
+		return nil
+	}
+
+	slog.Info(fmt.Sprintf("Instantiating PostgresClient %v in %v/%v", p.InstanceName, builder.Info().Package.PackageName, builder.Info().FileName))
+
+	return builder.DeclareConstructor(p.InstanceName, p.Spec.Constructor.AsConstructor(), []ir.IRNode{
+		p.Addr, p.DBVal, p.Username, p.Password, p.MaxOpenConns, p.MaxIdleConns, p.ConnMaxLifetime, p.Migrations,
+	})
+}
+
+// Implements golang.Migratable
+func (p *PostgresGoClient) AppliesMigrations() bool {
+	return p.Migrations.Value != ""
+}
+
+func (node *PostgresGoClient) ImplementsGolangNode()    {}
+func (node *PostgresGoClient) ImplementsGolangService() {}
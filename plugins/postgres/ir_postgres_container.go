@@ -0,0 +1,148 @@
+package postgres
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/address"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/backend"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/service"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/ir"
+	"github.com/blueprint-uservices/blueprint/plugins/docker"
+	"github.com/blueprint-uservices/blueprint/plugins/golang/goparser"
+	"github.com/blueprint-uservices/blueprint/plugins/workflow/workflowspec"
+	"github.com/blueprint-uservices/blueprint/runtime/plugins/postgres"
+	"golang.org/x/exp/slog"
+)
+
+// Blueprint IR Node that represents the server side docker container.
+//
+// If the container has init scripts, it uses an image that extends the configured image with the
+// scripts; otherwise it uses the configured image.
+type PostgresContainer struct {
+	backend.RelDB
+	docker.Container
+	docker.ProvidesContainerImage
+	docker.ProvidesContainerInstance
+
+	InstanceName string
+	BindAddr     *address.BindConfig
+	Iface        *goparser.ParsedInterface
+
+	database    string
+	image       string
+	username    string
+	password    string
+	initScripts []string
+}
+
+// Postgres interface exposed by the docker container.
+type PostgresInterface struct {
+	service.ServiceInterface
+	Wrapped service.ServiceInterface
+}
+
+func (p *PostgresInterface) GetName() string {
+	return "postgres(" + p.Wrapped.GetName() + ")"
+}
+
+func (p *PostgresInterface) GetMethods() []service.Method {
+	return p.Wrapped.GetMethods()
+}
+
+func newPostgresContainer(name string, database string, image string, username string, password string, initScripts []string) (*PostgresContainer, error) {
+	spec, err := workflowspec.GetService[postgres.PostgresDB]()
+	if err != nil {
+		return nil, err
+	}
+
+	cntr := &PostgresContainer{
+		InstanceName: name,
+		Iface:        spec.Iface,
+		database:     database,
+		image:        image,
+		username:     username,
+		password:     password,
+		initScripts:  initScripts,
+	}
+	return cntr, nil
+}
+
+// Implements ir.IRNode
+func (p *PostgresContainer) String() string {
+	return p.InstanceName + " = PostgresContainer(" + p.BindAddr.Name() + ")"
+}
+
+// Implements ir.IRNode
+func (p *PostgresContainer) Name() string {
+	return p.InstanceName
+}
+
+// Implements service.ServiceNode
+func (p *PostgresContainer) GetInterface(ctx ir.BuildContext) (service.ServiceInterface, error) {
+	iface := p.Iface.ServiceInterface(ctx)
+	return &PostgresInterface{Wrapped: iface}, nil
+}
+
+// The Dockerfile of an image with init scripts, which the official image's entrypoint executes
+// when the container starts with an empty data directory
+var dockerfile = `FROM %v
+COPY initdb/ /docker-entrypoint-initdb.d/
+`
+
+// Implements docker.ProvidesContainerImage
+func (p *PostgresContainer) AddContainerArtifacts(target docker.ContainerWorkspace) error {
+	if len(p.initScripts) == 0 || target.Visited(p.InstanceName+".artifacts") {
+		return nil
+	}
+
+	slog.Info(fmt.Sprintf("Creating container image %v", p.imageName()))
+	dir, err := target.CreateImageDir(p.imageName())
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte(fmt.Sprintf(dockerfile, p.image)), 0644); err != nil {
+		return err
+	}
+	initdb := filepath.Join(dir, "initdb")
+	if err := os.MkdirAll(initdb, 0755); err != nil {
+		return err
+	}
+	for i, script := range p.initScripts {
+		contents, err := os.ReadFile(script)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(initdb, initScriptName(i, script)), contents, 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Implements docker.ProvidesContainerInstance
+func (p *PostgresContainer) AddContainerInstance(target docker.ContainerWorkspace) error {
+	p.BindAddr.Port = 5432
+	var err error
+	if len(p.initScripts) == 0 {
+		err = target.DeclarePrebuiltInstance(p.InstanceName, p.image, p.BindAddr)
+	} else {
+		err = target.DeclareLocalImage(p.InstanceName, p.imageName(), p.BindAddr)
+	}
+	if err != nil {
+		return err
+	}
+	// Set necessary environment variables
+	env := [][2]string{{"POSTGRES_USER", p.username}, {"POSTGRES_PASSWORD", p.password}, {"POSTGRES_DB", p.database}}
+	for _, kv := range env {
+		if err := target.SetEnvironmentVariable(p.InstanceName, kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *PostgresContainer) imageName() string {
+	return ir.CleanName(p.InstanceName)
+}
@@ -0,0 +1,178 @@
+// Package postgres provides a plugin to generate and include a PostgreSQL instance in a Blueprint application.
+//
+// The package provides a built-in postgres container that provides the server-side implementation
+// and a go-client for connecting to the server.
+//
+// The applications must use a backend.RelationalDB (runtime/core/backend) as the interface in the workflow.
+// The client accepts the ? placeholders used by the other RelationalDB implementations, so the same workflow
+// can be compared on postgres and mysql by changing only the wiring spec.
+//
+// # Wiring Spec Usage
+//
+//	catalogue_db := postgres.Container(spec, "catalogue_db")
+//
+// The container's image, credentials and init scripts, and the client's connection pool, can be configured
+// with [ContainerOptions], e.g.
+//
+//	catalogue_db := postgres.Container(spec, "catalogue_db", postgres.ContainerOptions{
+//		Image:        "postgres:16",
+//		InitScripts:  []string{"catalogue/seed.sql"},
+//		MaxOpenConns: 20,
+//		Migrations:   "catalogue",
+//	})
+package postgres
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/blueprint"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/address"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/pointer"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/ir"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/wiring"
+)
+
+// Options for a postgres [Container]
+type ContainerOptions struct {
+	// The docker image of the server.  Defaults to "postgres", the latest official image.
+	Image string
+
+	// The credentials of the server's superuser, which the clients use.  Default to "postgres" and "pass".
+	Username string
+	Password string
+
+	// Paths of .sql, .sql.gz or .sh files, relative to the working directory of the wiring spec, that
+	// are executed in order when the container starts with an empty data directory, e.g. to insert seed data.
+	// The scripts are copied into the container image.
+	InitScripts []string
+
+	// The maximum numbers of open and idle connections of each client, and the maximum time a connection
+	// is reused.  Zero values leave the defaults of Go's database/sql package.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+
+	// The name with which the migrations to apply to the database are registered with migrate.Register.
+	// The package that registers them must be part of the processes that contain the database's clients,
+	// e.g. because it is the package of a service that uses the database.
+	Migrations string
+}
+
+// Container generate the IRNodes for a postgres server docker container and the clients needed by the
+// generated application to communicate with the server.
+//
+// The server creates the database dbName when it first starts.  If options are provided with a non-empty
+// Migrations, the clients apply the migrations that haven't been applied when their process starts; the
+// process can also be started with the --migrate flag to roll back migrations or print their status.
+func Container(spec wiring.WiringSpec, dbName string, options ...ContainerOptions) string {
+	// The nodes that we are defining
+	ctrName := dbName + ".ctr"
+	clientName := dbName + ".client"
+	addrName := dbName + ".addr"
+
+	opts := ContainerOptions{Image: "postgres", Username: "postgres", Password: "pass"}
+	if len(options) > 0 {
+		opts = options[0]
+		if opts.Image == "" {
+			opts.Image = "postgres"
+		}
+		if opts.Username == "" {
+			opts.Username = "postgres"
+		}
+		if opts.Password == "" {
+			opts.Password = "pass"
+		}
+	}
+	if err := validate(dbName, opts); err != nil {
+		spec.AddError(err)
+		return dbName
+	}
+
+	// Define the postgres container
+	spec.Define(ctrName, &PostgresContainer{}, func(ns wiring.Namespace) (ir.IRNode, error) {
+		ctr, err := newPostgresContainer(ctrName, dbName, opts.Image, opts.Username, opts.Password, opts.InitScripts)
+		if err != nil {
+			return nil, err
+		}
+
+		err = address.Bind[*PostgresContainer](ns, addrName, ctr, &ctr.BindAddr)
+		return ctr, err
+	})
+
+	// Create a pointer to the postgres container
+	ptr := pointer.CreatePointer[*PostgresGoClient](spec, dbName, ctrName)
+
+	// Define the address that points to the postgres container
+	address.Define[*PostgresContainer](spec, addrName, ctrName)
+
+	// Add the address to the pointer
+	ptr.AddAddrModifier(spec, addrName)
+
+	// Define the postgres client and add it to the client side of the pointer
+	clientNext := ptr.AddSrcModifier(spec, clientName)
+	spec.Define(clientName, &PostgresGoClient{}, func(ns wiring.Namespace) (ir.IRNode, error) {
+		addr, err := address.Dial[*PostgresContainer](ns, clientNext)
+		if err != nil {
+			return nil, blueprint.Errorf("%s expected %s to be an address but encountered %s", clientName, clientNext, err)
+		}
+
+		args := clientArgs{
+			Username:        &ir.IRValue{Value: opts.Username},
+			Password:        &ir.IRValue{Value: opts.Password},
+			DBVal:           &ir.IRValue{Value: dbName},
+			MaxOpenConns:    &ir.IRValue{Value: optionalInt(opts.MaxOpenConns)},
+			MaxIdleConns:    &ir.IRValue{Value: optionalInt(opts.MaxIdleConns)},
+			ConnMaxLifetime: &ir.IRValue{Value: ""},
+			Migrations:      &ir.IRValue{Value: opts.Migrations},
+		}
+		if opts.ConnMaxLifetime != 0 {
+			args.ConnMaxLifetime.Value = opts.ConnMaxLifetime.String()
+		}
+		return newPostgresGoClient(clientName, addr.Dial, args)
+	})
+
+	return dbName
+}
+
+// Returns an error if the options can't be used for the database dbName
+func validate(dbName string, opts ContainerOptions) error {
+	for option, value := range map[string]string{"image": opts.Image, "username": opts.Username, "password": opts.Password, "migrations name": opts.Migrations} {
+		if strings.ContainsAny(value, "\"\\\n") {
+			return blueprint.Errorf("invalid %v %q for postgres container %v", option, value, dbName)
+		}
+	}
+	if opts.MaxOpenConns < 0 || opts.MaxIdleConns < 0 || opts.ConnMaxLifetime < 0 {
+		return blueprint.Errorf("invalid connection pool settings for postgres container %v", dbName)
+	}
+	for _, script := range opts.InitScripts {
+		if !strings.HasSuffix(script, ".sql") && !strings.HasSuffix(script, ".sql.gz") && !strings.HasSuffix(script, ".sh") {
+			return blueprint.Errorf("init script %v for postgres container %v is not a .sql, .sql.gz or .sh file", script, dbName)
+		}
+		if info, err := os.Stat(script); err != nil || info.IsDir() {
+			return blueprint.Errorf("init script %v for postgres container %v is not a file", script, dbName)
+		}
+		if strings.ContainsAny(filepath.Base(script), " \"'\\\n") {
+			return blueprint.Errorf("invalid init script name %q for postgres container %v", script, dbName)
+		}
+	}
+	return nil
+}
+
+// Returns n as a string, or the empty string if n is zero
+func optionalInt(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// Returns the name of the i'th init script in the container, which is prefixed so that the scripts
+// are executed in the order they were given
+func initScriptName(i int, script string) string {
+	return fmt.Sprintf("%03d_%s", i, filepath.Base(script))
+}
@@ -17,19 +17,23 @@ import (
 type RabbitmqGoClient struct {
 	golang.Service
 	backend.Queue
-	InstanceName string
-	QueueName    *ir.IRValue
-	Addr         *address.DialConfig
-	Spec         *workflowspec.Service
+	InstanceName      string
+	QueueName         *ir.IRValue
+	VisibilityTimeout *ir.IRValue
+	MaxDeliveries     *ir.IRValue
+	Addr              *address.DialConfig
+	Spec              *workflowspec.Service
 }
 
-func newRabbitmqGoClient(name string, addr *address.DialConfig, queue_name *ir.IRValue) (*RabbitmqGoClient, error) {
+func newRabbitmqGoClient(name string, addr *address.DialConfig, queue_name *ir.IRValue, visibility_timeout *ir.IRValue, max_deliveries *ir.IRValue) (*RabbitmqGoClient, error) {
 	spec, err := workflowspec.GetService[rabbitmq.RabbitMQ]()
 	client := &RabbitmqGoClient{
-		InstanceName: name,
-		Addr:         addr,
-		QueueName:    queue_name,
-		Spec:         spec,
+		InstanceName:      name,
+		Addr:              addr,
+		QueueName:         queue_name,
+		VisibilityTimeout: visibility_timeout,
+		MaxDeliveries:     max_deliveries,
+		Spec:              spec,
 	}
 	return client, err
 }
@@ -66,7 +70,7 @@ func (n *RabbitmqGoClient) AddInstantiation(builder golang.NamespaceBuilder) err
 	}
 	slog.Info(fmt.Sprintf("Instantiating RabbitmqClient %v in %v/%v", n.InstanceName, builder.Info().Package.PackageName, builder.Info().FileName))
 
-	return builder.DeclareConstructor(n.InstanceName, n.Spec.Constructor.AsConstructor(), []ir.IRNode{n.Addr, n.QueueName})
+	return builder.DeclareConstructor(n.InstanceName, n.Spec.Constructor.AsConstructor(), []ir.IRNode{n.Addr, n.QueueName, n.VisibilityTimeout, n.MaxDeliveries})
 }
 
 func (n *RabbitmqGoClient) ImplementsGolangNode()    {}
@@ -4,9 +4,21 @@
 // and a go-client for connecting to the client.
 //
 // The applications must use a backend.Queue (runtime/core/backend) as the interface in the workflow.
+//
+// Items popped with PopDelivery that aren't acknowledged are redelivered after a visibility timeout, and
+// are moved to a dead-letter queue named after the queue with a ".dlq" suffix once they have been delivered
+// too many times.  Both can be configured with [ContainerOptions], e.g.
+//
+//	shipqueue := rabbitmq.Container(spec, "shipqueue", "shipping", rabbitmq.ContainerOptions{
+//		VisibilityTimeout: time.Minute,
+//		MaxDeliveries:     10,
+//	})
 package rabbitmq
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/blueprint"
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/address"
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/pointer"
@@ -14,14 +26,34 @@ import (
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/wiring"
 )
 
+// Options for a rabbitmq [Container]
+type ContainerOptions struct {
+	// The time after which items popped with PopDelivery that haven't been acknowledged are redelivered.
+	// Defaults to 30 seconds.
+	VisibilityTimeout time.Duration
+
+	// The number of times an item is delivered before it is moved to the dead-letter queue.  Defaults to 5.
+	// A negative value means items are redelivered until they are acknowledged.
+	MaxDeliveries int
+}
+
 // Container generate the IRNodes for a mysql server docker container that uses the latest mysql/mysql image
 // and the clients needed by the generated application to communicate with the server.
-func Container(spec wiring.WiringSpec, name string, queue_name string) string {
+func Container(spec wiring.WiringSpec, name string, queue_name string, options ...ContainerOptions) string {
 	// The nodes that we are defining
 	ctrName := name + ".ctr"
 	clientName := name + ".client"
 	addrName := name + ".addr"
 
+	var opts ContainerOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	if opts.VisibilityTimeout < 0 {
+		spec.AddError(blueprint.Errorf("invalid visibility timeout %v for rabbitmq queue %v", opts.VisibilityTimeout, name))
+		return name
+	}
+
 	// Define the rabbitmq container
 	spec.Define(ctrName, &RabbitmqContainer{}, func(ns wiring.Namespace) (ir.IRNode, error) {
 		ctr, err := newRabbitmqContainer(ctrName)
@@ -49,8 +81,16 @@ func Container(spec wiring.WiringSpec, name string, queue_name string) string {
 		}
 
 		queue_val := &ir.IRValue{Value: queue_name}
+		timeout_val := &ir.IRValue{}
+		if opts.VisibilityTimeout > 0 {
+			timeout_val.Value = opts.VisibilityTimeout.String()
+		}
+		deliveries_val := &ir.IRValue{}
+		if opts.MaxDeliveries != 0 {
+			deliveries_val.Value = strconv.Itoa(max(opts.MaxDeliveries, 0))
+		}
 
-		return newRabbitmqGoClient(clientName, addr.Dial, queue_val)
+		return newRabbitmqGoClient(clientName, addr.Dial, queue_val, timeout_val, deliveries_val)
 	})
 
 	return name
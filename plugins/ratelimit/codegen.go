@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/blueprint-uservices/blueprint/plugins/golang"
+	"github.com/blueprint-uservices/blueprint/plugins/golang/gocode"
+	"github.com/blueprint-uservices/blueprint/plugins/golang/gogen"
+	"golang.org/x/exp/slog"
+)
+
+// code generation function called from the ir.go file.
+func generateServerWrapper(builder golang.ModuleBuilder, wrapped *gocode.ServiceInterface, outputPackage string) error {
+	pkg, err := builder.CreatePackage(outputPackage)
+	if err != nil {
+		return err
+	}
+
+	server := serverArgs{
+		Package: pkg,
+		Service: wrapped,
+		Name:    wrapped.BaseName + "_RateLimiter",
+		Imports: gogen.NewImports(pkg.Name),
+	}
+
+	server.Imports.AddPackages("context", "github.com/blueprint-uservices/blueprint/runtime/plugins/ratelimit")
+	slog.Info(fmt.Sprintf("Generating %v/%v", server.Package.PackageName, wrapped.BaseName+"_RateLimiter"))
+	outputFile := filepath.Join(server.Package.Path, wrapped.BaseName+"_RateLimiter.go")
+
+	return gogen.ExecuteTemplateToFile("RateLimiter", serverTemplate, server, outputFile)
+}
+
+type serverArgs struct {
+	Package golang.PackageInfo
+	Service *gocode.ServiceInterface
+	Name    string
+	Imports *gogen.Imports
+}
+
+var serverTemplate = `// Blueprint: Auto-generated by RateLimiter Plugin
+package {{.Package.ShortName}}
+
+{{.Imports}}
+
+type {{.Name}} struct {
+	Server {{.Imports.NameOf .Service.UserType}}
+	Limiter *ratelimit.Limiter
+}
+
+func New_{{.Name}} (ctx context.Context, server {{.Imports.NameOf .Service.UserType}}, config string) (*{{.Name}}, error) {
+	handler := &{{.Name}}{}
+	handler.Server = server
+	limits, err := ratelimit.ParseConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	handler.Limiter = ratelimit.NewLimiter(limits)
+	return handler, nil
+}
+
+{{$service := .Service.Name -}}
+{{$receiver := .Name -}}
+{{ range $_, $f := .Service.Methods }}
+func (server *{{$receiver}}) {{$f.Name -}} ({{ArgVarsAndTypes $f "ctx context.Context"}}) ({{RetVarsAndTypes $f "err error"}}) {
+	done, err := server.Limiter.Admit("{{$f.Name}}")
+	if err != nil {
+		return
+	}
+	defer func() { done(err) }()
+	return server.Server.{{$f.Name}}({{ArgVars $f "ctx"}})
+}
+{{end}}
+`
@@ -0,0 +1,172 @@
+package ratelimit
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/blueprint"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/service"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/ir"
+	"github.com/blueprint-uservices/blueprint/plugins/golang"
+	"github.com/blueprint-uservices/blueprint/plugins/golang/gocode"
+)
+
+// Blueprint IR Node representing a server side rate limiter
+type RateLimiterWrapper struct {
+	golang.Service
+	golang.GeneratesFuncs
+	golang.Instantiable
+
+	InstanceName  string
+	Wrapped       golang.Service
+	outputPackage string
+	Limits        Limits
+	ConfigValue   *ir.IRValue
+}
+
+func newRateLimiterWrapper(name string, server ir.IRNode, limits Limits) (*RateLimiterWrapper, error) {
+	serverNode, is_callable := server.(golang.Service)
+	if !is_callable {
+		return nil, blueprint.Errorf("rate limiter wrapper requires %s to be a golang service but got %s", server.Name(), reflect.TypeOf(server).String())
+	}
+
+	config, err := limits.config()
+	if err != nil {
+		return nil, blueprint.Errorf("invalid rate limits for %s: %s", name, err.Error())
+	}
+
+	node := &RateLimiterWrapper{}
+	node.InstanceName = name
+	node.Wrapped = serverNode
+	node.outputPackage = "ratelimiter"
+	node.Limits = limits
+	node.ConfigValue = &ir.IRValue{Value: config}
+	return node, nil
+}
+
+// Validates the limits and returns them in the key=value form expected by the runtime
+func (limits Limits) config() (string, error) {
+	var entries []string
+	if limits.Rate < 0 {
+		return "", fmt.Errorf("rate of %v must not be negative", limits.Rate)
+	}
+	if limits.Rate > 0 {
+		entries = append(entries, "rate="+strconv.FormatFloat(limits.Rate, 'g', -1, 64))
+	}
+	if limits.Burst > 0 {
+		entries = append(entries, fmt.Sprintf("burst=%v", limits.Burst))
+	}
+	var methods []string
+	for method := range limits.MethodRates {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		if limits.MethodRates[method] < 0 || strings.ContainsAny(method, "=,") {
+			return "", fmt.Errorf("invalid rate %v for method %q", limits.MethodRates[method], method)
+		}
+		entries = append(entries, "rate."+method+"="+strconv.FormatFloat(limits.MethodRates[method], 'g', -1, 64))
+	}
+	if limits.Concurrency > 0 {
+		entries = append(entries, fmt.Sprintf("concurrency=%v", limits.Concurrency))
+	}
+	if limits.MinConcurrency > 0 {
+		entries = append(entries, fmt.Sprintf("min_concurrency=%v", limits.MinConcurrency))
+	}
+	if limits.MaxConcurrency > 0 {
+		entries = append(entries, fmt.Sprintf("max_concurrency=%v", limits.MaxConcurrency))
+	}
+	switch limits.Shedding {
+	case "", "none":
+	case "aimd", "gradient":
+		if limits.Concurrency <= 0 {
+			return "", fmt.Errorf("%v shedding requires a concurrency limit", limits.Shedding)
+		}
+		entries = append(entries, "shedding="+limits.Shedding)
+	default:
+		return "", fmt.Errorf("unknown shedding strategy %q", limits.Shedding)
+	}
+	if limits.TargetLatency != "" {
+		if _, err := time.ParseDuration(limits.TargetLatency); err != nil {
+			return "", err
+		}
+		entries = append(entries, "target="+limits.TargetLatency)
+	}
+	return strings.Join(entries, ","), nil
+}
+
+// Implements [ir.IRNode]
+func (node *RateLimiterWrapper) ImplementsGolangNode() {}
+
+// Implements [golang.Service]
+func (node *RateLimiterWrapper) ImplementsGolangService() {}
+
+// Implements [ir.IRNode]
+func (node *RateLimiterWrapper) Name() string {
+	return node.InstanceName
+}
+
+// Implements [ir.IRNode]
+func (node *RateLimiterWrapper) String() string {
+	return node.Name() + " = RateLimiter(" + node.Wrapped.Name() + ", " + node.ConfigValue.String() + ")"
+}
+
+// Implements [golang.Service]
+func (node *RateLimiterWrapper) AddInterfaces(builder golang.ModuleBuilder) error {
+	return node.Wrapped.AddInterfaces(builder)
+}
+
+// Implements [golang.Service]
+func (node *RateLimiterWrapper) GetInterface(ctx ir.BuildContext) (service.ServiceInterface, error) {
+	return node.Wrapped.GetInterface(ctx)
+}
+
+// Implements [golang.GeneratesFuncs]
+func (node *RateLimiterWrapper) GenerateFuncs(builder golang.ModuleBuilder) error {
+	if builder.Visited(node.InstanceName + ".generateFuncs") {
+		return nil
+	}
+
+	iface, err := golang.GetGoInterface(builder, node)
+	if err != nil {
+		return err
+	}
+
+	for method := range node.Limits.MethodRates {
+		if _, exists := iface.Methods[method]; !exists {
+			return blueprint.Errorf("rate limiter %s limits method %s, which %s does not have", node.InstanceName, method, iface.Name)
+		}
+	}
+
+	return generateServerWrapper(builder, iface, node.outputPackage)
+}
+
+// Implements golang.Instantiable
+func (node *RateLimiterWrapper) AddInstantiation(builder golang.NamespaceBuilder) error {
+	if builder.Visited(node.InstanceName) {
+		return nil
+	}
+
+	iface, err := golang.GetGoInterface(builder, node.Wrapped)
+	if err != nil {
+		return err
+	}
+
+	constructor := &gocode.Constructor{
+		Package: builder.Module().Info().Name + "/" + node.outputPackage,
+		Func: gocode.Func{
+			Name: fmt.Sprintf("New_%v_RateLimiter", iface.BaseName),
+			Arguments: []gocode.Variable{
+				{Name: "ctx", Type: &gocode.UserType{Package: "context", Name: "Context"}},
+				{Name: "server", Type: iface},
+				{Name: "config", Type: &gocode.BasicType{Name: "string"}},
+			},
+		},
+	}
+
+	return builder.DeclareConstructor(node.InstanceName, constructor, []ir.IRNode{node.Wrapped, node.ConfigValue})
+}
@@ -0,0 +1,86 @@
+// Package ratelimit provides a Blueprint modifier for the server side of service calls.
+//
+// The plugin wraps the server side of a service with admission control.  Each method has a token bucket
+// that limits the rate of calls, and optionally the number of calls in flight is bounded by a concurrency
+// limit.  The concurrency limit can be fixed, or adapted to observed latencies using AIMD or gradient
+// load shedding.  Calls that are not admitted fail immediately with an error wrapping the runtime's
+// ratelimit.ErrRejected, so that callers and experiments can distinguish shed load from other failures.
+//
+// # Wiring Spec Usage
+//
+//	ratelimit.Add(spec, "my_service", ratelimit.Limits{
+//		Rate:          100,
+//		MethodRates:   map[string]float64{"ComposePost": 20},
+//		Concurrency:   50,
+//		Shedding:      "aimd",
+//		TargetLatency: "50ms",
+//	})
+//
+// # Artifacts Generated
+//
+// During compilation, the plugin generates a server-side wrapper class.  The plugin also utilizes
+// some code in the [runtime/plugins/ratelimit] package.
+//
+// [runtime/plugins/ratelimit]: https://github.com/Blueprint-uServices/blueprint/tree/main/runtime/plugins/ratelimit
+package ratelimit
+
+import (
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/blueprint"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/pointer"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/ir"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/wiring"
+	"github.com/blueprint-uservices/blueprint/plugins/golang"
+	"golang.org/x/exp/slog"
+)
+
+// The admission control applied by [Add]
+type Limits struct {
+	// Rate, in calls per second, at which each method's token bucket is refilled.  Zero means unlimited.
+	Rate float64
+
+	// Capacity of each method's token bucket.  If zero, defaults to the rate rounded up.
+	Burst int64
+
+	// Per-method overrides of Rate
+	MethodRates map[string]float64
+
+	// Initial concurrency limit, i.e. the maximum number of calls in flight.  Zero means no concurrency limit.
+	Concurrency int64
+
+	// Bounds of an adaptive concurrency limit.  Default to 1 and 10 times Concurrency.
+	MinConcurrency int64
+	MaxConcurrency int64
+
+	// How the concurrency limit adapts; one of "none", "aimd" or "gradient".  Defaults to "none".
+	Shedding string
+
+	// For "aimd" shedding, calls slower than TargetLatency, e.g. "50ms", decrease the concurrency limit
+	TargetLatency string
+}
+
+// Adds rate limiting and load shedding to the server side of the specified service.
+// Uses a [blueprint.WiringSpec].
+// Modifies the given service such that calls exceeding the provided `limits` are rejected.
+// Usage:
+//
+//	Add(spec, "my_service", ratelimit.Limits{Rate: 100, Burst: 10})
+func Add(spec wiring.WiringSpec, serviceName string, limits Limits) {
+	serverWrapper := serviceName + ".server.ratelimit"
+	ptr := pointer.GetPointer(spec, serviceName)
+	if ptr == nil {
+		slog.Error("Unable to add rate limiting to " + serviceName + " as it is not a pointer")
+		return
+	}
+
+	serverNext := ptr.AddDstModifier(spec, serverWrapper)
+
+	spec.Define(serverWrapper, &RateLimiterWrapper{}, func(ns wiring.Namespace) (ir.IRNode, error) {
+		var wrapped golang.Service
+
+		if err := ns.Get(serverNext, &wrapped); err != nil {
+			return nil, blueprint.Errorf("RateLimiter %s expected %s to be a golang.Service, but encountered %s", serverWrapper, serverNext, err)
+		}
+
+		return newRateLimiterWrapper(serverWrapper, wrapped, limits)
+	})
+}
@@ -0,0 +1,70 @@
+package replicas
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/blueprint-uservices/blueprint/plugins/golang"
+	"github.com/blueprint-uservices/blueprint/plugins/golang/gocode"
+	"github.com/blueprint-uservices/blueprint/plugins/golang/gogen"
+	"golang.org/x/exp/slog"
+)
+
+// code generation function called from the ir.go file.
+func generateClient(builder golang.ModuleBuilder, wrapped *gocode.ServiceInterface, outputPackage string) error {
+	pkg, err := builder.CreatePackage(outputPackage)
+	if err != nil {
+		return err
+	}
+
+	client := clientArgs{
+		Package: pkg,
+		Service: wrapped,
+		Name:    wrapped.BaseName + "_LoadBalancer",
+		Imports: gogen.NewImports(pkg.Name),
+	}
+
+	client.Imports.AddPackages("context", "github.com/blueprint-uservices/blueprint/runtime/plugins/replicas")
+
+	slog.Info(fmt.Sprintf("Generating %v/%v", client.Package.PackageName, client.Name))
+	outputFile := filepath.Join(client.Package.Path, client.Name+".go")
+	return gogen.ExecuteTemplateToFile("Replicas", clientTemplate, client, outputFile)
+}
+
+type clientArgs struct {
+	Package golang.PackageInfo
+	Service *gocode.ServiceInterface
+	Name    string
+	Imports *gogen.Imports
+}
+
+var clientTemplate = `// Blueprint: Auto-generated by Replicas Plugin
+package {{.Package.ShortName}}
+
+{{.Imports}}
+
+type {{.Name}} struct {
+	Replicas []{{.Imports.NameOf .Service.UserType}}
+	balancer *replicas.Balancer
+}
+
+func New_{{.Name}} (ctx context.Context, policyName string, clients ...{{.Imports.NameOf .Service.UserType}}) (*{{.Name}}, error) {
+	policy, err := replicas.ParsePolicy(policyName)
+	if err != nil {
+		return nil, err
+	}
+	handler := &{{.Name}}{}
+	handler.Replicas = clients
+	handler.balancer, err = replicas.NewBalancer(policy, len(clients))
+	return handler, err
+}
+
+{{$receiver := .Name -}}
+{{ range $_, $f := .Service.Methods }}
+func (client *{{$receiver}}) {{$f.Name -}} ({{ArgVarsAndTypes $f "ctx context.Context"}}) ({{RetVarsAndTypes $f "err error"}}) {
+	replica, done := client.balancer.Pick()
+	defer done()
+	return client.Replicas[replica].{{$f.Name}}({{ArgVars $f "ctx"}})
+}
+{{end}}
+`
@@ -0,0 +1,137 @@
+package replicas
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/blueprint"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/service"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/ir"
+	"github.com/blueprint-uservices/blueprint/plugins/golang"
+	"github.com/blueprint-uservices/blueprint/plugins/golang/gocode"
+)
+
+// Blueprint IR node representing a client that load balances calls across the replicas of a service
+type LoadBalancer struct {
+	golang.Service
+	golang.GeneratesFuncs
+	golang.Instantiable
+
+	InstanceName string
+	Replicas     []golang.Service
+	Policy       string
+
+	outputPackage string
+}
+
+// Blueprint IR metadata node recording the replicas of a service
+type ReplicaSet struct {
+	ir.IRMetadata
+
+	SetName  string
+	Replicas []string
+}
+
+// Implements ir.IRNode
+func (set *ReplicaSet) Name() string {
+	return set.SetName
+}
+
+// Implements ir.IRNode
+func (set *ReplicaSet) String() string {
+	return set.SetName + " = ReplicaSet(" + strings.Join(set.Replicas, ", ") + ")"
+}
+
+func newLoadBalancer(name string, replicas []golang.Service, policy string) (*LoadBalancer, error) {
+	if len(replicas) == 0 {
+		return nil, blueprint.Errorf("load balancer %s requires at least one replica", name)
+	}
+	switch policy {
+	case "round_robin", "random", "least_outstanding", "power_of_two":
+	default:
+		return nil, blueprint.Errorf("unknown load balancing policy %v for %s", policy, name)
+	}
+
+	node := &LoadBalancer{}
+	node.InstanceName = name
+	node.Replicas = replicas
+	node.Policy = policy
+	node.outputPackage = "replicas"
+	return node, nil
+}
+
+func (node *LoadBalancer) ImplementsGolangNode() {}
+
+// Implements ir.IRNode
+func (node *LoadBalancer) Name() string {
+	return node.InstanceName
+}
+
+// Implements ir.IRNode
+func (node *LoadBalancer) String() string {
+	var replicas []string
+	for _, replica := range node.Replicas {
+		replicas = append(replicas, replica.Name())
+	}
+	return fmt.Sprintf("%v = LoadBalancer(%v, %v)", node.InstanceName, node.Policy, strings.Join(replicas, ", "))
+}
+
+// Implements golang.ProvidesInterface
+func (node *LoadBalancer) AddInterfaces(builder golang.ModuleBuilder) error {
+	for _, replica := range node.Replicas {
+		if err := replica.AddInterfaces(builder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Implements service.ServiceNode
+func (node *LoadBalancer) GetInterface(ctx ir.BuildContext) (service.ServiceInterface, error) {
+	return node.Replicas[0].GetInterface(ctx)
+}
+
+// Implements golang.GeneratesFuncs
+func (node *LoadBalancer) GenerateFuncs(builder golang.ModuleBuilder) error {
+	if builder.Visited(node.InstanceName + ".generateFuncs") {
+		return nil
+	}
+
+	iface, err := golang.GetGoInterface(builder, node)
+	if err != nil {
+		return err
+	}
+
+	return generateClient(builder, iface, node.outputPackage)
+}
+
+// Implements golang.Instantiable
+func (node *LoadBalancer) AddInstantiation(builder golang.NamespaceBuilder) error {
+	if builder.Visited(node.InstanceName) {
+		return nil
+	}
+
+	iface, err := golang.GetGoInterface(builder, node.Replicas[0])
+	if err != nil {
+		return err
+	}
+
+	// The generated constructor is variadic in its replicas
+	constructor := &gocode.Constructor{
+		Package: builder.Module().Info().Name + "/" + node.outputPackage,
+		Func: gocode.Func{
+			Name: fmt.Sprintf("New_%v_LoadBalancer", iface.BaseName),
+			Arguments: []gocode.Variable{
+				{Name: "ctx", Type: &gocode.UserType{Package: "context", Name: "Context"}},
+				{Name: "policy", Type: &gocode.BasicType{Name: "string"}},
+			},
+		},
+	}
+	args := []ir.IRNode{&ir.IRValue{Value: node.Policy}}
+	for i, replica := range node.Replicas {
+		constructor.Arguments = append(constructor.Arguments, gocode.Variable{Name: fmt.Sprintf("replica%d", i), Type: iface})
+		args = append(args, replica)
+	}
+
+	return builder.DeclareConstructor(node.InstanceName, constructor, args)
+}
@@ -0,0 +1,131 @@
+// Package replicas is a plugin for deploying multiple replicas of a service, with clients that
+// load balance calls across the replicas.
+//
+// # Wiring Spec Usage
+//
+// To deploy 3 replicas of a service, each in its own container and reachable over gRPC:
+//
+//	replicas.Deploy(spec, "user_service", 3)
+//
+// The load balancing policy can be one of "round_robin" (the default), "random", "least_outstanding"
+// or "power_of_two":
+//
+//	replicas.DeployWithPolicy(spec, "user_service", 3, "power_of_two")
+//
+// To deploy the replicas in some other way, use [Replicate], which returns the names of the
+// replica services, then deploy each of them as usual, e.g.
+//
+//	for _, replica := range replicas.Replicate(spec, "user_service", 3, "random") {
+//		http.Deploy(spec, replica)
+//		goproc.Deploy(spec, replica)
+//	}
+//
+// serviceName must be an application-level service that has not yet been deployed over RPC or to
+// a process.  Server-side modifiers applied to serviceName before replicating it are applied to
+// every replica.  Client-side modifiers applied to serviceName before replicating it wrap the load
+// balancer, e.g. a retrier may retry a failed call on a different replica.  Client-side modifiers
+// should not be applied to serviceName after replicating it.
+//
+// # Description
+//
+// Each replica is a separate instance of the service, with its own address.  Replicas share any
+// backends, such as databases, that are reachable from all of them, but each replica has its own
+// instance of any in-process dependencies.
+//
+// # Artifacts Generated
+//
+// During compilation, the plugin generates a load balancing client that wraps a client to each
+// replica.  The generated client uses the code in the [runtime/plugins/replicas] package.
+//
+// [runtime/plugins/replicas]: https://github.com/Blueprint-uServices/blueprint/tree/main/runtime/plugins/replicas
+package replicas
+
+import (
+	"fmt"
+
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/blueprint"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/pointer"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/ir"
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/wiring"
+	"github.com/blueprint-uservices/blueprint/plugins/golang"
+	"github.com/blueprint-uservices/blueprint/plugins/goproc"
+	"github.com/blueprint-uservices/blueprint/plugins/grpc"
+	"github.com/blueprint-uservices/blueprint/plugins/linuxcontainer"
+	"golang.org/x/exp/slog"
+)
+
+// Deploy can be used by wiring specs to deploy n replicas of serviceName, with clients that
+// load balance calls across the replicas in round-robin order.
+//
+// Each replica is deployed over gRPC, in its own process and container.
+//
+// Returns the names of the replicas' containers.
+func Deploy(spec wiring.WiringSpec, serviceName string, n int) []string {
+	return DeployWithPolicy(spec, serviceName, n, "round_robin")
+}
+
+// DeployWithPolicy is like [Deploy] but uses the specified load balancing policy, one of
+// "round_robin", "random", "least_outstanding" or "power_of_two".
+//
+// Returns the names of the replicas' containers.
+func DeployWithPolicy(spec wiring.WiringSpec, serviceName string, n int, policy string) []string {
+	var containers []string
+	for _, replica := range Replicate(spec, serviceName, n, policy) {
+		grpc.Deploy(spec, replica)
+		goproc.Deploy(spec, replica)
+		containers = append(containers, linuxcontainer.Deploy(spec, replica))
+	}
+	return containers
+}
+
+// Replicate can be used by wiring specs to define n replicas of serviceName, with clients that
+// load balance calls across the replicas using the specified policy.
+//
+// The replicas are named serviceName_replica0, serviceName_replica1, and so on.  They are
+// application-level services that must subsequently be deployed, e.g. over RPC and to processes.
+//
+// Returns the names of the replicas.
+func Replicate(spec wiring.WiringSpec, serviceName string, n int, policy string) []string {
+	lbName := serviceName + ".client.lb"
+	replicaSetName := serviceName + ".replicas"
+
+	ptr := pointer.GetPointer(spec, serviceName)
+	if ptr == nil {
+		slog.Error("Unable to replicate " + serviceName + " as it is not a pointer")
+		return nil
+	}
+
+	// Each replica is a pointer to the server side of serviceName, which will be instantiated
+	// once per replica
+	ptr.DisableUniqueness(spec)
+	dst := ptr.Dst()
+	var replicaNames []string
+	for i := 0; i < n; i++ {
+		replicaName := fmt.Sprintf("%s_replica%d", serviceName, i)
+		pointer.CreatePointer[*LoadBalancer](spec, replicaName, dst, pointer.PointerOpts{})
+		replicaNames = append(replicaNames, replicaName)
+	}
+
+	// Clients of serviceName call the replicas through a load balancer, rather than the next client modifier
+	ptr.AddSrcModifier(spec, lbName)
+	spec.Define(lbName, &LoadBalancer{}, func(namespace wiring.Namespace) (ir.IRNode, error) {
+		var replicas []golang.Service
+		for _, replicaName := range replicaNames {
+			var replica golang.Service
+			if err := namespace.Get(replicaName, &replica); err != nil {
+				return nil, blueprint.Errorf("load balancer %s expected %s to be a golang.Service, but encountered %s", lbName, replicaName, err)
+			}
+			replicas = append(replicas, replica)
+		}
+		return newLoadBalancer(lbName, replicas, policy)
+	})
+
+	// The server side of serviceName is only instantiated by the replicas, so clients of
+	// serviceName must not instantiate it
+	ptr.AddDstModifier(spec, replicaSetName)
+	spec.Define(replicaSetName, &ir.ApplicationNode{}, func(namespace wiring.Namespace) (ir.IRNode, error) {
+		return &ReplicaSet{SetName: replicaSetName, Replicas: replicaNames}, nil
+	})
+
+	return replicaNames
+}
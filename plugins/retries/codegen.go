@@ -11,7 +11,7 @@ import (
 )
 
 // code generation function called from the ir.go file.
-func generateClient(builder golang.ModuleBuilder, wrapped *gocode.ServiceInterface, outputPackage string, Max int64) error {
+func generateClient(builder golang.ModuleBuilder, wrapped *gocode.ServiceInterface, outputPackage string) error {
 	pkg, err := builder.CreatePackage(outputPackage)
 	if err != nil {
 		return err
@@ -21,11 +21,10 @@ func generateClient(builder golang.ModuleBuilder, wrapped *gocode.ServiceInterfa
 		Package: pkg,
 		Service: wrapped,
 		Name:    wrapped.BaseName + "_RetrierClient",
-		Max:     Max,
 		Imports: gogen.NewImports(pkg.Name),
 	}
 
-	client.Imports.AddPackages("context")
+	client.Imports.AddPackages("context", "github.com/blueprint-uservices/blueprint/runtime/plugins/retries")
 
 	slog.Info(fmt.Sprintf("Generating %v/%v", client.Package.PackageName, wrapped.BaseName+"_RetrierClient"))
 	outputFile := filepath.Join(client.Package.Path, wrapped.BaseName+"_RetrierClient.go")
@@ -36,7 +35,6 @@ type clientArgs struct {
 	Package golang.PackageInfo
 	Service *gocode.ServiceInterface
 	Name    string
-	Max     int64
 	Imports *gogen.Imports
 }
 
@@ -48,12 +46,18 @@ package {{.Package.ShortName}}
 type {{.Name}} struct {
 	Client {{.Imports.NameOf .Service.UserType}}
 	MaxTries int
+	retrier *retries.Retrier
 }
 
-func New_{{.Name}} (ctx context.Context, client {{.Imports.NameOf .Service.UserType}}) (*{{.Name}}, error) {
+func New_{{.Name}} (ctx context.Context, client {{.Imports.NameOf .Service.UserType}}, max_tries string, initial_backoff string, multiplier string, max_backoff string, jitter string, budget string, budget_window string, retryable string) (*{{.Name}}, error) {
+	policy, err := retries.ParsePolicy(max_tries, initial_backoff, multiplier, max_backoff, jitter, budget, budget_window, retryable)
+	if err != nil {
+		return nil, err
+	}
 	handler := &{{.Name}}{}
 	handler.Client = client
-	handler.MaxTries = {{.Max}}
+	handler.MaxTries = policy.MaxTries
+	handler.retrier = retries.NewRetrier(policy)
 	return handler, nil
 }
 
@@ -61,13 +65,13 @@ func New_{{.Name}} (ctx context.Context, client {{.Imports.NameOf .Service.UserT
 {{$receiver := .Name -}}
 {{ range $_, $f := .Service.Methods }}
 func (client *{{$receiver}}) {{$f.Name -}} ({{ArgVarsAndTypes $f "ctx context.Context"}}) ({{RetVarsAndTypes $f "err error"}}) {
-	for i := 0; i < client.MaxTries; i++ {
+	attempt := client.retrier.Begin()
+	for {
 		{{RetVars $f "err"}} = client.Client.{{$f.Name}}({{ArgVars $f "ctx"}})
-		if err == nil {
+		if !attempt.Retry(ctx, err) {
 			return
 		}
 	}
-	return
 }
 {{end}}
 `
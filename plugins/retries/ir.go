@@ -3,6 +3,8 @@ package retries
 import (
 	"fmt"
 	"reflect"
+	"strconv"
+	"time"
 
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/blueprint"
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/service"
@@ -21,7 +23,7 @@ type RetrierClient struct {
 	Wrapped      golang.Service
 
 	outputPackage string
-	Max           int64
+	Args          []ir.IRNode // max_tries followed by the fields of the retry Policy, as strings
 }
 
 func (node *RetrierClient) ImplementsGolangNode() {}
@@ -34,21 +36,59 @@ func (node *RetrierClient) String() string {
 	return node.Name() + " = Retrier(" + node.Wrapped.Name() + ")"
 }
 
-func newRetrierClient(name string, server ir.IRNode, max_clients int64) (*RetrierClient, error) {
+func newRetrierClient(name string, server ir.IRNode, max_clients int64, policy Policy) (*RetrierClient, error) {
 	serverNode, is_callable := server.(golang.Service)
 	if !is_callable {
 		return nil, blueprint.Errorf("retrier server wrapper requires %s to be a golang service but got %s", server.Name(), reflect.TypeOf(server).String())
 	}
+	if err := policy.validate(); err != nil {
+		return nil, blueprint.Errorf("invalid retry policy for %s: %s", name, err.Error())
+	}
 
 	node := &RetrierClient{}
 	node.InstanceName = name
 	node.Wrapped = serverNode
 	node.outputPackage = "retries"
-	node.Max = max_clients
+	node.Args = []ir.IRNode{
+		&ir.IRValue{Value: strconv.FormatInt(max_clients, 10)},
+		&ir.IRValue{Value: policy.InitialBackoff},
+		&ir.IRValue{Value: strconv.FormatFloat(policy.Multiplier, 'g', -1, 64)},
+		&ir.IRValue{Value: policy.MaxBackoff},
+		&ir.IRValue{Value: policy.Jitter},
+		&ir.IRValue{Value: strconv.FormatInt(policy.Budget, 10)},
+		&ir.IRValue{Value: policy.BudgetWindow},
+		&ir.IRValue{Value: policy.Retryable},
+	}
 
 	return node, nil
 }
 
+// Checks that durations parse and that named strategies are known to the runtime
+func (policy Policy) validate() error {
+	for _, d := range []string{policy.InitialBackoff, policy.MaxBackoff, policy.BudgetWindow} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			return err
+		}
+	}
+	switch policy.Jitter {
+	case "", "none", "full", "decorrelated":
+	default:
+		return fmt.Errorf("unknown jitter strategy %v", policy.Jitter)
+	}
+	switch policy.Retryable {
+	case "", "transient", "any":
+	default:
+		return fmt.Errorf("unknown retry predicate %v", policy.Retryable)
+	}
+	if policy.Budget > 0 && policy.BudgetWindow == "" {
+		return fmt.Errorf("a retry budget of %v requires a budget window", policy.Budget)
+	}
+	return nil
+}
+
 func (node *RetrierClient) AddInterfaces(builder golang.ModuleBuilder) error {
 	return node.Wrapped.AddInterfaces(builder)
 }
@@ -67,7 +107,7 @@ func (node *RetrierClient) GenerateFuncs(builder golang.ModuleBuilder) error {
 		return err
 	}
 
-	return generateClient(builder, iface, node.outputPackage, node.Max)
+	return generateClient(builder, iface, node.outputPackage)
 }
 
 func (node *RetrierClient) AddInstantiation(builder golang.NamespaceBuilder) error {
@@ -87,9 +127,17 @@ func (node *RetrierClient) AddInstantiation(builder golang.NamespaceBuilder) err
 			Arguments: []gocode.Variable{
 				{Name: "ctx", Type: &gocode.UserType{Package: "context", Name: "Context"}},
 				{Name: "client", Type: iface},
+				{Name: "max_tries", Type: &gocode.BasicType{Name: "string"}},
+				{Name: "initial_backoff", Type: &gocode.BasicType{Name: "string"}},
+				{Name: "multiplier", Type: &gocode.BasicType{Name: "string"}},
+				{Name: "max_backoff", Type: &gocode.BasicType{Name: "string"}},
+				{Name: "jitter", Type: &gocode.BasicType{Name: "string"}},
+				{Name: "budget", Type: &gocode.BasicType{Name: "string"}},
+				{Name: "budget_window", Type: &gocode.BasicType{Name: "string"}},
+				{Name: "retryable", Type: &gocode.BasicType{Name: "string"}},
 			},
 		},
 	}
 
-	return builder.DeclareConstructor(node.InstanceName, constructor, []ir.IRNode{node.Wrapped})
+	return builder.DeclareConstructor(node.InstanceName, constructor, append([]ir.IRNode{node.Wrapped}, node.Args...))
 }
@@ -3,10 +3,19 @@
 // The plugin wraps clients with a retrier using that retries a request until one of the two conditions is met:
 // i)  the requests returns without an error
 // ii) the number of failed tries has reached the maximum number of failures.
+//
+// [AddRetriesWithPolicy] additionally configures exponential backoff with jitter between tries,
+// a retry budget shared by all calls of a client, and which errors are worth retrying.
 // Usage:
-//  import "github.com/blueprint-uservices/blueprint/plugins/retries"
-//  retries.AddRetries(spec, "my_service", 10) // Only adds retries
-//  retries.AddRetriesWithTimeouts(spec, "my_service", 10, "1s") // Adds retries and timeouts
+//
+//	import "github.com/blueprint-uservices/blueprint/plugins/retries"
+//	retries.AddRetries(spec, "my_service", 10) // Only adds retries
+//	retries.AddRetriesWithTimeouts(spec, "my_service", 10, "1s") // Adds retries and timeouts
+//	retries.AddRetriesWithPolicy(spec, "my_service", 10, retries.Policy{InitialBackoff: "10ms", Multiplier: 2, Jitter: "full"})
+//
+// The generated retrier uses the code in the [runtime/plugins/retries] package.
+//
+// [runtime/plugins/retries]: https://github.com/Blueprint-uServices/blueprint/tree/main/runtime/plugins/retries
 package retries
 
 import (
@@ -23,8 +32,54 @@ import (
 // Uses a [blueprint.WiringSpec]
 // Modifies the given service such that all clients to that service retry `max_retries` number of times on error.
 // Usage:
-//   AddRetries(spec, "my_service", 10)
+//
+//	AddRetries(spec, "my_service", 10)
 func AddRetries(spec wiring.WiringSpec, serviceName string, max_retries int64) {
+	AddRetriesWithPolicy(spec, serviceName, max_retries, Policy{Retryable: "any"})
+}
+
+// Configures the backoff, budget and error classification of a retrier.
+// The zero value retries transient errors back-to-back without a budget.
+type Policy struct {
+	// The backoff before the first retry, e.g. "10ms".  If empty, retries are made back-to-back.
+	InitialBackoff string
+
+	// Factor by which the backoff grows after each retry.  Values less than 1 are treated as 1.
+	Multiplier float64
+
+	// Upper bound on any single backoff, e.g. "1s".  If empty, backoffs are unbounded.
+	MaxBackoff string
+
+	// Jitter applied to each backoff; one of "none", "full" or "decorrelated".  Defaults to "none".
+	Jitter string
+
+	// The maximum number of retries, across all calls of a client, that can be made within
+	// BudgetWindow.  If zero, retries are not budgeted.
+	Budget int64
+
+	// The window over which Budget is enforced, e.g. "1s".  Required if Budget is set.
+	BudgetWindow string
+
+	// Which errors are retried; one of "transient" or "any".  Defaults to "transient", which does not
+	// retry once the caller's context is cancelled, nor errors marked permanent by the callee.
+	Retryable string
+}
+
+// Add retrier functionality with the provided backoff policy to all clients of the specified service.
+// Uses a [blueprint.WiringSpec]
+// Modifies the given service such that all clients to that service try each call at most `max_retries` times,
+// backing off between tries as configured by `policy`.
+// Usage:
+//
+//	AddRetriesWithPolicy(spec, "my_service", 10, retries.Policy{
+//	  InitialBackoff: "10ms",
+//	  Multiplier:     2,
+//	  MaxBackoff:     "1s",
+//	  Jitter:         "decorrelated",
+//	  Budget:         100,
+//	  BudgetWindow:   "1s",
+//	})
+func AddRetriesWithPolicy(spec wiring.WiringSpec, serviceName string, max_retries int64, policy Policy) {
 	clientWrapper := serviceName + ".client.retrier"
 
 	ptr := pointer.GetPointer(spec, serviceName)
@@ -35,14 +90,14 @@ func AddRetries(spec wiring.WiringSpec, serviceName string, max_retries int64) {
 
 	clientNext := ptr.AddSrcModifier(spec, clientWrapper)
 
-	spec.Define(clientWrapper, &RetrierClient{Max: max_retries}, func(ns wiring.Namespace) (ir.IRNode, error) {
+	spec.Define(clientWrapper, &RetrierClient{}, func(ns wiring.Namespace) (ir.IRNode, error) {
 		var wrapped golang.Service
 
 		if err := ns.Get(clientNext, &wrapped); err != nil {
 			return nil, blueprint.Errorf("Retries %s expected %s to be a golang.Service, but encountered %s", clientWrapper, clientNext, err)
 		}
 
-		return newRetrierClient(clientWrapper, wrapped, max_retries)
+		return newRetrierClient(clientWrapper, wrapped, max_retries, policy)
 	})
 }
 
@@ -54,12 +109,16 @@ func AddRetries(spec wiring.WiringSpec, serviceName string, max_retries int64) {
 //
 // Ordering of functionality depicted via example call-chain:
 // Before:
-//   workflow -> plugin grpc
+//
+//	workflow -> plugin grpc
+//
 // After:
-//   workflow -> retrier -> timeout -> plugin grpc
+//
+//	workflow -> retrier -> timeout -> plugin grpc
 //
 // Usage:
-//   AddRetriesWithTimeouts(spec, "my_service", 10, "1s")
+//
+//	AddRetriesWithTimeouts(spec, "my_service", 10, "1s")
 func AddRetriesWithTimeouts(spec wiring.WiringSpec, serviceName string, max_retries int64, timeout string) {
 	AddRetries(spec, serviceName, max_retries)
 	timeouts.Add(spec, serviceName, timeout)
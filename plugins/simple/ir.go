@@ -30,13 +30,17 @@ type SimpleBackend struct {
 	BackendImpl  string // e.g. "SimpleNoSQLDB"
 
 	Spec *workflowspec.Service // The backend's interface and implementation
+	Args []ir.IRNode           // Hard-coded arguments to the backend's constructor, if any
+
+	Migrations string // The name of the migrations that the backend applies when it is instantiated, if any
 }
 
 // Creates a [SimpleBackend] IR node.
 //   - name should be a name for the instance, e.g. "my_nosql_db"
 //   - BackendIface should be the the interface this backend implements, e.g. "NoSQLDatabase"
 //   - BackendImpl should be the the implementation, e.g. "SimpleNoSQLDB"
-func newSimpleBackend[BackendImpl any](name string) (*SimpleBackend, error) {
+//   - args are any hard-coded arguments to the implementation's constructor
+func newSimpleBackend[BackendImpl any](name string, args ...ir.IRNode) (*SimpleBackend, error) {
 	spec, err := workflowspec.GetService[BackendImpl]()
 	if err != nil {
 		return nil, err
@@ -46,6 +50,7 @@ func newSimpleBackend[BackendImpl any](name string) (*SimpleBackend, error) {
 		Spec:         spec,
 		BackendType:  spec.Iface.Name,
 		BackendImpl:  gocode.NameOf[BackendImpl](),
+		Args:         args,
 	}
 
 	return node, nil
@@ -79,7 +84,7 @@ func (node *SimpleBackend) AddInstantiation(builder golang.NamespaceBuilder) err
 	}
 
 	slog.Info(fmt.Sprintf("Instantiating %v %v in %v/%v", node.BackendImpl, node.InstanceName, builder.Info().Package.PackageName, builder.Info().FileName))
-	return builder.DeclareConstructor(node.InstanceName, node.Spec.Constructor.AsConstructor(), nil)
+	return builder.DeclareConstructor(node.InstanceName, node.Spec.Constructor.AsConstructor(), node.Args)
 }
 
 // Implements ir.IRNode
@@ -87,5 +92,10 @@ func (node *SimpleBackend) String() string {
 	return fmt.Sprintf("%v = %v()", node.InstanceName, node.BackendImpl)
 }
 
+// Implements golang.Migratable
+func (node *SimpleBackend) AppliesMigrations() bool {
+	return node.Migrations != ""
+}
+
 func (node *SimpleBackend) ImplementsGolangNode()    {}
 func (node *SimpleBackend) ImplementsGolangService() {}
@@ -17,6 +17,32 @@
 //	simple.Queue(spec, "my_queue")
 //	simple.Cache(spec, "my_cache")
 //
+// By default the NoSQLDB is purely in-memory and loses its contents when the process exits.  It can instead
+// persist its contents to a directory with [NoSQLDBOptions], e.g.
+//
+//	simple.NoSQLDB(spec, "my_nosql_db", simple.NoSQLDBOptions{Dir: "/data/my_nosql_db", Fsync: "interval"})
+//
+// Similarly, each RelationalDB has its own in-memory database by default.  It can instead be stored in a directory,
+// and initialized from a schema file, with [RelationalDBOptions], e.g.
+//
+//	simple.RelationalDB(spec, "my_relational_db", simple.RelationalDBOptions{Dir: "/data", Schema: "schema.sql"})
+//
+// A RelationalDB can also apply a service's versioned migrations (see [runtime/core/migrate]) when it starts, e.g.
+//
+//	simple.RelationalDB(spec, "catalogue_db", simple.RelationalDBOptions{Migrations: "catalogue"})
+//
+// By default the cache is unbounded.  A capacity and eviction policy can be configured with [CacheOptions], e.g.
+//
+//	simple.Cache(spec, "my_cache", simple.CacheOptions{Capacity: 10000, Policy: "lfu"})
+//
+// Similarly, the queue holds at most 10 items by default, redelivers unacknowledged items after 30 seconds, and
+// dead-letters items after 5 deliveries.  These can be configured with [QueueOptions], e.g.
+//
+//	simple.Queue(spec, "my_queue", simple.QueueOptions{Capacity: 100, VisibilityTimeout: time.Minute})
+//
+// The dead-letter queue of a queue is itself a queue, named after the queue with a ".dlq" suffix, e.g.
+// "my_queue.dlq".  It resides in the same process as the queue.
+//
 // After instantiating a backend, it can be provided as argument to a workflow service.
 //
 // # Wiring Spec Example
@@ -55,11 +81,17 @@
 // [mysql]: https://github.com/Blueprint-uServices/blueprint/tree/main/plugins/mysql
 // [runtime/plugins/simplenosqldb]: https://github.com/Blueprint-uServices/blueprint/tree/main/runtime/plugins/simplenosqldb
 // [runtime/plugins/sqlitereldb]: https://github.com/Blueprint-uServices/blueprint/tree/main/runtime/plugins/sqlitereldb
+// [runtime/core/migrate]: https://github.com/Blueprint-uServices/blueprint/tree/main/runtime/core/migrate
 // [runtime/plugins/simplequeue]: https://github.com/Blueprint-uServices/blueprint/tree/main/runtime/plugins/simplequeue
 // [runtime/plugins/simplecache]: https://github.com/Blueprint-uServices/blueprint/tree/main/runtime/plugins/simplecache
 package simple
 
 import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/blueprint/pkg/blueprint"
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/coreplugins/pointer"
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/ir"
 	"github.com/blueprint-uservices/blueprint/blueprint/pkg/wiring"
@@ -70,39 +102,232 @@ import (
 	"github.com/blueprint-uservices/blueprint/runtime/plugins/sqlitereldb"
 )
 
+// Options for a [NoSQLDB]
+type NoSQLDBOptions struct {
+	// The directory in which to persist the database, relative to the working directory of the compiled
+	// application.  Empty means the database is in-memory only.
+	Dir string
+
+	// When the database's log is flushed to disk; one of "always", "interval" or "never".  Defaults to "always".
+	Fsync string
+
+	// The period between flushes when Fsync is "interval".  Defaults to 1 second.
+	FsyncInterval time.Duration
+
+	// The number of changes after which the database is snapshotted and its log truncated.  Defaults to 10000.
+	// A negative value disables snapshots.
+	SnapshotEvery int
+}
+
 // [NoSQLDB] can be used by wiring specs to create an in-memory [backend.NoSQLDatabase] instance with the specified name.
 // In the compiled application, uses the [simplenosqldb.SimpleNoSQLDB] implementation from the Blueprint runtime package
 // The SimpleNoSQLDB has limited support for query and update operations.
-func NoSQLDB(spec wiring.WiringSpec, name string) string {
-	return define[backend.NoSQLDatabase, simplenosqldb.SimpleNoSQLDB](spec, name)
+//
+// If options are provided with a non-empty Dir, the database instead uses the [simplenosqldb.DurableNoSQLDB]
+// implementation, which persists its contents to Dir and restores them when the application restarts.
+func NoSQLDB(spec wiring.WiringSpec, name string, options ...NoSQLDBOptions) string {
+	var opts NoSQLDBOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	if opts.Dir == "" {
+		return define[backend.NoSQLDatabase, simplenosqldb.SimpleNoSQLDB](spec, name)
+	}
+
+	if strings.ContainsAny(opts.Dir, "\"\\\n") {
+		spec.AddError(blueprint.Errorf("invalid directory %q for NoSQLDB %v", opts.Dir, name))
+		return name
+	}
+	if _, err := simplenosqldb.ParseFsyncPolicy(opts.Fsync); err != nil {
+		spec.AddError(blueprint.Errorf("invalid fsync policy for NoSQLDB %v: %v", name, err.Error()))
+		return name
+	}
+	if opts.FsyncInterval < 0 {
+		spec.AddError(blueprint.Errorf("invalid fsync interval %v for NoSQLDB %v", opts.FsyncInterval, name))
+		return name
+	}
+	return define[backend.NoSQLDatabase, simplenosqldb.DurableNoSQLDB](spec, name,
+		&ir.IRValue{Value: opts.Dir},
+		&ir.IRValue{Value: opts.Fsync},
+		&ir.IRValue{Value: opts.FsyncInterval.String()},
+		&ir.IRValue{Value: strconv.Itoa(opts.SnapshotEvery)},
+	)
+}
+
+// Options for a [RelationalDB]
+type RelationalDBOptions struct {
+	// The directory in which to store the database, in a file named after the database, relative to the
+	// working directory of the compiled application.  Empty means the database is in-memory only.
+	Dir string
+
+	// The path of a file of SQL statements used to initialize the database when it has no tables, e.g. to
+	// create tables and insert seed data.  Relative to the working directory of the compiled application.
+	Schema string
+
+	// The name with which the migrations to apply to the database are registered with migrate.Register.
+	// The package that registers them must be part of the process that contains the database, e.g. because
+	// it is the package of a service that uses the database.
+	Migrations string
 }
 
 // [RelationalDB] can be used by wiring specs to create an in-memory [backend.RelationalDB] instance with the specified name.
-// In the compiled application, uses the [sqlitereldb.SqliteRelDB] implementation from the Blueprint runtime package
+// In the compiled application, uses the [sqlitereldb.NamedSqliteRelDB] implementation from the Blueprint runtime package
 // The compiled application might fail to run if gcc is not installed and CGO_ENABLED is not set.
-func RelationalDB(spec wiring.WiringSpec, name string) string {
-	return define[backend.RelationalDB, sqlitereldb.SqliteRelDB](spec, name)
+//
+// Each instance has its own database.  If options are provided with a non-empty Dir, the database is stored in
+// a file in Dir and its contents survive restarts.  If options are provided with a non-empty Schema, the schema
+// is applied when the database is created.  If options are provided with a non-empty Migrations, the migrations
+// that haven't been applied are applied when the process starts; the process can also be started with the --migrate
+// flag to roll back migrations or print their status.
+func RelationalDB(spec wiring.WiringSpec, name string, options ...RelationalDBOptions) string {
+	var opts RelationalDBOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	if strings.ContainsAny(opts.Dir, "\"\\\n?#") {
+		spec.AddError(blueprint.Errorf("invalid directory %q for RelationalDB %v", opts.Dir, name))
+		return name
+	}
+	if strings.ContainsAny(opts.Schema, "\"\\\n") {
+		spec.AddError(blueprint.Errorf("invalid schema path %q for RelationalDB %v", opts.Schema, name))
+		return name
+	}
+	if strings.ContainsAny(opts.Migrations, "\"\\\n") {
+		spec.AddError(blueprint.Errorf("invalid migrations name %q for RelationalDB %v", opts.Migrations, name))
+		return name
+	}
+	return defineMigrated[backend.RelationalDB, sqlitereldb.NamedSqliteRelDB](spec, name, opts.Migrations,
+		&ir.IRValue{Value: name},
+		&ir.IRValue{Value: opts.Dir},
+		&ir.IRValue{Value: opts.Schema},
+		&ir.IRValue{Value: opts.Migrations},
+	)
+}
+
+// Options for a [Queue]
+type QueueOptions struct {
+	// The maximum number of items in the queue, including items popped with PopDelivery that haven't been
+	// acknowledged.  Defaults to 10.  A negative value means the queue is unbounded.
+	Capacity int
+
+	// The time after which items popped with PopDelivery that haven't been acknowledged are redelivered.
+	// Defaults to 30 seconds.
+	VisibilityTimeout time.Duration
+
+	// The number of times an item is delivered before it is moved to the dead-letter queue.  Defaults to 5.
+	// A negative value means items are redelivered until they are acknowledged.
+	MaxDeliveries int
 }
 
 // [Queue] can be used by wiring specs to create an in-memory [backend.Queue] instance with the specified name.
 // In the compiled application, uses the [simplequeue.SimpleQueue] implementation from the Blueprint runtime package
-func Queue(spec wiring.WiringSpec, name string) string {
-	return define[backend.Queue, simplequeue.SimpleQueue](spec, name)
+//
+// If options are provided, the queue instead uses the [simplequeue.ConfiguredQueue] implementation, which
+// has the configured capacity, visibility timeout and maximum number of deliveries.
+//
+// The queue's dead-letter queue can be used by wiring specs as a queue named name + ".dlq".
+func Queue(spec wiring.WiringSpec, name string, options ...QueueOptions) string {
+	defineDeadLetters(spec, name)
+	if len(options) == 0 {
+		return define[backend.Queue, simplequeue.SimpleQueue](spec, name)
+	}
+
+	opts := options[0]
+	if opts.VisibilityTimeout < 0 {
+		spec.AddError(blueprint.Errorf("invalid visibility timeout %v for queue %v", opts.VisibilityTimeout, name))
+		return name
+	}
+	capacity, timeout, deliveries := "", "", ""
+	if opts.Capacity != 0 {
+		capacity = strconv.Itoa(max(opts.Capacity, 0))
+	}
+	if opts.VisibilityTimeout != 0 {
+		timeout = opts.VisibilityTimeout.String()
+	}
+	if opts.MaxDeliveries != 0 {
+		deliveries = strconv.Itoa(max(opts.MaxDeliveries, 0))
+	}
+	return define[backend.Queue, simplequeue.ConfiguredQueue](spec, name,
+		&ir.IRValue{Value: name},
+		&ir.IRValue{Value: capacity},
+		&ir.IRValue{Value: timeout},
+		&ir.IRValue{Value: deliveries},
+	)
+}
+
+// Defines the dead-letter queue of the queue called name as a [simplequeue.DeadLetterQueue] called name + ".dlq"
+func defineDeadLetters(spec wiring.WiringSpec, name string) {
+	dlqName := name + ".dlq"
+	backendName := dlqName + ".backend"
+
+	// The dead-letter queue belongs to the queue, so it is instantiated from the queue
+	spec.Define(backendName, &SimpleBackend{}, func(namespace wiring.Namespace) (ir.IRNode, error) {
+		var queue *SimpleBackend
+		if err := namespace.Get(name+".backend", &queue); err != nil {
+			return nil, err
+		}
+		return newSimpleBackend[simplequeue.DeadLetterQueue](dlqName, queue)
+	})
+
+	pointer.CreatePointer[*SimpleBackend](spec, dlqName, backendName)
+}
+
+// Options for a [Cache]
+type CacheOptions struct {
+	// The maximum number of keys in the cache.  0 means unbounded.
+	Capacity int
+
+	// The eviction policy of a bounded cache; one of "lru", "lfu", "fifo" or "random".  Defaults to "lru".
+	Policy string
 }
 
 // [Cache] can be used by wiring specs to create an in-memory [backend.Cache] instance with the specified name.
-// In the compiled application, uses the [simplecache.SimpleCache] implementation from the Blueprint runtime package
-func Cache(spec wiring.WiringSpec, name string) string {
-	return define[backend.Cache, simplecache.SimpleCache](spec, name)
+// In the compiled application, uses the [simplecache.SimpleCache] implementation from the Blueprint runtime package.
+//
+// If options are provided with a non-zero Capacity, the cache instead uses the [simplecache.BoundedCache]
+// implementation, which evicts keys according to the configured policy and emits hit, miss and eviction metrics.
+func Cache(spec wiring.WiringSpec, name string, options ...CacheOptions) string {
+	var opts CacheOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	if opts.Capacity == 0 {
+		return define[backend.Cache, simplecache.SimpleCache](spec, name)
+	}
+
+	if opts.Capacity < 0 {
+		spec.AddError(blueprint.Errorf("invalid capacity %v for cache %v", opts.Capacity, name))
+		return name
+	}
+	if _, err := simplecache.ParsePolicy(opts.Policy); err != nil {
+		spec.AddError(blueprint.Errorf("invalid eviction policy for cache %v: %v", name, err.Error()))
+		return name
+	}
+	return define[backend.Cache, simplecache.BoundedCache](spec, name,
+		&ir.IRValue{Value: name},
+		&ir.IRValue{Value: strconv.Itoa(opts.Capacity)},
+		&ir.IRValue{Value: opts.Policy},
+	)
+}
+
+// Args are hard-coded values passed to the backend's constructor
+func define[BackendInterface any, BackendImpl any](spec wiring.WiringSpec, name string, args ...ir.IRNode) string {
+	return defineMigrated[BackendInterface, BackendImpl](spec, name, "", args...)
 }
 
-func define[BackendInterface any, BackendImpl any](spec wiring.WiringSpec, name string) string {
+// Like [define], for a backend that applies the named migrations when it is instantiated
+func defineMigrated[BackendInterface any, BackendImpl any](spec wiring.WiringSpec, name string, migrations string, args ...ir.IRNode) string {
 	// The nodes that we are defining
 	backendName := name + ".backend"
 
 	// Define the backend instance
 	spec.Define(backendName, &SimpleBackend{}, func(namespace wiring.Namespace) (ir.IRNode, error) {
-		return newSimpleBackend[BackendImpl](name)
+		node, err := newSimpleBackend[BackendImpl](name, args...)
+		if err != nil {
+			return nil, err
+		}
+		node.Migrations = migrations
+		return node, nil
 	})
 
 	// Create a pointer to the backend instance
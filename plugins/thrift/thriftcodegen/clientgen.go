@@ -35,6 +35,7 @@ func GenerateClient(builder golang.ModuleBuilder, service *gocode.ServiceInterfa
 	client.Imports.AddPackages(
 		"context", "time", "errors",
 		"github.com/apache/thrift/lib/go/thrift",
+		"github.com/blueprint-uservices/blueprint/runtime/plugins/deadline",
 		innerPkgPath,
 	)
 
@@ -107,10 +108,12 @@ func (client *{{$receiver}}) {{SignatureWithRetVars $f}} {
 	req := &{{$prefix}}.{{$service}}_{{$f.Name}}_Request{}
 	marshall_{{$f.Name}}_req(req, {{ArgVars $f}})
 
-	ctx, cancel := context.WithTimeout(ctx, client.Timeout)
+	// Apply the client-side request timeout, or the caller's deadline if it is earlier.
+	// The time remaining until the deadline is sent to the server alongside the request.
+	ctx, cancel := deadline.WithTimeout(ctx, client.Timeout)
 	defer cancel()
 
-	rsp, err := client.Client.{{$f.Name}}(ctx, req)
+	rsp, err := client.Client.{{$f.Name}}(ctx, req, deadline.Encode(ctx))
 	if err != nil {
 		err = ctx.Err()
 	}
@@ -32,7 +32,11 @@ func GenerateServerHandler(builder golang.ModuleBuilder, service *gocode.Service
 
 	innerPkgPath := builder.Info().Name + "/" + outputPackage + "/" + innerPkg
 
-	server.Imports.AddPackages("context", "github.com/apache/thrift/lib/go/thrift", innerPkgPath)
+	server.Imports.AddPackages(
+		"context", "github.com/apache/thrift/lib/go/thrift",
+		"github.com/blueprint-uservices/blueprint/runtime/plugins/deadline",
+		innerPkgPath,
+	)
 
 	slog.Info(fmt.Sprintf("Generating %v/%v_ThriftServer.go", server.Package.PackageName, service.Name))
 	outputFile := filepath.Join(server.Package.Path, service.Name+
@@ -96,7 +100,10 @@ func (handler *{{.Name}}) Run(ctx context.Context) error {
 {{$receiver := .Name -}}
 {{$prefix := .ImportPrefix -}}
 {{ range $_, $f := .Service.Methods }}
-func (handler *{{$receiver}}) {{$f.Name -}}(ctx context.Context, req *{{$prefix}}.{{$service}}_{{$f.Name}}_Request) (*{{$prefix}}.{{$service}}_{{$f.Name}}_Response, error) {
+func (handler *{{$receiver}}) {{$f.Name -}}(ctx context.Context, req *{{$prefix}}.{{$service}}_{{$f.Name}}_Request, timeoutNanos int64) (*{{$prefix}}.{{$service}}_{{$f.Name}}_Response, error) {
+	// Apply the deadline propagated by the client
+	ctx, cancel := deadline.Decode(ctx, timeoutNanos)
+	defer cancel()
 	{{ArgVarsEquals $f}} unmarshall_{{$f.Name}}_req(req)
 	{{RetVars $f "err"}} := handler.Service.{{$f.Name}}({{ArgVars $f "ctx"}})
 	if err != nil {
@@ -155,7 +155,7 @@ struct {{$struct.Name}} {
 {{range $_, $service := .Services}}
 service {{$service.Name}} {
 	{{- range $_, $method := $service.Methods}}
-	{{$method.Response.Name}} {{$method.Name}} (1:{{$method.Request.Name}} req),
+	{{$method.Response.Name}} {{$method.Name}} (1:{{$method.Request.Name}} req, 2:i64 timeoutNanos),
 	{{- end}}
 }
 {{end}}
@@ -3,6 +3,9 @@
 // The plugin configures clients with a timeout mechanism using contexts.
 // The plugin will generate a wrapper client class that will wait for a fixed amount of time (the specified timeout value) before canceling the context. Once the context is cancelled, the execution returns to the caller.
 //
+// If the service is deployed with the http, grpc or thrift plugins, the deadline is propagated to the server,
+// which cancels the service's context when the deadline expires.
+//
 // Example Usage to add a "1s" timeout to each request:
 //  timeouts.Add(spec, "my_service", "1s")
 package timeouts
@@ -0,0 +1,158 @@
+// Package backendtest provides conformance tests that are shared by the implementations of the
+// [backend] interfaces.
+//
+// The tests are called from the tests of each implementation, e.g.
+//
+//	func TestConformance(t *testing.T) {
+//		cache, err := simplecache.NewSimpleCache(context.Background())
+//		require.NoError(t, err)
+//		backendtest.TestCache(t, cache)
+//	}
+package backendtest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+	"github.com/stretchr/testify/require"
+)
+
+// Returns a key prefix that is unique to this run of a test, so that conformance tests can run
+// against caches that contain other data.
+func uniquePrefix(t *testing.T) string {
+	return fmt.Sprintf("%s/%d/", t.Name(), time.Now().UnixNano())
+}
+
+// Tests that cache conforms to the [backend.Cache] interface.
+//
+// Some of the tests wait for keys to expire, which takes a few seconds because some caches expire
+// keys with a granularity of one second.
+func TestCache(t *testing.T, cache backend.Cache) {
+	ctx := context.Background()
+
+	t.Run("PutGetDelete", func(t *testing.T) {
+		key := uniquePrefix(t) + "key"
+		require.NoError(t, cache.Put(ctx, key, "hello"))
+
+		var v string
+		exists, err := cache.Get(ctx, key, &v)
+		require.NoError(t, err)
+		require.True(t, exists)
+		require.Equal(t, "hello", v)
+
+		require.NoError(t, cache.Delete(ctx, key))
+		exists, err = cache.Get(ctx, key, &v)
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+
+	t.Run("MsetMget", func(t *testing.T) {
+		prefix := uniquePrefix(t)
+		keys := []string{prefix + "a", prefix + "b"}
+		require.NoError(t, cache.Mset(ctx, keys, []any{int64(5), "hello"}))
+
+		var a int64
+		var b string
+		require.NoError(t, cache.Mget(ctx, keys, []any{&a, &b}))
+		require.Equal(t, int64(5), a)
+		require.Equal(t, "hello", b)
+	})
+
+	t.Run("Incr", func(t *testing.T) {
+		key := uniquePrefix(t) + "counter"
+		require.NoError(t, cache.Put(ctx, key, int64(0)))
+		for i := 1; i <= 3; i++ {
+			v, err := cache.Incr(ctx, key)
+			require.NoError(t, err)
+			require.Equal(t, int64(i), v)
+		}
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		prefix := uniquePrefix(t)
+
+		// A key without an expiry has no TTL
+		require.NoError(t, cache.Put(ctx, prefix+"forever", "v"))
+		ttl, exists, err := cache.TTL(ctx, prefix+"forever")
+		require.NoError(t, err)
+		require.True(t, exists)
+		require.Zero(t, ttl)
+
+		// A key with an expiry reports its remaining TTL
+		require.NoError(t, cache.PutWithTTL(ctx, prefix+"expiring", "v", time.Minute))
+		ttl, exists, err = cache.TTL(ctx, prefix+"expiring")
+		require.NoError(t, err)
+		require.True(t, exists)
+		require.Greater(t, ttl, 50*time.Second)
+		require.LessOrEqual(t, ttl, time.Minute+time.Second)
+
+		// Missing keys have no TTL
+		ttl, exists, err = cache.TTL(ctx, prefix+"missing")
+		require.NoError(t, err)
+		require.False(t, exists)
+		require.Zero(t, ttl)
+
+		// Negative TTLs are invalid
+		require.Error(t, cache.PutWithTTL(ctx, prefix+"invalid", "v", -time.Second))
+	})
+
+	t.Run("Expire", func(t *testing.T) {
+		prefix := uniquePrefix(t)
+
+		// Expiring a missing key has no effect
+		exists, err := cache.Expire(ctx, prefix+"missing", time.Minute)
+		require.NoError(t, err)
+		require.False(t, exists)
+
+		require.NoError(t, cache.Put(ctx, prefix+"key", "v"))
+		exists, err = cache.Expire(ctx, prefix+"key", time.Minute)
+		require.NoError(t, err)
+		require.True(t, exists)
+		ttl, _, err := cache.TTL(ctx, prefix+"key")
+		require.NoError(t, err)
+		require.Greater(t, ttl, 50*time.Second)
+
+		// A TTL of 0 removes the expiry
+		exists, err = cache.Expire(ctx, prefix+"key", 0)
+		require.NoError(t, err)
+		require.True(t, exists)
+		ttl, exists, err = cache.TTL(ctx, prefix+"key")
+		require.NoError(t, err)
+		require.True(t, exists)
+		require.Zero(t, ttl)
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		prefix := uniquePrefix(t)
+		require.NoError(t, cache.PutWithTTL(ctx, prefix+"put", "v", time.Second))
+		require.NoError(t, cache.Put(ctx, prefix+"expire", "v"))
+		_, err := cache.Expire(ctx, prefix+"expire", time.Second)
+		require.NoError(t, err)
+		// Incrementing a key does not change its expiry
+		require.NoError(t, cache.PutWithTTL(ctx, prefix+"counter", int64(0), time.Second))
+		v, err := cache.Incr(ctx, prefix+"counter")
+		require.NoError(t, err)
+		require.Equal(t, int64(1), v)
+		require.NoError(t, cache.PutWithTTL(ctx, prefix+"kept", "v", time.Minute))
+
+		var s string
+		exists, err := cache.Get(ctx, prefix+"put", &s)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		time.Sleep(2100 * time.Millisecond)
+
+		for _, key := range []string{"put", "expire", "counter"} {
+			var v any
+			exists, err := cache.Get(ctx, prefix+key, &v)
+			require.NoError(t, err)
+			require.False(t, exists, "%s should have expired", key)
+		}
+		exists, err = cache.Get(ctx, prefix+"kept", &s)
+		require.NoError(t, err)
+		require.True(t, exists)
+	})
+}
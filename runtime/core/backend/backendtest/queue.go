@@ -0,0 +1,182 @@
+package backendtest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that q conforms to the [backend.Queue] interface.
+//
+// q and its dead-letter queue deadLetters must be empty.  q must redeliver unacknowledged items after
+// visibilityTimeout, and must deliver items maxDeliveries times, which must be at least 2, before
+// moving them to deadLetters.  A short visibility timeout keeps the tests fast.
+func TestQueue(t *testing.T, q backend.Queue, deadLetters backend.Queue, visibilityTimeout time.Duration, maxDeliveries int) {
+	ctx := context.Background()
+	require.GreaterOrEqual(t, maxDeliveries, 2)
+
+	// How long to wait for an item that should be, or should not be, in a queue
+	wait := max(5*visibilityTimeout, time.Second)
+
+	pop := func(t *testing.T, q backend.Queue) string {
+		ctx, cancel := context.WithTimeout(ctx, wait)
+		defer cancel()
+		var item string
+		popped, err := q.Pop(ctx, &item)
+		require.NoError(t, err)
+		require.True(t, popped)
+		return item
+	}
+	popDelivery := func(t *testing.T) (backend.QueueDelivery, string) {
+		ctx, cancel := context.WithTimeout(ctx, wait)
+		defer cancel()
+		var item string
+		d, popped, err := q.PopDelivery(ctx, &item)
+		require.NoError(t, err)
+		require.True(t, popped)
+		return d, item
+	}
+	requireEmpty := func(t *testing.T, q backend.Queue) {
+		ctx, cancel := context.WithTimeout(ctx, visibilityTimeout+100*time.Millisecond)
+		defer cancel()
+		var item string
+		popped, err := q.Pop(ctx, &item)
+		require.NoError(t, err)
+		require.False(t, popped, "unexpected item %v", item)
+	}
+	push := func(t *testing.T, item string) {
+		pushed, err := q.Push(ctx, item)
+		require.NoError(t, err)
+		require.True(t, pushed)
+	}
+
+	t.Run("PushPop", func(t *testing.T) {
+		item := uniquePrefix(t) + "item"
+		push(t, item)
+		require.Equal(t, item, pop(t, q))
+	})
+
+	t.Run("PopTimeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		var item string
+		popped, err := q.Pop(ctx, &item)
+		require.NoError(t, err)
+		require.False(t, popped)
+		d, popped, err := q.PopDelivery(ctx, &item)
+		require.NoError(t, err)
+		require.False(t, popped)
+		require.Nil(t, d)
+	})
+
+	t.Run("Ack", func(t *testing.T) {
+		item := uniquePrefix(t) + "item"
+		push(t, item)
+		d, popped := popDelivery(t)
+		require.Equal(t, item, popped)
+		require.Equal(t, 1, d.Deliveries())
+		require.NoError(t, d.Ack(ctx))
+
+		// Acknowledged items are not redelivered, and can only be acknowledged once
+		time.Sleep(visibilityTimeout)
+		requireEmpty(t, q)
+		require.ErrorIs(t, d.Ack(ctx), backend.ErrDeliveryExpired)
+	})
+
+	t.Run("Nack", func(t *testing.T) {
+		item := uniquePrefix(t) + "item"
+		push(t, item)
+		d, _ := popDelivery(t)
+		require.NoError(t, d.Nack(ctx, true))
+
+		d, popped := popDelivery(t)
+		require.Equal(t, item, popped)
+		require.Equal(t, 2, d.Deliveries())
+		require.NoError(t, d.Ack(ctx))
+		requireEmpty(t, q)
+	})
+
+	t.Run("VisibilityTimeout", func(t *testing.T) {
+		item := uniquePrefix(t) + "item"
+		push(t, item)
+		expired, _ := popDelivery(t)
+
+		d, popped := popDelivery(t)
+		require.Equal(t, item, popped)
+		require.Equal(t, 2, d.Deliveries())
+
+		// The first delivery can no longer be acknowledged
+		require.ErrorIs(t, expired.Ack(ctx), backend.ErrDeliveryExpired)
+		require.NoError(t, d.Ack(ctx))
+		requireEmpty(t, q)
+	})
+
+	t.Run("DeadLetter", func(t *testing.T) {
+		item := uniquePrefix(t) + "item"
+		push(t, item)
+		for i := 1; i <= maxDeliveries; i++ {
+			d, popped := popDelivery(t)
+			require.Equal(t, item, popped)
+			require.Equal(t, i, d.Deliveries())
+			require.NoError(t, d.Nack(ctx, true))
+		}
+		requireEmpty(t, q)
+		require.Equal(t, item, pop(t, deadLetters))
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		item := uniquePrefix(t) + "item"
+		push(t, item)
+		d, _ := popDelivery(t)
+		require.NoError(t, d.Nack(ctx, false))
+		require.ErrorIs(t, d.Ack(ctx), backend.ErrDeliveryExpired)
+		requireEmpty(t, q)
+		require.Equal(t, item, pop(t, deadLetters))
+	})
+
+	t.Run("ConcurrentConsumers", func(t *testing.T) {
+		prefix := uniquePrefix(t)
+		n := 20
+		go func() {
+			for i := 0; i < n; i++ {
+				push(t, fmt.Sprintf("%s%d", prefix, i))
+			}
+		}()
+
+		// Each item is delivered to exactly one consumer
+		var mu sync.Mutex
+		received := make(map[string]int)
+		var wg sync.WaitGroup
+		for c := 0; c < 4; c++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					popCtx, cancel := context.WithTimeout(ctx, wait)
+					var item string
+					d, popped, err := q.PopDelivery(popCtx, &item)
+					cancel()
+					require.NoError(t, err)
+					if !popped {
+						return
+					}
+					mu.Lock()
+					received[item]++
+					mu.Unlock()
+					require.NoError(t, d.Ack(ctx))
+				}
+			}()
+		}
+		wg.Wait()
+
+		require.Len(t, received, n)
+		for item, count := range received {
+			require.Equal(t, 1, count, item)
+		}
+	})
+}
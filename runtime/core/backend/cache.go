@@ -1,6 +1,9 @@
 package backend
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Represents a key-value cache.
 type Cache interface {
@@ -32,6 +35,25 @@ type Cache interface {
 	// Delete from the cache
 	Delete(ctx context.Context, key string) error
 
-	// Treats the value mapped to key as an integer, and increments it
+	// Treats the value mapped to key as an integer, and increments it.
+	// Incrementing a key does not change its expiry.
 	Incr(ctx context.Context, key string) (int64, error)
+
+	// Store a key-value pair in the cache that expires after ttl.
+	// A ttl of 0 stores the pair without an expiry, like Put.
+	//
+	// Implementations may round ttl up to their expiry granularity, e.g. memcached expires keys
+	// with a granularity of one second.
+	PutWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+
+	// Sets key to expire after ttl, replacing any previous expiry.
+	// A ttl of 0 removes the expiry of key, so that it never expires.
+	//
+	// Reports whether the key existed in the cache
+	Expire(ctx context.Context, key string, ttl time.Duration) (bool, error)
+
+	// Returns the remaining time to live of key, or 0 if key does not expire.
+	//
+	// Reports whether the key existed in the cache
+	TTL(ctx context.Context, key string) (time.Duration, bool, error)
 }
@@ -2,6 +2,7 @@ package backend
 
 import (
 	"context"
+	"errors"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -13,6 +14,60 @@ type NoSQLDatabase interface {
 		or might not have those concepts.
 	*/
 	GetCollection(ctx context.Context, db_name string, collection_name string) (NoSQLCollection, error)
+
+	// Starts a transaction.  The transaction's reads see a snapshot of the database taken when the
+	// transaction started, plus the transaction's own writes.  Its writes are invisible to everyone
+	// else until it is committed, and are discarded if it is aborted.
+	//
+	// Use [WithTransaction] to run a function in a transaction and retry it if it conflicts with
+	// another transaction.
+	//
+	// We use the same transaction semantics as mongodb
+	// https://www.mongodb.com/docs/manual/core/transactions/
+	StartTransaction(ctx context.Context) (NoSQLTransaction, error)
+}
+
+// A transaction started by [NoSQLDatabase.StartTransaction]
+type NoSQLTransaction interface {
+	// Returns a collection whose reads and writes are part of the transaction.  Creating indexes
+	// and watching for changes are not supported within a transaction.
+	GetCollection(ctx context.Context, db_name string, collection_name string) (NoSQLCollection, error)
+
+	// Atomically applies the transaction's writes to the database.
+	//
+	// Returns an error wrapping [ErrTransactionConflict] if a document written by the transaction
+	// was also written by another transaction that committed after this one started.  In that case
+	// none of the transaction's writes are applied.
+	Commit(ctx context.Context) error
+
+	// Discards the transaction's writes
+	Abort(ctx context.Context) error
+}
+
+// Runs fn in a transaction on db and commits it.  If fn returns an error, the transaction is aborted
+// and the error is returned.
+//
+// If fn or the commit fails with [ErrTransactionConflict], the transaction is aborted and fn is run
+// again in a new transaction, after a short random delay, until it succeeds or ctx is done.  fn can
+// therefore be called more than once, and should not have side effects outside of the transaction.
+func WithTransaction(ctx context.Context, db NoSQLDatabase, fn func(ctx context.Context, tx NoSQLTransaction) error) error {
+	return retryConflicts(ctx, func() error {
+		return runTransaction(ctx, db, fn)
+	})
+}
+
+func runTransaction(ctx context.Context, db NoSQLDatabase, fn func(ctx context.Context, tx NoSQLTransaction) error) error {
+	tx, err := db.StartTransaction(ctx)
+	if err != nil {
+		return err
+	}
+	if err := fn(ctx, tx); err != nil {
+		if abortErr := tx.Abort(ctx); abortErr != nil {
+			return errors.Join(err, abortErr)
+		}
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
 type NoSQLCursor interface {
@@ -28,7 +83,110 @@ type NoSQLCursor interface {
 	All(ctx context.Context, obj interface{}) error //similar logic to Decode, but for multiple documents
 }
 
+// Returned, possibly wrapped, when a write would give two documents the same key in a unique index.
+// Use errors.Is to check for it.
+var ErrDuplicateKey = errors.New("duplicate key error")
+
+// Options for [NoSQLCollection.CreateIndex]
+type IndexOptions struct {
+	// The name of the index.  If empty, a name is derived from the index keys, e.g. "type_1_rating_-1".
+	Name string
+
+	// If true, writes that would give two documents the same key fail with [ErrDuplicateKey].
+	Unique bool
+}
+
+// Options for [NoSQLCollection.FindManyWithOptions]
+type FindOptions struct {
+	// The order of results, as a list of fields and directions, e.g. bson.D{{"rating", -1}, {"name", 1}}.
+	// A direction is 1 for ascending or -1 for descending.  Fields can be dotted paths to nested fields.
+	// If nil, results are returned in an unspecified order.
+	Sort bson.D
+
+	// The number of results to skip.  Must not be negative.
+	Skip int64
+
+	// The maximum number of results to return, after skipping.  Must not be negative.  0 means no limit.
+	Limit int64
+
+	// An optional projection, with mongodb semantics.
+	Projection bson.D
+}
+
+// Options for [NoSQLCollection.UpdateOneWithOptions] and [NoSQLCollection.UpdateManyWithOptions]
+type UpdateOptions struct {
+	// Filters that select the array elements updated by the $[<identifier>] positional operator.
+	// For example, bson.D{{"elem.grade", bson.D{{"$gte", 85}}}} selects the elements updated by
+	// bson.D{{"$set", bson.D{{"grades.$[elem].passed", true}}}}.
+	ArrayFilters []bson.D
+
+	// If true and no documents match the filter, inserts a new document.  The new document contains
+	// the fields that the filter compares for equality, then has the update applied to it, including
+	// any $setOnInsert fields.
+	Upsert bool
+}
+
+// Options for [NoSQLCollection.Watch]
+type WatchOptions struct {
+	// Resumes a change stream after the event with this [NoSQLChangeEvent.ResumeToken].  If empty,
+	// the stream starts with the next change to the collection.
+	ResumeAfter string
+}
+
+// The kinds of change reported by a [NoSQLChangeStream]
+const (
+	ChangeInsert  = "insert"
+	ChangeUpdate  = "update"
+	ChangeReplace = "replace"
+	ChangeDelete  = "delete"
+)
+
+// A change to a document of a [NoSQLCollection]
+type NoSQLChangeEvent struct {
+	// The kind of change; one of [ChangeInsert], [ChangeUpdate], [ChangeReplace] or [ChangeDelete]
+	OperationType string
+
+	// The _id of the changed document
+	DocumentKey interface{}
+
+	// The document after the change.  Nil for deletes.
+	FullDocument bson.D
+
+	// Identifies this event.  Can be passed as [WatchOptions.ResumeAfter] to start a new change
+	// stream with the events that follow this one.
+	ResumeToken string
+}
+
+// Returned by [NoSQLChangeStream.Next] after the stream has been closed
+var ErrChangeStreamClosed = errors.New("change stream closed")
+
+// A stream of the changes made to a [NoSQLCollection], in the order they were made
+type NoSQLChangeStream interface {
+	// Waits for the next change to the collection and returns it.
+	//
+	// Returns an error if ctx is done before a change is available, or [ErrChangeStreamClosed]
+	// if the stream is closed.
+	Next(ctx context.Context) (NoSQLChangeEvent, error)
+
+	// Closes the stream.  Changes made after closing are not returned.
+	Close(ctx context.Context) error
+}
+
 type NoSQLCollection interface {
+	// Creates an index over the fields in keys, e.g. bson.D{{"type", 1}, {"rating", -1}} for a compound
+	// index.  A direction is 1 for ascending or -1 for descending.  Fields can be dotted paths to nested
+	// fields.  Returns the name of the index.
+	//
+	// A direction of "text" creates a text index, e.g. bson.D{{"description", "text"}}, which is
+	// searched by $text filters.  A collection can have at most one text index.
+	//
+	// Creating an index that already exists with the same keys and options does nothing.  Creating a
+	// unique index fails with [ErrDuplicateKey] if existing documents have duplicate keys.
+	//
+	// We use the same index semantics as mongodb
+	// https://www.mongodb.com/docs/manual/indexes/
+	CreateIndex(ctx context.Context, keys bson.D, opts IndexOptions) (string, error)
+
 	// Deletes the first document that matches filter
 	//
 	// We use the same filter semantics as mongodb
@@ -42,9 +200,12 @@ type NoSQLCollection interface {
 	DeleteMany(ctx context.Context, filter bson.D) error
 
 	// Inserts the document into the collection.
+	//
+	// Returns an error wrapping [ErrDuplicateKey] if the document has the same "_id", or the same
+	// key in a unique index, as an existing document.
 	InsertOne(ctx context.Context, document interface{}) error
 
-	// Inserts all provided documents into the collection
+	// Inserts all provided documents into the collection, stopping at the first error.
 	InsertMany(ctx context.Context, documents []interface{}) error
 
 	// Finds a document that matches filter.
@@ -63,6 +224,41 @@ type NoSQLCollection interface {
 	// Projections are optional and behave with mongodb semantics.
 	FindMany(ctx context.Context, filter bson.D, projection ...bson.D) (NoSQLCursor, error) // Result is not a slice -> it is an object we can use to retrieve documents using res.All().
 
+	// Finds all documents that match the filter, sorting, skipping and limiting the results
+	// as specified by opts.
+	//
+	// We use the same filter semantics as mongodb
+	// https://www.mongodb.com/docs/manual/tutorial/query-documents/
+	//
+	// Sorting uses the same comparison order as mongodb, including for fields that
+	// have values of different types
+	// https://www.mongodb.com/docs/manual/reference/bson-type-comparison-order/
+	FindManyWithOptions(ctx context.Context, filter bson.D, opts FindOptions) (NoSQLCursor, error)
+
+	// Returns the number of documents that match the filter.
+	//
+	// We use the same filter semantics as mongodb
+	// https://www.mongodb.com/docs/manual/tutorial/query-documents/
+	CountDocuments(ctx context.Context, filter bson.D) (int64, error)
+
+	// Returns the distinct values of field across all documents that match the filter.
+	// field can be a dotted path to a nested field.  If the value of field is an array,
+	// each element of the array is treated as a separate value.
+	//
+	// We use the same filter semantics as mongodb
+	// https://www.mongodb.com/docs/manual/tutorial/query-documents/
+	Distinct(ctx context.Context, field string, filter bson.D) ([]interface{}, error)
+
+	// Runs an aggregation pipeline over the documents of the collection and returns the
+	// documents output by the last stage.
+	//
+	// We use the same pipeline semantics as mongodb
+	// https://www.mongodb.com/docs/manual/core/aggregation-pipeline/
+	//
+	// Implementations support at least the $match, $project, $group, $sort, $limit, $skip,
+	// $unwind and $lookup stages, and the $sum, $avg, $min, $max and $push accumulators.
+	Aggregate(ctx context.Context, pipeline []bson.D) (NoSQLCursor, error)
+
 	// Applies the provided update to the first document that matches filter
 	//
 	// We use the same filter semantics as mongodb
@@ -85,6 +281,18 @@ type NoSQLCollection interface {
 	// Returns the number of updated documents (>= 0)
 	UpdateMany(ctx context.Context, filter bson.D, update bson.D) (int, error)
 
+	// Equivalent to UpdateOne, with array filters for the $[<identifier>] positional operator,
+	// and optionally upserting a document if none match the filter.
+	//
+	// Returns the number of updated or upserted documents (0 or 1)
+	UpdateOneWithOptions(ctx context.Context, filter bson.D, update bson.D, opts UpdateOptions) (int, error)
+
+	// Equivalent to UpdateMany, with array filters for the $[<identifier>] positional operator,
+	// and optionally upserting a document if none match the filter.
+	//
+	// Returns the number of updated or upserted documents (>= 0)
+	UpdateManyWithOptions(ctx context.Context, filter bson.D, update bson.D, opts UpdateOptions) (int, error)
+
 	// Attempts to find a document in the collection that matches the filter.
 	// If a match is found, replaces the existing document with the provided document.
 	// If a match is not found, document is inserted into the collection.
@@ -116,4 +324,14 @@ type NoSQLCollection interface {
 	//
 	// Returns the number of replaced documents.
 	ReplaceMany(ctx context.Context, filter bson.D, replacements ...interface{}) (int, error)
+
+	// Returns a stream of the inserts, updates, replacements and deletes of documents in the
+	// collection, starting with the next change, or resuming after opts.ResumeAfter.
+	//
+	// Resuming fails if the resume token is invalid or the event is too old to still be
+	// retained by the implementation.
+	//
+	// We use the same change stream semantics as mongodb
+	// https://www.mongodb.com/docs/manual/changeStreams/
+	Watch(ctx context.Context, opts WatchOptions) (NoSQLChangeStream, error)
 }
@@ -2,9 +2,17 @@ package backend
 
 import (
 	"context"
+	"errors"
 )
 
 // A Queue backend is used for pushing and popping elements.
+//
+// Items can be popped in two modes:
+//   - [Queue.Pop] removes the item from the queue as soon as it is popped, so the item is lost if the
+//     caller fails to process it (at-most-once).
+//   - [Queue.PopDelivery] returns a [QueueDelivery] that the caller must acknowledge once it has processed
+//     the item (at-least-once).  Items that are not acknowledged within the queue's visibility timeout are
+//     redelivered, and items that are delivered too many times are moved to the queue's dead-letter queue.
 type Queue interface {
 
 	// Pushes an item to the tail of the queue.
@@ -26,4 +34,42 @@ type Queue interface {
 	// Reports whether the item was pushed to the queue, or if an error was encountered.
 	// A context cancellation/timeout is not considered an error.
 	Pop(ctx context.Context, dst interface{}) (bool, error)
+
+	// Pops an item from the front of the queue without removing it from the queue.
+	//
+	// This call will block until an item is successfully popped, or until the context
+	// is cancelled.
+	//
+	// dst must be a pointer type that can receive the item popped from the queue.
+	//
+	// The item must be acknowledged with [QueueDelivery.Ack] once it has been processed.  Until then, it
+	// is invisible to other calls to Pop and PopDelivery.  If it isn't acknowledged within the queue's
+	// visibility timeout, or if it is rejected with [QueueDelivery.Nack], it is delivered again.  Once an
+	// item has been delivered the queue's maximum number of times, it is moved to the queue's dead-letter
+	// queue instead.  Redelivered items might not keep their position in the queue.
+	//
+	// If the item can't be copied to dst, it is moved to the dead-letter queue and an error is returned.
+	//
+	// Returns the delivery, or nil and false if the context was cancelled.
+	PopDelivery(ctx context.Context, dst interface{}) (QueueDelivery, bool, error)
 }
+
+// An item popped with [Queue.PopDelivery] that hasn't been acknowledged yet.
+type QueueDelivery interface {
+	// Acknowledges that the item has been processed, which removes it from the queue.
+	Ack(ctx context.Context) error
+
+	// Rejects the item.  If requeue is true, the item is delivered again, unless it has been delivered
+	// the queue's maximum number of times; otherwise, or if it has, the item is moved to the queue's
+	// dead-letter queue.
+	Nack(ctx context.Context, requeue bool) error
+
+	// The number of times the item has been delivered, including this delivery.
+	Deliveries() int
+}
+
+// Returned, possibly wrapped, by [QueueDelivery.Ack] and [QueueDelivery.Nack] when the delivery's
+// visibility timeout elapsed before it was acknowledged, so the item has already been redelivered or
+// moved to the dead-letter queue, or when the delivery was already acknowledged.  Use errors.Is to
+// check for it.
+var ErrDeliveryExpired = errors.New("queue delivery expired")
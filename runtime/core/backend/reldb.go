@@ -3,6 +3,7 @@ package backend
 import (
 	"context"
 	"database/sql"
+	"errors"
 )
 
 // A Relational database backend is used for storing and querying structured data using SQL queries.
@@ -39,4 +40,78 @@ type RelationalDB interface {
 	//
 	// Uses [github.com/jmoiron/sqlx] to marshal query results into dst.
 	Get(ctx context.Context, dst interface{}, query string, args ...any) error
+
+	// BeginTx starts a transaction.  All of the transaction's queries run on the same connection, and
+	// none of its changes are visible to other connections until it is committed.  The transaction
+	// must be finished by calling Commit or Rollback.
+	//
+	// If ctx is canceled before the transaction is committed, the transaction is rolled back.
+	//
+	// Use [WithTx] to run a function in a transaction and retry it if it conflicts with another
+	// transaction.
+	BeginTx(ctx context.Context, opts TxOptions) (RelationalTx, error)
+}
+
+// Options for [RelationalDB.BeginTx]
+type TxOptions struct {
+	// The isolation level of the transaction, e.g. [sql.LevelSerializable].  If zero, the database's
+	// default isolation level is used.  Returns an error if the database doesn't support the level.
+	Isolation sql.IsolationLevel
+
+	// If true, the transaction is read-only.  Databases that support read-only transactions reject
+	// writes within them.
+	ReadOnly bool
+}
+
+// A transaction started by [RelationalDB.BeginTx].  The query methods behave like those of
+// [RelationalDB], except that they run within the transaction.
+//
+// Errors caused by the transaction conflicting with a concurrent transaction, such as serialization
+// failures and deadlocks, wrap [ErrTransactionConflict].
+type RelationalTx interface {
+	// Exec executes a query without returning any rows.  See [RelationalDB.Exec].
+	Exec(ctx context.Context, query string, args ...any) (sql.Result, error)
+
+	// Query executes a query that returns rows, typically a SELECT.  See [RelationalDB.Query].
+	Query(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+
+	// Prepare creates a prepared statement that runs within the transaction.  See [RelationalDB.Prepare].
+	Prepare(ctx context.Context, query string) (*sql.Stmt, error)
+
+	// Select using this transaction.  See [RelationalDB.Select].
+	Select(ctx context.Context, dst interface{}, query string, args ...any) error
+
+	// Get using this transaction.  See [RelationalDB.Get].
+	Get(ctx context.Context, dst interface{}, query string, args ...any) error
+
+	// Commits the transaction.  Returns [sql.ErrTxDone] if the transaction was already committed or
+	// rolled back.
+	Commit(ctx context.Context) error
+
+	// Rolls back the transaction.  Returns [sql.ErrTxDone] if the transaction was already committed or
+	// rolled back.
+	Rollback(ctx context.Context) error
+}
+
+// Runs fn in a transaction on db and commits it.  If fn returns an error, the transaction is rolled
+// back and the error is returned.
+//
+// If fn or the commit fails with [ErrTransactionConflict], e.g. because of a serialization failure or
+// deadlock, the transaction is rolled back and fn is run again in a new transaction, after a short
+// random delay, until it succeeds or ctx is done.  fn can therefore be called more than once, and
+// should not have side effects outside of the transaction.
+func WithTx(ctx context.Context, db RelationalDB, opts TxOptions, fn func(ctx context.Context, tx RelationalTx) error) error {
+	return retryConflicts(ctx, func() error {
+		tx, err := db.BeginTx(ctx, opts)
+		if err != nil {
+			return err
+		}
+		if err := fn(ctx, tx); err != nil {
+			if rollbackErr := tx.Rollback(ctx); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				return errors.Join(err, rollbackErr)
+			}
+			return err
+		}
+		return tx.Commit(ctx)
+	})
 }
@@ -0,0 +1,33 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Returned, possibly wrapped, when a transaction cannot be committed because it conflicts with a
+// concurrent transaction, e.g. because of a write conflict, serialization failure or deadlock.
+// The transaction can be retried.  Use errors.Is to check for it.
+var ErrTransactionConflict = errors.New("transaction conflict")
+
+// Calls attempt until it returns an error that isn't [ErrTransactionConflict], backing off for a
+// short random delay between attempts.  Gives up when ctx is done.
+func retryConflicts(ctx context.Context, attempt func() error) error {
+	backoff := time.Millisecond
+	for {
+		err := attempt()
+		if err == nil || !errors.Is(err, ErrTransactionConflict) {
+			return err
+		}
+
+		delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff)))
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+		backoff = min(2*backoff, 100*time.Millisecond)
+	}
+}
@@ -0,0 +1,99 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+	"golang.org/x/exp/slog"
+)
+
+// The migration command set with [SetCommand]
+var command string
+
+// Sets the migration command that [Run] runs when each database is created, instead of applying the
+// migrations that haven't been applied.  Called by the main func of a process that was started with
+// the --migrate flag, before any database is created; the process should then exit instead of serving
+// requests.
+func SetCommand(cmd string) {
+	command = cmd
+}
+
+// Returns the migration command set with [SetCommand], or the empty string if the process was
+// started normally.
+func Command() string {
+	return command
+}
+
+// Migrates the database db, named name, using the migrations registered as source for the given
+// dialect.  lock is passed to [New].
+//
+// When the process is started normally, the migrations that haven't been applied are applied.
+// When a command was set with [SetCommand], the command is run instead:
+//   - up applies the migrations that haven't been applied
+//   - down rolls back the newest applied migration, and down:<steps> rolls back the newest steps
+//   - status prints the status of each migration to stdout
+func Run(ctx context.Context, name string, db backend.RelationalDB, source string, dialect string, lock LockFunc) error {
+	migrations, err := Lookup(source, dialect)
+	if err != nil {
+		return err
+	}
+	m, err := New(db, migrations, lock)
+	if err != nil {
+		return err
+	}
+
+	cmd := Command()
+	switch {
+	case cmd == "" || cmd == "up":
+		count, err := m.Up(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to migrate %v: %w", name, err)
+		}
+		slog.Info(fmt.Sprintf("%v applied %v migrations from %v", name, count, source))
+	case cmd == "down" || strings.HasPrefix(cmd, "down:"):
+		steps := 1
+		if cmd != "down" {
+			steps, err = strconv.Atoi(strings.TrimPrefix(cmd, "down:"))
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("invalid number of migrations to roll back in --migrate=%v", cmd)
+			}
+		}
+		count, err := m.Down(ctx, steps)
+		if err != nil {
+			return fmt.Errorf("unable to roll back %v: %w", name, err)
+		}
+		slog.Info(fmt.Sprintf("%v rolled back %v migrations from %v", name, count, source))
+	case cmd == "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to get migration status of %v: %w", name, err)
+		}
+		return printStatus(os.Stdout, name, statuses)
+	default:
+		return fmt.Errorf("unknown migration command --migrate=%v; expected up, down, down:<steps>, or status", cmd)
+	}
+	return nil
+}
+
+// Prints a table of the status of each migration of the database named name
+func printStatus(out io.Writer, name string, statuses []Status) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "DATABASE\tVERSION\tNAME\tAPPLIED\n")
+	for _, status := range statuses {
+		applied := "pending"
+		if status.Applied {
+			applied = status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		if status.Unknown {
+			applied += " (unknown migration)"
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", name, status.Version, status.Name, applied)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,203 @@
+// Package migrate applies versioned schema migrations to a [backend.RelationalDB].
+//
+// A service ships the DDL for its database as migrations: pairs of SQL files, typically embedded
+// in the service's package, that are registered under a name when the package is initialized:
+//
+//	//go:embed migrations
+//	var migrations embed.FS
+//
+//	func init() {
+//		migrate.Register("catalogue", migrations, "migrations")
+//	}
+//
+// Each migration is a file named <version>_<description>.up.sql, which applies the migration, and
+// optionally a file named <version>_<description>.down.sql, which reverts it, e.g.
+// 0001_create_tables.up.sql.  Versions are positive integers, and migrations are applied in
+// ascending order of version.  A migration without a down file cannot be rolled back.
+//
+// SQL that differs between databases can be written for a specific dialect, e.g.
+// 0001_create_tables.mysql.up.sql and 0001_create_tables.sqlite.up.sql.  A file for the
+// database's dialect takes precedence over a file without a dialect.
+//
+// The relational database plugins apply registered migrations when the database is created, e.g.
+// with the Migrations option of simple.RelationalDB or mysql.Container; see [Run].  The versions
+// that have been applied are recorded in the database's schema_migrations table.
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A versioned schema migration
+type Migration struct {
+	Version    int64
+	Name       string // The description from the migration's file names
+	Up         string // The SQL statements that apply the migration
+	Down       string // The SQL statements that revert the migration
+	Reversible bool   // Whether the migration has a down file
+}
+
+// The migrations that have been registered with [Register], by name
+var registry = struct {
+	sync.Mutex
+	sources map[string]source
+}{sources: make(map[string]source)}
+
+type source struct {
+	fsys fs.FS
+	dir  string
+}
+
+// Registers the migrations in the directory dir of fsys under the given name, so that databases
+// can be configured to apply them.  Typically called from the init function of the package that
+// embeds the migrations.  Panics if migrations are already registered with the name.
+//
+// The migrations are parsed when they are looked up, so any error in them is reported when a
+// database that uses them is created.
+func Register(name string, fsys fs.FS, dir string) {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, exists := registry.sources[name]; exists {
+		panic(fmt.Sprintf("migrations %q are already registered", name))
+	}
+	registry.sources[name] = source{fsys: fsys, dir: dir}
+}
+
+// Returns the migrations registered under the given name, for a database of the given dialect
+func Lookup(name string, dialect string) ([]Migration, error) {
+	registry.Lock()
+	src, exists := registry.sources[name]
+	registry.Unlock()
+	if !exists {
+		return nil, fmt.Errorf("no migrations are registered as %q; the package that registers them must be imported by the process", name)
+	}
+	migrations, err := Parse(src.fsys, src.dir, dialect)
+	if err != nil {
+		return nil, fmt.Errorf("invalid migrations %q: %w", name, err)
+	}
+	return migrations, nil
+}
+
+// Matches the names of migration files: version, description, optional dialect, and direction
+var filePattern = regexp.MustCompile(`^(\d+)_([\w-]+)(?:\.(\w+))?\.(up|down)\.sql$`)
+
+// Parses the migrations in the directory dir of fsys for a database of the given dialect, and
+// returns them in ascending order of version.  Files whose names don't end in .sql are ignored.
+func Parse(fsys fs.FS, dir string, dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type file struct {
+		contents string
+		dialect  bool // Whether the file is specific to the dialect
+		exists   bool
+	}
+	type versionFiles struct {
+		name     string
+		up, down file
+	}
+	versions := make(map[int64]*versionFiles)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		match := filePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("%v is not named <version>_<description>[.<dialect>].(up|down).sql", entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("%v has an invalid version", entry.Name())
+		}
+		v, exists := versions[version]
+		if !exists {
+			v = &versionFiles{name: match[2]}
+			versions[version] = v
+		} else if v.name != match[2] {
+			return nil, fmt.Errorf("migration %v is named both %v and %v", version, v.name, match[2])
+		}
+		if match[3] != "" && match[3] != dialect {
+			continue
+		}
+		f := &v.up
+		if match[4] == "down" {
+			f = &v.down
+		}
+		if f.exists && f.dialect == (match[3] != "") {
+			return nil, fmt.Errorf("migration %v has more than one %v file", version, match[4])
+		}
+		if f.exists && f.dialect {
+			continue
+		}
+		contents, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		*f = file{contents: string(contents), dialect: match[3] != "", exists: true}
+	}
+
+	var migrations []Migration
+	for version, v := range versions {
+		if !v.up.exists {
+			return nil, fmt.Errorf("migration %v_%v has no up file for dialect %v", version, v.name, dialect)
+		}
+		migrations = append(migrations, Migration{
+			Version:    version,
+			Name:       v.name,
+			Up:         v.up.contents,
+			Down:       v.down.contents,
+			Reversible: v.down.exists,
+		})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Splits SQL into statements separated by semicolons.  Semicolons in quoted strings and identifiers,
+// and in comments, don't separate statements.  Empty statements are omitted.
+func splitStatements(sql string) []string {
+	var statements []string
+	start := 0
+	add := func(end int) {
+		if statement := strings.TrimSpace(sql[start:end]); statement != "" {
+			statements = append(statements, statement)
+		}
+		start = end + 1
+	}
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; {
+		case c == ';':
+			add(i)
+		case c == '\'' || c == '"' || c == '`':
+			// Quotes are escaped by doubling them, which this treats as two adjacent strings
+			if end := strings.IndexByte(sql[i+1:], c); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(sql)
+			}
+		case strings.HasPrefix(sql[i:], "--"):
+			if end := strings.IndexByte(sql[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(sql)
+			}
+		case strings.HasPrefix(sql[i:], "/*"):
+			if end := strings.Index(sql[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(sql)
+			}
+		}
+	}
+	add(len(sql))
+	return statements
+}
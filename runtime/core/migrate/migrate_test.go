@@ -0,0 +1,238 @@
+package migrate_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/migrate"
+	"github.com/blueprint-uservices/blueprint/runtime/plugins/sqlitereldb"
+	"github.com/stretchr/testify/require"
+)
+
+var teaMigrations = fstest.MapFS{
+	"migrations/0001_create_teas.up.sql":      {Data: []byte("CREATE TABLE teas (id INTEGER PRIMARY KEY, name TEXT);\nINSERT INTO teas (name) VALUES ('Oolong; Formosa');")},
+	"migrations/0001_create_teas.down.sql":    {Data: []byte("DROP TABLE teas;")},
+	"migrations/0002_add_rating.up.sql":       {Data: []byte("-- Ratings are out of 10;\nALTER TABLE teas ADD COLUMN rating INTEGER DEFAULT 5;")},
+	"migrations/0002_add_rating.mysql.up.sql": {Data: []byte("ALTER TABLE teas ADD COLUMN rating INT DEFAULT 5 NOT NULL;")},
+	"migrations/0002_add_rating.down.sql":     {Data: []byte("ALTER TABLE teas DROP COLUMN rating;")},
+	"migrations/0003_add_sencha.up.sql":       {Data: []byte("INSERT INTO teas (name) VALUES ('Sencha');")},
+	"migrations/README.md":                    {Data: []byte("Migrations for the teas database")},
+}
+
+func init() {
+	migrate.Register("teas", teaMigrations, "migrations")
+}
+
+func TestParse(t *testing.T) {
+	migrations, err := migrate.Parse(teaMigrations, "migrations", "sqlite")
+	require.NoError(t, err)
+	require.Len(t, migrations, 3)
+	require.Equal(t, int64(1), migrations[0].Version)
+	require.Equal(t, "create_teas", migrations[0].Name)
+	require.True(t, migrations[0].Reversible)
+	require.Contains(t, migrations[1].Up, "rating INTEGER")
+	require.False(t, migrations[2].Reversible)
+
+	// A file for the dialect takes precedence
+	migrations, err = migrate.Parse(teaMigrations, "migrations", "mysql")
+	require.NoError(t, err)
+	require.Contains(t, migrations[1].Up, "rating INT DEFAULT 5 NOT NULL")
+
+	for _, invalid := range []fstest.MapFS{
+		{"m/1_a.postgres.up.sql": {}},
+		{"m/create_teas.up.sql": {}},
+		{"m/0_create_teas.up.sql": {}},
+		{"m/1_create teas.up.sql": {}},
+		{"m/1_a.up.sql": {}, "m/1_b.down.sql": {}},
+		{"m/1_a.up.sql": {}, "m/01_a.up.sql": {}},
+		{"m/1_a.down.sql": {}},
+	} {
+		_, err := migrate.Parse(invalid, "m", "sqlite")
+		require.Error(t, err, "%v", invalid)
+	}
+}
+
+func teaNames(t *testing.T, db *sqlitereldb.SqliteRelDB) []string {
+	var names []string
+	require.NoError(t, db.Select(context.Background(), &names, `SELECT name FROM teas ORDER BY id;`))
+	return names
+}
+
+func TestUpDown(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlitereldb.NewSqliteRelDB(ctx)
+	require.NoError(t, err)
+	defer db.Close()
+
+	all, err := migrate.Parse(teaMigrations, "migrations", "sqlite")
+	require.NoError(t, err)
+
+	// Apply the first two migrations, then all of them
+	m, err := migrate.New(db, all[:2], nil)
+	require.NoError(t, err)
+	count, err := m.Up(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	require.Equal(t, []string{"Oolong; Formosa"}, teaNames(t, db))
+	var rating int
+	require.NoError(t, db.Get(ctx, &rating, `SELECT rating FROM teas;`))
+	require.Equal(t, 5, rating)
+
+	m, err = migrate.New(db, all, nil)
+	require.NoError(t, err)
+	count, err = m.Up(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	require.Equal(t, []string{"Oolong; Formosa", "Sencha"}, teaNames(t, db))
+
+	count, err = m.Up(ctx)
+	require.NoError(t, err)
+	require.Zero(t, count)
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	for _, status := range statuses {
+		require.True(t, status.Applied)
+		require.False(t, status.AppliedAt.IsZero())
+	}
+
+	// The newest migration has no down file
+	_, err = m.Down(ctx, 1)
+	require.Error(t, err)
+
+	// Without the newest migration, it is unknown and can't be rolled back either
+	m, err = migrate.New(db, all[:2], nil)
+	require.NoError(t, err)
+	statuses, err = m.Status(ctx)
+	require.NoError(t, err)
+	require.True(t, statuses[2].Unknown)
+	_, err = m.Down(ctx, 1)
+	require.Error(t, err)
+
+	// Roll back to an empty database
+	_, err = db.Exec(ctx, `DELETE FROM schema_migrations WHERE version = 3;`)
+	require.NoError(t, err)
+	count, err = m.Down(ctx, 5)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	_, err = db.Exec(ctx, `SELECT * FROM teas;`)
+	require.Error(t, err)
+	statuses, err = m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	require.False(t, statuses[0].Applied)
+}
+
+func TestUpFailure(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlitereldb.NewSqliteRelDB(ctx)
+	require.NoError(t, err)
+	defer db.Close()
+
+	m, err := migrate.New(db, []migrate.Migration{
+		{Version: 1, Name: "create_teas", Up: "CREATE TABLE teas (id INTEGER PRIMARY KEY, name TEXT);"},
+		{Version: 2, Name: "bad", Up: "INSERT INTO teas (name) VALUES ('Sencha'); INSERT INTO nonexistent VALUES (1);"},
+	}, nil)
+	require.NoError(t, err)
+	count, err := m.Up(ctx)
+	require.Error(t, err)
+	require.Equal(t, 1, count)
+
+	// The failed migration is rolled back entirely
+	require.Empty(t, teaNames(t, db))
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.True(t, statuses[0].Applied)
+	require.False(t, statuses[1].Applied)
+
+	// A migration older than an applied one is not applied
+	_, err = db.Exec(ctx, `INSERT INTO schema_migrations VALUES (3, 'newer', '2024-01-01T00:00:00Z');`)
+	require.NoError(t, err)
+	_, err = m.Up(ctx)
+	require.Error(t, err)
+
+	_, err = migrate.New(db, []migrate.Migration{{Version: 1, Name: "a"}, {Version: 1, Name: "b"}}, nil)
+	require.Error(t, err)
+	_, err = migrate.New(db, []migrate.Migration{{Version: 1, Name: "a'b"}}, nil)
+	require.Error(t, err)
+}
+
+func TestConcurrentUp(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlitereldb.NewSqliteRelDB(ctx)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var migrations []migrate.Migration
+	for i := int64(1); i <= 5; i++ {
+		migrations = append(migrations, migrate.Migration{Version: i, Name: "seed", Up: "CREATE TABLE IF NOT EXISTS teas (id INTEGER PRIMARY KEY, name TEXT); INSERT INTO teas (name) VALUES ('Sencha');"})
+	}
+
+	// Each migration is applied exactly once
+	var wg sync.WaitGroup
+	counts := make([]int, 4)
+	for i := range counts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m, err := migrate.New(db, migrations, nil)
+			require.NoError(t, err)
+			counts[i], err = m.Up(ctx)
+			require.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, 5, counts[0]+counts[1]+counts[2]+counts[3])
+	require.Len(t, teaNames(t, db), 5)
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlitereldb.NewSqliteRelDB(ctx)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.Error(t, migrate.Run(ctx, "teas", db, "unregistered", "sqlite", nil))
+
+	require.Panics(t, func() { migrate.Register("teas", teaMigrations, "migrations") })
+
+	locks, unlocks := 0, 0
+	lock := func(ctx context.Context) (func(), error) {
+		locks++
+		return func() { unlocks++ }, nil
+	}
+	require.NoError(t, migrate.Run(ctx, "teas", db, "teas", "sqlite", lock))
+	require.Equal(t, 1, locks)
+	require.Equal(t, 1, unlocks)
+	require.Equal(t, []string{"Oolong; Formosa", "Sencha"}, teaNames(t, db))
+}
+
+func TestCommand(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlitereldb.NewSqliteRelDB(ctx)
+	require.NoError(t, err)
+	defer db.Close()
+	defer migrate.SetCommand("")
+
+	// Status doesn't apply migrations
+	migrate.SetCommand("status")
+	require.NoError(t, migrate.Run(ctx, "teas", db, "teas", "sqlite", nil))
+	_, err = db.Exec(ctx, `SELECT * FROM teas;`)
+	require.Error(t, err)
+
+	migrate.SetCommand("up")
+	require.NoError(t, migrate.Run(ctx, "teas", db, "teas", "sqlite", nil))
+	require.Equal(t, []string{"Oolong; Formosa", "Sencha"}, teaNames(t, db))
+
+	// The newest migration can't be rolled back
+	migrate.SetCommand("down")
+	require.Error(t, migrate.Run(ctx, "teas", db, "teas", "sqlite", nil))
+
+	for _, invalid := range []string{"down:0", "down:two", "sideways"} {
+		migrate.SetCommand(invalid)
+		require.Error(t, migrate.Run(ctx, "teas", db, "teas", "sqlite", nil), invalid)
+	}
+}
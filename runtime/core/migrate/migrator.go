@@ -0,0 +1,260 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+)
+
+// The table in which the applied migrations are recorded.
+//
+// Statements on the table don't use placeholders, whose syntax differs between databases; the
+// values in them are versions, names that match [filePattern], and timestamps.
+const versionTable = "schema_migrations"
+
+var createVersionTable = `CREATE TABLE IF NOT EXISTS ` + versionTable + ` (
+	version BIGINT NOT NULL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	applied_at VARCHAR(64) NOT NULL
+)`
+
+// Acquires a lock that excludes other processes from migrating a database, and returns a function
+// that releases it.
+type LockFunc func(ctx context.Context) (unlock func(), err error)
+
+// Migrations within a process are serialized, whatever the database
+var processLock sync.Mutex
+
+// Applies and rolls back migrations of a database
+type Migrator struct {
+	db         backend.RelationalDB
+	migrations []Migration
+	lock       LockFunc
+}
+
+// The status of a migration in a database
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time // Zero if the migration hasn't been applied
+	Unknown   bool      // Whether the migration was applied to the database but isn't one of the Migrator's migrations
+}
+
+type appliedRow struct {
+	Version   int64  `db:"version"`
+	Name      string `db:"name"`
+	AppliedAt string `db:"applied_at"`
+}
+
+// Returns a [Migrator] for the migrations of db.
+//
+// Each migration is applied or rolled back in a transaction, along with the change to the version
+// table.  On databases where DDL statements commit implicitly, such as MySQL, a migration that
+// fails part way through must be repaired by hand.
+//
+// lock, if not nil, is held while migrating, to exclude other processes.  Otherwise, processes that
+// migrate the same database concurrently rely on conflicts between their transactions.
+func New(db backend.RelationalDB, migrations []Migration, lock LockFunc) (*Migrator, error) {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i := range sorted {
+		if sorted[i].Version <= 0 || !filePattern.MatchString(fmt.Sprintf("%d_%s.up.sql", sorted[i].Version, sorted[i].Name)) {
+			return nil, fmt.Errorf("invalid migration %v_%v", sorted[i].Version, sorted[i].Name)
+		}
+		if i > 0 && sorted[i].Version == sorted[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %v", sorted[i].Version)
+		}
+	}
+	return &Migrator{db: db, migrations: sorted, lock: lock}, nil
+}
+
+// Acquires the process lock and the Migrator's lock, and creates the version table
+func (m *Migrator) acquire(ctx context.Context) (unlock func(), err error) {
+	processLock.Lock()
+	unlock = processLock.Unlock
+	if m.lock != nil {
+		unlockDB, err := m.lock(ctx)
+		if err != nil {
+			processLock.Unlock()
+			return nil, fmt.Errorf("unable to lock database for migration: %w", err)
+		}
+		unlock = func() {
+			unlockDB()
+			processLock.Unlock()
+		}
+	}
+	err = backend.WithTx(ctx, m.db, backend.TxOptions{}, func(ctx context.Context, tx backend.RelationalTx) error {
+		_, err := tx.Exec(ctx, createVersionTable)
+		return err
+	})
+	if err != nil {
+		unlock()
+		return nil, fmt.Errorf("unable to create %v table: %w", versionTable, err)
+	}
+	return unlock, nil
+}
+
+// Returns the applied migrations, in ascending order of version
+func (m *Migrator) applied(ctx context.Context) ([]appliedRow, error) {
+	var rows []appliedRow
+	err := m.db.Select(ctx, &rows, `SELECT version, name, applied_at FROM `+versionTable+` ORDER BY version`)
+	return rows, err
+}
+
+// Returns true if the migration with the given version has been applied, as seen by tx
+func isApplied(ctx context.Context, tx backend.RelationalTx, version int64) (bool, error) {
+	var count int
+	err := tx.Get(ctx, &count, fmt.Sprintf(`SELECT COUNT(*) FROM %v WHERE version = %d`, versionTable, version))
+	return count > 0, err
+}
+
+// Executes each of the statements in sql
+func execAll(ctx context.Context, tx backend.RelationalTx, sql string) error {
+	for _, statement := range splitStatements(sql) {
+		if _, err := tx.Exec(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Applies the migrations that haven't been applied, in ascending order of version, and returns the
+// number applied.  Fails without applying any migrations if one that hasn't been applied is older
+// than the newest one that has.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	unlock, err := m.acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	rows, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	applied := make(map[int64]bool)
+	var newest int64
+	for _, row := range rows {
+		applied[row.Version] = true
+		newest = max(newest, row.Version)
+	}
+	for _, migration := range m.migrations {
+		if !applied[migration.Version] && migration.Version < newest {
+			return 0, fmt.Errorf("migration %v_%v has not been applied, but is older than the applied migration %v", migration.Version, migration.Name, newest)
+		}
+	}
+
+	count := 0
+	for _, migration := range m.migrations {
+		if applied[migration.Version] {
+			continue
+		}
+		ran := false
+		err := backend.WithTx(ctx, m.db, backend.TxOptions{}, func(ctx context.Context, tx backend.RelationalTx) error {
+			// Another process might have applied the migration in the meantime
+			if done, err := isApplied(ctx, tx, migration.Version); err != nil || done {
+				return err
+			}
+			if err := execAll(ctx, tx, migration.Up); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, fmt.Sprintf(`INSERT INTO %v (version, name, applied_at) VALUES (%d, '%s', '%s')`,
+				versionTable, migration.Version, migration.Name, time.Now().UTC().Format(time.RFC3339)))
+			ran = err == nil
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("unable to apply migration %v_%v: %w", migration.Version, migration.Name, err)
+		}
+		if ran {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Rolls back the newest steps applied migrations, newest first, and returns the number rolled back.
+// Fails if one of them isn't reversible or isn't one of the Migrator's migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	unlock, err := m.acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	rows, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	migrations := make(map[int64]Migration)
+	for _, migration := range m.migrations {
+		migrations[migration.Version] = migration
+	}
+
+	count := 0
+	for i := len(rows) - 1; i >= 0 && count < steps; i-- {
+		migration, known := migrations[rows[i].Version]
+		if !known {
+			return count, fmt.Errorf("unable to roll back migration %v_%v; it is not one of the migrations", rows[i].Version, rows[i].Name)
+		}
+		if !migration.Reversible {
+			return count, fmt.Errorf("unable to roll back migration %v_%v; it has no down file", migration.Version, migration.Name)
+		}
+		err := backend.WithTx(ctx, m.db, backend.TxOptions{}, func(ctx context.Context, tx backend.RelationalTx) error {
+			// Another process might have rolled back the migration in the meantime
+			if done, err := isApplied(ctx, tx, migration.Version); err != nil || !done {
+				return err
+			}
+			if err := execAll(ctx, tx, migration.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, fmt.Sprintf(`DELETE FROM %v WHERE version = %d`, versionTable, migration.Version))
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("unable to roll back migration %v_%v: %w", migration.Version, migration.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Returns the status of the Migrator's migrations, and of any other migrations that have been
+// applied to the database, in ascending order of version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	unlock, err := m.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	rows, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make(map[int64]*Status)
+	for _, migration := range m.migrations {
+		statuses[migration.Version] = &Status{Version: migration.Version, Name: migration.Name}
+	}
+	for _, row := range rows {
+		status, known := statuses[row.Version]
+		if !known {
+			status = &Status{Version: row.Version, Name: row.Name, Unknown: true}
+			statuses[row.Version] = status
+		}
+		status.Applied = true
+		status.AppliedAt, _ = time.Parse(time.RFC3339, row.AppliedAt)
+	}
+
+	var result []Status
+	for _, status := range statuses {
+		result = append(result, *status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
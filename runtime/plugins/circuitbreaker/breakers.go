@@ -0,0 +1,105 @@
+package circuitbreaker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"golang.org/x/exp/slog"
+)
+
+// Breakers manages the circuit breakers of a client.  Calls to all methods either share a
+// single breaker, or each method has its own breaker.
+//
+// State transitions are emitted as OpenTelemetry metrics using a meter obtained from [backend.Meter]:
+//   - circuitbreaker.transitions counts transitions, with attributes for the method and the from and to states
+//   - circuitbreaker.state reports the current state of each breaker, as 0 (closed), 1 (half-open) or 2 (open)
+type Breakers struct {
+	name      string
+	config    Config
+	perMethod bool
+
+	lock     sync.Mutex
+	breakers map[string]*Breaker
+
+	transitions metric.Int64Counter
+}
+
+// Instantiates the circuit breakers of the client with the given name.  If perMethod is true,
+// each method has its own breaker; otherwise all methods share one breaker.
+//
+// If no metric collector is available, the breakers are created without metrics.
+func NewBreakers(ctx context.Context, name string, config Config, perMethod bool) (*Breakers, error) {
+	bs := &Breakers{
+		name:      name,
+		config:    config,
+		perMethod: perMethod,
+		breakers:  make(map[string]*Breaker),
+	}
+
+	meter, err := backend.Meter(ctx, name)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Circuit breaker %v will not emit metrics: %v", name, err))
+		meter = noop.NewMeterProvider().Meter(name)
+	}
+	if bs.transitions, err = meter.Int64Counter("circuitbreaker.transitions",
+		metric.WithDescription("Number of circuit breaker state transitions")); err != nil {
+		return nil, err
+	}
+	if _, err = meter.Int64ObservableGauge("circuitbreaker.state",
+		metric.WithDescription("Circuit breaker state: 0 is closed, 1 is half-open, 2 is open"),
+		metric.WithInt64Callback(bs.observe)); err != nil {
+		return nil, err
+	}
+	return bs, nil
+}
+
+// Reports the state of every breaker
+func (bs *Breakers) observe(ctx context.Context, observer metric.Int64Observer) error {
+	bs.lock.Lock()
+	breakers := make(map[string]*Breaker, len(bs.breakers))
+	for method, b := range bs.breakers {
+		breakers[method] = b
+	}
+	bs.lock.Unlock()
+
+	for method, b := range breakers {
+		observer.Observe(int64(b.State()), metric.WithAttributes(
+			attribute.String("client", bs.name),
+			attribute.String("method", method),
+		))
+	}
+	return nil
+}
+
+// Returns the breaker for calls to method
+func (bs *Breakers) Get(method string) *Breaker {
+	if !bs.perMethod {
+		method = "*"
+	}
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	if b, exists := bs.breakers[method]; exists {
+		return b
+	}
+	b := NewBreaker(bs.config, func(from, to State) {
+		slog.Info(fmt.Sprintf("Circuit breaker %v for %v transitioned from %v to %v", bs.name, method, from, to))
+		bs.transitions.Add(context.Background(), 1, metric.WithAttributes(
+			attribute.String("client", bs.name),
+			attribute.String("method", method),
+			attribute.String("from", from.String()),
+			attribute.String("to", to.String()),
+		))
+	})
+	bs.breakers[method] = b
+	return b
+}
+
+// Requests permission to call method; see [Breaker.Allow]
+func (bs *Breakers) Allow(method string) (done func(err error), err error) {
+	return bs.Get(method).Allow()
+}
@@ -0,0 +1,221 @@
+// Package circuitbreaker implements the runtime components of Blueprint's circuitbreaker plugin.
+//
+// Circuit breakers do not need to be used directly by application workflow specs.  Instead, this
+// code is included in a compiled application by applying the circuitbreaker modifier to the wiring spec.
+//
+// A [Breaker] moves between three states:
+//   - [Closed]: calls are allowed, and failures are counted over a fixed interval.  Once at least
+//     MinRequests calls have been made in the interval and the fraction that failed reaches
+//     FailureRate, the breaker trips and becomes [Open].
+//   - [Open]: calls are rejected with [ErrOpen].  After OpenDuration the breaker becomes [HalfOpen].
+//   - [HalfOpen]: up to HalfOpenProbes calls are allowed through as probes, and other calls are rejected.
+//     If all probes succeed the breaker becomes [Closed]; if any probe fails it becomes [Open] again.
+package circuitbreaker
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The state of a [Breaker]
+type State int
+
+const (
+	Closed State = iota
+	HalfOpen
+	Open
+)
+
+// Implements fmt.Stringer
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	}
+	return "unknown"
+}
+
+// Returned for calls rejected by a breaker that is open, or half-open with all probes in flight
+var ErrOpen = errors.New("circuit breaker is open")
+
+// Configuration of a [Breaker]
+type Config struct {
+	// The minimum number of calls within an interval before the breaker can trip
+	MinRequests int64
+
+	// The fraction of failed calls within an interval, between 0 and 1, at which the breaker trips
+	FailureRate float64
+
+	// The interval after which call counters are reset while the breaker is closed
+	Interval time.Duration
+
+	// How long the breaker stays open before probing.  Defaults to Interval.
+	OpenDuration time.Duration
+
+	// The number of successful probes required to close a half-open breaker.  Defaults to 1.
+	HalfOpenProbes int64
+}
+
+// Parses the string-encoded fields of a [Config], as passed to the constructors of generated clients.
+// An empty openDuration defaults to interval, and an empty halfOpenProbes defaults to 1.
+func ParseConfig(minRequests string, failureRate string, interval string, openDuration string, halfOpenProbes string) (Config, error) {
+	var config Config
+	var err error
+	if config.MinRequests, err = strconv.ParseInt(minRequests, 10, 64); err != nil {
+		return config, fmt.Errorf("invalid minimum number of requests %q", minRequests)
+	}
+	if config.FailureRate, err = strconv.ParseFloat(failureRate, 64); err != nil {
+		return config, fmt.Errorf("invalid failure rate %q", failureRate)
+	}
+	if config.Interval, err = time.ParseDuration(interval); err != nil {
+		return config, fmt.Errorf("invalid interval %q", interval)
+	}
+	config.OpenDuration = config.Interval
+	if openDuration != "" {
+		if config.OpenDuration, err = time.ParseDuration(openDuration); err != nil {
+			return config, fmt.Errorf("invalid open duration %q", openDuration)
+		}
+	}
+	config.HalfOpenProbes = 1
+	if halfOpenProbes != "" {
+		if config.HalfOpenProbes, err = strconv.ParseInt(halfOpenProbes, 10, 64); err != nil || config.HalfOpenProbes <= 0 {
+			return config, fmt.Errorf("invalid number of half-open probes %q", halfOpenProbes)
+		}
+	}
+	return config, nil
+}
+
+// A Breaker for a single circuit.  A Breaker is safe for concurrent use.
+type Breaker struct {
+	config   Config
+	onChange func(from, to State)
+
+	lock          sync.Mutex
+	state         State
+	windowStart   time.Time
+	requests      int64
+	failures      int64
+	openedAt      time.Time
+	probesStarted int64
+	probesPassed  int64
+}
+
+// Instantiates a closed [Breaker].  If onChange is not nil, it is called on every state transition;
+// it must not call back into the breaker.
+func NewBreaker(config Config, onChange func(from, to State)) *Breaker {
+	if config.OpenDuration <= 0 {
+		config.OpenDuration = config.Interval
+	}
+	if config.HalfOpenProbes <= 0 {
+		config.HalfOpenProbes = 1
+	}
+	return &Breaker{config: config, onChange: onChange, windowStart: time.Now()}
+}
+
+// Returns the current state of the breaker
+func (b *Breaker) State() State {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.advance(time.Now())
+	return b.state
+}
+
+// Transitions to state to.  Must be called with the lock held.
+func (b *Breaker) transition(to State, now time.Time) {
+	from := b.state
+	b.state = to
+	switch to {
+	case Closed:
+		b.windowStart = now
+		b.requests, b.failures = 0, 0
+	case Open:
+		b.openedAt = now
+	case HalfOpen:
+		b.probesStarted, b.probesPassed = 0, 0
+	}
+	if b.onChange != nil && from != to {
+		b.onChange(from, to)
+	}
+}
+
+// Applies time-based transitions.  Must be called with the lock held.
+func (b *Breaker) advance(now time.Time) {
+	switch b.state {
+	case Closed:
+		if b.config.Interval > 0 && now.Sub(b.windowStart) >= b.config.Interval {
+			b.windowStart = now
+			b.requests, b.failures = 0, 0
+		}
+	case Open:
+		if now.Sub(b.openedAt) >= b.config.OpenDuration {
+			b.transition(HalfOpen, now)
+		}
+	}
+}
+
+// Requests permission to make a call.  If the call is allowed, the caller must invoke the
+// returned done func with the call's error once the call completes.  Otherwise, returns [ErrOpen].
+func (b *Breaker) Allow() (done func(err error), err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := time.Now()
+	b.advance(now)
+
+	switch b.state {
+	case Open:
+		return nil, ErrOpen
+	case HalfOpen:
+		if b.probesStarted >= b.config.HalfOpenProbes {
+			return nil, ErrOpen
+		}
+		b.probesStarted++
+		return b.probeDone, nil
+	}
+	windowStart := b.windowStart
+	return func(err error) { b.closedDone(windowStart, err) }, nil
+}
+
+// Records the outcome of a call made while closed
+func (b *Breaker) closedDone(windowStart time.Time, err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := time.Now()
+	b.advance(now)
+
+	// Ignore outcomes from a previous interval or state
+	if b.state != Closed || !b.windowStart.Equal(windowStart) {
+		return
+	}
+	b.requests++
+	if err != nil {
+		b.failures++
+	}
+	if b.requests >= b.config.MinRequests && float64(b.failures) >= b.config.FailureRate*float64(b.requests) && b.failures > 0 {
+		b.transition(Open, now)
+	}
+}
+
+// Records the outcome of a probe made while half-open
+func (b *Breaker) probeDone(err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.state != HalfOpen {
+		return
+	}
+	now := time.Now()
+	if err != nil {
+		b.transition(Open, now)
+		return
+	}
+	b.probesPassed++
+	if b.probesPassed >= b.config.HalfOpenProbes {
+		b.transition(Closed, now)
+	}
+}
@@ -0,0 +1,150 @@
+package circuitbreaker_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/plugins/circuitbreaker"
+	"github.com/stretchr/testify/require"
+)
+
+var errFailed = errors.New("call failed")
+
+// Makes a call through the breaker that returns err
+func call(t *testing.T, b *circuitbreaker.Breaker, err error) error {
+	done, allowErr := b.Allow()
+	if allowErr != nil {
+		return allowErr
+	}
+	done(err)
+	return err
+}
+
+type transition struct {
+	from, to circuitbreaker.State
+}
+
+func TestTripsOnFailureRate(t *testing.T) {
+	var transitions []transition
+	b := circuitbreaker.NewBreaker(circuitbreaker.Config{
+		MinRequests:  4,
+		FailureRate:  0.5,
+		Interval:     time.Hour,
+		OpenDuration: time.Hour,
+	}, func(from, to circuitbreaker.State) { transitions = append(transitions, transition{from, to}) })
+
+	require.NoError(t, call(t, b, nil))
+	require.NoError(t, call(t, b, nil))
+	require.Error(t, call(t, b, errFailed))
+	require.Equal(t, circuitbreaker.Closed, b.State())
+
+	// 2 of 4 requests failed
+	require.Error(t, call(t, b, errFailed))
+	require.Equal(t, circuitbreaker.Open, b.State())
+	require.ErrorIs(t, call(t, b, nil), circuitbreaker.ErrOpen)
+	require.Equal(t, []transition{{circuitbreaker.Closed, circuitbreaker.Open}}, transitions)
+}
+
+func TestIntervalResetsCounters(t *testing.T) {
+	b := circuitbreaker.NewBreaker(circuitbreaker.Config{
+		MinRequests: 2,
+		FailureRate: 1,
+		Interval:    20 * time.Millisecond,
+	}, nil)
+
+	call(t, b, errFailed)
+	time.Sleep(30 * time.Millisecond)
+	call(t, b, errFailed)
+	require.Equal(t, circuitbreaker.Closed, b.State())
+}
+
+func TestHalfOpenProbes(t *testing.T) {
+	var transitions []transition
+	b := circuitbreaker.NewBreaker(circuitbreaker.Config{
+		MinRequests:    1,
+		FailureRate:    1,
+		Interval:       time.Hour,
+		OpenDuration:   20 * time.Millisecond,
+		HalfOpenProbes: 2,
+	}, func(from, to circuitbreaker.State) { transitions = append(transitions, transition{from, to}) })
+
+	call(t, b, errFailed)
+	require.Equal(t, circuitbreaker.Open, b.State())
+
+	time.Sleep(30 * time.Millisecond)
+	require.Equal(t, circuitbreaker.HalfOpen, b.State())
+
+	// Only two probes are allowed through concurrently
+	done1, err := b.Allow()
+	require.NoError(t, err)
+	done2, err := b.Allow()
+	require.NoError(t, err)
+	_, err = b.Allow()
+	require.ErrorIs(t, err, circuitbreaker.ErrOpen)
+
+	done1(nil)
+	require.Equal(t, circuitbreaker.HalfOpen, b.State())
+	done2(nil)
+	require.Equal(t, circuitbreaker.Closed, b.State())
+
+	require.Equal(t, []transition{
+		{circuitbreaker.Closed, circuitbreaker.Open},
+		{circuitbreaker.Open, circuitbreaker.HalfOpen},
+		{circuitbreaker.HalfOpen, circuitbreaker.Closed},
+	}, transitions)
+}
+
+func TestFailedProbeReopens(t *testing.T) {
+	b := circuitbreaker.NewBreaker(circuitbreaker.Config{
+		MinRequests:  1,
+		FailureRate:  1,
+		Interval:     time.Hour,
+		OpenDuration: 20 * time.Millisecond,
+	}, nil)
+
+	call(t, b, errFailed)
+	time.Sleep(30 * time.Millisecond)
+
+	require.Error(t, call(t, b, errFailed))
+	require.Equal(t, circuitbreaker.Open, b.State())
+	require.ErrorIs(t, call(t, b, nil), circuitbreaker.ErrOpen)
+}
+
+func TestPerMethodBreakers(t *testing.T) {
+	config := circuitbreaker.Config{MinRequests: 1, FailureRate: 1, Interval: time.Hour}
+
+	bs, err := circuitbreaker.NewBreakers(context.Background(), "TestPerMethodBreakers", config, true)
+	require.NoError(t, err)
+	done, err := bs.Allow("Failing")
+	require.NoError(t, err)
+	done(errFailed)
+	_, err = bs.Allow("Failing")
+	require.ErrorIs(t, err, circuitbreaker.ErrOpen)
+	_, err = bs.Allow("Healthy")
+	require.NoError(t, err)
+
+	shared, err := circuitbreaker.NewBreakers(context.Background(), "TestSharedBreaker", config, false)
+	require.NoError(t, err)
+	done, err = shared.Allow("Failing")
+	require.NoError(t, err)
+	done(errFailed)
+	_, err = shared.Allow("Healthy")
+	require.ErrorIs(t, err, circuitbreaker.ErrOpen)
+}
+
+func TestParseConfig(t *testing.T) {
+	config, err := circuitbreaker.ParseConfig("100", "0.5", "1s", "", "")
+	require.NoError(t, err)
+	require.Equal(t, circuitbreaker.Config{MinRequests: 100, FailureRate: 0.5, Interval: time.Second, OpenDuration: time.Second, HalfOpenProbes: 1}, config)
+
+	config, err = circuitbreaker.ParseConfig("10", "0.1", "1s", "5s", "3")
+	require.NoError(t, err)
+	require.Equal(t, circuitbreaker.Config{MinRequests: 10, FailureRate: 0.1, Interval: time.Second, OpenDuration: 5 * time.Second, HalfOpenProbes: 3}, config)
+
+	for _, args := range [][5]string{{"x", "0.1", "1s", "", ""}, {"10", "x", "1s", "", ""}, {"10", "0.1", "x", "", ""}, {"10", "0.1", "1s", "x", ""}, {"10", "0.1", "1s", "", "0"}} {
+		_, err := circuitbreaker.ParseConfig(args[0], args[1], args[2], args[3], args[4])
+		require.Error(t, err, args)
+	}
+}
@@ -0,0 +1,72 @@
+// Package deadline implements the runtime components used by Blueprint's RPC plugins to propagate
+// request deadlines from clients to servers.
+//
+// This code does not need to be used directly by application workflow specs.  It is included in a
+// compiled application by the generated HTTP and Thrift clients and servers.  gRPC propagates
+// deadlines natively, so the gRPC plugin only uses [WithTimeout].
+//
+// Like gRPC's grpc-timeout header, a deadline is sent over the wire as the time remaining until it
+// expires, in nanoseconds, so that it does not depend on the clocks of the client and server
+// agreeing.  Servers derive the context passed to the service from the transport request, so that
+// server-side work is cancelled either when the deadline expires or when the caller gives up and
+// disconnects.
+package deadline
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The HTTP header used to propagate deadlines
+const Header = "X-Blueprint-Timeout"
+
+// Returns the time remaining until the deadline of ctx in nanoseconds, or 0 if ctx has no deadline.
+// A deadline that has already passed is encoded as 1ns, so that it still expires on the server.
+func Encode(ctx context.Context) int64 {
+	if d, ok := ctx.Deadline(); ok {
+		return max(int64(time.Until(d)), 1)
+	}
+	return 0
+}
+
+// Returns a child of ctx with the deadline encoded by [Encode], i.e. that expires timeout
+// nanoseconds from now.  If timeout is 0, ctx is returned with no deadline applied.  The returned
+// cancel func must always be called.
+func Decode(ctx context.Context, timeout int64) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(timeout))
+}
+
+// Sets the deadline header of an outgoing HTTP request from ctx.  Does nothing if ctx has no
+// deadline.
+func SetHeader(ctx context.Context, header http.Header) {
+	if d := Encode(ctx); d > 0 {
+		header.Set(Header, strconv.FormatInt(d, 10))
+	}
+}
+
+// Returns the context of an incoming HTTP request with the deadline from its deadline header
+// applied.  The request context is cancelled when the client disconnects.  A missing or malformed
+// header is ignored.  The returned cancel func must always be called.
+func FromRequest(r *http.Request) (context.Context, context.CancelFunc) {
+	d, err := strconv.ParseInt(r.Header.Get(Header), 10, 64)
+	if err != nil {
+		d = 0
+	}
+	return Decode(r.Context(), d)
+}
+
+// Applies timeout to ctx.  Used by clients to apply their configured timeout; if ctx already has an
+// earlier deadline (e.g. one set by the timeouts plugin, or propagated from an upstream request), the
+// earlier deadline applies.  A timeout of 0 or less applies no timeout.  The returned cancel func
+// must always be called.
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,125 @@
+package deadline_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/plugins/deadline"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	require.Equal(t, int64(0), deadline.Encode(context.Background()))
+
+	d := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), d)
+	defer cancel()
+
+	// The remaining time is sent, so the decoded deadline is the original, give or take transit time
+	encoded := deadline.Encode(ctx)
+	require.InDelta(t, int64(time.Minute), encoded, float64(time.Second))
+	decoded, cancel2 := deadline.Decode(context.Background(), encoded)
+	defer cancel2()
+	got, ok := decoded.Deadline()
+	require.True(t, ok)
+	require.WithinDuration(t, d, got, time.Second)
+
+	// An expired deadline is still sent, and expires on the server
+	expired, cancel4 := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel4()
+	require.Equal(t, int64(1), deadline.Encode(expired))
+
+	none, cancel3 := deadline.Decode(context.Background(), 0)
+	defer cancel3()
+	_, ok = none.Deadline()
+	require.False(t, ok)
+}
+
+func TestHeaderRoundTrip(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	deadline.SetHeader(ctx, r.Header)
+	require.NotEmpty(t, r.Header.Get(deadline.Header))
+
+	serverCtx, serverCancel := deadline.FromRequest(r)
+	defer serverCancel()
+	select {
+	case <-serverCtx.Done():
+		require.ErrorIs(t, serverCtx.Err(), context.DeadlineExceeded)
+	case <-time.After(time.Second):
+		t.Fatal("server context was not cancelled at the propagated deadline")
+	}
+}
+
+func TestMissingHeader(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	deadline.SetHeader(context.Background(), r.Header)
+	require.Empty(t, r.Header.Get(deadline.Header))
+
+	r.Header.Set(deadline.Header, "not-a-deadline")
+	ctx, cancel := deadline.FromRequest(r)
+	defer cancel()
+	_, ok := ctx.Deadline()
+	require.False(t, ok)
+}
+
+func TestServerCancelledWhenClientGivesUp(t *testing.T) {
+	cancelled := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := deadline.FromRequest(r)
+		defer cancel()
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	deadline.SetHeader(ctx, req.Header)
+	_, err = http.DefaultClient.Do(req)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	select {
+	case err := <-cancelled:
+		require.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("server-side work was not cancelled")
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	ctx, cancel := deadline.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, ok := ctx.Deadline()
+	require.True(t, ok)
+
+	// A longer caller deadline is shortened by the timeout
+	parent, parentCancel := context.WithTimeout(context.Background(), time.Hour)
+	defer parentCancel()
+	ctx2, cancel2 := deadline.WithTimeout(parent, time.Second)
+	defer cancel2()
+	got, _ := ctx2.Deadline()
+	require.WithinDuration(t, time.Now().Add(time.Second), got, 100*time.Millisecond)
+
+	// A shorter caller deadline is kept
+	parent3, parentCancel3 := context.WithTimeout(context.Background(), time.Second)
+	defer parentCancel3()
+	want, _ := parent3.Deadline()
+	ctx3, cancel3 := deadline.WithTimeout(parent3, time.Hour)
+	defer cancel3()
+	got, _ = ctx3.Deadline()
+	require.Equal(t, want, got)
+
+	// No timeout leaves ctx without a deadline
+	ctx4, cancel4 := deadline.WithTimeout(context.Background(), 0)
+	defer cancel4()
+	_, ok = ctx4.Deadline()
+	require.False(t, ok)
+}
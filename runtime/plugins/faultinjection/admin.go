@@ -0,0 +1,107 @@
+package faultinjection
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/exp/slog"
+)
+
+var (
+	registryLock sync.Mutex
+	registry     = make(map[string]*Injector)
+	adminAddrs   = make(map[string]bool)
+)
+
+func register(injector *Injector) {
+	registryLock.Lock()
+	registry[injector.name] = injector
+	registryLock.Unlock()
+}
+
+// Serves the admin endpoint returned by [AdminHandler] on addr, e.g. 0.0.0.0:9100.
+//
+// The endpoint controls every injector in the process, so it is started at most once per address
+// regardless of how many injectors call ServeAdmin.  An empty addr is ignored.
+func ServeAdmin(addr string) {
+	if addr == "" {
+		return
+	}
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if adminAddrs[addr] {
+		return
+	}
+	adminAddrs[addr] = true
+
+	go func() {
+		slog.Info(fmt.Sprintf("Serving fault injection admin endpoint on %v", addr))
+		if err := http.ListenAndServe(addr, AdminHandler()); err != nil {
+			slog.Error(fmt.Sprintf("Fault injection admin endpoint on %v exited: %v", addr, err))
+		}
+	}()
+}
+
+type injectorStatus struct {
+	Name    string
+	Enabled bool
+	Faults  string
+}
+
+// Returns an [http.Handler] for the admin endpoint that controls all injectors in this process.
+//
+//   - GET /faults returns a JSON list of injectors and their state
+//   - POST /faults/<injector name> updates an injector with the request body; see [Injector.Update]
+func AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/faults", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		registryLock.Lock()
+		var statuses []injectorStatus
+		for _, injector := range registry {
+			var specs []string
+			for _, fault := range injector.Faults() {
+				specs = append(specs, fault.String())
+			}
+			statuses = append(statuses, injectorStatus{injector.name, injector.Enabled(), strings.Join(specs, ",")})
+		}
+		registryLock.Unlock()
+		sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(statuses)
+	})
+	mux.HandleFunc("/faults/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/faults/")
+		registryLock.Lock()
+		injector, exists := registry[name]
+		registryLock.Unlock()
+		if !exists {
+			http.Error(w, fmt.Sprintf("unknown fault injector %v", name), http.StatusNotFound)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := injector.Update(string(body)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
@@ -0,0 +1,236 @@
+// Package faultinjection implements the runtime components of Blueprint's fault injection plugin.
+//
+// Injectors do not need to be used directly by application workflow specs.  Instead, this
+// code is included in a compiled application by applying the faultinjection modifier to the wiring spec.
+//
+// # Fault Specs
+//
+// The faults of an injector are described by a spec string, a comma-separated list of faults
+// of the form method:kind:probability, for example
+//
+//	ReadPost:error:0.1,ComposePost:hang:0.05,*:panic:0.001
+//
+// The method * matches every method.  Valid kinds are error, hang, panic and crash; see [Kind].
+//
+// # Runtime Control
+//
+// Faults can be toggled or replaced without recompiling the application:
+//   - At startup, the environment variable named after the injector (see [EnvVar]) is consulted.
+//     A value of "off" disables the injector; "on" enables it; any other non-empty value is parsed
+//     as a spec that replaces the compiled faults.
+//   - [ServeAdmin] starts an admin HTTP endpoint on an address, e.g. 0.0.0.0:9100.  GET /faults lists
+//     all injectors in the process, and POST /faults/<injector name> with a body of "on", "off" or a
+//     spec updates an injector.
+package faultinjection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/plugins/golang"
+	"golang.org/x/exp/slog"
+)
+
+// The kind of fault to inject
+type Kind string
+
+const (
+	// The call fails with an error wrapping [ErrInjected]
+	Error Kind = "error"
+
+	// The call blocks until the caller's context is done, then fails with the context's error
+	Hang Kind = "hang"
+
+	// The call panics
+	Panic Kind = "panic"
+
+	// The process exits immediately with a non-zero exit code
+	Crash Kind = "crash"
+)
+
+// The error returned by calls that fail due to an injected [Error] fault
+var ErrInjected = errors.New("injected fault")
+
+// A Fault to inject into calls to Method with the given Probability
+type Fault struct {
+	Method      string
+	Kind        Kind
+	Probability float64
+}
+
+// Implements fmt.Stringer; the result can be parsed by [ParseFaults]
+func (f Fault) String() string {
+	return fmt.Sprintf("%v:%v:%v", f.Method, f.Kind, strconv.FormatFloat(f.Probability, 'g', -1, 64))
+}
+
+func (f Fault) matches(method string) bool {
+	return f.Method == "*" || f.Method == method
+}
+
+// Parses a comma-separated fault spec.  The empty string is a valid spec with no faults.
+func ParseFaults(spec string) ([]Fault, error) {
+	var faults []Fault
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid fault %q; expected method:kind:probability", entry)
+		}
+		fault := Fault{Method: parts[0], Kind: Kind(parts[1])}
+		switch fault.Kind {
+		case Error, Hang, Panic, Crash:
+		default:
+			return nil, fmt.Errorf("invalid fault %q; unknown kind %v", entry, parts[1])
+		}
+		p, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil || p < 0 || p > 1 {
+			return nil, fmt.Errorf("invalid fault %q; probability must be between 0 and 1", entry)
+		}
+		fault.Probability = p
+		faults = append(faults, fault)
+	}
+	return faults, nil
+}
+
+// Returns the environment variable that controls the injector with the given name.
+// For example, the injector user_service.server.faults is controlled by USER_SERVICE_SERVER_FAULTS.
+func EnvVar(name string) string {
+	return golang.EnvVar(name)
+}
+
+// An Injector randomly injects faults into calls.  An Injector is safe for concurrent use.
+type Injector struct {
+	name string
+
+	lock    sync.Mutex
+	enabled bool
+	faults  []Fault
+	rng     *rand.Rand
+}
+
+// Instantiates an [Injector] with the given name, injecting the faults described by spec.
+//
+// The injector is registered with the process's admin endpoint, and its initial state
+// is taken from its environment variable if set.
+func NewInjector(name string, spec string) (*Injector, error) {
+	faults, err := ParseFaults(spec)
+	if err != nil {
+		return nil, err
+	}
+	injector := &Injector{
+		name:    name,
+		enabled: true,
+		faults:  faults,
+		rng:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if value := os.Getenv(EnvVar(name)); value != "" {
+		if err := injector.Update(value); err != nil {
+			return nil, fmt.Errorf("environment variable %v: %w", EnvVar(name), err)
+		}
+	}
+	register(injector)
+	return injector, nil
+}
+
+// Returns the name of the injector
+func (injector *Injector) Name() string {
+	return injector.name
+}
+
+// Enables or disables the injector.  A disabled injector does not inject any faults.
+func (injector *Injector) SetEnabled(enabled bool) {
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+	injector.enabled = enabled
+}
+
+// Reports whether the injector is enabled
+func (injector *Injector) Enabled() bool {
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+	return injector.enabled
+}
+
+// Replaces the injector's faults with those described by spec
+func (injector *Injector) SetFaults(spec string) error {
+	faults, err := ParseFaults(spec)
+	if err != nil {
+		return err
+	}
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+	injector.faults = faults
+	return nil
+}
+
+// Returns the current faults of the injector
+func (injector *Injector) Faults() []Fault {
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+	return append([]Fault(nil), injector.faults...)
+}
+
+// Applies a control value: "on" or "off" enable or disable the injector; any other
+// value is parsed as a spec that replaces the injector's faults and enables it.
+func (injector *Injector) Update(value string) error {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "on", "true", "1":
+		injector.SetEnabled(true)
+	case "off", "false", "0":
+		injector.SetEnabled(false)
+	default:
+		if err := injector.SetFaults(value); err != nil {
+			return err
+		}
+		injector.SetEnabled(true)
+	}
+	return nil
+}
+
+// Chooses the fault, if any, to inject into a call to method
+func (injector *Injector) choose(method string) (Fault, bool) {
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+	if !injector.enabled {
+		return Fault{}, false
+	}
+	for _, fault := range injector.faults {
+		if fault.matches(method) && injector.rng.Float64() < fault.Probability {
+			return fault, true
+		}
+	}
+	return Fault{}, false
+}
+
+// Possibly injects a fault into a call to method.  Returns a non-nil error if the call should fail.
+//
+// Faults are considered in the order of the spec, and at most one fault is injected per call.
+func (injector *Injector) Inject(ctx context.Context, method string) error {
+	fault, inject := injector.choose(method)
+	if !inject {
+		return nil
+	}
+	switch fault.Kind {
+	case Error:
+		return fmt.Errorf("%v.%v: %w", injector.name, method, ErrInjected)
+	case Hang:
+		<-ctx.Done()
+		return ctx.Err()
+	case Panic:
+		panic(fmt.Sprintf("%v.%v: injected panic", injector.name, method))
+	case Crash:
+		slog.Error(fmt.Sprintf("%v.%v: injected crash; exiting", injector.name, method))
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package faultinjection_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/plugins/faultinjection"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFaults(t *testing.T) {
+	faults, err := faultinjection.ParseFaults("ReadPost:error:0.1, *:hang:1")
+	require.NoError(t, err)
+	require.Equal(t, []faultinjection.Fault{
+		{Method: "ReadPost", Kind: faultinjection.Error, Probability: 0.1},
+		{Method: "*", Kind: faultinjection.Hang, Probability: 1},
+	}, faults)
+	require.Equal(t, "ReadPost:error:0.1", faults[0].String())
+
+	faults, err = faultinjection.ParseFaults("")
+	require.NoError(t, err)
+	require.Empty(t, faults)
+
+	for _, invalid := range []string{"ReadPost", "ReadPost:explode:0.1", "ReadPost:error:2", "ReadPost:error:x"} {
+		_, err = faultinjection.ParseFaults(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestInjectError(t *testing.T) {
+	injector, err := faultinjection.NewInjector("TestInjectError", "Fails:error:1")
+	require.NoError(t, err)
+
+	err = injector.Inject(context.Background(), "Fails")
+	require.ErrorIs(t, err, faultinjection.ErrInjected)
+
+	err = injector.Inject(context.Background(), "Succeeds")
+	require.NoError(t, err)
+}
+
+func TestInjectHang(t *testing.T) {
+	injector, err := faultinjection.NewInjector("TestInjectHang", "*:hang:1")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = injector.Inject(ctx, "Anything")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestInjectPanic(t *testing.T) {
+	injector, err := faultinjection.NewInjector("TestInjectPanic", "Panics:panic:1")
+	require.NoError(t, err)
+
+	require.Panics(t, func() { injector.Inject(context.Background(), "Panics") })
+}
+
+func TestProbability(t *testing.T) {
+	injector, err := faultinjection.NewInjector("TestProbability", "*:error:0.3")
+	require.NoError(t, err)
+
+	failed := 0
+	for i := 0; i < 10000; i++ {
+		if injector.Inject(context.Background(), "Method") != nil {
+			failed++
+		}
+	}
+	require.InDelta(t, 3000, failed, 300)
+}
+
+func TestUpdate(t *testing.T) {
+	injector, err := faultinjection.NewInjector("TestUpdate", "*:error:1")
+	require.NoError(t, err)
+
+	require.NoError(t, injector.Update("off"))
+	require.False(t, injector.Enabled())
+	require.NoError(t, injector.Inject(context.Background(), "Method"))
+
+	require.NoError(t, injector.Update("on"))
+	require.Error(t, injector.Inject(context.Background(), "Method"))
+
+	require.NoError(t, injector.Update("Other:error:1"))
+	require.NoError(t, injector.Inject(context.Background(), "Method"))
+	require.Error(t, injector.Inject(context.Background(), "Other"))
+
+	require.Error(t, injector.Update("Other:error"))
+}
+
+func TestEnvironmentVariable(t *testing.T) {
+	require.Equal(t, "USER_SERVICE_SERVER_FAULTS", faultinjection.EnvVar("user_service.server.faults"))
+
+	t.Setenv(faultinjection.EnvVar("TestEnvironmentVariable"), "off")
+	injector, err := faultinjection.NewInjector("TestEnvironmentVariable", "*:error:1")
+	require.NoError(t, err)
+	require.False(t, injector.Enabled())
+
+	t.Setenv(faultinjection.EnvVar("TestEnvironmentVariable"), "*:explode:1")
+	_, err = faultinjection.NewInjector("TestEnvironmentVariable", "*:error:1")
+	require.Error(t, err)
+}
+
+func TestAdminHandler(t *testing.T) {
+	injector, err := faultinjection.NewInjector("TestAdminHandler", "*:error:1")
+	require.NoError(t, err)
+
+	server := httptest.NewServer(faultinjection.AdminHandler())
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/faults/TestAdminHandler", "text/plain", strings.NewReader("off"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.False(t, injector.Enabled())
+
+	resp, err = http.Post(server.URL+"/faults/NoSuchInjector", "text/plain", strings.NewReader("off"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/faults")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var statuses []struct {
+		Name    string
+		Enabled bool
+		Faults  string
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&statuses))
+	found := false
+	for _, status := range statuses {
+		if status.Name == "TestAdminHandler" {
+			found = true
+			require.False(t, status.Enabled)
+			require.Equal(t, "*:error:1", status.Faults)
+		}
+	}
+	require.True(t, found)
+}
+
+func TestServeAdmin(t *testing.T) {
+	injector, err := faultinjection.NewInjector("TestServeAdmin", "*:error:1")
+	require.NoError(t, err)
+
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	addr := lis.Addr().String()
+	require.NoError(t, lis.Close())
+
+	// Serving the same address twice only starts one endpoint
+	faultinjection.ServeAdmin(addr)
+	faultinjection.ServeAdmin(addr)
+
+	require.Eventually(t, func() bool {
+		resp, err := http.Post("http://"+addr+"/faults/TestServeAdmin", "text/plain", strings.NewReader("off"))
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusNoContent
+	}, 5*time.Second, 10*time.Millisecond)
+	require.False(t, injector.Enabled())
+}
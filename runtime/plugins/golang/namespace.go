@@ -199,6 +199,13 @@ func (b *NamespaceBuilder) Instantiate(name string) {
 	b.instantiate = append(b.instantiate, name)
 }
 
+// Instantiates only the named nodes when the namespace is built, instead of the nodes specified with
+// [Instantiate].  Typically used to instantiate only the databases of a process that is run to
+// migrate them, so that no servers are started.
+func (b *NamespaceBuilder) InstantiateOnly(names ...string) {
+	b.instantiate = names
+}
+
 // Builds and returns the namespace.  This will:
 //   - check that all required nodes have been defined
 //   - parse command line arguments looking for missing required nodes
@@ -199,6 +199,24 @@ func TestInstantiate(t *testing.T) {
 	assert.Equal(t, 1, count)
 }
 
+func TestInstantiateOnly(t *testing.T) {
+	b := golang.NewNamespaceBuilder("TestInstantiateOnly")
+	built := make(map[string]int)
+
+	for _, key := range []string{"server", "db"} {
+		key := key
+		b.Define(key, func(n *golang.Namespace) (any, error) {
+			built[key]++
+			return key, nil
+		})
+		b.Instantiate(key)
+	}
+	b.InstantiateOnly("db")
+	_, err := b.Build(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"db": 1}, built)
+}
+
 type runtester struct {
 	done bool
 	golang.Runnable
@@ -0,0 +1,50 @@
+package hedging
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The hedgers of a client, one per method, so that the hedging delay of each method is based on
+// the latencies of that method's calls.  Hedgers is safe for concurrent use.
+type Hedgers struct {
+	delay      time.Duration
+	percentile float64
+
+	lock    sync.Mutex
+	hedgers map[string]*Hedger
+}
+
+// Instantiates the hedgers of a client.  delay is a duration such as "50ms" and percentile is a
+// number between 0 and 100; see [NewHedger].
+func NewHedgers(delay string, percentile string) (*Hedgers, error) {
+	d, err := time.ParseDuration(delay)
+	if err != nil || d < 0 {
+		return nil, fmt.Errorf("invalid hedging delay %q", delay)
+	}
+	p, err := strconv.ParseFloat(percentile, 64)
+	if err != nil || p < 0 || p > 100 {
+		return nil, fmt.Errorf("invalid hedging percentile %q; expected a number between 0 and 100", percentile)
+	}
+	return &Hedgers{delay: d, percentile: p, hedgers: make(map[string]*Hedger)}, nil
+}
+
+// Returns the hedger for calls to method
+func (hs *Hedgers) Get(method string) *Hedger {
+	hs.lock.Lock()
+	defer hs.lock.Unlock()
+	if h, exists := hs.hedgers[method]; exists {
+		return h
+	}
+	h := NewHedger(hs.delay, hs.percentile)
+	hs.hedgers[method] = h
+	return h
+}
+
+// Makes a hedged call to method; see [Hedger.Do]
+func (hs *Hedgers) Do(ctx context.Context, method string, call func(ctx context.Context) (commit func(), err error)) error {
+	return hs.Get(method).Do(ctx, call)
+}
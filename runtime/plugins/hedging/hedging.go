@@ -0,0 +1,153 @@
+// Package hedging implements the runtime components of Blueprint's hedging plugin.
+//
+// Hedgers do not need to be used directly by application workflow specs.  Instead, this
+// code is included in a compiled application by applying the hedging modifier to the wiring spec.
+//
+// A hedged call is first sent once.  If it has not completed after the hedging delay, a duplicate
+// request is sent, and the first successful response is used.  The context of the other request is
+// cancelled.  The hedging delay is either fixed, or a percentile of the recently observed latencies of
+// the same method.
+package hedging
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// The number of recent latencies from which percentiles are computed
+	windowSize = 1000
+
+	// The number of latencies that must be observed before percentiles are used
+	minSamples = 20
+
+	// The number of observations after which a cached percentile is recomputed
+	refreshEvery = 50
+)
+
+// A Hedger decides when to send a duplicate request.  A Hedger is safe for concurrent use.
+type Hedger struct {
+	delay      time.Duration
+	percentile float64
+
+	lock      sync.Mutex
+	window    []time.Duration
+	next      int
+	sinceCalc int
+	cached    time.Duration
+}
+
+// Instantiates a [Hedger].
+//
+// If percentile is zero, duplicate requests are sent after the fixed delay.  Otherwise, percentile
+// must be between 0 and 100, and duplicate requests are sent once a call has taken longer than that
+// percentile of recently observed latencies.  Until enough latencies have been observed, delay is used.
+func NewHedger(delay time.Duration, percentile float64) *Hedger {
+	return &Hedger{
+		delay:      delay,
+		percentile: percentile,
+		cached:     delay,
+	}
+}
+
+// Returns the current hedging delay
+func (h *Hedger) Delay() time.Duration {
+	if h.percentile <= 0 {
+		return h.delay
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.cached
+}
+
+// Records the latency of a successful call
+func (h *Hedger) Observe(latency time.Duration) {
+	if h.percentile <= 0 {
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if len(h.window) < windowSize {
+		h.window = append(h.window, latency)
+	} else {
+		h.window[h.next] = latency
+		h.next = (h.next + 1) % windowSize
+	}
+	h.sinceCalc++
+	if len(h.window) >= minSamples && (h.sinceCalc >= refreshEvery || len(h.window) == minSamples) {
+		h.sinceCalc = 0
+		sorted := append([]time.Duration(nil), h.window...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		i := int(math.Ceil(h.percentile/100*float64(len(sorted)))) - 1
+		i = max(0, min(len(sorted)-1, i))
+		h.cached = sorted[i]
+	}
+}
+
+type result struct {
+	commit  func()
+	err     error
+	latency time.Duration
+}
+
+// Makes a hedged call.
+//
+// call is invoked with a context that is cancelled once the hedged call completes.  It returns
+// the call's error and a commit func that copies the call's results to the caller.  commit is
+// only invoked for the response that is used, and it is invoked on the caller's goroutine.
+//
+// If the first request fails before the hedging delay has elapsed, its error is returned without
+// sending a duplicate.  If all requests fail, the error of the last to fail is returned.
+func (h *Hedger) Do(ctx context.Context, call func(ctx context.Context) (commit func(), err error)) error {
+	results := make(chan result, 2)
+	var cancels []context.CancelFunc
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+
+	launch := func() {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+		go func() {
+			start := time.Now()
+			commit, err := call(attemptCtx)
+			results <- result{commit, err, time.Since(start)}
+		}()
+	}
+
+	launch()
+	pending := 1
+	timer := time.NewTimer(h.Delay())
+	defer timer.Stop()
+	hedge := timer.C
+
+	var err error
+	for {
+		select {
+		case <-hedge:
+			hedge = nil
+			launch()
+			pending++
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				h.Observe(r.latency)
+				if r.commit != nil {
+					r.commit()
+				}
+				return nil
+			}
+			err = r.err
+			if pending == 0 {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package hedging_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/plugins/hedging"
+	"github.com/stretchr/testify/require"
+)
+
+var errFailed = errors.New("call failed")
+
+func TestFastCallIsNotHedged(t *testing.T) {
+	h := hedging.NewHedger(50*time.Millisecond, 0)
+
+	var calls atomic.Int64
+	result := 0
+	err := h.Do(context.Background(), func(ctx context.Context) (func(), error) {
+		calls.Add(1)
+		return func() { result = 1 }, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, result)
+	time.Sleep(70 * time.Millisecond)
+	require.Equal(t, int64(1), calls.Load())
+}
+
+func TestSlowCallIsHedged(t *testing.T) {
+	h := hedging.NewHedger(10*time.Millisecond, 0)
+
+	var calls atomic.Int64
+	primaryCancelled := make(chan struct{})
+	result := 0
+	err := h.Do(context.Background(), func(ctx context.Context) (func(), error) {
+		attempt := int(calls.Add(1))
+		if attempt == 1 {
+			// The primary request hangs until it is cancelled
+			<-ctx.Done()
+			close(primaryCancelled)
+			return func() { result = attempt }, ctx.Err()
+		}
+		return func() { result = attempt }, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, result)
+
+	select {
+	case <-primaryCancelled:
+	case <-time.After(time.Second):
+		t.Fatal("primary request was not cancelled")
+	}
+}
+
+func TestPrimaryErrorIsNotHedged(t *testing.T) {
+	h := hedging.NewHedger(50*time.Millisecond, 0)
+
+	var calls atomic.Int64
+	err := h.Do(context.Background(), func(ctx context.Context) (func(), error) {
+		calls.Add(1)
+		return nil, errFailed
+	})
+	require.ErrorIs(t, err, errFailed)
+	require.Equal(t, int64(1), calls.Load())
+}
+
+func TestFailedHedgeUsesPrimary(t *testing.T) {
+	h := hedging.NewHedger(10*time.Millisecond, 0)
+
+	var calls atomic.Int64
+	result := 0
+	err := h.Do(context.Background(), func(ctx context.Context) (func(), error) {
+		attempt := int(calls.Add(1))
+		if attempt == 1 {
+			time.Sleep(30 * time.Millisecond)
+			return func() { result = attempt }, nil
+		}
+		return nil, errFailed
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, result)
+}
+
+func TestCallerCancellation(t *testing.T) {
+	h := hedging.NewHedger(10*time.Millisecond, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	err := h.Do(ctx, func(ctx context.Context) (func(), error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestPercentileDelay(t *testing.T) {
+	h := hedging.NewHedger(time.Second, 90)
+	require.Equal(t, time.Second, h.Delay())
+
+	// The percentile is computed after 20 observations, then refreshed every 50
+	for i := 1; i <= 20; i++ {
+		h.Observe(time.Duration(i) * time.Millisecond)
+	}
+	require.Equal(t, 18*time.Millisecond, h.Delay())
+	for i := 21; i <= 70; i++ {
+		h.Observe(time.Duration(i) * time.Millisecond)
+	}
+	require.Equal(t, 63*time.Millisecond, h.Delay())
+}
+
+func TestPercentileDelayPerMethod(t *testing.T) {
+	hs, err := hedging.NewHedgers("1s", "50")
+	require.NoError(t, err)
+
+	// Each method's delay is based on its own latencies
+	for i := 0; i < 20; i++ {
+		hs.Get("Fast").Observe(time.Millisecond)
+		hs.Get("Slow").Observe(100 * time.Millisecond)
+	}
+	require.Equal(t, time.Millisecond, hs.Get("Fast").Delay())
+	require.Equal(t, 100*time.Millisecond, hs.Get("Slow").Delay())
+	require.Equal(t, time.Second, hs.Get("Other").Delay())
+}
+
+func TestInvalidHedgers(t *testing.T) {
+	invalid := [][2]string{{"soon", "0"}, {"-1ms", "0"}, {"10ms", "high"}, {"10ms", "101"}, {"10ms", "-1"}}
+	for _, args := range invalid {
+		_, err := hedging.NewHedgers(args[0], args[1])
+		require.Error(t, err, "%v", args)
+	}
+}
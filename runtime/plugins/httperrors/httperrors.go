@@ -0,0 +1,95 @@
+// Package httperrors implements the typed errors of Blueprint's http plugin.
+//
+// Services deployed with the http plugin can return these errors, or errors that wrap them, to
+// control the HTTP status code of a response, e.g.
+//
+//	return fmt.Errorf("no post with id %v: %w", id, httperrors.ErrNotFound)
+//
+// The generated HTTP server writes the error using the matching status code, and the generated HTTP
+// client reads it back into an [*Error], so that on the client
+//
+//	errors.Is(err, httperrors.ErrNotFound) == true
+//
+// Errors that do not wrap a typed error are returned with status 500 Internal Server Error.
+package httperrors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+var (
+	ErrBadRequest   = &Error{Status: http.StatusBadRequest, Message: "bad request"}
+	ErrUnauthorized = &Error{Status: http.StatusUnauthorized, Message: "unauthorized"}
+	ErrForbidden    = &Error{Status: http.StatusForbidden, Message: "forbidden"}
+	ErrNotFound     = &Error{Status: http.StatusNotFound, Message: "not found"}
+	ErrConflict     = &Error{Status: http.StatusConflict, Message: "conflict"}
+	ErrTooMany      = &Error{Status: http.StatusTooManyRequests, Message: "too many requests"}
+	ErrInternal     = &Error{Status: http.StatusInternalServerError, Message: "internal server error"}
+	ErrUnavailable  = &Error{Status: http.StatusServiceUnavailable, Message: "service unavailable"}
+	ErrTimeout      = &Error{Status: http.StatusGatewayTimeout, Message: "timeout"}
+)
+
+// An error with an HTTP status code.
+//
+// Two Errors match with [errors.Is] if they have the same status code, so an error read by a client
+// matches the typed error that was returned by the service.
+type Error struct {
+	Status  int    `json:"status"`
+	Message string `json:"error"`
+}
+
+// Creates an [*Error] with the given status code and message
+func New(status int, message string) *Error {
+	return &Error{Status: status, Message: message}
+}
+
+// Implements error
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Implements the interface used by [errors.Is]
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Status == e.Status
+}
+
+// Returns the HTTP status code for err.  Errors that wrap an [*Error] use its status code;
+// context deadlines and cancellations map to 504 Gateway Timeout; other errors map to 500.
+func StatusCode(err error) int {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		return e.Status
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// Writes err to w as a JSON object, using the status code returned by [StatusCode]
+func Write(w http.ResponseWriter, err error) {
+	status := StatusCode(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&Error{Status: status, Message: err.Error()})
+}
+
+// Reads the error from a response with a non-2xx status code that was written by [Write].
+// The returned error is an [*Error] with the response's status code.
+func Read(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	var e Error
+	if err := json.Unmarshal(body, &e); err != nil || e.Message == "" {
+		e.Message = string(body)
+		if e.Message == "" {
+			e.Message = http.StatusText(resp.StatusCode)
+		}
+	}
+	e.Status = resp.StatusCode
+	return &e
+}
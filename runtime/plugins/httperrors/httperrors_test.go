@@ -0,0 +1,52 @@
+package httperrors_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/blueprint-uservices/blueprint/runtime/plugins/httperrors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusCode(t *testing.T) {
+	require.Equal(t, http.StatusNotFound, httperrors.StatusCode(fmt.Errorf("post 5: %w", httperrors.ErrNotFound)))
+	require.Equal(t, http.StatusTeapot, httperrors.StatusCode(httperrors.New(http.StatusTeapot, "teapot")))
+	require.Equal(t, http.StatusGatewayTimeout, httperrors.StatusCode(context.DeadlineExceeded))
+	require.Equal(t, http.StatusInternalServerError, httperrors.StatusCode(errors.New("failed")))
+}
+
+func TestRoundTrip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httperrors.Write(w, fmt.Errorf("post 5: %w", httperrors.ErrNotFound))
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	err = httperrors.Read(resp)
+	require.ErrorIs(t, err, httperrors.ErrNotFound)
+	require.False(t, errors.Is(err, httperrors.ErrConflict))
+	require.Equal(t, "post 5: not found", err.Error())
+}
+
+func TestReadPlainBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream down", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	err = httperrors.Read(resp)
+	require.ErrorIs(t, err, httperrors.ErrUnavailable)
+	require.Equal(t, "upstream down\n", err.Error())
+}
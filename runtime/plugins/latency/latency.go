@@ -0,0 +1,294 @@
+// Package latency implements the runtime components of Blueprint's latency injection plugin.
+//
+// Injectors do not need to be used directly by application workflow specs.  Instead, this
+// code is included in a compiled application by applying the latency modifier to the wiring spec.
+package latency
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Distribution from which injected latencies are sampled
+type Distribution interface {
+	// Draws a latency using the provided source of randomness.  Never negative.
+	Sample(rng *rand.Rand) time.Duration
+}
+
+type uniform struct {
+	min, max time.Duration
+}
+
+// A [Distribution] whose samples are uniformly distributed in [min, max)
+func Uniform(min, max time.Duration) Distribution {
+	if max < min {
+		min, max = max, min
+	}
+	return &uniform{min, max}
+}
+
+func (d *uniform) Sample(rng *rand.Rand) time.Duration {
+	if d.max == d.min {
+		return clamp(float64(d.min))
+	}
+	return clamp(float64(d.min) + rng.Float64()*float64(d.max-d.min))
+}
+
+type normal struct {
+	mean, stddev time.Duration
+}
+
+// A [Distribution] that is normally distributed with the provided mean and standard deviation.
+// Negative samples are clamped to zero.
+func Normal(mean, stddev time.Duration) Distribution {
+	return &normal{mean, stddev}
+}
+
+func (d *normal) Sample(rng *rand.Rand) time.Duration {
+	return clamp(float64(d.mean) + rng.NormFloat64()*float64(d.stddev))
+}
+
+type exponential struct {
+	mean time.Duration
+}
+
+// A [Distribution] that is exponentially distributed with the provided mean
+func Exponential(mean time.Duration) Distribution {
+	return &exponential{mean}
+}
+
+func (d *exponential) Sample(rng *rand.Rand) time.Duration {
+	return clamp(rng.ExpFloat64() * float64(d.mean))
+}
+
+type logNormal struct {
+	mu, sigma float64
+}
+
+// A [Distribution] whose logarithm is normally distributed.  The distribution is
+// parameterized by its median and by sigma, the standard deviation of the logarithm.
+func LogNormal(median time.Duration, sigma float64) Distribution {
+	mu := math.Inf(-1)
+	if median > 0 {
+		mu = math.Log(float64(median))
+	}
+	return &logNormal{mu, sigma}
+}
+
+func (d *logNormal) Sample(rng *rand.Rand) time.Duration {
+	return clamp(math.Exp(d.mu + rng.NormFloat64()*d.sigma))
+}
+
+type pareto struct {
+	scale time.Duration
+	shape float64
+}
+
+// A [Distribution] following a Pareto (type I) distribution with minimum value scale and tail index shape.
+// Smaller shapes produce heavier tails.
+func Pareto(scale time.Duration, shape float64) Distribution {
+	return &pareto{scale, shape}
+}
+
+func (d *pareto) Sample(rng *rand.Rand) time.Duration {
+	if d.shape <= 0 {
+		return clamp(float64(d.scale))
+	}
+	// Inverse transform sampling; 1 - Float64() is in (0, 1]
+	return clamp(float64(d.scale) / math.Pow(1-rng.Float64(), 1/d.shape))
+}
+
+type empirical struct {
+	samples []time.Duration
+}
+
+// A [Distribution] that draws uniformly from a set of previously observed latencies.
+// If samples is empty, all samples are zero.
+func Empirical(samples []time.Duration) Distribution {
+	return &empirical{samples}
+}
+
+func (d *empirical) Sample(rng *rand.Rand) time.Duration {
+	if len(d.samples) == 0 {
+		return 0
+	}
+	return clamp(float64(d.samples[rng.Intn(len(d.samples))]))
+}
+
+// Converts a float to a non-negative duration, saturating on overflow
+func clamp(d float64) time.Duration {
+	if d <= 0 || math.IsNaN(d) {
+		return 0
+	}
+	if d >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(d)
+}
+
+// Parses a [Distribution] from its string form, as passed to the constructors of generated wrappers.
+// The string names a distribution and lists its arguments, e.g. "Exponential(20ms)", "Uniform(10ms, 20ms)"
+// or "LogNormal(10ms, 0.5)".  Durations are parsed with [time.ParseDuration], and the arguments of
+// "Empirical" are its samples.
+func ParseDistribution(spec string) (Distribution, error) {
+	open := strings.IndexByte(spec, '(')
+	if open < 0 || !strings.HasSuffix(spec, ")") {
+		return nil, fmt.Errorf("invalid latency distribution %q", spec)
+	}
+	kind := strings.TrimSpace(spec[:open])
+	var args []string
+	if inner := strings.TrimSpace(spec[open+1 : len(spec)-1]); inner != "" {
+		for _, arg := range strings.Split(inner, ",") {
+			args = append(args, strings.TrimSpace(arg))
+		}
+	}
+
+	// The number of duration arguments of each distribution, and whether a shape follows them
+	var numDurations int
+	var hasShape bool
+	switch kind {
+	case "Uniform", "Normal":
+		numDurations = 2
+	case "Exponential":
+		numDurations = 1
+	case "LogNormal", "Pareto":
+		numDurations, hasShape = 1, true
+	case "Empirical":
+		numDurations = len(args)
+	default:
+		return nil, fmt.Errorf("unknown latency distribution %q", kind)
+	}
+	if hasShape && len(args) != numDurations+1 || !hasShape && len(args) != numDurations {
+		return nil, fmt.Errorf("latency distribution %q has the wrong number of arguments", spec)
+	}
+
+	durations := make([]time.Duration, numDurations)
+	for i := range durations {
+		var err error
+		if durations[i], err = time.ParseDuration(args[i]); err != nil {
+			return nil, fmt.Errorf("invalid duration %q in latency distribution %q", args[i], spec)
+		}
+	}
+	var shape float64
+	if hasShape {
+		var err error
+		if shape, err = strconv.ParseFloat(args[numDurations], 64); err != nil {
+			return nil, fmt.Errorf("invalid shape %q in latency distribution %q", args[numDurations], spec)
+		}
+	}
+
+	switch kind {
+	case "Uniform":
+		return Uniform(durations[0], durations[1]), nil
+	case "Normal":
+		return Normal(durations[0], durations[1]), nil
+	case "Exponential":
+		return Exponential(durations[0]), nil
+	case "LogNormal":
+		return LogNormal(durations[0], shape), nil
+	case "Pareto":
+		return Pareto(durations[0], shape), nil
+	default:
+		return Empirical(durations), nil
+	}
+}
+
+// An Injector decides which calls to delay and by how much.
+//
+// An Injector is safe for concurrent use.  Its source of randomness is shared by all
+// calls; when seeded, the sequence of sampling decisions and latencies is reproducible
+// for a given sequence of calls.
+type Injector struct {
+	dist     Distribution
+	fraction float64
+	methods  map[string]struct{}
+
+	lock sync.Mutex
+	rng  *rand.Rand
+}
+
+// Instantiates an [Injector] that samples latencies from dist.
+//
+// Only calls to the named methods are delayed; if methods is empty, calls to all methods are delayed.
+// Of those calls, only the provided fraction is delayed; fractions outside of (0, 1) delay every call.
+// If seed is zero, the injector is seeded from the current time.
+func NewInjector(dist Distribution, fraction float64, methods []string, seed int64) *Injector {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	injector := &Injector{
+		dist:     dist,
+		fraction: fraction,
+		rng:      rand.New(rand.NewSource(seed)),
+	}
+	if len(methods) > 0 {
+		injector.methods = make(map[string]struct{})
+		for _, method := range methods {
+			injector.methods[method] = struct{}{}
+		}
+	}
+	return injector
+}
+
+// Instantiates an [Injector] from the string form of its settings, as passed to the constructors of
+// generated wrappers.  distribution is parsed with [ParseDistribution], methods is a comma-separated
+// list of method names, and an empty seed is zero; see [NewInjector].
+func ParseInjector(distribution string, fraction string, methods string, seed string) (*Injector, error) {
+	dist, err := ParseDistribution(distribution)
+	if err != nil {
+		return nil, err
+	}
+	f, err := strconv.ParseFloat(fraction, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fraction %q", fraction)
+	}
+	var names []string
+	if methods != "" {
+		names = strings.Split(methods, ",")
+	}
+	var s int64
+	if seed != "" {
+		if s, err = strconv.ParseInt(seed, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid seed %q", seed)
+		}
+	}
+	return NewInjector(dist, f, names, s), nil
+}
+
+// Returns the latency to inject for a call to method; zero if the call is not selected.
+func (injector *Injector) Delay(method string) time.Duration {
+	if injector.methods != nil {
+		if _, selected := injector.methods[method]; !selected {
+			return 0
+		}
+	}
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+	if injector.fraction > 0 && injector.fraction < 1 && injector.rng.Float64() >= injector.fraction {
+		return 0
+	}
+	return injector.dist.Sample(injector.rng)
+}
+
+// Delays a call to method by a sampled latency.  Returns early with the context's error
+// if ctx is done before the latency elapses.
+func (injector *Injector) Inject(ctx context.Context, method string) error {
+	delay := injector.Delay(method)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,158 @@
+package latency_test
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/plugins/latency"
+	"github.com/stretchr/testify/require"
+)
+
+const numSamples = 20000
+
+func draw(dist latency.Distribution) []time.Duration {
+	rng := rand.New(rand.NewSource(1))
+	samples := make([]time.Duration, numSamples)
+	for i := range samples {
+		samples[i] = dist.Sample(rng)
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	return samples
+}
+
+func mean(samples []time.Duration) time.Duration {
+	var total float64
+	for _, s := range samples {
+		total += float64(s)
+	}
+	return time.Duration(total / float64(len(samples)))
+}
+
+func median(samples []time.Duration) time.Duration {
+	return samples[len(samples)/2]
+}
+
+func TestUniform(t *testing.T) {
+	samples := draw(latency.Uniform(10*time.Millisecond, 20*time.Millisecond))
+	require.GreaterOrEqual(t, samples[0], 10*time.Millisecond)
+	require.Less(t, samples[len(samples)-1], 20*time.Millisecond)
+	require.InDelta(t, 15*time.Millisecond, mean(samples), float64(500*time.Microsecond))
+}
+
+func TestNormal(t *testing.T) {
+	samples := draw(latency.Normal(50*time.Millisecond, 5*time.Millisecond))
+	require.InDelta(t, 50*time.Millisecond, mean(samples), float64(500*time.Microsecond))
+
+	// Samples are clamped at zero
+	samples = draw(latency.Normal(0, 5*time.Millisecond))
+	require.Equal(t, time.Duration(0), samples[0])
+}
+
+func TestExponential(t *testing.T) {
+	samples := draw(latency.Exponential(10 * time.Millisecond))
+	require.GreaterOrEqual(t, samples[0], time.Duration(0))
+	require.InDelta(t, 10*time.Millisecond, mean(samples), float64(500*time.Microsecond))
+}
+
+func TestLogNormal(t *testing.T) {
+	samples := draw(latency.LogNormal(10*time.Millisecond, 0.5))
+	require.Greater(t, samples[0], time.Duration(0))
+	require.InDelta(t, 10*time.Millisecond, median(samples), float64(500*time.Microsecond))
+}
+
+func TestPareto(t *testing.T) {
+	samples := draw(latency.Pareto(10*time.Millisecond, 2))
+	require.GreaterOrEqual(t, samples[0], 10*time.Millisecond)
+
+	// The median of a Pareto distribution is scale * 2^(1/shape)
+	require.InDelta(t, 14142*time.Microsecond, median(samples), float64(500*time.Microsecond))
+}
+
+func TestEmpirical(t *testing.T) {
+	observed := []time.Duration{time.Millisecond, 5 * time.Millisecond, 7 * time.Millisecond}
+	samples := draw(latency.Empirical(observed))
+	for _, s := range samples {
+		require.Contains(t, observed, s)
+	}
+	require.Equal(t, observed[0], samples[0])
+	require.Equal(t, observed[2], samples[len(samples)-1])
+
+	require.Equal(t, time.Duration(0), latency.Empirical(nil).Sample(rand.New(rand.NewSource(1))))
+}
+
+func TestSeededInjectorIsReproducible(t *testing.T) {
+	a := latency.NewInjector(latency.Exponential(time.Millisecond), 0.5, nil, 42)
+	b := latency.NewInjector(latency.Exponential(time.Millisecond), 0.5, nil, 42)
+	for i := 0; i < 100; i++ {
+		require.Equal(t, a.Delay("Method"), b.Delay("Method"))
+	}
+}
+
+func TestInjectorMethods(t *testing.T) {
+	injector := latency.NewInjector(latency.Uniform(time.Millisecond, time.Millisecond), 1, []string{"Slow"}, 1)
+	require.Equal(t, time.Millisecond, injector.Delay("Slow"))
+	require.Equal(t, time.Duration(0), injector.Delay("Fast"))
+}
+
+func TestInjectorFraction(t *testing.T) {
+	injector := latency.NewInjector(latency.Uniform(time.Millisecond, time.Millisecond), 0.25, nil, 1)
+
+	delayed := 0
+	for i := 0; i < numSamples; i++ {
+		if injector.Delay("Method") > 0 {
+			delayed++
+		}
+	}
+	require.InDelta(t, 0.25, float64(delayed)/numSamples, 0.02)
+}
+
+func TestInjectRespectsContext(t *testing.T) {
+	injector := latency.NewInjector(latency.Uniform(time.Hour, time.Hour), 1, nil, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := injector.Inject(ctx, "Method")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestParseDistribution(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	dist, err := latency.ParseDistribution("Uniform(3ms, 3ms)")
+	require.NoError(t, err)
+	require.Equal(t, 3*time.Millisecond, dist.Sample(rng))
+
+	dist, err = latency.ParseDistribution("Empirical(1ms, 2.5ms)")
+	require.NoError(t, err)
+	require.Contains(t, []time.Duration{time.Millisecond, 2500 * time.Microsecond}, dist.Sample(rng))
+
+	dist, err = latency.ParseDistribution("Pareto(1ms, 0)")
+	require.NoError(t, err)
+	require.Equal(t, time.Millisecond, dist.Sample(rng))
+
+	for _, spec := range []string{"", "Exponential", "Gamma(1ms)", "Normal(1ms)", "Exponential(1)", "LogNormal(1ms, x)"} {
+		_, err = latency.ParseDistribution(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestParseInjector(t *testing.T) {
+	injector, err := latency.ParseInjector("Uniform(1ms, 1ms)", "1", "Slow,Slower", "7")
+	require.NoError(t, err)
+	require.Equal(t, time.Millisecond, injector.Delay("Slow"))
+	require.Equal(t, time.Millisecond, injector.Delay("Slower"))
+	require.Equal(t, time.Duration(0), injector.Delay("Fast"))
+
+	injector, err = latency.ParseInjector("Uniform(1ms, 1ms)", "0", "", "")
+	require.NoError(t, err)
+	require.Equal(t, time.Millisecond, injector.Delay("Fast"))
+
+	_, err = latency.ParseInjector("Uniform(1ms, 1ms)", "half", "", "")
+	require.Error(t, err)
+	_, err = latency.ParseInjector("Uniform(1ms, 1ms)", "1", "", "seed")
+	require.Error(t, err)
+}
@@ -1,10 +1,18 @@
 // Package memcached implements a key-value [backend.Cache] client interface to a vanilla memcached implementation.
+//
+// Memcached expires keys with a granularity of one second, so TTLs are rounded up to whole seconds.
+// Memcached cannot report the TTL of a key, so the client records the expiry time of each key in the
+// key's flags.
 package memcached
 
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"sync"
+	"time"
 
 	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
 	"github.com/bradfitz/gomemcache/memcache"
@@ -25,13 +33,82 @@ func NewMemcachedClient(ctx context.Context, serverAddress string) (*Memcached,
 	return cache, nil
 }
 
+// Memcached interprets expirations longer than 30 days as absolute unix times
+const maxRelativeExpiration = 30 * 24 * 60 * 60
+
+// Returns the memcached expiration for ttl, and the flags recording the expiry time
+func expiration(ttl time.Duration) (int32, uint32) {
+	if ttl == 0 {
+		return 0, 0
+	}
+	seconds := int64(math.Ceil(ttl.Seconds()))
+	expiresAt := time.Now().Unix() + seconds
+	if seconds > maxRelativeExpiration {
+		return int32(expiresAt), uint32(expiresAt)
+	}
+	return int32(seconds), uint32(expiresAt)
+}
+
 // Implements the backend.Cache interface
 func (m *Memcached) Put(ctx context.Context, key string, value interface{}) error {
+	return m.PutWithTTL(ctx, key, value, 0)
+}
+
+// Implements the backend.Cache interface
+func (m *Memcached) PutWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("invalid ttl %v for key %v", ttl, key)
+	}
 	marshaled_val, err := json.Marshal(value)
 	if err != nil {
 		return err
 	}
-	return m.Client.Set(&memcache.Item{Key: key, Value: marshaled_val})
+	item := &memcache.Item{Key: key, Value: marshaled_val}
+	item.Expiration, item.Flags = expiration(ttl)
+	return m.Client.Set(item)
+}
+
+// Implements the backend.Cache interface
+func (m *Memcached) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	if ttl < 0 {
+		return false, fmt.Errorf("invalid ttl %v for key %v", ttl, key)
+	}
+	for {
+		// The flags must be updated together with the expiration, so we can't use touch
+		it, err := m.Client.Get(key)
+		if err == memcache.ErrCacheMiss {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		it.Expiration, it.Flags = expiration(ttl)
+		err = m.Client.CompareAndSwap(it)
+		if errors.Is(err, memcache.ErrCASConflict) {
+			continue
+		}
+		if errors.Is(err, memcache.ErrCacheMiss) || errors.Is(err, memcache.ErrNotStored) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+}
+
+// Implements the backend.Cache interface
+func (m *Memcached) TTL(ctx context.Context, key string) (time.Duration, bool, error) {
+	it, err := m.Client.Get(key)
+	if err == memcache.ErrCacheMiss {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if it.Flags == 0 {
+		return 0, true, nil
+	}
+	// memcached may hold a key for up to a second after its recorded expiry
+	ttl := time.Until(time.Unix(int64(it.Flags), 0))
+	return max(ttl, time.Nanosecond), true, nil
 }
 
 // Implements the backend.Cache interface
@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend/backendtest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -159,3 +160,9 @@ func TestMemcachedMset(t *testing.T) {
 		t.Errorf("Incorrect value received from server. Expected: {7 NotVaastav}, Actual: %v", val1)
 	}
 }
+
+func TestConformance(t *testing.T) {
+	cache, err := NewMemcachedClient(context.Background(), "localhost:11211")
+	assert.NoError(t, err)
+	backendtest.TestCache(t, cache)
+}
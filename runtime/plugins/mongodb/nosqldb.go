@@ -4,12 +4,17 @@ package mongodb
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
 
 	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 )
 
 // Implements the [backend.NoSQLDatabase] interface as a client-wrapper to a mongodb server.
@@ -20,12 +25,21 @@ type MongoDB struct {
 // Implements the [backend.NoSQLCollection] interface as a client-wrapper to a mongodb server
 type MongoCollection struct {
 	collection *mongo.Collection
+	session    mongo.Session // The session of the transaction that the collection belongs to, if any
+}
+
+// Implements the [backend.NoSQLTransaction] interface as a client-wrapper to a mongodb session
+type MongoTransaction struct {
+	client  *mongo.Client
+	session mongo.Session
 }
 
 // Instantiates a new MongoDB client-wrapper instance which connects to a mongodb server running at `addr`.
 // REQUIRED: A mongodb server should be running at `addr`
+//
+// The client connects directly to `addr`, even if the server is a member of a replica set.
 func NewMongoDB(ctx context.Context, addr string) (*MongoDB, error) {
-	clientOptions := options.Client().ApplyURI("mongodb://" + addr)
+	clientOptions := options.Client().ApplyURI("mongodb://" + addr + "/?directConnection=true")
 	client, err := mongo.Connect(ctx, clientOptions)
 
 	if err != nil {
@@ -45,38 +59,119 @@ func (md *MongoDB) GetCollection(ctx context.Context, db_name string, collection
 	}, nil
 }
 
-// Implements the [backend.NoSQLCollection] interface
-func (mc *MongoCollection) DeleteOne(ctx context.Context, filter bson.D) error {
+// Implements the [backend.NoSQLDatabase] interface.
+//
+// Transactions are only available when the mongodb server is a replica set.  The mongodb container
+// plugin runs the server as a single-node replica set.
+func (md *MongoDB) StartTransaction(ctx context.Context) (backend.NoSQLTransaction, error) {
+	session, err := md.client.StartSession()
+	if err != nil {
+		return nil, err
+	}
+	txOpts := options.Transaction().SetReadConcern(readconcern.Snapshot()).SetWriteConcern(writeconcern.Majority())
+	if err := session.StartTransaction(txOpts); err != nil {
+		session.EndSession(ctx)
+		return nil, err
+	}
+	return &MongoTransaction{client: md.client, session: session}, nil
+}
 
-	_, err := mc.collection.DeleteOne(ctx, filter)
+// Implements the [backend.NoSQLTransaction] interface
+func (tx *MongoTransaction) GetCollection(ctx context.Context, db_name string, collectionName string) (backend.NoSQLCollection, error) {
+	coll := tx.client.Database(db_name).Collection(collectionName)
+	return &MongoCollection{
+		collection: coll,
+		session:    tx.session,
+	}, nil
+}
 
-	return err
+// The maximum number of attempts to commit a transaction whose commit outcome is unknown
+const commitAttempts = 5
+
+// Implements the [backend.NoSQLTransaction] interface
+func (tx *MongoTransaction) Commit(ctx context.Context) error {
+	defer tx.session.EndSession(ctx)
+	return wrapError(retryUnknownCommitResult(ctx, tx.session.CommitTransaction))
+}
+
+// As recommended by mongodb, retries commit if its outcome is unknown, e.g. after a network error.
+// Retries back off exponentially, and give up after [commitAttempts] attempts or when ctx is done.
+func retryUnknownCommitResult(ctx context.Context, commit func(context.Context) error) error {
+	backoff := 10 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := commit(ctx)
+		if !hasErrorLabel(err, "UnknownTransactionCommitResult") || attempt == commitAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
 
+// Implements the [backend.NoSQLTransaction] interface
+func (tx *MongoTransaction) Abort(ctx context.Context) error {
+	defer tx.session.EndSession(ctx)
+	return tx.session.AbortTransaction(ctx)
+}
+
+// Returns ctx, associated with the collection's session if the collection belongs to a transaction
+func (mc *MongoCollection) withSession(ctx context.Context) context.Context {
+	if mc.session == nil {
+		return ctx
+	}
+	return mongo.NewSessionContext(ctx, mc.session)
+}
+
+// Implements the [backend.NoSQLCollection] interface
+func (mc *MongoCollection) CreateIndex(ctx context.Context, keys bson.D, opts backend.IndexOptions) (string, error) {
+	if mc.session != nil {
+		return "", errors.New("indexes cannot be created in a transaction")
+	}
+	indexOpts := options.Index().SetUnique(opts.Unique)
+	if opts.Name != "" {
+		indexOpts.SetName(opts.Name)
+	}
+	name, err := mc.collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: keys, Options: indexOpts})
+	return name, wrapError(err)
+}
+
+// Implements the [backend.NoSQLCollection] interface
+func (mc *MongoCollection) DeleteOne(ctx context.Context, filter bson.D) error {
+	ctx = mc.withSession(ctx)
+	_, err := mc.collection.DeleteOne(ctx, filter)
+	return wrapError(err)
 }
 
 // Implements the [backend.NoSQLCollection] interface
 func (mc *MongoCollection) DeleteMany(ctx context.Context, filter bson.D) error {
+	ctx = mc.withSession(ctx)
 	_, err := mc.collection.DeleteMany(ctx, filter)
-	return err
+	return wrapError(err)
 }
 
 // Implements the [backend.NoSQLCollection] interface
 func (mc *MongoCollection) InsertOne(ctx context.Context, document interface{}) error {
+	ctx = mc.withSession(ctx)
 	_, err := mc.collection.InsertOne(ctx, document)
 
-	return err
+	return wrapError(err)
 }
 
 // Implements the [backend.NoSQLCollection] interface
 func (mc *MongoCollection) InsertMany(ctx context.Context, documents []interface{}) error {
+	ctx = mc.withSession(ctx)
 	_, err := mc.collection.InsertMany(ctx, documents)
 
-	return err
+	return wrapError(err)
 }
 
 // Implements the [backend.NoSQLCollection] interface
 func (mc *MongoCollection) FindOne(ctx context.Context, filter bson.D, projection ...bson.D) (backend.NoSQLCursor, error) {
-
+	ctx = mc.withSession(ctx)
 	withProjection := false
 
 	if len(projection) > 1 {
@@ -97,13 +192,13 @@ func (mc *MongoCollection) FindOne(ctx context.Context, filter bson.D, projectio
 	if err == nil || err == mongo.ErrNoDocuments {
 		return &MongoCursor{underlyingResult: singleResult}, nil
 	} else {
-		return nil, err
+		return nil, wrapError(err)
 	}
 }
 
 // Implements the [backend.NoSQLCollection] interface
 func (mc *MongoCollection) FindMany(ctx context.Context, filter bson.D, projection ...bson.D) (backend.NoSQLCursor, error) {
-
+	ctx = mc.withSession(ctx)
 	withProjection := false
 
 	if len(projection) > 1 {
@@ -122,10 +217,66 @@ func (mc *MongoCollection) FindMany(ctx context.Context, filter bson.D, projecti
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
+	}
+	if cursor.Err() != nil {
+		return nil, wrapError(cursor.Err())
+	}
+
+	return &MongoCursor{underlyingResult: cursor}, nil
+}
+
+// Implements the [backend.NoSQLCollection] interface
+func (mc *MongoCollection) FindManyWithOptions(ctx context.Context, filter bson.D, opts backend.FindOptions) (backend.NoSQLCursor, error) {
+	ctx = mc.withSession(ctx)
+	findOpts := options.Find()
+	if opts.Sort != nil {
+		findOpts.SetSort(opts.Sort)
+	}
+	if opts.Skip != 0 {
+		findOpts.SetSkip(opts.Skip)
+	}
+	if opts.Limit != 0 {
+		findOpts.SetLimit(opts.Limit)
+	}
+	if opts.Projection != nil {
+		findOpts.SetProjection(opts.Projection)
+	}
+
+	cursor, err := mc.collection.Find(ctx, filter, findOpts)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	if cursor.Err() != nil {
+		return nil, wrapError(cursor.Err())
+	}
+
+	return &MongoCursor{underlyingResult: cursor}, nil
+}
+
+// Implements the [backend.NoSQLCollection] interface
+func (mc *MongoCollection) CountDocuments(ctx context.Context, filter bson.D) (int64, error) {
+	ctx = mc.withSession(ctx)
+	count, err := mc.collection.CountDocuments(ctx, filter)
+	return count, wrapError(err)
+}
+
+// Implements the [backend.NoSQLCollection] interface
+func (mc *MongoCollection) Distinct(ctx context.Context, field string, filter bson.D) ([]interface{}, error) {
+	ctx = mc.withSession(ctx)
+	values, err := mc.collection.Distinct(ctx, field, filter)
+	return values, wrapError(err)
+}
+
+// Implements the [backend.NoSQLCollection] interface
+func (mc *MongoCollection) Aggregate(ctx context.Context, pipeline []bson.D) (backend.NoSQLCursor, error) {
+	ctx = mc.withSession(ctx)
+	cursor, err := mc.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, wrapError(err)
 	}
 	if cursor.Err() != nil {
-		return nil, cursor.Err()
+		return nil, wrapError(cursor.Err())
 	}
 
 	return &MongoCursor{underlyingResult: cursor}, nil
@@ -133,33 +284,70 @@ func (mc *MongoCollection) FindMany(ctx context.Context, filter bson.D, projecti
 
 // Implements the [backend.NoSQLCollection] interface
 func (mc *MongoCollection) UpdateOne(ctx context.Context, filter bson.D, update bson.D) (int, error) {
+	ctx = mc.withSession(ctx)
 	result, err := mc.collection.UpdateOne(ctx, filter, update)
 	if result == nil {
-		return 0, err
+		return 0, wrapError(err)
 	} else {
-		return int(result.ModifiedCount), err
+		return int(result.ModifiedCount), wrapError(err)
 	}
 }
 
 // Implements the [backend.NoSQLCollection] interface
 func (mc *MongoCollection) UpdateMany(ctx context.Context, filter bson.D, update bson.D) (int, error) {
+	ctx = mc.withSession(ctx)
 	result, err := mc.collection.UpdateMany(ctx, filter, update)
 	if result == nil {
-		return 0, err
+		return 0, wrapError(err)
+	} else {
+		return int(result.ModifiedCount), wrapError(err)
+	}
+}
+
+// Implements the [backend.NoSQLCollection] interface
+func (mc *MongoCollection) UpdateOneWithOptions(ctx context.Context, filter bson.D, update bson.D, opts backend.UpdateOptions) (int, error) {
+	ctx = mc.withSession(ctx)
+	result, err := mc.collection.UpdateOne(ctx, filter, update, updateOptions(opts))
+	if result == nil {
+		return 0, wrapError(err)
 	} else {
-		return int(result.ModifiedCount), err
+		return int(result.ModifiedCount + result.UpsertedCount), wrapError(err)
 	}
 }
 
+// Implements the [backend.NoSQLCollection] interface
+func (mc *MongoCollection) UpdateManyWithOptions(ctx context.Context, filter bson.D, update bson.D, opts backend.UpdateOptions) (int, error) {
+	ctx = mc.withSession(ctx)
+	result, err := mc.collection.UpdateMany(ctx, filter, update, updateOptions(opts))
+	if result == nil {
+		return 0, wrapError(err)
+	} else {
+		return int(result.ModifiedCount + result.UpsertedCount), wrapError(err)
+	}
+}
+
+func updateOptions(opts backend.UpdateOptions) *options.UpdateOptions {
+	updateOpts := options.Update().SetUpsert(opts.Upsert)
+	if len(opts.ArrayFilters) > 0 {
+		var filters []interface{}
+		for _, filter := range opts.ArrayFilters {
+			filters = append(filters, filter)
+		}
+		updateOpts.SetArrayFilters(options.ArrayFilters{Filters: filters})
+	}
+	return updateOpts
+}
+
 // Implements the [backend.NoSQLCollection] interface
 func (mc *MongoCollection) Upsert(ctx context.Context, filter bson.D, document interface{}) (bool, error) {
+	ctx = mc.withSession(ctx)
 	update := bson.D{{"$set", document}}
 	opts := options.Update().SetUpsert(true)
 	result, err := mc.collection.UpdateOne(ctx, filter, update, opts)
 	if result == nil {
-		return false, err
+		return false, wrapError(err)
 	} else {
-		return result.MatchedCount == 1, err
+		return result.MatchedCount == 1, wrapError(err)
 	}
 }
 
@@ -171,11 +359,12 @@ func (mc *MongoCollection) UpsertID(ctx context.Context, id primitive.ObjectID,
 
 // Implements the [backend.NoSQLCollection] interface
 func (mc *MongoCollection) ReplaceOne(ctx context.Context, filter bson.D, replacement interface{}) (int, error) {
+	ctx = mc.withSession(ctx)
 	result, err := mc.collection.ReplaceOne(ctx, filter, replacement)
 	if result == nil {
-		return 0, err
+		return 0, wrapError(err)
 	} else {
-		return int(result.MatchedCount), err
+		return int(result.MatchedCount), wrapError(err)
 	}
 }
 
@@ -184,6 +373,42 @@ func (mc *MongoCollection) ReplaceMany(ctx context.Context, filter bson.D, repla
 	return 0, errors.New("ReplaceMany not implemented")
 }
 
+// Implements the [backend.NoSQLCollection] interface.
+//
+// Change streams are only available when the mongodb server is a replica set.  The mongodb container
+// plugin runs the server as a single-node replica set.
+func (mc *MongoCollection) Watch(ctx context.Context, opts backend.WatchOptions) (backend.NoSQLChangeStream, error) {
+	if mc.session != nil {
+		return nil, errors.New("collections cannot be watched in a transaction")
+	}
+	streamOpts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if opts.ResumeAfter != "" {
+		streamOpts.SetResumeAfter(bson.D{{"_data", opts.ResumeAfter}})
+	}
+	stream, err := mc.collection.Watch(ctx, mongo.Pipeline{}, streamOpts)
+	if err != nil {
+		return nil, err
+	}
+	return &MongoChangeStream{stream: stream}, nil
+}
+
+// Wraps mongodb's duplicate key errors with [backend.ErrDuplicateKey], and transient transaction
+// errors, such as write conflicts, with [backend.ErrTransactionConflict]
+func wrapError(err error) error {
+	if err != nil && mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %w", backend.ErrDuplicateKey, err)
+	}
+	if hasErrorLabel(err, "TransientTransactionError") {
+		return fmt.Errorf("%w: %w", backend.ErrTransactionConflict, err)
+	}
+	return err
+}
+
+func hasErrorLabel(err error, label string) bool {
+	var labeled mongo.LabeledError
+	return errors.As(err, &labeled) && labeled.HasErrorLabel(label)
+}
+
 // Implements the [backend.NoSQLCursor] interface as a client-wrapper to the Cursor returned by a mongodb server
 type MongoCursor struct {
 	underlyingResult interface{}
@@ -216,3 +441,63 @@ func (mr *MongoCursor) All(ctx context.Context, objs interface{}) error {
 		return errors.New("result does not return a Cursor")
 	}
 }
+
+// Implements the [backend.NoSQLChangeStream] interface as a client-wrapper to a mongodb change stream
+type MongoChangeStream struct {
+	stream *mongo.ChangeStream
+	closed atomic.Bool
+}
+
+// The fields of a mongodb change event that are returned as a [backend.NoSQLChangeEvent]
+type changeEvent struct {
+	ID            bson.Raw `bson:"_id"`
+	OperationType string   `bson:"operationType"`
+	DocumentKey   bson.D   `bson:"documentKey"`
+	FullDocument  bson.D   `bson:"fullDocument"`
+}
+
+// Implements the [backend.NoSQLChangeStream] interface.
+//
+// Events other than inserts, updates, replacements and deletes, such as drops and renames, are skipped.
+func (s *MongoChangeStream) Next(ctx context.Context) (backend.NoSQLChangeEvent, error) {
+	for s.stream.Next(ctx) {
+		var event changeEvent
+		if err := s.stream.Decode(&event); err != nil {
+			return backend.NoSQLChangeEvent{}, err
+		}
+		switch event.OperationType {
+		case backend.ChangeInsert, backend.ChangeUpdate, backend.ChangeReplace, backend.ChangeDelete:
+		default:
+			continue
+		}
+		token, _ := event.ID.Lookup("_data").StringValueOK()
+		result := backend.NoSQLChangeEvent{
+			OperationType: event.OperationType,
+			FullDocument:  event.FullDocument,
+			ResumeToken:   token,
+		}
+		for _, e := range event.DocumentKey {
+			if e.Key == "_id" {
+				result.DocumentKey = e.Value
+			}
+		}
+		return result, nil
+	}
+	if s.closed.Load() {
+		return backend.NoSQLChangeEvent{}, backend.ErrChangeStreamClosed
+	}
+	if err := s.stream.Err(); err != nil {
+		return backend.NoSQLChangeEvent{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return backend.NoSQLChangeEvent{}, err
+	}
+	// The stream was invalidated, e.g. because the collection was dropped
+	return backend.NoSQLChangeEvent{}, backend.ErrChangeStreamClosed
+}
+
+// Implements the [backend.NoSQLChangeStream] interface
+func (s *MongoChangeStream) Close(ctx context.Context) error {
+	s.closed.Store(true)
+	return s.stream.Close(ctx)
+}
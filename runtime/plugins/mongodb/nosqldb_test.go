@@ -0,0 +1,57 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestRetryUnknownCommitResult(t *testing.T) {
+	unknown := mongo.CommandError{Message: "network error", Labels: []string{"UnknownTransactionCommitResult"}}
+
+	// Commits with an unknown outcome are retried until they succeed
+	attempts := 0
+	err := retryUnknownCommitResult(context.Background(), func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return unknown
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, attempts)
+
+	// ...up to a limit
+	attempts = 0
+	err = retryUnknownCommitResult(context.Background(), func(ctx context.Context) error {
+		attempts++
+		return unknown
+	})
+	require.ErrorAs(t, err, &mongo.CommandError{})
+	require.Equal(t, commitAttempts, attempts)
+
+	// ...or until ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	attempts = 0
+	err = retryUnknownCommitResult(ctx, func(ctx context.Context) error {
+		attempts++
+		return unknown
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, attempts, commitAttempts)
+
+	// Other errors are returned without retrying
+	failure := errors.New("failed")
+	attempts = 0
+	err = retryUnknownCommitResult(context.Background(), func(ctx context.Context) error {
+		attempts++
+		return failure
+	})
+	require.Equal(t, failure, err)
+	require.Equal(t, 1, attempts)
+}
@@ -4,10 +4,14 @@ package mysql
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"time"
 
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+	"github.com/blueprint-uservices/blueprint/runtime/core/migrate"
+	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
-
-	_ "github.com/go-sql-driver/mysql"
 )
 
 // Implements a RelationalDB that uses the mysql package
@@ -17,7 +21,11 @@ type MySqlDB struct {
 }
 
 // Instantiates a new [MySqlDB] instance that stores query data in a MySqlDB instance
-func NewMySqlDB(ctx context.Context, addr string, name string, username string, password string) (*MySqlDB, error) {
+//
+// If migrations is non-empty, it is the name of migrations registered with [migrate.Register], which
+// are applied using [migrate.Run] with the "mysql" dialect.  A named mysql lock excludes other
+// processes from migrating the database at the same time.
+func NewMySqlDB(ctx context.Context, addr string, name string, username string, password string, migrations string) (*MySqlDB, error) {
 	db, err := sqlx.Open("mysql", username+":"+password+"@tcp("+addr+")/")
 	if err != nil {
 		return nil, err
@@ -39,30 +47,137 @@ func NewMySqlDB(ctx context.Context, addr string, name string, username string,
 		return nil, err
 	}
 
-	return &MySqlDB{name: name, db: db}, nil
+	s := &MySqlDB{name: name, db: db}
+	if migrations != "" {
+		if err := migrate.Run(ctx, name, s, migrations, "mysql", s.lockMigrations); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// How long to wait for another process to finish migrating the database
+const migrationLockTimeout = 5 * time.Minute
+
+// Implements [migrate.LockFunc] with a named mysql lock, which is held by a dedicated connection
+func (s *MySqlDB) lockMigrations(ctx context.Context) (func(), error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lockName := "migrate." + s.name
+	var acquired sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?);", lockName, int(migrationLockTimeout.Seconds())).Scan(&acquired)
+	if err == nil && acquired.Int64 != 1 {
+		err = fmt.Errorf("timed out waiting for lock %v", lockName)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return func() {
+		conn.ExecContext(context.Background(), "DO RELEASE_LOCK(?);", lockName)
+		conn.Close()
+	}, nil
 }
 
 // Exec implements backend.RelationalDB
 func (s *MySqlDB) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
-	return s.db.ExecContext(ctx, query, args...)
+	result, err := s.db.ExecContext(ctx, query, args...)
+	return result, wrapError(err)
 }
 
 // Query implements backend.RelationalDB
 func (s *MySqlDB) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
-	return s.db.QueryContext(ctx, query, args...)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	return rows, wrapError(err)
 }
 
 // Prepare implements backend.RelationalDB
 func (s *MySqlDB) Prepare(ctx context.Context, query string) (*sql.Stmt, error) {
-	return s.db.PrepareContext(ctx, query)
+	stmt, err := s.db.PrepareContext(ctx, query)
+	return stmt, wrapError(err)
 }
 
 // Select implements backend.RelationalDB
 func (s *MySqlDB) Select(ctx context.Context, dst interface{}, query string, args ...any) error {
-	return s.db.SelectContext(ctx, dst, query, args...)
+	return wrapError(s.db.SelectContext(ctx, dst, query, args...))
 }
 
 // Get implements backend.RelationalDB
 func (s *MySqlDB) Get(ctx context.Context, dst interface{}, query string, args ...any) error {
-	return s.db.GetContext(ctx, dst, query, args...)
+	return wrapError(s.db.GetContext(ctx, dst, query, args...))
+}
+
+// BeginTx implements backend.RelationalDB
+//
+// All of mysql's isolation levels are supported: read uncommitted, read committed, repeatable read
+// (the default) and serializable.
+//
+// Deadlocks and lock wait timeouts fail with an error that wraps [backend.ErrTransactionConflict].
+func (s *MySqlDB) BeginTx(ctx context.Context, opts backend.TxOptions) (backend.RelationalTx, error) {
+	tx, err := s.db.BeginTxx(ctx, &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return &MySqlTx{tx: tx}, nil
+}
+
+// A transaction started by [MySqlDB.BeginTx]
+type MySqlTx struct {
+	tx *sqlx.Tx
+}
+
+// Exec implements backend.RelationalTx
+func (t *MySqlTx) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	result, err := t.tx.ExecContext(ctx, query, args...)
+	return result, wrapError(err)
+}
+
+// Query implements backend.RelationalTx
+func (t *MySqlTx) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	rows, err := t.tx.QueryContext(ctx, query, args...)
+	return rows, wrapError(err)
+}
+
+// Prepare implements backend.RelationalTx
+func (t *MySqlTx) Prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	stmt, err := t.tx.PrepareContext(ctx, query)
+	return stmt, wrapError(err)
+}
+
+// Select implements backend.RelationalTx
+func (t *MySqlTx) Select(ctx context.Context, dst interface{}, query string, args ...any) error {
+	return wrapError(t.tx.SelectContext(ctx, dst, query, args...))
+}
+
+// Get implements backend.RelationalTx
+func (t *MySqlTx) Get(ctx context.Context, dst interface{}, query string, args ...any) error {
+	return wrapError(t.tx.GetContext(ctx, dst, query, args...))
+}
+
+// Commit implements backend.RelationalTx
+func (t *MySqlTx) Commit(ctx context.Context) error {
+	return wrapError(t.tx.Commit())
+}
+
+// Rollback implements backend.RelationalTx
+func (t *MySqlTx) Rollback(ctx context.Context) error {
+	return t.tx.Rollback()
+}
+
+// mysql error numbers for transactions that can be retried
+const (
+	errLockWaitTimeout = 1205 // ER_LOCK_WAIT_TIMEOUT
+	errLockDeadlock    = 1213 // ER_LOCK_DEADLOCK, also returned for serialization failures
+)
+
+// Wraps mysql's deadlock and lock wait timeout errors with [backend.ErrTransactionConflict]
+func wrapError(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && (mysqlErr.Number == errLockWaitTimeout || mysqlErr.Number == errLockDeadlock) {
+		return fmt.Errorf("%w: %w", backend.ErrTransactionConflict, err)
+	}
+	return err
 }
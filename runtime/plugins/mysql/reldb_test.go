@@ -2,8 +2,12 @@ package mysql
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"sync"
 	"testing"
 
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
 	"github.com/stretchr/testify/require"
 )
 
@@ -11,7 +15,7 @@ import (
 func TestRelDB(t *testing.T) {
 	ctx := context.Background()
 
-	db, err := NewMySqlDB(ctx, "127.0.0.1:3306", "TestRelDB", "root", "pass")
+	db, err := NewMySqlDB(ctx, "127.0.0.1:3306", "TestRelDB", "root", "pass", "")
 	require.NoError(t, err)
 
 	batch := []string{
@@ -61,3 +65,57 @@ func TestRelDB(t *testing.T) {
 
 	require.False(t, rows.Next())
 }
+
+// Test requires a functional mysql instance to be already running
+func TestWithTx(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := NewMySqlDB(ctx, "127.0.0.1:3306", "TestRelDB", "root", "pass", "")
+	require.NoError(t, err)
+
+	batch := []string{
+		`CREATE TABLE IF NOT EXISTS accounts (id INT PRIMARY KEY, balance INT);`,
+		`DELETE FROM accounts;`,
+		`INSERT INTO accounts (id, balance) VALUES (1, 100), (2, 0);`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(ctx, b)
+		require.NoError(t, err)
+	}
+
+	// Concurrent serializable transfers deadlock and are retried, so no update is lost
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := backend.WithTx(ctx, db, backend.TxOptions{Isolation: sql.LevelSerializable}, func(ctx context.Context, tx backend.RelationalTx) error {
+				var balance int
+				if err := tx.Get(ctx, &balance, `SELECT balance FROM accounts WHERE id = 1;`); err != nil {
+					return err
+				}
+				if _, err := tx.Exec(ctx, `UPDATE accounts SET balance = ? WHERE id = 1;`, balance-10); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, `UPDATE accounts SET balance = balance + 10 WHERE id = 2;`)
+				return err
+			})
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	var balances []int
+	require.NoError(t, db.Select(ctx, &balances, `SELECT balance FROM accounts ORDER BY id;`))
+	require.Equal(t, []int{20, 80}, balances)
+
+	// Rolled back changes are discarded
+	tx, err := db.BeginTx(ctx, backend.TxOptions{})
+	require.NoError(t, err)
+	_, err = tx.Exec(ctx, `DELETE FROM accounts;`)
+	require.NoError(t, err)
+	require.NoError(t, tx.Rollback(ctx))
+	require.True(t, errors.Is(tx.Commit(ctx), sql.ErrTxDone))
+	require.NoError(t, db.Select(ctx, &balances, `SELECT balance FROM accounts ORDER BY id;`))
+	require.Equal(t, []int{20, 80}, balances)
+}
@@ -0,0 +1,315 @@
+// Package postgres provides a client-wrapper implementation of the [backend.RelationalDB] interface for a
+// PostgreSQL server, using the [github.com/lib/pq] driver.
+//
+// Queries can use either postgres's $1, $2, ... placeholders, or the ? placeholders used by the other
+// [backend.RelationalDB] implementations, which are rewritten to postgres's placeholders.  So the same
+// workflow code can run against postgres and mysql, as long as its SQL is otherwise portable.  A ? in a
+// quoted string or identifier or in a comment isn't a placeholder; nor is any ? in a query that uses
+// $1, $2, ... placeholders, so such queries can use postgres's ? operators.
+//
+// The driver doesn't support [sql.Result.LastInsertId]; use INSERT ... RETURNING instead.
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+	"github.com/blueprint-uservices/blueprint/runtime/core/migrate"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Implements a RelationalDB that uses the lib/pq package
+type PostgresDB struct {
+	name string
+	db   *sqlx.DB
+}
+
+// Instantiates a new [PostgresDB] instance that stores query data in the database name of the postgres
+// server at addr.  The database is created if it doesn't exist.
+//
+// maxOpenConns, maxIdleConns and connMaxLifetime configure the client's connection pool; see
+// [sql.DB.SetMaxOpenConns], [sql.DB.SetMaxIdleConns] and [sql.DB.SetConnMaxLifetime].  Empty values
+// leave the defaults.  connMaxLifetime is a duration such as "5m".
+//
+// If migrations is non-empty, it is the name of migrations registered with [migrate.Register], which
+// are applied using [migrate.Run] with the "postgres" dialect.  An advisory lock excludes other
+// processes from migrating the database at the same time.
+func NewPostgresDB(ctx context.Context, addr string, name string, username string, password string, maxOpenConns string, maxIdleConns string, connMaxLifetime string, migrations string) (*PostgresDB, error) {
+	if err := createDatabase(ctx, dsn(addr, "postgres", username, password), name); err != nil {
+		return nil, fmt.Errorf("unable to create database %v: %w", name, err)
+	}
+
+	db, err := sqlx.Open("postgres", dsn(addr, name, username, password))
+	if err != nil {
+		return nil, err
+	}
+	if err := configurePool(db, maxOpenConns, maxIdleConns, connMaxLifetime); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &PostgresDB{name: name, db: db}
+	if migrations != "" {
+		if err := migrate.Run(ctx, name, s, migrations, "postgres", s.lockMigrations); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Returns the connection string for the database name of the postgres server at addr
+func dsn(addr string, name string, username string, password string) string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(username, password),
+		Host:     addr,
+		Path:     "/" + name,
+		RawQuery: "sslmode=disable",
+	}
+	return u.String()
+}
+
+// Creates the database name if it doesn't exist, using a connection to the server's postgres database
+func createDatabase(ctx context.Context, serverDSN string, name string) error {
+	db, err := sqlx.Open("postgres", serverDSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var exists bool
+	if err := db.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1);", name); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	_, err = db.ExecContext(ctx, "CREATE DATABASE "+pq.QuoteIdentifier(name)+";")
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == errDuplicateDatabase {
+		// Created concurrently by another client
+		return nil
+	}
+	return err
+}
+
+// Applies the connection pool settings passed to [NewPostgresDB]
+func configurePool(db *sqlx.DB, maxOpenConns string, maxIdleConns string, connMaxLifetime string) error {
+	if maxOpenConns != "" {
+		n, err := strconv.Atoi(maxOpenConns)
+		if err != nil {
+			return fmt.Errorf("invalid maximum number of open connections %q", maxOpenConns)
+		}
+		db.SetMaxOpenConns(n)
+	}
+	if maxIdleConns != "" {
+		n, err := strconv.Atoi(maxIdleConns)
+		if err != nil {
+			return fmt.Errorf("invalid maximum number of idle connections %q", maxIdleConns)
+		}
+		db.SetMaxIdleConns(n)
+	}
+	if connMaxLifetime != "" {
+		d, err := time.ParseDuration(connMaxLifetime)
+		if err != nil {
+			return fmt.Errorf("invalid maximum connection lifetime %q", connMaxLifetime)
+		}
+		db.SetConnMaxLifetime(d)
+	}
+	return nil
+}
+
+// How long to wait for another process to finish migrating the database
+const migrationLockTimeout = 5 * time.Minute
+
+// Implements [migrate.LockFunc] with a postgres advisory lock, which is held by a dedicated connection
+func (s *PostgresDB) lockMigrations(ctx context.Context) (func(), error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lockName := "migrate." + s.name
+	lockCtx, cancel := context.WithTimeout(ctx, migrationLockTimeout)
+	defer cancel()
+	if _, err := conn.ExecContext(lockCtx, "SELECT pg_advisory_lock(hashtext($1));", lockName); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to acquire lock %v: %w", lockName, err)
+	}
+	return func() {
+		conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1));", lockName)
+		conn.Close()
+	}, nil
+}
+
+// Closes the client's connections to the database
+func (s *PostgresDB) Close() error {
+	return s.db.Close()
+}
+
+// Exec implements backend.RelationalDB
+func (s *PostgresDB) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	result, err := s.db.ExecContext(ctx, rebind(query), args...)
+	return result, wrapError(err)
+}
+
+// Query implements backend.RelationalDB
+func (s *PostgresDB) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	rows, err := s.db.QueryContext(ctx, rebind(query), args...)
+	return rows, wrapError(err)
+}
+
+// Prepare implements backend.RelationalDB
+func (s *PostgresDB) Prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	stmt, err := s.db.PrepareContext(ctx, rebind(query))
+	return stmt, wrapError(err)
+}
+
+// Select implements backend.RelationalDB
+func (s *PostgresDB) Select(ctx context.Context, dst interface{}, query string, args ...any) error {
+	return wrapError(s.db.SelectContext(ctx, dst, rebind(query), args...))
+}
+
+// Get implements backend.RelationalDB
+func (s *PostgresDB) Get(ctx context.Context, dst interface{}, query string, args ...any) error {
+	return wrapError(s.db.GetContext(ctx, dst, rebind(query), args...))
+}
+
+// BeginTx implements backend.RelationalDB
+//
+// All of postgres's isolation levels are supported: read committed (the default), repeatable read and
+// serializable.  Read uncommitted behaves like read committed.
+//
+// Serialization failures and deadlocks fail with an error that wraps [backend.ErrTransactionConflict].
+func (s *PostgresDB) BeginTx(ctx context.Context, opts backend.TxOptions) (backend.RelationalTx, error) {
+	tx, err := s.db.BeginTxx(ctx, &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return &PostgresTx{tx: tx}, nil
+}
+
+// A transaction started by [PostgresDB.BeginTx]
+type PostgresTx struct {
+	tx *sqlx.Tx
+}
+
+// Exec implements backend.RelationalTx
+func (t *PostgresTx) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	result, err := t.tx.ExecContext(ctx, rebind(query), args...)
+	return result, wrapError(err)
+}
+
+// Query implements backend.RelationalTx
+func (t *PostgresTx) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	rows, err := t.tx.QueryContext(ctx, rebind(query), args...)
+	return rows, wrapError(err)
+}
+
+// Prepare implements backend.RelationalTx
+func (t *PostgresTx) Prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	stmt, err := t.tx.PrepareContext(ctx, rebind(query))
+	return stmt, wrapError(err)
+}
+
+// Select implements backend.RelationalTx
+func (t *PostgresTx) Select(ctx context.Context, dst interface{}, query string, args ...any) error {
+	return wrapError(t.tx.SelectContext(ctx, dst, rebind(query), args...))
+}
+
+// Get implements backend.RelationalTx
+func (t *PostgresTx) Get(ctx context.Context, dst interface{}, query string, args ...any) error {
+	return wrapError(t.tx.GetContext(ctx, dst, rebind(query), args...))
+}
+
+// Commit implements backend.RelationalTx
+func (t *PostgresTx) Commit(ctx context.Context) error {
+	return wrapError(t.tx.Commit())
+}
+
+// Rollback implements backend.RelationalTx
+func (t *PostgresTx) Rollback(ctx context.Context) error {
+	return t.tx.Rollback()
+}
+
+// postgres error codes
+const (
+	errSerializationFailure = "40001" // serialization_failure
+	errDeadlockDetected     = "40P01" // deadlock_detected
+	errDuplicateDatabase    = "42P04" // duplicate_database
+)
+
+// Wraps postgres's serialization failure and deadlock errors with [backend.ErrTransactionConflict]
+func wrapError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && (pqErr.Code == errSerializationFailure || pqErr.Code == errDeadlockDetected) {
+		return fmt.Errorf("%w: %w", backend.ErrTransactionConflict, err)
+	}
+	return err
+}
+
+// Matches postgres's placeholders, and the start of dollar-quoted strings
+var (
+	dollarPlaceholder = regexp.MustCompile(`\$[0-9]+`)
+	dollarQuote       = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+)
+
+// Rewrites the ? placeholders in query to postgres's $1, $2, ... placeholders, unless query already
+// uses postgres's placeholders.  Quoted strings and identifiers, dollar-quoted strings and comments are
+// left unchanged.
+func rebind(query string) string {
+	if !strings.Contains(query, "?") || dollarPlaceholder.MatchString(query) {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for i := 0; i < len(query); i++ {
+		// The length of the quoted string or comment starting at i, if any
+		skip := 0
+		switch c := query[i]; {
+		case c == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		case c == '\'' || c == '"':
+			// Quotes are escaped by doubling them, which this treats as two adjacent strings
+			skip = len(query) - i
+			if end := strings.IndexByte(query[i+1:], c); end >= 0 {
+				skip = end + 2
+			}
+		case strings.HasPrefix(query[i:], "--"):
+			skip = len(query) - i
+			if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+				skip = end
+			}
+		case strings.HasPrefix(query[i:], "/*"):
+			skip = len(query) - i
+			if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				skip = end + 4
+			}
+		case c == '$':
+			if tag := dollarQuote.FindString(query[i:]); tag != "" {
+				skip = len(query) - i
+				if end := strings.Index(query[i+len(tag):], tag); end >= 0 {
+					skip = len(tag) + end + len(tag)
+				}
+			}
+		}
+		if skip > 0 {
+			b.WriteString(query[i : i+skip])
+			i += skip - 1
+		} else {
+			b.WriteByte(query[i])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,238 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+	"github.com/blueprint-uservices/blueprint/runtime/core/migrate"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+// Returns a client of the TestRelDB database of the postgres server at $POSTGRES_ADDR, with username
+// postgres and password pass, e.g. a server started with:
+//
+//	docker run -p 5432:5432 --env POSTGRES_PASSWORD=pass postgres
+//
+// If POSTGRES_ADDR isn't set, the client connects to a stand-in shared by the tests instead; see
+// [standIn].
+func testDB(t *testing.T, migrations string) *PostgresDB {
+	addr := os.Getenv("POSTGRES_ADDR")
+	if addr == "" {
+		standInOnce.Do(func() { standInAddr, standInErr = startStandIn() })
+		require.NoError(t, standInErr)
+		addr = standInAddr
+	}
+
+	db, err := NewPostgresDB(context.Background(), addr, "TestRelDB", "postgres", "pass", "10", "2", "1m", migrations)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+var (
+	standInOnce sync.Once
+	standInAddr string
+	standInErr  error
+)
+
+func TestRebind(t *testing.T) {
+	for query, expected := range map[string]string{
+		`SELECT * FROM t WHERE a = ? AND b = ?;`:               `SELECT * FROM t WHERE a = $1 AND b = $2;`,
+		"SELECT '?', \"?\" FROM t WHERE a = ? -- ?\n AND b=?;": "SELECT '?', \"?\" FROM t WHERE a = $1 -- ?\n AND b=$2;",
+		`SELECT /* ? */ 'it''s?', ?;`:                          `SELECT /* ? */ 'it''s?', $1;`,
+		`CREATE FUNCTION f() AS $body$ SELECT '?' $body$; ?`:   `CREATE FUNCTION f() AS $body$ SELECT '?' $body$; $1`,
+		`SELECT $$?$$, ?;`:                                     `SELECT $$?$$, $1;`,
+		`SELECT data ? 'key' FROM t WHERE id = $1;`:            `SELECT data ? 'key' FROM t WHERE id = $1;`,
+		`SELECT 'unterminated ?`:                               `SELECT 'unterminated ?`,
+	} {
+		require.Equal(t, expected, rebind(query), query)
+	}
+}
+
+func TestWrapError(t *testing.T) {
+	for _, code := range []pq.ErrorCode{errSerializationFailure, errDeadlockDetected} {
+		err := wrapError(&pq.Error{Code: code})
+		require.ErrorIs(t, err, backend.ErrTransactionConflict, code)
+		var pqErr *pq.Error
+		require.ErrorAs(t, err, &pqErr)
+		require.Equal(t, code, pqErr.Code)
+
+		// Wrapped postgres errors are also recognized
+		err = wrapError(fmt.Errorf("commit failed: %w", &pq.Error{Code: code}))
+		require.ErrorIs(t, err, backend.ErrTransactionConflict, code)
+	}
+
+	// Other errors are returned unchanged
+	for _, err := range []error{&pq.Error{Code: "23505"}, sql.ErrNoRows} {
+		require.Equal(t, err, wrapError(err))
+		require.NotErrorIs(t, wrapError(err), backend.ErrTransactionConflict)
+	}
+	require.NoError(t, wrapError(nil))
+}
+
+func TestConfigurePool(t *testing.T) {
+	// Opening a database doesn't connect to the server
+	db, err := sqlx.Open("postgres", dsn("127.0.0.1:5432", "TestConfigurePool", "postgres", "pass"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, configurePool(db, "7", "3", "1m"))
+	require.Equal(t, 7, db.Stats().MaxOpenConnections)
+
+	// Empty settings leave the pool unchanged
+	require.NoError(t, configurePool(db, "", "", ""))
+	require.Equal(t, 7, db.Stats().MaxOpenConnections)
+
+	for _, settings := range [][]string{{"seven", "", ""}, {"", "three", ""}, {"", "", "a minute"}} {
+		require.Error(t, configurePool(db, settings[0], settings[1], settings[2]), "%v", settings)
+	}
+}
+
+func TestRelDB(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t, "")
+
+	batch := []string{
+		`CREATE TABLE IF NOT EXISTS address (id INT PRIMARY KEY, street TEXT, street_number INT);`,
+		`CREATE TABLE IF NOT EXISTS user_addresses (address_id INT, user_id INT);`,
+		`DELETE FROM address;`,
+		`DELETE FROM user_addresses;`,
+		`INSERT INTO address (id, street, street_number) VALUES (1, 'rue Victor Hugo', 32);`,
+		`INSERT INTO address (id, street, street_number) VALUES (2, 'boulevard de la République', 23);`,
+		`INSERT INTO address (id, street, street_number) VALUES (3, 'rue Charles Martel', 5);`,
+		`INSERT INTO address (id, street, street_number) VALUES (4, 'chemin du bout du monde', 323);`,
+		`INSERT INTO user_addresses (address_id, user_id) VALUES (2, 1);`,
+		`INSERT INTO user_addresses (address_id, user_id) VALUES (4, 1);`,
+		`INSERT INTO user_addresses (address_id, user_id) VALUES (2, 2);`,
+	}
+	for _, b := range batch {
+		_, err := db.Exec(ctx, b)
+		require.NoError(t, err, b)
+	}
+
+	// ? and $1 placeholders are both supported
+	for _, query := range []string{
+		`SELECT address.street_number, address.street FROM address JOIN user_addresses ON address.id=user_addresses.address_id WHERE user_addresses.user_id = ? ORDER BY address.id;`,
+		`SELECT address.street_number, address.street FROM address JOIN user_addresses ON address.id=user_addresses.address_id WHERE user_addresses.user_id = $1 ORDER BY address.id;`,
+	} {
+		rows, err := db.Query(ctx, query, 1)
+		require.NoError(t, err)
+
+		var number int
+		var street string
+		require.True(t, rows.Next())
+		require.NoError(t, rows.Scan(&number, &street))
+		require.Equal(t, 23, number)
+		require.Equal(t, "boulevard de la République", street)
+		require.True(t, rows.Next())
+		require.NoError(t, rows.Scan(&number, &street))
+		require.Equal(t, 323, number)
+		require.False(t, rows.Next())
+		require.NoError(t, rows.Close())
+	}
+
+	var streets []string
+	require.NoError(t, db.Select(ctx, &streets, `SELECT street FROM address WHERE street_number > ? AND street LIKE '%?%' ORDER BY id;`, 10))
+	require.Empty(t, streets)
+	require.NoError(t, db.Select(ctx, &streets, `SELECT street FROM address WHERE street_number > ? ORDER BY id;`, 10))
+	require.Equal(t, []string{"rue Victor Hugo", "boulevard de la République", "chemin du bout du monde"}, streets)
+}
+
+func TestWithTx(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t, "")
+
+	batch := []string{
+		`CREATE TABLE IF NOT EXISTS accounts (id INT PRIMARY KEY, balance INT);`,
+		`DELETE FROM accounts;`,
+		`INSERT INTO accounts (id, balance) VALUES (1, 100), (2, 0);`,
+	}
+	for _, b := range batch {
+		_, err := db.Exec(ctx, b)
+		require.NoError(t, err)
+	}
+
+	// Concurrent serializable transfers fail to serialize and are retried, so no update is lost
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := backend.WithTx(ctx, db, backend.TxOptions{Isolation: sql.LevelSerializable}, func(ctx context.Context, tx backend.RelationalTx) error {
+				var balance int
+				if err := tx.Get(ctx, &balance, `SELECT balance FROM accounts WHERE id = 1;`); err != nil {
+					return err
+				}
+				if _, err := tx.Exec(ctx, `UPDATE accounts SET balance = ? WHERE id = 1;`, balance-10); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, `UPDATE accounts SET balance = balance + 10 WHERE id = 2;`)
+				return err
+			})
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	var balances []int
+	require.NoError(t, db.Select(ctx, &balances, `SELECT balance FROM accounts ORDER BY id;`))
+	require.Equal(t, []int{20, 80}, balances)
+
+	// Rolled back changes are discarded
+	tx, err := db.BeginTx(ctx, backend.TxOptions{})
+	require.NoError(t, err)
+	_, err = tx.Exec(ctx, `DELETE FROM accounts;`)
+	require.NoError(t, err)
+	require.NoError(t, tx.Rollback(ctx))
+	require.True(t, errors.Is(tx.Commit(ctx), sql.ErrTxDone))
+	require.NoError(t, db.Select(ctx, &balances, `SELECT balance FROM accounts ORDER BY id;`))
+	require.Equal(t, []int{20, 80}, balances)
+}
+
+func init() {
+	migrate.Register("postgres_teas", fstest.MapFS{
+		"1_create_teas.up.sql":         {Data: []byte(`CREATE TABLE teas (id INT PRIMARY KEY, name TEXT);`)},
+		"1_create_teas.down.sql":       {Data: []byte(`DROP TABLE teas;`)},
+		"2_add_sencha.postgres.up.sql": {Data: []byte(`INSERT INTO teas (id, name) VALUES (1, 'Sencha?');`)},
+		"2_add_sencha.down.sql":        {Data: []byte(`DELETE FROM teas;`)},
+		"2_add_sencha.mysql.up.sql":    {Data: []byte(`INSERT INTO teas VALUES (1, 'Sencha');`)},
+		"3_noop.postgres.up.sql":       {Data: []byte(`SELECT 1;`)},
+		"3_noop.postgres.down.sql":     {Data: []byte(`SELECT 1;`)},
+	}, ".")
+}
+
+func TestMigrations(t *testing.T) {
+	ctx := context.Background()
+	setup := testDB(t, "")
+	for _, statement := range []string{`DROP TABLE IF EXISTS teas;`, `DROP TABLE IF EXISTS schema_migrations;`} {
+		_, err := setup.Exec(ctx, statement)
+		require.NoError(t, err)
+	}
+
+	// Concurrent clients apply each migration once
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			testDB(t, "postgres_teas")
+		}()
+	}
+	wg.Wait()
+
+	var names []string
+	require.NoError(t, setup.Select(ctx, &names, `SELECT name FROM teas;`))
+	require.Equal(t, []string{"Sencha?"}, names)
+	var versions []int
+	require.NoError(t, setup.Select(ctx, &versions, `SELECT version FROM schema_migrations ORDER BY version;`))
+	require.Equal(t, []int{1, 2, 3}, versions)
+}
@@ -0,0 +1,763 @@
+package postgres
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// A stand-in for a postgres server, used by the tests when POSTGRES_ADDR isn't set.  It speaks as much of
+// postgres's wire protocol as lib/pq uses, and runs statements on an in-memory sqlite database.
+//
+// All clients share the one database, whichever database they connect to.  Statements are passed to
+// sqlite unchanged, except that $1 placeholders become ?1; CREATE DATABASE and the advisory locks of
+// [PostgresDB.lockMigrations] are implemented by the stand-in itself.  Transactions run one at a time;
+// a serializable transaction that begins while another is running fails with a serialization failure
+// at its first statement, as it could on postgres if the two conflict.
+type standIn struct {
+	conn *sql.Conn // the connection to the in-memory database, shared by all sessions
+
+	lock     sync.Mutex
+	changed  *sync.Cond          // broadcast when owner or advisory change
+	owner    *session            // the session using conn, if any
+	advisory map[string]*session // holders of advisory locks, by key
+}
+
+// Starts a stand-in listening on a random local port and returns its address.
+func startStandIn() (string, error) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return "", err
+	}
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return "", err
+	}
+	if _, err := conn.ExecContext(context.Background(), `CREATE TABLE pg_database (datname TEXT PRIMARY KEY);`); err != nil {
+		return "", err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+
+	s := &standIn{conn: conn, advisory: make(map[string]*session)}
+	s.changed = sync.NewCond(&s.lock)
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return listener.Addr().String(), nil
+}
+
+// An error returned to the client as an ErrorResponse
+type pgError struct {
+	code    string
+	message string
+}
+
+func (e *pgError) Error() string { return e.code + ": " + e.message }
+
+var (
+	errInFailedTx = &pgError{"25P02", "current transaction is aborted, commands ignored until end of transaction block"}
+	errSerialize  = &pgError{"40001", "could not serialize access due to concurrent update"}
+)
+
+// Converts a sqlite error to a postgres one
+func toPgError(err error) *pgError {
+	var pgErr *pgError
+	if errors.As(err, &pgErr) {
+		return pgErr
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey) {
+		return &pgError{"23505", err.Error()}
+	}
+	return &pgError{"XX000", err.Error()}
+}
+
+type statementKind int
+
+const (
+	sqliteStatement statementKind = iota
+	beginStatement
+	commitStatement
+	rollbackStatement
+	createDatabaseStatement
+	advisoryLockStatement
+	advisoryUnlockStatement
+)
+
+type statement struct {
+	kind         statementKind
+	query        string // with placeholders translated for sqlite
+	serializable bool   // for beginStatement
+	database     string // for createDatabaseStatement
+	params       int
+	columns      []string
+}
+
+var (
+	beginRegex          = regexp.MustCompile(`(?is)^\s*(BEGIN|START\s+TRANSACTION)\b(.*)$`)
+	commitRegex         = regexp.MustCompile(`(?is)^\s*(COMMIT|END)\b`)
+	rollbackRegex       = regexp.MustCompile(`(?is)^\s*(ROLLBACK|ABORT)\b`)
+	createDatabaseRegex = regexp.MustCompile(`(?is)^\s*CREATE\s+DATABASE\s+"((?:[^"]|"")*)"\s*;?\s*$`)
+	advisoryRegex       = regexp.MustCompile(`(?is)^\s*SELECT\s+pg_advisory_(lock|unlock)\(\s*hashtext\(\s*\$1\s*\)\s*\)\s*;?\s*$`)
+)
+
+// Translates postgres's $1 placeholders, outside of quotes, to sqlite's ?1
+func translatePlaceholders(query string) string {
+	var b strings.Builder
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '$' && i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9':
+			c = '?'
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// The state of one client connection
+type session struct {
+	s *standIn
+	r *bufio.Reader
+	w *bufio.Writer
+
+	inTx   bool // a transaction block is open
+	owns   bool // the session holds the database for its transaction
+	doomed bool // the transaction began while another was running, and fails at its first statement
+	failed bool // a statement of the transaction failed
+
+	statements map[string]*statement
+	portals    map[string]*portal
+	skipping   bool // an extended query failed, so messages are ignored until Sync
+}
+
+type portal struct {
+	statement *statement
+	args      []any
+}
+
+func (s *standIn) serve(c net.Conn) {
+	defer c.Close()
+	sess := &session{
+		s:          s,
+		r:          bufio.NewReader(c),
+		w:          bufio.NewWriter(c),
+		statements: make(map[string]*statement),
+		portals:    make(map[string]*portal),
+	}
+	defer sess.close()
+	if err := sess.startup(); err != nil {
+		return
+	}
+	for {
+		typ, body, err := sess.receive()
+		if err != nil || typ == 'X' {
+			return
+		}
+		if err := sess.handle(typ, body); err != nil {
+			return
+		}
+	}
+}
+
+// Releases the database and advisory locks held by the session
+func (sess *session) close() {
+	sess.s.lock.Lock()
+	defer sess.s.lock.Unlock()
+	if sess.owns {
+		sess.s.conn.ExecContext(context.Background(), `ROLLBACK;`)
+		sess.s.owner = nil
+	}
+	for key, holder := range sess.s.advisory {
+		if holder == sess {
+			delete(sess.s.advisory, key)
+		}
+	}
+	sess.s.changed.Broadcast()
+}
+
+func (sess *session) startup() error {
+	for {
+		var length int32
+		if err := binary.Read(sess.r, binary.BigEndian, &length); err != nil {
+			return err
+		}
+		body := make([]byte, length-4)
+		if _, err := io.ReadFull(sess.r, body); err != nil {
+			return err
+		}
+		switch binary.BigEndian.Uint32(body) {
+		case 80877103: // SSLRequest
+			if err := sess.w.WriteByte('N'); err != nil {
+				return err
+			}
+			if err := sess.w.Flush(); err != nil {
+				return err
+			}
+		case 196608: // protocol 3.0
+			sess.send('R', new(message).int32(0))                                // AuthenticationOk
+			sess.send('S', new(message).string("server_version").string("16.0")) // ParameterStatus
+			return sess.ready()
+		default: // e.g. CancelRequest, which isn't supported
+			return fmt.Errorf("unsupported startup message")
+		}
+	}
+}
+
+func (sess *session) receive() (byte, *reader, error) {
+	typ, err := sess.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var length int32
+	if err := binary.Read(sess.r, binary.BigEndian, &length); err != nil {
+		return 0, nil, err
+	}
+	body := make([]byte, length-4)
+	if _, err := io.ReadFull(sess.r, body); err != nil {
+		return 0, nil, err
+	}
+	return typ, &reader{body}, nil
+}
+
+func (sess *session) handle(typ byte, r *reader) error {
+	if typ == 'S' { // Sync
+		sess.skipping = false
+		return sess.ready()
+	}
+	if sess.skipping {
+		return nil
+	}
+
+	var err error
+	switch typ {
+	case 'Q': // Query
+		err = sess.simpleQuery(r.string())
+		if err != nil {
+			sess.sendError(err)
+		}
+		return sess.ready()
+	case 'P': // Parse
+		name, query := r.string(), r.string()
+		var st *statement
+		if st, err = sess.prepare(query); err == nil {
+			sess.statements[name] = st
+			sess.send('1', nil) // ParseComplete
+		}
+	case 'D': // Describe
+		kind, name := r.byte(), r.string()
+		if kind == 'S' {
+			err = sess.describeStatement(sess.statements[name])
+		} else if p := sess.portals[name]; p != nil {
+			sess.describeColumns(p.statement)
+		} else {
+			err = &pgError{"34000", fmt.Sprintf("portal %q does not exist", name)}
+		}
+	case 'B': // Bind
+		err = sess.bind(r)
+	case 'E': // Execute
+		name := r.string()
+		if p := sess.portals[name]; p != nil {
+			err = sess.execute(p.statement, p.args)
+		} else {
+			err = &pgError{"34000", fmt.Sprintf("portal %q does not exist", name)}
+		}
+	case 'C': // Close
+		kind, name := r.byte(), r.string()
+		if kind == 'S' {
+			delete(sess.statements, name)
+		} else {
+			delete(sess.portals, name)
+		}
+		sess.send('3', nil) // CloseComplete
+	case 'H': // Flush
+		return sess.w.Flush()
+	default:
+		err = &pgError{"08P01", fmt.Sprintf("unsupported message %q", typ)}
+	}
+	if err != nil {
+		sess.sendError(err)
+		sess.skipping = true
+	}
+	return nil
+}
+
+func (sess *session) simpleQuery(query string) error {
+	if strings.TrimSpace(strings.TrimRight(strings.TrimSpace(query), ";")) == "" {
+		sess.send('I', nil) // EmptyQueryResponse
+		return nil
+	}
+	st, err := sess.prepare(query)
+	if err != nil {
+		return err
+	}
+	if st.params > 0 {
+		return &pgError{"08P01", fmt.Sprintf("%v parameters given, but the query has %v", 0, st.params)}
+	}
+	if len(st.columns) > 0 {
+		sess.describeColumns(st)
+	}
+	return sess.execute(st, nil)
+}
+
+func (sess *session) bind(r *reader) error {
+	portalName, name := r.string(), r.string()
+	st := sess.statements[name]
+	if st == nil {
+		return &pgError{"26000", fmt.Sprintf("prepared statement %q does not exist", name)}
+	}
+	formats := make([]int, r.int16())
+	for i := range formats {
+		formats[i] = r.int16()
+	}
+	args := make([]any, r.int16())
+	for i := range args {
+		if len(formats) == 1 && formats[0] != 0 || len(formats) > 1 && formats[i] != 0 {
+			return &pgError{"0A000", "binary parameters are not supported"}
+		}
+		if n := r.int32(); n >= 0 {
+			args[i] = string(r.bytes(n))
+		}
+	}
+	if len(args) != st.params {
+		return &pgError{"08P01", fmt.Sprintf("%v parameters given, but the query has %v", len(args), st.params)}
+	}
+	sess.portals[portalName] = &portal{statement: st, args: args}
+	sess.send('2', nil) // BindComplete
+	return nil
+}
+
+func (sess *session) describeStatement(st *statement) error {
+	if st == nil {
+		return &pgError{"26000", "prepared statement does not exist"}
+	}
+	params := new(message).int16(st.params)
+	for i := 0; i < st.params; i++ {
+		params.int32(0) // unspecified type
+	}
+	sess.send('t', params) // ParameterDescription
+	sess.describeColumns(st)
+	return nil
+}
+
+// Sends a RowDescription of st's columns, all of which are text, or NoData if it has none
+func (sess *session) describeColumns(st *statement) {
+	if len(st.columns) == 0 {
+		sess.send('n', nil)
+		return
+	}
+	columns := new(message).int16(len(st.columns))
+	for _, column := range st.columns {
+		columns.string(column).int32(0).int16(0) // no table or attribute
+		columns.int32(25).int16(-1).int32(-1)    // text
+		columns.int16(0)                         // text format
+	}
+	sess.send('T', columns)
+}
+
+// Returns the error of a statement in the current transaction, if it has failed
+func (sess *session) checkTx() error {
+	switch {
+	case !sess.inTx:
+		return nil
+	case sess.doomed:
+		sess.doomed, sess.failed = false, true
+		return errSerialize
+	case sess.failed:
+		return errInFailedTx
+	}
+	return nil
+}
+
+func (sess *session) prepare(query string) (*statement, error) {
+	switch {
+	case beginRegex.MatchString(query):
+		rest := strings.ToUpper(beginRegex.FindStringSubmatch(query)[2])
+		return &statement{kind: beginStatement, serializable: strings.Contains(rest, "SERIALIZABLE")}, nil
+	case commitRegex.MatchString(query):
+		return &statement{kind: commitStatement}, nil
+	case rollbackRegex.MatchString(query):
+		return &statement{kind: rollbackStatement}, nil
+	}
+	if err := sess.checkTx(); err != nil {
+		return nil, err
+	}
+	if m := createDatabaseRegex.FindStringSubmatch(query); m != nil {
+		return &statement{kind: createDatabaseStatement, database: strings.ReplaceAll(m[1], `""`, `"`)}, nil
+	}
+	if m := advisoryRegex.FindStringSubmatch(query); m != nil {
+		st := &statement{kind: advisoryLockStatement, params: 1, columns: []string{"pg_advisory_lock"}}
+		if strings.EqualFold(m[1], "unlock") {
+			st.kind, st.columns = advisoryUnlockStatement, []string{"pg_advisory_unlock"}
+		}
+		return st, nil
+	}
+
+	st := &statement{kind: sqliteStatement, query: translatePlaceholders(query)}
+	err := sess.use(func() error {
+		return sess.s.conn.Raw(func(driverConn any) error {
+			// Binding a statement without stepping it reveals its columns without running it
+			stmt, err := driverConn.(driver.ConnPrepareContext).PrepareContext(context.Background(), st.query)
+			if err != nil {
+				return err
+			}
+			defer stmt.Close()
+			st.params = stmt.NumInput()
+			args := make([]driver.NamedValue, st.params)
+			for i := range args {
+				args[i].Ordinal = i + 1
+			}
+			rows, err := stmt.(driver.StmtQueryContext).QueryContext(context.Background(), args)
+			if err != nil {
+				return err
+			}
+			st.columns = rows.Columns()
+			return rows.Close()
+		})
+	})
+	if err != nil {
+		sess.failTx()
+		return nil, err
+	}
+	return st, nil
+}
+
+func (sess *session) failTx() {
+	if sess.inTx {
+		sess.failed = true
+	}
+}
+
+// Runs fn while holding the database, waiting for any other session's transaction to end
+func (sess *session) use(fn func() error) error {
+	if sess.owns {
+		return fn()
+	}
+	sess.s.lock.Lock()
+	for sess.s.owner != nil {
+		sess.s.changed.Wait()
+	}
+	sess.s.owner = sess
+	sess.s.lock.Unlock()
+
+	defer sess.release()
+	return fn()
+}
+
+func (sess *session) release() {
+	sess.s.lock.Lock()
+	defer sess.s.lock.Unlock()
+	sess.s.owner = nil
+	sess.owns = false
+	sess.s.changed.Broadcast()
+}
+
+// Runs st and sends its rows and CommandComplete
+func (sess *session) execute(st *statement, args []any) error {
+	switch st.kind {
+	case beginStatement:
+		return sess.begin(st.serializable)
+	case commitStatement, rollbackStatement:
+		return sess.end(st.kind == commitStatement)
+	case advisoryLockStatement, advisoryUnlockStatement:
+		return sess.advisory(st, args[0].(string))
+	}
+	if err := sess.checkTx(); err != nil {
+		return err
+	}
+
+	var rows [][]*string
+	var affected int64
+	err := sess.use(func() error {
+		ctx := context.Background()
+		if st.kind == createDatabaseStatement {
+			_, err := sess.s.conn.ExecContext(ctx, `INSERT INTO pg_database (datname) VALUES (?);`, st.database)
+			if err != nil && toPgError(err).code == "23505" {
+				return &pgError{"42P04", fmt.Sprintf("database %q already exists", st.database)}
+			}
+			return err
+		}
+		if len(st.columns) == 0 {
+			result, err := sess.s.conn.ExecContext(ctx, st.query, args...)
+			if err != nil {
+				return err
+			}
+			affected, err = result.RowsAffected()
+			return err
+		}
+		result, err := sess.s.conn.QueryContext(ctx, st.query, args...)
+		if err != nil {
+			return err
+		}
+		defer result.Close()
+		for result.Next() {
+			values := make([]any, len(st.columns))
+			pointers := make([]any, len(values))
+			for i := range values {
+				pointers[i] = &values[i]
+			}
+			if err := result.Scan(pointers...); err != nil {
+				return err
+			}
+			rows = append(rows, textValues(values))
+		}
+		affected = int64(len(rows))
+		return result.Err()
+	})
+	if err != nil {
+		sess.failTx()
+		return err
+	}
+
+	for _, row := range rows {
+		sess.sendRow(row)
+	}
+	sess.send('C', new(message).string(commandTag(st, affected)))
+	return nil
+}
+
+// Formats values scanned from sqlite as postgres's text format
+func textValues(values []any) []*string {
+	texts := make([]*string, len(values))
+	for i, value := range values {
+		var text string
+		switch v := value.(type) {
+		case nil:
+			continue
+		case []byte:
+			text = string(v)
+		case time.Time:
+			text = v.Format(time.RFC3339Nano)
+		case bool:
+			text = map[bool]string{true: "t", false: "f"}[v]
+		default:
+			text = fmt.Sprint(v)
+		}
+		texts[i] = &text
+	}
+	return texts
+}
+
+func commandTag(st *statement, affected int64) string {
+	if st.kind == createDatabaseStatement {
+		return "CREATE DATABASE"
+	}
+	words := strings.Fields(strings.ToUpper(strings.TrimLeft(st.query, " \t\r\n(")))
+	if len(words) == 0 {
+		return ""
+	}
+	switch words[0] {
+	case "INSERT":
+		return fmt.Sprintf("INSERT 0 %d", affected)
+	case "SELECT", "WITH", "VALUES", "UPDATE", "DELETE":
+		if words[0] == "WITH" || words[0] == "VALUES" {
+			words[0] = "SELECT"
+		}
+		return fmt.Sprintf("%v %d", words[0], affected)
+	case "CREATE", "DROP", "ALTER":
+		if len(words) > 1 {
+			return words[0] + " " + strings.TrimRight(words[1], ";")
+		}
+	}
+	return strings.TrimRight(words[0], ";")
+}
+
+func (sess *session) begin(serializable bool) error {
+	if !sess.inTx {
+		sess.inTx = true
+		sess.s.lock.Lock()
+		if serializable && sess.s.owner != nil {
+			sess.doomed = true
+		} else {
+			for sess.s.owner != nil {
+				sess.s.changed.Wait()
+			}
+			sess.s.owner, sess.owns = sess, true
+		}
+		sess.s.lock.Unlock()
+		if sess.owns {
+			if _, err := sess.s.conn.ExecContext(context.Background(), `BEGIN;`); err != nil {
+				sess.release()
+				sess.inTx = false
+				return err
+			}
+		}
+	}
+	sess.send('C', new(message).string("BEGIN"))
+	return nil
+}
+
+func (sess *session) end(commit bool) error {
+	tag := "ROLLBACK"
+	if commit && !sess.failed && !sess.doomed {
+		tag = "COMMIT"
+	}
+	var err error
+	if sess.owns {
+		if tag == "COMMIT" {
+			_, err = sess.s.conn.ExecContext(context.Background(), `COMMIT;`)
+		}
+		if tag == "ROLLBACK" || err != nil {
+			sess.s.conn.ExecContext(context.Background(), `ROLLBACK;`)
+		}
+		sess.release()
+	}
+	sess.inTx, sess.doomed, sess.failed = false, false, false
+	if err != nil {
+		return err
+	}
+	sess.send('C', new(message).string(tag))
+	return nil
+}
+
+func (sess *session) advisory(st *statement, key string) error {
+	sess.s.lock.Lock()
+	result := "t"
+	if st.kind == advisoryLockStatement {
+		for sess.s.advisory[key] != nil && sess.s.advisory[key] != sess {
+			sess.s.changed.Wait()
+		}
+		sess.s.advisory[key] = sess
+		result = ""
+	} else if sess.s.advisory[key] == sess {
+		delete(sess.s.advisory, key)
+		sess.s.changed.Broadcast()
+	} else {
+		result = "f"
+	}
+	sess.s.lock.Unlock()
+
+	sess.sendRow([]*string{&result})
+	sess.send('C', new(message).string("SELECT 1"))
+	return nil
+}
+
+func (sess *session) sendRow(row []*string) {
+	data := new(message).int16(len(row))
+	for _, value := range row {
+		if value == nil {
+			data.int32(-1)
+		} else {
+			data.int32(len(*value))
+			*data = append(*data, *value...)
+		}
+	}
+	sess.send('D', data) // DataRow
+}
+
+func (sess *session) sendError(err error) {
+	pgErr := toPgError(err)
+	fields := new(message)
+	fields.byte('S').string("ERROR").byte('V').string("ERROR")
+	fields.byte('C').string(pgErr.code).byte('M').string(pgErr.message)
+	fields.byte(0)
+	sess.send('E', fields) // ErrorResponse
+}
+
+// Sends ReadyForQuery with the transaction status and flushes the buffered messages
+func (sess *session) ready() error {
+	status := byte('I')
+	if sess.inTx && sess.failed {
+		status = 'E'
+	} else if sess.inTx {
+		status = 'T'
+	}
+	sess.send('Z', new(message).byte(status))
+	return sess.w.Flush()
+}
+
+func (sess *session) send(typ byte, body *message) {
+	if body == nil {
+		body = new(message)
+	}
+	sess.w.WriteByte(typ)
+	binary.Write(sess.w, binary.BigEndian, int32(len(*body)+4))
+	sess.w.Write(*body)
+}
+
+// The body of a message to the client
+type message []byte
+
+func (m *message) byte(b byte) *message {
+	*m = append(*m, b)
+	return m
+}
+
+func (m *message) int16(n int) *message {
+	*m = binary.BigEndian.AppendUint16(*m, uint16(n))
+	return m
+}
+
+func (m *message) int32(n int) *message {
+	*m = binary.BigEndian.AppendUint32(*m, uint32(n))
+	return m
+}
+
+func (m *message) string(s string) *message {
+	*m = append(append(*m, s...), 0)
+	return m
+}
+
+// The body of a message from the client
+type reader struct {
+	buf []byte
+}
+
+func (r *reader) byte() byte {
+	b := r.buf[0]
+	r.buf = r.buf[1:]
+	return b
+}
+
+func (r *reader) int16() int {
+	n := int16(binary.BigEndian.Uint16(r.buf))
+	r.buf = r.buf[2:]
+	return int(n)
+}
+
+func (r *reader) int32() int {
+	n := int32(binary.BigEndian.Uint32(r.buf))
+	r.buf = r.buf[4:]
+	return int(n)
+}
+
+func (r *reader) string() string {
+	end := strings.IndexByte(string(r.buf), 0)
+	s := string(r.buf[:end])
+	r.buf = r.buf[end+1:]
+	return s
+}
+
+func (r *reader) bytes(n int) []byte {
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
@@ -1,42 +1,125 @@
 // Package rabbitmq provides a client-wrapper implementation of the [backend.Queue] interface for a rabbitmq server.
+//
+// Items are consumed with manual acknowledgements.  [backend.Queue.Pop] acknowledges items as soon as they are
+// received, whereas [backend.Queue.PopDelivery] leaves it to the caller.  A client only starts consuming when it
+// first pops an item, so clients that only push items don't hold on to any.
+//
+// Because rabbitmq's classic queues don't count deliveries, the client redelivers an item by publishing it again
+// to the tail of the queue, with a header that counts its deliveries, before acknowledging the original.  Items
+// are dead-lettered by publishing them to a queue named after the queue with a ".dlq" suffix.  The visibility
+// timeout is enforced by the client that popped the item; if the client disconnects instead, the server
+// redelivers its unacknowledged items.
 package rabbitmq
 
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+// The default settings of a [RabbitMQ] queue
+const (
+	DefaultVisibilityTimeout = 30 * time.Second
+	DefaultMaxDeliveries     = 5
+)
+
+// The maximum number of unacknowledged items that the server sends to a client
+const prefetchCount = 64
+
+// The header that counts an item's previous deliveries
+const deliveriesHeader = "x-blueprint-deliveries"
+
 // Implements a Queue that uses the rabbitmq package
 type RabbitMQ struct {
-	name  string
-	queue amqp.Queue
-	ch    *amqp.Channel
-	conn  *amqp.Connection
-	msgs  <-chan amqp.Delivery
+	name              string
+	queue             amqp.Queue
+	deadLetters       string
+	visibilityTimeout time.Duration
+	maxDeliveries     int
+	ch                *amqp.Channel
+	conn              *amqp.Connection
+
+	consumeLock sync.Mutex
+	msgs        <-chan amqp.Delivery // nil until the client starts consuming
 }
 
 // Instantiates a new [Queue] instances that provides a queue interface via a RabbitMQ instance
-func NewRabbitMQ(ctx context.Context, addr string, queue_name string) (*RabbitMQ, error) {
-	conn, err := amqp.Dial("amqp://guest:guest@" + addr + "/")
+//
+// visibility_timeout is a duration such as "30s" after which items popped with [RabbitMQ.PopDelivery] that
+// haven't been acknowledged are redelivered.  max_deliveries is the number of times an item is delivered before
+// it is moved to the dead-letter queue; "0" means items are redelivered until they are acknowledged.  Empty
+// values leave the defaults, 30 seconds and 5 deliveries.
+func NewRabbitMQ(ctx context.Context, addr string, queue_name string, visibility_timeout string, max_deliveries string) (*RabbitMQ, error) {
+	q := &RabbitMQ{
+		name:              queue_name,
+		deadLetters:       queue_name + ".dlq",
+		visibilityTimeout: DefaultVisibilityTimeout,
+		maxDeliveries:     DefaultMaxDeliveries,
+	}
+	var err error
+	if visibility_timeout != "" {
+		if q.visibilityTimeout, err = time.ParseDuration(visibility_timeout); err != nil || q.visibilityTimeout <= 0 {
+			return nil, fmt.Errorf("invalid visibility timeout %q for queue %v; expected a positive duration", visibility_timeout, queue_name)
+		}
+	}
+	if max_deliveries != "" {
+		if q.maxDeliveries, err = strconv.Atoi(max_deliveries); err != nil || q.maxDeliveries < 0 {
+			return nil, fmt.Errorf("invalid maximum number of deliveries %q for queue %v; expected a non-negative integer", max_deliveries, queue_name)
+		}
+	}
+
+	q.conn, err = amqp.Dial("amqp://guest:guest@" + addr + "/")
 	if err != nil {
 		return nil, err
 	}
-	ch, err := conn.Channel()
-	if err != nil {
+	if err := q.open(); err != nil {
+		q.conn.Close()
 		return nil, err
 	}
-	q, err := ch.QueueDeclare(queue_name, false, false, false, false, nil)
-	if err != nil {
+	return q, nil
+}
+
+// Declares the queue and its dead-letter queue
+func (q *RabbitMQ) open() (err error) {
+	if q.ch, err = q.conn.Channel(); err != nil {
+		return err
+	}
+	if q.queue, err = q.ch.QueueDeclare(q.name, false, false, false, false, nil); err != nil {
+		return err
+	}
+	_, err = q.ch.QueueDeclare(q.deadLetters, false, false, false, false, nil)
+	return err
+}
+
+// Starts consuming the queue if the client hasn't already, and returns the channel of deliveries
+func (q *RabbitMQ) consume() (<-chan amqp.Delivery, error) {
+	q.consumeLock.Lock()
+	defer q.consumeLock.Unlock()
+	if q.msgs != nil {
+		return q.msgs, nil
+	}
+	if err := q.ch.Qos(prefetchCount, 0, false); err != nil {
 		return nil, err
 	}
-	msgs, err := ch.Consume(q.Name, "", true, false, false, false, nil)
+	msgs, err := q.ch.Consume(q.queue.Name, "", false, false, false, false, nil)
 	if err != nil {
 		return nil, err
 	}
-	return &RabbitMQ{name: queue_name, conn: conn, ch: ch, queue: q, msgs: msgs}, nil
+	q.msgs = msgs
+	return msgs, nil
+}
+
+// Closes the client's connection to the server.  The server redelivers the items that the client hasn't
+// acknowledged.
+func (q *RabbitMQ) Close() error {
+	return q.conn.Close()
 }
 
 func getBytes(key interface{}) ([]byte, error) {
@@ -49,37 +132,163 @@ func decodeBytes(val []byte) (interface{}, error) {
 	return res, err
 }
 
+// Publishes body to the named queue, with the number of times it has been delivered
+func (q *RabbitMQ) publish(ctx context.Context, queue_name string, body []byte, deliveries int) error {
+	publish_msg := amqp.Publishing{ContentType: "text/plain", Body: body}
+	if deliveries > 0 {
+		publish_msg.Headers = amqp.Table{deliveriesHeader: int64(deliveries)}
+	}
+	return q.ch.PublishWithContext(ctx, "", queue_name, false, false, publish_msg)
+}
+
 // Push implements backend.Queue
 func (q *RabbitMQ) Push(ctx context.Context, item interface{}) (bool, error) {
 	raw_bytes, err := getBytes(item)
 	if err != nil {
 		return false, err
 	}
-	publish_msg := amqp.Publishing{ContentType: "text/plain", Body: raw_bytes}
-	return true, q.ch.Publish("", q.queue.Name, false, false, publish_msg)
+	return true, q.publish(ctx, q.queue.Name, raw_bytes, 0)
 }
 
-// Pop implements backend.Queue
-func (q *RabbitMQ) Pop(ctx context.Context, dst interface{}) (bool, error) {
+// Receives the next item from the server.  Returns false if ctx is done first.
+func (q *RabbitMQ) receive(ctx context.Context) (amqp.Delivery, bool, error) {
+	var v amqp.Delivery
+	msgs, err := q.consume()
+	if err != nil {
+		return v, false, err
+	}
+	var ok bool
 	select {
-	case v := <-q.msgs:
-		val, err := decodeBytes(v.Body)
-		if err != nil {
-			return true, err
-		}
-		return true, backend.CopyResult(val, dst)
+	case v, ok = <-msgs:
 	default:
 		{
 			select {
-			case v := <-q.msgs:
-				val, err := decodeBytes(v.Body)
-				if err != nil {
-					return true, err
-				}
-				return true, backend.CopyResult(val, dst)
+			case v, ok = <-msgs:
 			case <-ctx.Done():
-				return false, nil
+				return v, false, nil
 			}
 		}
 	}
+	if !ok {
+		return v, true, amqp.ErrClosed
+	}
+	return v, true, nil
+}
+
+// Pop implements backend.Queue
+func (q *RabbitMQ) Pop(ctx context.Context, dst interface{}) (bool, error) {
+	v, received, err := q.receive(ctx)
+	if !received || err != nil {
+		return received, err
+	}
+	if err := v.Ack(false); err != nil {
+		return true, err
+	}
+	val, err := decodeBytes(v.Body)
+	if err != nil {
+		return true, err
+	}
+	return true, backend.CopyResult(val, dst)
+}
+
+// PopDelivery implements backend.Queue
+func (q *RabbitMQ) PopDelivery(ctx context.Context, dst interface{}) (backend.QueueDelivery, bool, error) {
+	v, received, err := q.receive(ctx)
+	if !received || err != nil {
+		return nil, received, err
+	}
+
+	d := &delivery{q: q, msg: v, deliveries: previousDeliveries(v) + 1}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	val, err := decodeBytes(v.Body)
+	if err == nil {
+		err = backend.CopyResult(val, dst)
+	}
+	if err != nil {
+		return nil, true, errors.Join(err, d.settle(ctx, false, false))
+	}
+	d.timer = time.AfterFunc(q.visibilityTimeout, d.expire)
+	return d, true, nil
+}
+
+// Returns the number of times v was delivered before.  If the server redelivered v, e.g. because the client
+// that popped it disconnected, the server's delivery is counted too.
+func previousDeliveries(v amqp.Delivery) int {
+	n := 0
+	switch count := v.Headers[deliveriesHeader].(type) {
+	case int64:
+		n = int(count)
+	case int32:
+		n = int(count)
+	case int:
+		n = count
+	}
+	if v.Redelivered {
+		n++
+	}
+	return n
+}
+
+// An item popped with [RabbitMQ.PopDelivery]
+type delivery struct {
+	q          *RabbitMQ
+	msg        amqp.Delivery
+	deliveries int
+
+	mu    sync.Mutex
+	timer *time.Timer
+	done  bool
+}
+
+// Ends the delivery.  Unless the item was acknowledged, it is published again to the queue if requeue is true
+// and it can be delivered again, and to the dead-letter queue otherwise.  d.mu must be held.
+func (d *delivery) settle(ctx context.Context, ack bool, requeue bool) error {
+	if d.done {
+		return backend.ErrDeliveryExpired
+	}
+	d.done = true
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+
+	if !ack {
+		var err error
+		if requeue && (d.q.maxDeliveries == 0 || d.deliveries < d.q.maxDeliveries) {
+			err = d.q.publish(ctx, d.q.queue.Name, d.msg.Body, d.deliveries)
+		} else {
+			err = d.q.publish(ctx, d.q.deadLetters, d.msg.Body, 0)
+		}
+		if err != nil {
+			// Leave it to the server to redeliver the item
+			return errors.Join(err, d.msg.Nack(false, true))
+		}
+	}
+	return d.msg.Ack(false)
+}
+
+// Ack implements backend.QueueDelivery
+func (d *delivery) Ack(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.settle(ctx, true, false)
+}
+
+// Nack implements backend.QueueDelivery
+func (d *delivery) Nack(ctx context.Context, requeue bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.settle(ctx, false, requeue)
+}
+
+// Deliveries implements backend.QueueDelivery
+func (d *delivery) Deliveries() int {
+	return d.deliveries
+}
+
+// Redelivers the item when the visibility timeout elapses
+func (d *delivery) expire() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.settle(context.Background(), false, true)
 }
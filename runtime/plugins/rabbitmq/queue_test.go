@@ -5,13 +5,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend/backendtest"
 	"github.com/stretchr/testify/require"
 )
 
 func TestPushPop(t *testing.T) {
 	ctx := context.Background()
 
-	q, err := NewRabbitMQ(ctx, "localhost:5672", "queue")
+	q, err := NewRabbitMQ(ctx, "localhost:5672", "queue", "", "")
 	require.NoError(t, err)
 
 	snd := "hello"
@@ -36,7 +37,7 @@ func TestTryTimeout(t *testing.T) {
 
 	ctx := context.Background()
 
-	q, err := NewRabbitMQ(ctx, "localhost:5672", "queue")
+	q, err := NewRabbitMQ(ctx, "localhost:5672", "queue", "", "")
 	require.NoError(t, err)
 
 	first := "hello"
@@ -97,3 +98,53 @@ func TestTryTimeout(t *testing.T) {
 		require.Equal(t, second, rcv)
 	}
 }
+
+func TestPushOnly(t *testing.T) {
+	ctx := context.Background()
+
+	name := "pushonly." + time.Now().Format("20060102150405.000000")
+	producer, err := NewRabbitMQ(ctx, "localhost:5672", name, "", "")
+	require.NoError(t, err)
+	defer producer.Close()
+	consumer, err := NewRabbitMQ(ctx, "localhost:5672", name, "", "")
+	require.NoError(t, err)
+	defer consumer.Close()
+
+	// The producer never pops, so it mustn't take deliveries of the items it pushes
+	for _, item := range []string{"hello", "world"} {
+		success, err := producer.Push(ctx, item)
+		require.NoError(t, err)
+		require.True(t, success)
+	}
+	for _, item := range []string{"hello", "world"} {
+		var rcv string
+		timeoutCtx, cancel := context.WithTimeout(ctx, time.Second)
+		success, err := consumer.Pop(timeoutCtx, &rcv)
+		cancel()
+		require.NoError(t, err)
+		require.True(t, success)
+		require.Equal(t, item, rcv)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	ctx := context.Background()
+
+	name := "conformance." + time.Now().Format("20060102150405.000000")
+	q, err := NewRabbitMQ(ctx, "localhost:5672", name, "200ms", "3")
+	require.NoError(t, err)
+	defer q.Close()
+	deadLetters, err := NewRabbitMQ(ctx, "localhost:5672", name+".dlq", "", "")
+	require.NoError(t, err)
+	defer deadLetters.Close()
+
+	backendtest.TestQueue(t, q, deadLetters, 200*time.Millisecond, 3)
+}
+
+func TestInvalidSettings(t *testing.T) {
+	ctx := context.Background()
+	for _, args := range [][2]string{{"0s", ""}, {"soon", ""}, {"", "-1"}, {"", "five"}} {
+		_, err := NewRabbitMQ(ctx, "localhost:5672", "queue", args[0], args[1])
+		require.Error(t, err, args)
+	}
+}
@@ -0,0 +1,333 @@
+// Package ratelimit implements the runtime components of Blueprint's ratelimit plugin.
+//
+// Limiters do not need to be used directly by application workflow specs.  Instead, this
+// code is included in a compiled application by applying the ratelimit modifier to the wiring spec.
+//
+// A [Limiter] admits calls if they pass two checks:
+//   - A per-method token bucket, refilled at a configured rate
+//   - An optional concurrency limit on the number of calls in flight, which can be fixed or
+//     adapted to observed latencies using AIMD or gradient load shedding
+//
+// Rejected calls fail with an error that wraps [ErrRejected], so that callers can distinguish
+// shed load from other failures.
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// Wrapped by all errors returned for calls rejected by a [Limiter]
+	ErrRejected = errors.New("rejected by rate limiter")
+
+	// Returned for calls that exceed the rate of their method's token bucket
+	ErrRateLimited = fmt.Errorf("rate limit exceeded: %w", ErrRejected)
+
+	// Returned for calls that exceed the concurrency limit
+	ErrOverloaded = fmt.Errorf("concurrency limit exceeded: %w", ErrRejected)
+)
+
+// Strategies for adapting the concurrency limit
+const (
+	// The concurrency limit is fixed
+	NoShedding = "none"
+
+	// Additive-increase, multiplicative-decrease: the limit grows by one every limit calls
+	// that complete within the target latency, and shrinks by a constant factor otherwise
+	AIMD = "aimd"
+
+	// The limit is scaled by the ratio of the minimum observed latency to the current latency
+	Gradient = "gradient"
+)
+
+// Configuration of a [Limiter]
+type Config struct {
+	// Default rate, in calls per second, of each method's token bucket.  Zero means unlimited.
+	Rate float64
+
+	// Default capacity of each method's token bucket.  If zero, defaults to the rate rounded up.
+	Burst int
+
+	// Per-method overrides of Rate
+	MethodRates map[string]float64
+
+	// Initial concurrency limit.  Zero means no concurrency limit.
+	Concurrency int
+
+	// Bounds of an adaptive concurrency limit.  Default to 1 and 10 times Concurrency.
+	MinConcurrency int
+	MaxConcurrency int
+
+	// One of [NoShedding], [AIMD], or [Gradient]
+	Shedding string
+
+	// For [AIMD], calls slower than this are treated as a sign of overload
+	TargetLatency time.Duration
+}
+
+// Parses a comma-separated key=value config, for example
+//
+//	rate=100,burst=20,rate.ReadPost=10,concurrency=50,shedding=aimd,target=50ms
+//
+// Keys are rate, burst, rate.<method>, concurrency, min_concurrency, max_concurrency,
+// shedding and target.
+func ParseConfig(spec string) (Config, error) {
+	config := Config{MethodRates: make(map[string]float64), Shedding: NoShedding}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, value, found := strings.Cut(entry, "=")
+		if !found {
+			return config, fmt.Errorf("invalid rate limit config %q; expected key=value", entry)
+		}
+		var err error
+		switch {
+		case key == "rate":
+			config.Rate, err = strconv.ParseFloat(value, 64)
+		case strings.HasPrefix(key, "rate."):
+			config.MethodRates[strings.TrimPrefix(key, "rate.")], err = strconv.ParseFloat(value, 64)
+		case key == "burst":
+			config.Burst, err = strconv.Atoi(value)
+		case key == "concurrency":
+			config.Concurrency, err = strconv.Atoi(value)
+		case key == "min_concurrency":
+			config.MinConcurrency, err = strconv.Atoi(value)
+		case key == "max_concurrency":
+			config.MaxConcurrency, err = strconv.Atoi(value)
+		case key == "shedding":
+			switch value {
+			case NoShedding, AIMD, Gradient:
+				config.Shedding = value
+			default:
+				err = fmt.Errorf("unknown shedding strategy %v", value)
+			}
+		case key == "target":
+			config.TargetLatency, err = time.ParseDuration(value)
+		default:
+			err = fmt.Errorf("unknown key %v", key)
+		}
+		if err != nil {
+			return config, fmt.Errorf("invalid rate limit config %q: %w", entry, err)
+		}
+	}
+	return config, nil
+}
+
+// Implements fmt.Stringer; the result can be parsed by [ParseConfig]
+func (config Config) String() string {
+	var entries []string
+	if config.Rate > 0 {
+		entries = append(entries, "rate="+strconv.FormatFloat(config.Rate, 'g', -1, 64))
+	}
+	if config.Burst > 0 {
+		entries = append(entries, fmt.Sprintf("burst=%v", config.Burst))
+	}
+	var methods []string
+	for method := range config.MethodRates {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		entries = append(entries, "rate."+method+"="+strconv.FormatFloat(config.MethodRates[method], 'g', -1, 64))
+	}
+	if config.Concurrency > 0 {
+		entries = append(entries, fmt.Sprintf("concurrency=%v", config.Concurrency))
+	}
+	if config.MinConcurrency > 0 {
+		entries = append(entries, fmt.Sprintf("min_concurrency=%v", config.MinConcurrency))
+	}
+	if config.MaxConcurrency > 0 {
+		entries = append(entries, fmt.Sprintf("max_concurrency=%v", config.MaxConcurrency))
+	}
+	if config.Shedding != "" && config.Shedding != NoShedding {
+		entries = append(entries, "shedding="+config.Shedding)
+	}
+	if config.TargetLatency > 0 {
+		entries = append(entries, "target="+config.TargetLatency.String())
+	}
+	return strings.Join(entries, ",")
+}
+
+// A token bucket that holds up to burst tokens and is refilled at rate tokens per second
+type tokenBucket struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst <= 0 {
+		burst = int(math.Ceil(rate))
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Takes a token from the bucket if one is available
+func (b *tokenBucket) take() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// A concurrency limit that is optionally adapted to observed latencies
+type concurrencyLimit struct {
+	lock     sync.Mutex
+	shedding string
+	limit    float64
+	min, max float64
+	target   time.Duration
+	minRTT   time.Duration
+	inflight int
+}
+
+func newConcurrencyLimit(config Config) *concurrencyLimit {
+	c := &concurrencyLimit{
+		shedding: config.Shedding,
+		limit:    float64(config.Concurrency),
+		min:      float64(config.MinConcurrency),
+		max:      float64(config.MaxConcurrency),
+		target:   config.TargetLatency,
+	}
+	if c.min <= 0 {
+		c.min = 1
+	}
+	if c.max <= 0 {
+		c.max = 10 * c.limit
+	}
+	return c
+}
+
+func (c *concurrencyLimit) acquire() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.inflight >= int(c.limit) {
+		return false
+	}
+	c.inflight++
+	return true
+}
+
+func (c *concurrencyLimit) release(rtt time.Duration, overloaded bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.inflight--
+
+	switch c.shedding {
+	case AIMD:
+		if overloaded || (c.target > 0 && rtt > c.target) {
+			c.limit *= 0.9
+		} else {
+			c.limit += 1 / c.limit
+		}
+	case Gradient:
+		if c.minRTT == 0 || rtt < c.minRTT {
+			c.minRTT = rtt
+		}
+		if rtt <= 0 {
+			return
+		}
+		gradient := math.Max(0.5, math.Min(1, float64(c.minRTT)/float64(rtt)))
+		if overloaded {
+			gradient = 0.5
+		}
+		newLimit := c.limit*gradient + math.Sqrt(c.limit)
+		c.limit = 0.8*c.limit + 0.2*newLimit
+	default:
+		return
+	}
+	c.limit = math.Max(c.min, math.Min(c.max, c.limit))
+}
+
+// The current concurrency limit
+func (c *concurrencyLimit) current() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return int(c.limit)
+}
+
+// A Limiter decides whether to admit calls.  A Limiter is safe for concurrent use.
+type Limiter struct {
+	config      Config
+	lock        sync.Mutex
+	buckets     map[string]*tokenBucket
+	concurrency *concurrencyLimit
+}
+
+// Instantiates a [Limiter] with the provided config
+func NewLimiter(config Config) *Limiter {
+	limiter := &Limiter{
+		config:  config,
+		buckets: make(map[string]*tokenBucket),
+	}
+	if config.Concurrency > 0 {
+		limiter.concurrency = newConcurrencyLimit(config)
+	}
+	return limiter
+}
+
+// Returns the token bucket of method, or nil if the method is not rate limited
+func (limiter *Limiter) bucket(method string) *tokenBucket {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	if b, exists := limiter.buckets[method]; exists {
+		return b
+	}
+	rate, hasRate := limiter.config.MethodRates[method]
+	if !hasRate {
+		rate = limiter.config.Rate
+	}
+	var b *tokenBucket
+	if rate > 0 {
+		b = newTokenBucket(rate, limiter.config.Burst)
+	}
+	limiter.buckets[method] = b
+	return b
+}
+
+// Admits or rejects a call to method.
+//
+// If the call is rejected, the returned error wraps [ErrRejected].  Otherwise, the caller must invoke
+// the returned done func once the call completes, passing the call's error; the latency and outcome of
+// the call are used to adapt the concurrency limit.  Calls that fail with an error wrapping
+// [ErrRejected], e.g. because a downstream service shed load, are treated as a sign of overload.
+func (limiter *Limiter) Admit(method string) (done func(err error), err error) {
+	if b := limiter.bucket(method); b != nil && !b.take() {
+		return nil, ErrRateLimited
+	}
+	if limiter.concurrency == nil {
+		return func(error) {}, nil
+	}
+	if !limiter.concurrency.acquire() {
+		return nil, ErrOverloaded
+	}
+	start := time.Now()
+	return func(err error) {
+		limiter.concurrency.release(time.Since(start), errors.Is(err, ErrRejected))
+	}, nil
+}
+
+// Returns the current concurrency limit, or zero if there is no concurrency limit
+func (limiter *Limiter) ConcurrencyLimit() int {
+	if limiter.concurrency == nil {
+		return 0
+	}
+	return limiter.concurrency.current()
+}
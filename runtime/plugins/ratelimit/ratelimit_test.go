@@ -0,0 +1,137 @@
+package ratelimit_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/plugins/ratelimit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig(t *testing.T) {
+	spec := "rate=100,burst=20,rate.ReadPost=10,concurrency=50,min_concurrency=5,max_concurrency=500,shedding=aimd,target=50ms"
+	config, err := ratelimit.ParseConfig(spec)
+	require.NoError(t, err)
+	require.Equal(t, ratelimit.Config{
+		Rate:           100,
+		Burst:          20,
+		MethodRates:    map[string]float64{"ReadPost": 10},
+		Concurrency:    50,
+		MinConcurrency: 5,
+		MaxConcurrency: 500,
+		Shedding:       ratelimit.AIMD,
+		TargetLatency:  50 * time.Millisecond,
+	}, config)
+	require.Equal(t, spec, config.String())
+
+	for _, invalid := range []string{"rate", "rate=fast", "shedding=random", "color=blue", "target=soon"} {
+		_, err := ratelimit.ParseConfig(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.Config{Rate: 10, Burst: 3})
+
+	for i := 0; i < 3; i++ {
+		done, err := limiter.Admit("Method")
+		require.NoError(t, err)
+		done(nil)
+	}
+	_, err := limiter.Admit("Method")
+	require.ErrorIs(t, err, ratelimit.ErrRateLimited)
+	require.ErrorIs(t, err, ratelimit.ErrRejected)
+
+	// Buckets are per-method
+	_, err = limiter.Admit("OtherMethod")
+	require.NoError(t, err)
+
+	// Refilled at 10 tokens per second
+	time.Sleep(150 * time.Millisecond)
+	_, err = limiter.Admit("Method")
+	require.NoError(t, err)
+}
+
+func TestMethodRates(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.Config{MethodRates: map[string]float64{"Limited": 1}})
+
+	_, err := limiter.Admit("Limited")
+	require.NoError(t, err)
+	_, err = limiter.Admit("Limited")
+	require.ErrorIs(t, err, ratelimit.ErrRateLimited)
+
+	for i := 0; i < 100; i++ {
+		_, err = limiter.Admit("Unlimited")
+		require.NoError(t, err)
+	}
+}
+
+func TestFixedConcurrency(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.Config{Concurrency: 2})
+
+	done1, err := limiter.Admit("Method")
+	require.NoError(t, err)
+	_, err = limiter.Admit("Method")
+	require.NoError(t, err)
+
+	_, err = limiter.Admit("Method")
+	require.ErrorIs(t, err, ratelimit.ErrOverloaded)
+	require.ErrorIs(t, err, ratelimit.ErrRejected)
+
+	done1(nil)
+	_, err = limiter.Admit("Method")
+	require.NoError(t, err)
+	require.Equal(t, 2, limiter.ConcurrencyLimit())
+}
+
+func TestAIMD(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.Config{
+		Concurrency:    10,
+		MaxConcurrency: 20,
+		Shedding:       ratelimit.AIMD,
+		TargetLatency:  time.Second,
+	})
+
+	// Fast calls increase the limit additively
+	for i := 0; i < 100; i++ {
+		done, err := limiter.Admit("Method")
+		require.NoError(t, err)
+		done(nil)
+	}
+	require.Greater(t, limiter.ConcurrencyLimit(), 10)
+	require.LessOrEqual(t, limiter.ConcurrencyLimit(), 20)
+
+	// Overload signals decrease the limit multiplicatively
+	for i := 0; i < 100; i++ {
+		done, err := limiter.Admit("Method")
+		require.NoError(t, err)
+		done(ratelimit.ErrOverloaded)
+	}
+	require.Equal(t, 1, limiter.ConcurrencyLimit())
+}
+
+func TestGradient(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.Config{
+		Concurrency:    10,
+		MinConcurrency: 2,
+		MaxConcurrency: 40,
+		Shedding:       ratelimit.Gradient,
+	})
+
+	// Stable latencies grow the limit
+	for i := 0; i < 50; i++ {
+		done, err := limiter.Admit("Method")
+		require.NoError(t, err)
+		done(nil)
+	}
+	require.Greater(t, limiter.ConcurrencyLimit(), 10)
+
+	// Rejections from downstream shrink it
+	for i := 0; i < 200; i++ {
+		done, err := limiter.Admit("Method")
+		require.NoError(t, err)
+		done(errors.Join(errors.New("downstream"), ratelimit.ErrRejected))
+	}
+	require.Less(t, limiter.ConcurrencyLimit(), 10)
+}
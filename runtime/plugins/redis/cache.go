@@ -4,6 +4,8 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"time"
 
 	redis_impl "github.com/go-redis/redis/v8"
 )
@@ -34,6 +36,51 @@ func (r *RedisCache) Put(ctx context.Context, key string, value interface{}) err
 	return r.client.Set(ctx, key, val_str, 0).Err()
 }
 
+// Implements the backend.Cache interface
+func (r *RedisCache) PutWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("invalid ttl %v for key %v", ttl, key)
+	}
+	val, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, key, string(val), ttl).Err()
+}
+
+// Implements the backend.Cache interface
+func (r *RedisCache) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	if ttl < 0 {
+		return false, fmt.Errorf("invalid ttl %v for key %v", ttl, key)
+	}
+	if ttl == 0 {
+		// PERSIST reports false both for missing keys and for keys without an expiry
+		n, err := r.client.Exists(ctx, key).Result()
+		if err != nil || n == 0 {
+			return false, err
+		}
+		return true, r.client.Persist(ctx, key).Err()
+	}
+	return r.client.PExpire(ctx, key, ttl).Result()
+}
+
+// Implements the backend.Cache interface
+func (r *RedisCache) TTL(ctx context.Context, key string) (time.Duration, bool, error) {
+	ttl, err := r.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, false, err
+	}
+	switch ttl {
+	case -2:
+		// Key doesn't exist
+		return 0, false, nil
+	case -1:
+		// Key exists but has no expiry
+		return 0, true, nil
+	}
+	return ttl, true, nil
+}
+
 // Implements the backend.Cache interface
 func (r *RedisCache) Get(ctx context.Context, key string, value interface{}) (bool, error) {
 	val, err := r.client.Get(ctx, key).Result()
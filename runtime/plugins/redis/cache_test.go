@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend/backendtest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -205,3 +206,9 @@ func TestRedisPerformance(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestConformance(t *testing.T) {
+	cache, err := NewRedisCacheClient(context.Background(), "localhost:6379")
+	assert.NoError(t, err)
+	backendtest.TestCache(t, cache)
+}
@@ -0,0 +1,113 @@
+// Package replicas implements the runtime components of Blueprint's replicas plugin.
+//
+// Balancers do not need to be used directly by application workflow specs.  Instead, this
+// code is included in a compiled application by deploying a service with the replicas plugin.
+//
+// A [Balancer] chooses which replica of a service each call is sent to, using one of the
+// following policies:
+//   - [RoundRobin] sends calls to each replica in turn
+//   - [Random] sends each call to a replica chosen uniformly at random
+//   - [LeastOutstanding] sends each call to the replica with the fewest calls in flight
+//   - [PowerOfTwo] picks two replicas at random and sends the call to the one with fewer calls in flight
+package replicas
+
+import (
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+)
+
+// A load balancing policy
+type Policy int
+
+const (
+	RoundRobin Policy = iota
+	Random
+	LeastOutstanding
+	PowerOfTwo
+)
+
+// Implements fmt.Stringer
+func (p Policy) String() string {
+	switch p {
+	case RoundRobin:
+		return "round_robin"
+	case Random:
+		return "random"
+	case LeastOutstanding:
+		return "least_outstanding"
+	case PowerOfTwo:
+		return "power_of_two"
+	}
+	return "unknown"
+}
+
+// Parses the name of a load balancing policy.  The empty string is [RoundRobin].
+func ParsePolicy(name string) (Policy, error) {
+	switch name {
+	case "", "round_robin":
+		return RoundRobin, nil
+	case "random":
+		return Random, nil
+	case "least_outstanding":
+		return LeastOutstanding, nil
+	case "power_of_two":
+		return PowerOfTwo, nil
+	}
+	return RoundRobin, fmt.Errorf("unknown load balancing policy %v", name)
+}
+
+// A Balancer chooses between a fixed number of replicas.  A Balancer is safe for concurrent use.
+type Balancer struct {
+	policy      Policy
+	next        atomic.Uint64
+	outstanding []atomic.Int64
+}
+
+// Instantiates a [Balancer] across n replicas.
+func NewBalancer(policy Policy, n int) (*Balancer, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("cannot load balance across %v replicas", n)
+	}
+	return &Balancer{policy: policy, outstanding: make([]atomic.Int64, n)}, nil
+}
+
+// Chooses the replica for a call.  The caller must invoke the returned done func once the call completes.
+func (b *Balancer) Pick() (replica int, done func()) {
+	n := len(b.outstanding)
+	switch b.policy {
+	case Random:
+		replica = rand.Intn(n)
+	case LeastOutstanding:
+		// Start the scan at a rotating offset so that ties are spread across replicas
+		start := int(b.next.Add(1) % uint64(n))
+		replica = start
+		for i := 1; i < n; i++ {
+			candidate := (start + i) % n
+			if b.outstanding[candidate].Load() < b.outstanding[replica].Load() {
+				replica = candidate
+			}
+		}
+	case PowerOfTwo:
+		replica = rand.Intn(n)
+		if n > 1 {
+			other := rand.Intn(n - 1)
+			if other >= replica {
+				other++
+			}
+			if b.outstanding[other].Load() < b.outstanding[replica].Load() {
+				replica = other
+			}
+		}
+	default:
+		replica = int((b.next.Add(1) - 1) % uint64(n))
+	}
+
+	b.outstanding[replica].Add(1)
+	return replica, func() { b.outstanding[replica].Add(-1) }
+}
+
+// Returns the number of calls currently in flight to replica
+func (b *Balancer) Outstanding(replica int) int64 {
+	return b.outstanding[replica].Load()
+}
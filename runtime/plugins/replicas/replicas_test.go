@@ -0,0 +1,84 @@
+package replicas_test
+
+import (
+	"testing"
+
+	"github.com/blueprint-uservices/blueprint/runtime/plugins/replicas"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicy(t *testing.T) {
+	for _, policy := range []replicas.Policy{replicas.RoundRobin, replicas.Random, replicas.LeastOutstanding, replicas.PowerOfTwo} {
+		parsed, err := replicas.ParsePolicy(policy.String())
+		require.NoError(t, err)
+		require.Equal(t, policy, parsed)
+	}
+	_, err := replicas.ParsePolicy("sticky")
+	require.Error(t, err)
+}
+
+func TestRoundRobin(t *testing.T) {
+	b, err := replicas.NewBalancer(replicas.RoundRobin, 3)
+	require.NoError(t, err)
+
+	var picked []int
+	for i := 0; i < 6; i++ {
+		replica, done := b.Pick()
+		picked = append(picked, replica)
+		done()
+	}
+	require.Equal(t, []int{0, 1, 2, 0, 1, 2}, picked)
+}
+
+func TestRandom(t *testing.T) {
+	b, err := replicas.NewBalancer(replicas.Random, 4)
+	require.NoError(t, err)
+
+	counts := make([]int, 4)
+	for i := 0; i < 4000; i++ {
+		replica, done := b.Pick()
+		counts[replica]++
+		done()
+	}
+	for _, count := range counts {
+		require.Greater(t, count, 800)
+	}
+}
+
+func TestLeastOutstanding(t *testing.T) {
+	b, err := replicas.NewBalancer(replicas.LeastOutstanding, 3)
+	require.NoError(t, err)
+
+	// Calls that don't complete spread evenly across replicas
+	dones := make(map[int]func())
+	for i := 0; i < 3; i++ {
+		replica, done := b.Pick()
+		dones[replica] = done
+	}
+	for i := 0; i < 3; i++ {
+		require.Equal(t, int64(1), b.Outstanding(i))
+	}
+
+	// The next call goes to the replica that has completed its call
+	dones[1]()
+	replica, _ := b.Pick()
+	require.Equal(t, 1, replica)
+}
+
+func TestPowerOfTwoAvoidsBusyReplica(t *testing.T) {
+	b, err := replicas.NewBalancer(replicas.PowerOfTwo, 2)
+	require.NoError(t, err)
+
+	// With two replicas, both are always compared so the idle replica is always chosen
+	busy, _ := b.Pick()
+	for i := 0; i < 100; i++ {
+		replica, done := b.Pick()
+		require.NotEqual(t, busy, replica)
+		done()
+	}
+}
+
+func TestNoReplicas(t *testing.T) {
+	_, err := replicas.NewBalancer(replicas.RoundRobin, 0)
+	require.Error(t, err)
+}
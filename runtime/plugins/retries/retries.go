@@ -0,0 +1,302 @@
+// Package retries implements the runtime components of Blueprint's retries plugin.
+//
+// Retriers do not need to be used directly by application workflow specs.  Instead, this
+// code is included in a compiled application by applying the retries modifier to the wiring spec.
+//
+// Workflow services can mark an error as non-transient by wrapping it with [Permanent]; the
+// default [IsTransient] predicate will then not retry the call.
+package retries
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The jitter strategy applied to computed backoffs
+type Jitter int
+
+const (
+	// Sleep for exactly the computed exponential backoff
+	NoJitter Jitter = iota
+
+	// Sleep for a uniformly random duration between zero and the computed exponential backoff
+	FullJitter
+
+	// Sleep for a uniformly random duration between the initial backoff and the
+	// previous sleep multiplied by the policy's multiplier
+	DecorrelatedJitter
+)
+
+// Parses the name of a jitter strategy; one of "none", "full" or "decorrelated".
+// The empty string is equivalent to "none".
+func ParseJitter(name string) (Jitter, error) {
+	switch name {
+	case "", "none":
+		return NoJitter, nil
+	case "full":
+		return FullJitter, nil
+	case "decorrelated":
+		return DecorrelatedJitter, nil
+	}
+	return NoJitter, fmt.Errorf("unknown jitter strategy %v", name)
+}
+
+// A predicate that decides whether a call that returned err should be retried.
+// ctx is the context of the caller.
+type Predicate func(ctx context.Context, err error) bool
+
+// Looks up a predicate by name.  Valid names are:
+//   - "transient" (or the empty string) for [IsTransient]
+//   - "any" for [AnyError]
+func ParsePredicate(name string) (Predicate, error) {
+	switch name {
+	case "", "transient":
+		return IsTransient, nil
+	case "any":
+		return AnyError, nil
+	}
+	return nil, fmt.Errorf("unknown retry predicate %v", name)
+}
+
+// A [Predicate] that retries every non-nil error
+func AnyError(ctx context.Context, err error) bool {
+	return err != nil
+}
+
+// A [Predicate] that retries errors that might succeed if the call is re-attempted.
+//
+// A call is not retried if the caller's context is already done, if the error is
+// [context.Canceled], or if the error was marked with [Permanent].
+func IsTransient(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var p *permanentError
+	return !errors.As(err, &p)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Wraps err to indicate that it is not transient and should not be retried by [IsTransient].
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// Configuration of a [Retrier]
+type Policy struct {
+	// The maximum number of times a call will be attempted, including the initial attempt
+	MaxTries int
+
+	// The backoff before the first retry.  If zero, retries are made back-to-back.
+	InitialBackoff time.Duration
+
+	// Factor by which the backoff grows after each retry.  Values less than 1 are treated as 1.
+	Multiplier float64
+
+	// Upper bound on any single backoff.  If zero, backoffs are unbounded.
+	MaxBackoff time.Duration
+
+	// Jitter applied to the computed backoff
+	Jitter Jitter
+
+	// The maximum number of retries, across all calls, that can be made within
+	// a BudgetWindow.  If zero, retries are not budgeted.
+	Budget int
+
+	// The window over which Budget is enforced
+	BudgetWindow time.Duration
+
+	// Decides whether an error should be retried.  If nil, [IsTransient] is used.
+	Retryable Predicate
+}
+
+// Parses a [Policy] from the string form of its settings, as passed to the constructors of generated
+// retriers.  Empty durations are zero; jitter and retryable are parsed with [ParseJitter] and
+// [ParsePredicate].
+func ParsePolicy(maxTries string, initialBackoff string, multiplier string, maxBackoff string, jitter string, budget string, budgetWindow string, retryable string) (Policy, error) {
+	var policy Policy
+	var err error
+	if policy.MaxTries, err = strconv.Atoi(maxTries); err != nil {
+		return policy, fmt.Errorf("invalid maximum number of tries %q", maxTries)
+	}
+	if policy.Multiplier, err = strconv.ParseFloat(multiplier, 64); err != nil {
+		return policy, fmt.Errorf("invalid backoff multiplier %q", multiplier)
+	}
+	if policy.Budget, err = strconv.Atoi(budget); err != nil {
+		return policy, fmt.Errorf("invalid retry budget %q", budget)
+	}
+	durations := []struct {
+		value string
+		dst   *time.Duration
+	}{{initialBackoff, &policy.InitialBackoff}, {maxBackoff, &policy.MaxBackoff}, {budgetWindow, &policy.BudgetWindow}}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		if *d.dst, err = time.ParseDuration(d.value); err != nil {
+			return policy, fmt.Errorf("invalid duration %q", d.value)
+		}
+	}
+	if policy.Jitter, err = ParseJitter(jitter); err != nil {
+		return policy, err
+	}
+	if policy.Retryable, err = ParsePredicate(retryable); err != nil {
+		return policy, err
+	}
+	return policy, nil
+}
+
+// A Retrier computes backoffs and enforces the retry budget for all calls made by a client.
+type Retrier struct {
+	policy Policy
+
+	lock        sync.Mutex
+	rng         *rand.Rand
+	windowStart time.Time
+	windowSpent int
+}
+
+// Instantiates a [Retrier] with the provided policy
+func NewRetrier(policy Policy) *Retrier {
+	if policy.Multiplier < 1 {
+		policy.Multiplier = 1
+	}
+	if policy.Retryable == nil {
+		policy.Retryable = IsTransient
+	}
+	return &Retrier{
+		policy: policy,
+		rng:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Begins a new call.  The returned [Attempt] tracks the retry state of that call
+// and must not be shared between calls.
+func (r *Retrier) Begin() *Attempt {
+	return &Attempt{retrier: r}
+}
+
+// Reserves a retry from the budget; returns false if the budget for the current window is exhausted.
+func (r *Retrier) spend() bool {
+	if r.policy.Budget <= 0 {
+		return true
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	now := time.Now()
+	if now.Sub(r.windowStart) >= r.policy.BudgetWindow {
+		r.windowStart = now
+		r.windowSpent = 0
+	}
+	if r.windowSpent >= r.policy.Budget {
+		return false
+	}
+	r.windowSpent++
+	return true
+}
+
+// Returns a uniformly random duration in [lo, hi)
+func (r *Retrier) between(lo, hi time.Duration) time.Duration {
+	if hi <= lo {
+		return lo
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return lo + time.Duration(r.rng.Int63n(int64(hi-lo)))
+}
+
+// Computes the backoff before the retry following the given number of tries,
+// given the previous backoff.
+func (r *Retrier) backoff(tries int, prev time.Duration) time.Duration {
+	p := r.policy
+	if p.InitialBackoff <= 0 {
+		return 0
+	}
+
+	var d time.Duration
+	switch p.Jitter {
+	case DecorrelatedJitter:
+		if prev < p.InitialBackoff {
+			prev = p.InitialBackoff
+		}
+		d = r.between(p.InitialBackoff, time.Duration(float64(prev)*p.Multiplier)+1)
+	default:
+		exp := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(tries-1))
+		if exp > math.MaxInt64 {
+			exp = math.MaxInt64
+		}
+		d = time.Duration(exp)
+	}
+
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if p.Jitter == FullJitter {
+		d = r.between(0, d)
+	}
+	return d
+}
+
+// The retry state of a single call
+type Attempt struct {
+	retrier *Retrier
+	tries   int
+	prev    time.Duration
+}
+
+// Reports whether the call should be attempted again after it returned err.
+//
+// If the call should be retried, Retry first sleeps for the backoff prescribed by the
+// policy.  Retry returns false without retrying if err is nil, if the policy's
+// predicate deems err non-retryable, if the maximum number of tries has been reached,
+// if the retry budget is exhausted, or if ctx is done before the backoff elapses.
+func (a *Attempt) Retry(ctx context.Context, err error) bool {
+	a.tries++
+	p := a.retrier.policy
+	if err == nil || a.tries >= p.MaxTries || !p.Retryable(ctx, err) {
+		return false
+	}
+	if !a.retrier.spend() {
+		return false
+	}
+
+	a.prev = a.retrier.backoff(a.tries, a.prev)
+	if a.prev <= 0 {
+		return true
+	}
+	timer := time.NewTimer(a.prev)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// Returns the number of times the call has been attempted so far
+func (a *Attempt) Tries() int {
+	return a.tries
+}
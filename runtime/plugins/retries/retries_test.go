@@ -0,0 +1,225 @@
+package retries_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/plugins/retries"
+	"github.com/stretchr/testify/require"
+)
+
+var errTransient = errors.New("transient failure")
+
+// Calls fn until the attempt says to stop, returning the number of calls made
+func run(ctx context.Context, r *retries.Retrier, fn func() error) (int, error) {
+	attempt := r.Begin()
+	calls := 0
+	for {
+		calls++
+		err := fn()
+		if !attempt.Retry(ctx, err) {
+			return calls, err
+		}
+	}
+}
+
+func TestMaxTries(t *testing.T) {
+	r := retries.NewRetrier(retries.Policy{MaxTries: 5})
+
+	calls, err := run(context.Background(), r, func() error { return errTransient })
+	require.Equal(t, 5, calls)
+	require.ErrorIs(t, err, errTransient)
+
+	calls, err = run(context.Background(), r, func() error { return nil })
+	require.Equal(t, 1, calls)
+	require.NoError(t, err)
+}
+
+func TestSucceedsAfterFailures(t *testing.T) {
+	r := retries.NewRetrier(retries.Policy{MaxTries: 10})
+
+	remaining := 3
+	calls, err := run(context.Background(), r, func() error {
+		if remaining > 0 {
+			remaining--
+			return errTransient
+		}
+		return nil
+	})
+	require.Equal(t, 4, calls)
+	require.NoError(t, err)
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	r := retries.NewRetrier(retries.Policy{
+		MaxTries:       4,
+		InitialBackoff: 10 * time.Millisecond,
+		Multiplier:     2,
+	})
+
+	// Backoffs of 10ms, 20ms and 40ms
+	start := time.Now()
+	calls, _ := run(context.Background(), r, func() error { return errTransient })
+	require.Equal(t, 4, calls)
+	require.GreaterOrEqual(t, time.Since(start), 70*time.Millisecond)
+}
+
+func TestMaxBackoff(t *testing.T) {
+	r := retries.NewRetrier(retries.Policy{
+		MaxTries:       4,
+		InitialBackoff: 10 * time.Millisecond,
+		Multiplier:     100,
+		MaxBackoff:     15 * time.Millisecond,
+	})
+
+	// Backoffs of 10ms, 15ms and 15ms
+	start := time.Now()
+	run(context.Background(), r, func() error { return errTransient })
+	elapsed := time.Since(start)
+	require.GreaterOrEqual(t, elapsed, 40*time.Millisecond)
+	require.Less(t, elapsed, 500*time.Millisecond)
+}
+
+func TestJitterBounds(t *testing.T) {
+	for _, jitter := range []retries.Jitter{retries.FullJitter, retries.DecorrelatedJitter} {
+		r := retries.NewRetrier(retries.Policy{
+			MaxTries:       6,
+			InitialBackoff: time.Millisecond,
+			Multiplier:     3,
+			MaxBackoff:     5 * time.Millisecond,
+			Jitter:         jitter,
+		})
+
+		start := time.Now()
+		calls, _ := run(context.Background(), r, func() error { return errTransient })
+		require.Equal(t, 6, calls)
+		require.Less(t, time.Since(start), 200*time.Millisecond, "jitter %v", jitter)
+	}
+}
+
+func TestParseJitter(t *testing.T) {
+	for name, expect := range map[string]retries.Jitter{
+		"":             retries.NoJitter,
+		"none":         retries.NoJitter,
+		"full":         retries.FullJitter,
+		"decorrelated": retries.DecorrelatedJitter,
+	} {
+		jitter, err := retries.ParseJitter(name)
+		require.NoError(t, err)
+		require.Equal(t, expect, jitter)
+	}
+
+	_, err := retries.ParseJitter("sideways")
+	require.Error(t, err)
+}
+
+func TestBudget(t *testing.T) {
+	r := retries.NewRetrier(retries.Policy{
+		MaxTries:     10,
+		Budget:       3,
+		BudgetWindow: time.Hour,
+	})
+
+	// The first call consumes the entire budget
+	calls, _ := run(context.Background(), r, func() error { return errTransient })
+	require.Equal(t, 4, calls)
+
+	// Subsequent calls within the window are not retried
+	calls, _ = run(context.Background(), r, func() error { return errTransient })
+	require.Equal(t, 1, calls)
+}
+
+func TestBudgetWindowResets(t *testing.T) {
+	r := retries.NewRetrier(retries.Policy{
+		MaxTries:     10,
+		Budget:       1,
+		BudgetWindow: 20 * time.Millisecond,
+	})
+
+	calls, _ := run(context.Background(), r, func() error { return errTransient })
+	require.Equal(t, 2, calls)
+
+	time.Sleep(30 * time.Millisecond)
+
+	calls, _ = run(context.Background(), r, func() error { return errTransient })
+	require.Equal(t, 2, calls)
+}
+
+func TestPermanentErrorsNotRetried(t *testing.T) {
+	r := retries.NewRetrier(retries.Policy{MaxTries: 10})
+
+	errNotFound := errors.New("not found")
+	calls, err := run(context.Background(), r, func() error { return fmt.Errorf("lookup: %w", retries.Permanent(errNotFound)) })
+	require.Equal(t, 1, calls)
+	require.ErrorIs(t, err, errNotFound)
+}
+
+func TestCancelledContextNotRetried(t *testing.T) {
+	r := retries.NewRetrier(retries.Policy{MaxTries: 10})
+
+	calls, _ := run(context.Background(), r, func() error { return context.Canceled })
+	require.Equal(t, 1, calls)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls, _ = run(ctx, r, func() error { return errTransient })
+	require.Equal(t, 1, calls)
+}
+
+func TestCancelledDuringBackoff(t *testing.T) {
+	r := retries.NewRetrier(retries.Policy{MaxTries: 10, InitialBackoff: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	calls, err := run(ctx, r, func() error { return errTransient })
+	require.Equal(t, 1, calls)
+	require.ErrorIs(t, err, errTransient)
+}
+
+func TestAnyErrorPredicate(t *testing.T) {
+	pred, err := retries.ParsePredicate("any")
+	require.NoError(t, err)
+	r := retries.NewRetrier(retries.Policy{MaxTries: 3, Retryable: pred})
+
+	calls, _ := run(context.Background(), r, func() error { return retries.Permanent(errTransient) })
+	require.Equal(t, 3, calls)
+
+	_, err = retries.ParsePredicate("sometimes")
+	require.Error(t, err)
+}
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := retries.ParsePolicy("5", "10ms", "2", "1s", "full", "100", "1s", "any")
+	require.NoError(t, err)
+	require.Equal(t, 5, policy.MaxTries)
+	require.Equal(t, 10*time.Millisecond, policy.InitialBackoff)
+	require.Equal(t, 2.0, policy.Multiplier)
+	require.Equal(t, time.Second, policy.MaxBackoff)
+	require.Equal(t, retries.FullJitter, policy.Jitter)
+	require.Equal(t, 100, policy.Budget)
+	require.Equal(t, time.Second, policy.BudgetWindow)
+	require.NotNil(t, policy.Retryable)
+
+	// Empty durations are zero
+	policy, err = retries.ParsePolicy("3", "", "0", "", "", "0", "", "")
+	require.NoError(t, err)
+	require.Equal(t, 3, policy.MaxTries)
+	require.Zero(t, policy.InitialBackoff)
+	require.Zero(t, policy.MaxBackoff)
+	require.Zero(t, policy.BudgetWindow)
+
+	for _, args := range [][]string{
+		{"three", "", "0", "", "", "0", "", ""},
+		{"3", "soon", "0", "", "", "0", "", ""},
+		{"3", "", "double", "", "", "0", "", ""},
+		{"3", "", "0", "", "sideways", "0", "", ""},
+		{"3", "", "0", "", "", "0", "", "sometimes"},
+	} {
+		_, err := retries.ParsePolicy(args[0], args[1], args[2], args[3], args[4], args[5], args[6], args[7])
+		require.Error(t, err, "%v", args)
+	}
+}
@@ -0,0 +1,170 @@
+package simplecache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"golang.org/x/exp/slog"
+)
+
+// A map-based cache that holds at most a fixed number of keys and implements the [backend.Cache]
+// interface.  When the cache is full, inserting a new key evicts an existing key chosen by the
+// cache's eviction [Policy].
+//
+// Hits, misses and evictions are emitted as OpenTelemetry metrics using a meter obtained from
+// [backend.Meter]:
+//   - simplecache.hits counts Gets of keys that exist
+//   - simplecache.misses counts Gets of keys that do not exist
+//   - simplecache.evictions counts keys evicted to make space for new keys
+//
+// Each metric has a cache attribute with the name of the cache.  The same counts are returned by
+// [BoundedCache.Stats].
+type BoundedCache struct {
+	backend.Cache
+	cache *SimpleCache
+}
+
+// Cumulative counts of cache operations
+type Stats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+}
+
+// Instantiates a [BoundedCache] named name that holds at most capacity keys and evicts keys
+// using the named policy (see [ParsePolicy]).
+//
+// If no metric collector is available, the cache is created without metrics.
+func NewBoundedCache(ctx context.Context, name string, capacity string, policy string) (*BoundedCache, error) {
+	n, err := strconv.Atoi(capacity)
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("invalid capacity %q for cache %v; expected a positive integer", capacity, name)
+	}
+	p, err := ParsePolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := newMetrics(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := &SimpleCache{
+		values:    make(map[string]*entry),
+		lastSweep: time.Now(),
+		capacity:  n,
+		evictor:   newEvictor(p),
+		stats:     stats,
+	}
+	return &BoundedCache{cache: cache}, nil
+}
+
+// Returns the number of keys in the cache, including expired keys that have not yet been removed
+func (c *BoundedCache) Len() int {
+	c.cache.RLock()
+	defer c.cache.RUnlock()
+	return len(c.cache.values)
+}
+
+// Returns the cumulative hits, misses and evictions of the cache
+func (c *BoundedCache) Stats() Stats {
+	return Stats{
+		Hits:      c.cache.stats.hits.Load(),
+		Misses:    c.cache.stats.misses.Load(),
+		Evictions: c.cache.stats.evictions.Load(),
+	}
+}
+
+func (c *BoundedCache) Put(ctx context.Context, key string, value interface{}) error {
+	return c.cache.Put(ctx, key, value)
+}
+
+func (c *BoundedCache) PutWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return c.cache.PutWithTTL(ctx, key, value, ttl)
+}
+
+func (c *BoundedCache) Get(ctx context.Context, key string, val interface{}) (bool, error) {
+	return c.cache.Get(ctx, key, val)
+}
+
+func (c *BoundedCache) Mset(ctx context.Context, keys []string, values []interface{}) error {
+	return c.cache.Mset(ctx, keys, values)
+}
+
+func (c *BoundedCache) Mget(ctx context.Context, keys []string, values []interface{}) error {
+	return c.cache.Mget(ctx, keys, values)
+}
+
+func (c *BoundedCache) Delete(ctx context.Context, key string) error {
+	return c.cache.Delete(ctx, key)
+}
+
+func (c *BoundedCache) Incr(ctx context.Context, key string) (int64, error) {
+	return c.cache.Incr(ctx, key)
+}
+
+func (c *BoundedCache) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return c.cache.Expire(ctx, key, ttl)
+}
+
+func (c *BoundedCache) TTL(ctx context.Context, key string) (time.Duration, bool, error) {
+	return c.cache.TTL(ctx, key)
+}
+
+// Counts the hits, misses and evictions of a cache.  A nil *metrics records nothing.
+type metrics struct {
+	hits, misses, evictions         atomic.Int64
+	hitCount, missCount, evictCount metric.Int64Counter
+	attrs                           metric.MeasurementOption
+}
+
+func newMetrics(ctx context.Context, name string) (*metrics, error) {
+	meter, err := backend.Meter(ctx, name)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Cache %v will not emit metrics: %v", name, err))
+		meter = noop.NewMeterProvider().Meter(name)
+	}
+
+	m := &metrics{attrs: metric.WithAttributes(attribute.String("cache", name))}
+	if m.hitCount, err = meter.Int64Counter("simplecache.hits",
+		metric.WithDescription("Number of cache gets of keys that exist")); err != nil {
+		return nil, err
+	}
+	if m.missCount, err = meter.Int64Counter("simplecache.misses",
+		metric.WithDescription("Number of cache gets of keys that do not exist")); err != nil {
+		return nil, err
+	}
+	if m.evictCount, err = meter.Int64Counter("simplecache.evictions",
+		metric.WithDescription("Number of keys evicted to make space for new keys")); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *metrics) hit(ctx context.Context) {
+	if m != nil {
+		m.hits.Add(1)
+		m.hitCount.Add(ctx, 1, m.attrs)
+	}
+}
+
+func (m *metrics) miss(ctx context.Context) {
+	if m != nil {
+		m.misses.Add(1)
+		m.missCount.Add(ctx, 1, m.attrs)
+	}
+}
+
+func (m *metrics) evict(ctx context.Context) {
+	if m != nil {
+		m.evictions.Add(1)
+		m.evictCount.Add(ctx, 1, m.attrs)
+	}
+}
@@ -0,0 +1,149 @@
+package simplecache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend/backendtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newBounded(t *testing.T, capacity string, policy string) *BoundedCache {
+	cache, err := NewBoundedCache(context.Background(), "test_cache", capacity, policy)
+	assert.NoError(t, err)
+	return cache
+}
+
+func exists(t *testing.T, cache *BoundedCache, key string) bool {
+	var v any
+	exists, err := cache.cache.Get(context.Background(), key, &v)
+	assert.NoError(t, err)
+	return exists
+}
+
+func TestBoundedConformance(t *testing.T) {
+	backendtest.TestCache(t, newBounded(t, "1000", "lru"))
+}
+
+func TestInvalidConfig(t *testing.T) {
+	ctx := context.Background()
+	_, err := NewBoundedCache(ctx, "c", "0", "lru")
+	assert.Error(t, err)
+	_, err = NewBoundedCache(ctx, "c", "ten", "lru")
+	assert.Error(t, err)
+	_, err = NewBoundedCache(ctx, "c", "10", "mru")
+	assert.Error(t, err)
+}
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	cache := newBounded(t, "2", "lru")
+	assert.NoError(t, cache.Put(ctx, "a", 1))
+	assert.NoError(t, cache.Put(ctx, "b", 2))
+
+	// Reading a makes b the least recently used
+	var v int
+	_, err := cache.Get(ctx, "a", &v)
+	assert.NoError(t, err)
+	assert.NoError(t, cache.Put(ctx, "c", 3))
+
+	assert.Equal(t, 2, cache.Len())
+	assert.True(t, exists(t, cache, "a"))
+	assert.False(t, exists(t, cache, "b"))
+	assert.True(t, exists(t, cache, "c"))
+}
+
+func TestLFU(t *testing.T) {
+	ctx := context.Background()
+	cache := newBounded(t, "2", "lfu")
+	assert.NoError(t, cache.Put(ctx, "a", 1))
+	assert.NoError(t, cache.Put(ctx, "b", 2))
+
+	var v int
+	for i := 0; i < 3; i++ {
+		_, err := cache.Get(ctx, "b", &v)
+		assert.NoError(t, err)
+	}
+	_, err := cache.Get(ctx, "a", &v)
+	assert.NoError(t, err)
+
+	// a was used less often than b, despite being used more recently
+	assert.NoError(t, cache.Put(ctx, "c", 3))
+	assert.False(t, exists(t, cache, "a"))
+	assert.True(t, exists(t, cache, "b"))
+	assert.True(t, exists(t, cache, "c"))
+}
+
+func TestFIFO(t *testing.T) {
+	ctx := context.Background()
+	cache := newBounded(t, "2", "fifo")
+	assert.NoError(t, cache.Put(ctx, "a", 1))
+	assert.NoError(t, cache.Put(ctx, "b", 2))
+
+	// Reads and updates do not change the insertion order
+	var v int
+	_, err := cache.Get(ctx, "a", &v)
+	assert.NoError(t, err)
+	assert.NoError(t, cache.Put(ctx, "a", 10))
+	assert.NoError(t, cache.Put(ctx, "c", 3))
+
+	assert.False(t, exists(t, cache, "a"))
+	assert.True(t, exists(t, cache, "b"))
+	assert.True(t, exists(t, cache, "c"))
+}
+
+func TestRandom(t *testing.T) {
+	ctx := context.Background()
+	cache := newBounded(t, "10", "random")
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, cache.Put(ctx, string(rune('a'+i%26))+string(rune('a'+i/26)), i))
+		assert.LessOrEqual(t, cache.Len(), 10)
+	}
+	assert.Equal(t, 10, cache.Len())
+	assert.Equal(t, int64(90), cache.Stats().Evictions)
+
+	// Deleted keys are removed from the eviction candidates
+	for key := range cache.cache.values {
+		assert.NoError(t, cache.Delete(ctx, key))
+	}
+	assert.Equal(t, 0, cache.Len())
+	assert.NoError(t, cache.Put(ctx, "z", 1))
+	assert.True(t, exists(t, cache, "z"))
+}
+
+func TestExpiredBeforeEviction(t *testing.T) {
+	ctx := context.Background()
+	cache := newBounded(t, "2", "lru")
+	assert.NoError(t, cache.Put(ctx, "a", 1))
+	assert.NoError(t, cache.PutWithTTL(ctx, "b", 2, 10*time.Millisecond))
+	time.Sleep(20 * time.Millisecond)
+
+	// a is the least recently used, but b has expired, so b is removed instead of evicting a
+	assert.NoError(t, cache.Put(ctx, "c", 3))
+	assert.True(t, exists(t, cache, "a"))
+	assert.False(t, exists(t, cache, "b"))
+	assert.True(t, exists(t, cache, "c"))
+	assert.Equal(t, 2, cache.Len())
+	assert.Equal(t, int64(0), cache.Stats().Evictions)
+}
+
+func TestStats(t *testing.T) {
+	ctx := context.Background()
+	cache := newBounded(t, "1", "lru")
+	assert.NoError(t, cache.Put(ctx, "a", 1))
+
+	var v int
+	_, err := cache.Get(ctx, "a", &v)
+	assert.NoError(t, err)
+	_, err = cache.Get(ctx, "b", &v)
+	assert.NoError(t, err)
+	assert.NoError(t, cache.Mget(ctx, []string{"a", "b"}, []any{&v, &v}))
+
+	// Incrementing a new key inserts it, evicting a
+	n, err := cache.Incr(ctx, "counter")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	assert.Equal(t, Stats{Hits: 2, Misses: 2, Evictions: 1}, cache.Stats())
+}
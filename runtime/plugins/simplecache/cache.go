@@ -1,40 +1,101 @@
 // Package simplecache implements a key-value [backend.Cache] using a golang map.
+//
+// Keys with a TTL are expired lazily: an expired key is never returned, and expired keys are
+// removed from the map by a periodic sweep that piggybacks on writes.
+//
+// [SimpleCache] is unbounded.  [BoundedCache] holds a limited number of keys, evicting keys
+// according to an eviction [Policy] when it is full.
 package simplecache
 
 import (
+	"container/list"
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
 )
 
+// The minimum interval between sweeps of expired keys
+const sweepInterval = time.Second
+
 // A simple map-based cache that implements the [backend.Cache] interface
 type SimpleCache struct {
 	backend.Cache
 	sync.RWMutex
-	values map[string]any
+	values     map[string]*entry
+	lastSweep  time.Time
+	nextExpiry time.Time // No entry expires before this time; the zero time if no entry expires
+
+	capacity int      // The maximum number of keys, or 0 if unbounded
+	evictor  evictor  // Chooses keys to evict; nil if unbounded
+	stats    *metrics // Records hits, misses and evictions; nil if unbounded
+}
+
+type entry struct {
+	key     string
+	value   any
+	expires time.Time // The zero time if the entry does not expire
+
+	// Used by evictors
+	elem    *list.Element
+	uses    int64
+	lastUse uint64
+	index   int
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
 }
 
 // Instantiates a map-based [SimpleCache]
 func NewSimpleCache(ctx context.Context) (*SimpleCache, error) {
 	cache := &SimpleCache{}
-	cache.values = make(map[string]any)
+	cache.values = make(map[string]*entry)
+	cache.lastSweep = time.Now()
 	return cache, nil
 }
 
 func (cache *SimpleCache) Put(ctx context.Context, key string, value interface{}) error {
+	return cache.PutWithTTL(ctx, key, value, 0)
+}
+
+func (cache *SimpleCache) PutWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("invalid ttl %v for key %v", ttl, key)
+	}
 	cache.Lock()
 	defer cache.Unlock()
-	cache.values[key] = value
+	now := time.Now()
+	cache.sweep(now)
+	var expires time.Time
+	if ttl > 0 {
+		expires = now.Add(ttl)
+	}
+	cache.insert(ctx, key, value, expires, now)
 	return nil
 }
 
 func (cache *SimpleCache) Get(ctx context.Context, key string, val interface{}) (bool, error) {
-	if v, exists := cache.values[key]; exists {
-		return true, backend.CopyResult(v, val)
+	if cache.evictor != nil {
+		// Reads update the eviction order
+		cache.Lock()
+		defer cache.Unlock()
+	} else {
+		cache.RLock()
+		defer cache.RUnlock()
 	}
-	return false, nil
+	e := cache.lookup(key, time.Now())
+	if e == nil {
+		cache.stats.miss(ctx)
+		return false, nil
+	}
+	cache.stats.hit(ctx)
+	if cache.evictor != nil {
+		cache.evictor.touch(e)
+	}
+	return true, backend.CopyResult(e.value, val)
 }
 
 func (cache *SimpleCache) Mset(ctx context.Context, keys []string, values []interface{}) error {
@@ -68,16 +129,139 @@ func (cache *SimpleCache) Mget(ctx context.Context, keys []string, values []inte
 func (cache *SimpleCache) Delete(ctx context.Context, key string) error {
 	cache.Lock()
 	defer cache.Unlock()
-	delete(cache.values, key)
+	if e, exists := cache.values[key]; exists {
+		cache.remove(e)
+	}
 	return nil
 }
 
 func (cache *SimpleCache) Incr(ctx context.Context, key string) (int64, error) {
+	cache.Lock()
+	defer cache.Unlock()
+	now := time.Now()
 	cur := int64(0)
-	_, err := cache.Get(ctx, key, &cur)
-	if err != nil {
+	e := cache.lookup(key, now)
+	if e == nil {
+		cache.sweep(now)
+		cache.insert(ctx, key, int64(1), time.Time{}, now)
+		return 1, nil
+	}
+	if err := backend.CopyResult(e.value, &cur); err != nil {
 		return cur, err
 	}
 	cur += 1
-	return cur, cache.Put(ctx, key, cur)
+	e.value = cur
+	if cache.evictor != nil {
+		cache.evictor.touch(e)
+	}
+	return cur, nil
+}
+
+func (cache *SimpleCache) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	if ttl < 0 {
+		return false, fmt.Errorf("invalid ttl %v for key %v", ttl, key)
+	}
+	cache.Lock()
+	defer cache.Unlock()
+	now := time.Now()
+	e := cache.lookup(key, now)
+	if e == nil {
+		return false, nil
+	}
+	if ttl > 0 {
+		e.expires = now.Add(ttl)
+		cache.expiresAt(e.expires)
+	} else {
+		e.expires = time.Time{}
+	}
+	return true, nil
+}
+
+func (cache *SimpleCache) TTL(ctx context.Context, key string) (time.Duration, bool, error) {
+	cache.RLock()
+	defer cache.RUnlock()
+	now := time.Now()
+	e := cache.lookup(key, now)
+	if e == nil {
+		return 0, false, nil
+	}
+	if e.expires.IsZero() {
+		return 0, true, nil
+	}
+	return e.expires.Sub(now), true, nil
+}
+
+// Returns the entry for key, or nil if it does not exist or has expired.  Requires a read lock.
+func (cache *SimpleCache) lookup(key string, now time.Time) *entry {
+	e, exists := cache.values[key]
+	if !exists || e.expired(now) {
+		return nil
+	}
+	return e
+}
+
+// Stores value for key, replacing any existing entry.  If the cache is full, removes expired entries,
+// then evicts an entry if it is still full.  Requires a write lock.
+func (cache *SimpleCache) insert(ctx context.Context, key string, value any, expires time.Time, now time.Time) {
+	cache.expiresAt(expires)
+	if e, exists := cache.values[key]; exists {
+		e.value = value
+		e.expires = expires
+		if cache.evictor != nil {
+			cache.evictor.touch(e)
+		}
+		return
+	}
+
+	if cache.capacity > 0 && len(cache.values) >= cache.capacity && !cache.nextExpiry.IsZero() && !now.Before(cache.nextExpiry) {
+		cache.removeExpired(now)
+	}
+	if cache.capacity > 0 && len(cache.values) >= cache.capacity {
+		if victim := cache.evictor.victim(); victim != nil {
+			cache.remove(victim)
+			cache.stats.evict(ctx)
+		}
+	}
+	e := &entry{key: key, value: value, expires: expires}
+	cache.values[key] = e
+	if cache.evictor != nil {
+		cache.evictor.add(e)
+	}
+}
+
+// Removes an entry.  Requires a write lock.
+func (cache *SimpleCache) remove(e *entry) {
+	delete(cache.values, e.key)
+	if cache.evictor != nil {
+		cache.evictor.remove(e)
+	}
+}
+
+// Removes expired entries, at most once per sweepInterval.  Requires a write lock.
+func (cache *SimpleCache) sweep(now time.Time) {
+	if now.Sub(cache.lastSweep) < sweepInterval {
+		return
+	}
+	cache.removeExpired(now)
+}
+
+// Removes expired entries.  Requires a write lock.
+func (cache *SimpleCache) removeExpired(now time.Time) {
+	cache.lastSweep = now
+	cache.nextExpiry = time.Time{}
+	for _, e := range cache.values {
+		if e.expired(now) {
+			cache.remove(e)
+		} else {
+			cache.expiresAt(e.expires)
+		}
+	}
+}
+
+// Records that an entry expires at expires, which is the zero time if it does not expire.  Requires a
+// write lock.
+func (cache *SimpleCache) expiresAt(expires time.Time) {
+	if !expires.IsZero() && (cache.nextExpiry.IsZero() || expires.Before(cache.nextExpiry)) {
+		cache.nextExpiry = expires
+	}
 }
@@ -3,7 +3,9 @@ package simplecache
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend/backendtest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -73,3 +75,25 @@ func TestMget(t *testing.T) {
 	err = cache.Mget(ctx, []string{}, getvalues)
 	assert.Error(t, err)
 }
+
+func TestConformance(t *testing.T) {
+	cache, err := NewSimpleCache(context.Background())
+	assert.NoError(t, err)
+	backendtest.TestCache(t, cache)
+}
+
+func TestSweep(t *testing.T) {
+	ctx := context.Background()
+	cache, _ := NewSimpleCache(ctx)
+
+	assert.NoError(t, cache.PutWithTTL(ctx, "a", "v", time.Millisecond))
+	assert.NoError(t, cache.Put(ctx, "b", "v"))
+	time.Sleep(5 * time.Millisecond)
+
+	// Expired keys are removed by the next write after the sweep interval
+	cache.lastSweep = time.Now().Add(-sweepInterval)
+	assert.NoError(t, cache.Put(ctx, "c", "v"))
+	assert.Len(t, cache.values, 2)
+	_, exists := cache.values["a"]
+	assert.False(t, exists)
+}
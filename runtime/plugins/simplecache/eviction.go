@@ -0,0 +1,165 @@
+package simplecache
+
+import (
+	"container/heap"
+	"container/list"
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// The policy used by a [BoundedCache] to choose which key to evict when it is full
+type Policy int
+
+const (
+	LRU    Policy = iota // Evicts the least recently used key
+	LFU                  // Evicts the least frequently used key, breaking ties by least recent use
+	FIFO                 // Evicts the key that was inserted first
+	Random               // Evicts a random key
+)
+
+// Parses the name of a policy, i.e. one of "lru", "lfu", "fifo" or "random".  The empty string is LRU.
+func ParsePolicy(s string) (Policy, error) {
+	switch strings.ToLower(s) {
+	case "", "lru":
+		return LRU, nil
+	case "lfu":
+		return LFU, nil
+	case "fifo":
+		return FIFO, nil
+	case "random":
+		return Random, nil
+	}
+	return LRU, fmt.Errorf("unknown eviction policy %q; expected lru, lfu, fifo or random", s)
+}
+
+// Tracks the entries of a bounded cache and chooses which to evict.  Not safe for concurrent use.
+type evictor interface {
+	add(e *entry)    // A new entry was inserted
+	touch(e *entry)  // An existing entry was read or written
+	remove(e *entry) // An entry was deleted, expired or evicted
+	victim() *entry  // Returns the entry to evict next
+}
+
+func newEvictor(policy Policy) evictor {
+	switch policy {
+	case LFU:
+		return &lfuEvictor{}
+	case FIFO:
+		return &listEvictor{order: list.New(), moveOnTouch: false}
+	case Random:
+		return &randomEvictor{}
+	default:
+		return &listEvictor{order: list.New(), moveOnTouch: true}
+	}
+}
+
+// Orders entries by insertion (FIFO) or by most recent use (LRU)
+type listEvictor struct {
+	order       *list.List
+	moveOnTouch bool
+}
+
+func (ev *listEvictor) add(e *entry) {
+	e.elem = ev.order.PushFront(e)
+}
+
+func (ev *listEvictor) touch(e *entry) {
+	if ev.moveOnTouch {
+		ev.order.MoveToFront(e.elem)
+	}
+}
+
+func (ev *listEvictor) remove(e *entry) {
+	ev.order.Remove(e.elem)
+	e.elem = nil
+}
+
+func (ev *listEvictor) victim() *entry {
+	if back := ev.order.Back(); back != nil {
+		return back.Value.(*entry)
+	}
+	return nil
+}
+
+// A min-heap of entries ordered by use count, then by last use
+type lfuEvictor struct {
+	entries []*entry
+	clock   uint64
+}
+
+func (ev *lfuEvictor) Len() int { return len(ev.entries) }
+func (ev *lfuEvictor) Less(i, j int) bool {
+	a, b := ev.entries[i], ev.entries[j]
+	if a.uses != b.uses {
+		return a.uses < b.uses
+	}
+	return a.lastUse < b.lastUse
+}
+func (ev *lfuEvictor) Swap(i, j int) {
+	ev.entries[i], ev.entries[j] = ev.entries[j], ev.entries[i]
+	ev.entries[i].index = i
+	ev.entries[j].index = j
+}
+func (ev *lfuEvictor) Push(x any) {
+	e := x.(*entry)
+	e.index = len(ev.entries)
+	ev.entries = append(ev.entries, e)
+}
+func (ev *lfuEvictor) Pop() any {
+	e := ev.entries[len(ev.entries)-1]
+	ev.entries = ev.entries[:len(ev.entries)-1]
+	e.index = -1
+	return e
+}
+
+func (ev *lfuEvictor) add(e *entry) {
+	ev.clock++
+	e.uses, e.lastUse = 1, ev.clock
+	heap.Push(ev, e)
+}
+
+func (ev *lfuEvictor) touch(e *entry) {
+	ev.clock++
+	e.uses++
+	e.lastUse = ev.clock
+	heap.Fix(ev, e.index)
+}
+
+func (ev *lfuEvictor) remove(e *entry) {
+	heap.Remove(ev, e.index)
+}
+
+func (ev *lfuEvictor) victim() *entry {
+	if len(ev.entries) == 0 {
+		return nil
+	}
+	return ev.entries[0]
+}
+
+// Chooses entries to evict uniformly at random
+type randomEvictor struct {
+	entries []*entry
+}
+
+func (ev *randomEvictor) add(e *entry) {
+	e.index = len(ev.entries)
+	ev.entries = append(ev.entries, e)
+}
+
+func (ev *randomEvictor) touch(e *entry) {}
+
+func (ev *randomEvictor) remove(e *entry) {
+	last := ev.entries[len(ev.entries)-1]
+	ev.entries[e.index] = last
+	last.index = e.index
+	ev.entries = ev.entries[:len(ev.entries)-1]
+	e.index = -1
+}
+
+func (ev *randomEvictor) victim() *entry {
+	if len(ev.entries) == 0 {
+		return nil
+	}
+	return ev.entries[rand.Intn(len(ev.entries))]
+}
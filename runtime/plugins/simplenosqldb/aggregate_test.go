@@ -0,0 +1,206 @@
+package simplenosqldb_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type ratingsByVendor struct {
+	Vendor  string `bson:"_id"`
+	Count   int
+	Total   int
+	Average float64
+	Lowest  int
+	Highest int
+	Types   []string
+}
+
+func TestAggregateMatchProject(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	pipeline := []bson.D{
+		{{"$match", bson.D{{"rating", bson.D{{"$gte", 7}}}}}},
+		{{"$project", bson.D{{"_id", 0}, {"type", 1}, {"kind", "$packaging.kind"}}}},
+		{{"$sort", bson.D{{"type", 1}}}},
+	}
+	cursor, err := db.Aggregate(ctx, pipeline)
+	require.NoError(t, err)
+
+	var results []bson.D
+	require.NoError(t, cursor.All(ctx, &results))
+	require.Equal(t, []bson.D{
+		{{"type", "Earl Grey"}, {"kind", ""}},
+		{{"type", "Masala"}, {"kind", "Paper"}},
+		{{"type", "Oolong"}, {"kind", ""}},
+	}, results)
+}
+
+func TestAggregateProjectExclude(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	pipeline := []bson.D{
+		{{"$match", bson.D{{"type", "Assam"}}}},
+		{{"$project", bson.D{{"_id", 0}, {"sizes", 0}, {"packaging.width", 0}}}},
+	}
+	cursor, err := db.Aggregate(ctx, pipeline)
+	require.NoError(t, err)
+
+	var results []bson.D
+	require.NoError(t, cursor.All(ctx, &results))
+	require.Equal(t, []bson.D{
+		{{"type", "Assam"}, {"rating", int32(5)}, {"packaging", bson.D{{"length", int64(8)}, {"kind", "Cardboard"}}}},
+	}, results)
+
+	_, err = db.Aggregate(ctx, []bson.D{{{"$project", bson.D{{"type", 1}, {"sizes", 0}}}}})
+	require.Error(t, err)
+}
+
+func TestAggregateGroup(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	pipeline := []bson.D{
+		{{"$unwind", "$vendor"}},
+		{{"$group", bson.D{
+			{"_id", "$vendor"},
+			{"count", bson.D{{"$sum", 1}}},
+			{"total", bson.D{{"$sum", "$rating"}}},
+			{"average", bson.D{{"$avg", "$rating"}}},
+			{"lowest", bson.D{{"$min", "$rating"}}},
+			{"highest", bson.D{{"$max", "$rating"}}},
+			{"types", bson.D{{"$push", "$type"}}},
+		}}},
+		{{"$sort", bson.D{{"_id", 1}}}},
+	}
+	cursor, err := db.Aggregate(ctx, pipeline)
+	require.NoError(t, err)
+
+	var results []ratingsByVendor
+	require.NoError(t, cursor.All(ctx, &results))
+	require.Len(t, results, 3)
+
+	require.Equal(t, "A", results[0].Vendor)
+	require.Equal(t, 2, results[0].Count)
+	require.Equal(t, 18, results[0].Total)
+	require.Equal(t, 9.0, results[0].Average)
+	require.Equal(t, 8, results[0].Lowest)
+	require.Equal(t, 10, results[0].Highest)
+	require.ElementsMatch(t, []string{"Masala", "Earl Grey"}, results[0].Types)
+
+	require.Equal(t, "B", results[1].Vendor)
+	require.Equal(t, 1, results[1].Count)
+	require.Equal(t, []string{"Earl Grey"}, results[1].Types)
+
+	require.Equal(t, "C", results[2].Vendor)
+	require.Equal(t, 2, results[2].Count)
+	require.Equal(t, 17, results[2].Total)
+	require.Equal(t, 8.5, results[2].Average)
+	require.ElementsMatch(t, []string{"Masala", "Oolong"}, results[2].Types)
+}
+
+func TestAggregateGroupAll(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	pipeline := []bson.D{
+		{{"$group", bson.D{{"_id", nil}, {"count", bson.D{{"$sum", 1}}}, {"average", bson.D{{"$avg", "$rating"}}}}}},
+	}
+	cursor, err := db.Aggregate(ctx, pipeline)
+	require.NoError(t, err)
+
+	var results []bson.D
+	require.NoError(t, cursor.All(ctx, &results))
+	require.Equal(t, []bson.D{{{"_id", nil}, {"count", int32(5)}, {"average", 7.2}}}, results)
+}
+
+func TestAggregateUnwind(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	pipeline := []bson.D{
+		{{"$match", bson.D{{"type", bson.D{{"$in", bson.A{"English Breakfast", "Assam"}}}}}}},
+		{{"$unwind", bson.D{{"path", "$vendor"}, {"preserveNullAndEmptyArrays", true}}}},
+		{{"$unwind", bson.D{{"path", "$sizes"}, {"includeArrayIndex", "index"}}}},
+		{{"$project", bson.D{{"_id", 0}, {"type", 1}, {"sizes", 1}, {"index", 1}}}},
+		{{"$sort", bson.D{{"sizes", -1}, {"type", 1}}}},
+		{{"$skip", 1}},
+		{{"$limit", 2}},
+	}
+	cursor, err := db.Aggregate(ctx, pipeline)
+	require.NoError(t, err)
+
+	var results []bson.D
+	require.NoError(t, cursor.All(ctx, &results))
+	require.Equal(t, []bson.D{
+		{{"type", "English Breakfast"}, {"sizes", int32(16)}, {"index", int64(2)}},
+		{{"type", "English Breakfast"}, {"sizes", int32(8)}, {"index", int64(1)}},
+	}, results)
+
+	// Documents without vendors are dropped unless preserved
+	cursor, err = db.Aggregate(ctx, []bson.D{{{"$unwind", "$vendor"}}})
+	require.NoError(t, err)
+	results = nil
+	require.NoError(t, cursor.All(ctx, &results))
+	require.Len(t, results, 5)
+}
+
+func TestAggregateLookup(t *testing.T) {
+	ctx, db := getDB(t)
+
+	// $lookup joins collections of the same database
+	teacoll, err := db.GetCollection(ctx, "testdb", fmt.Sprintf("testcollection%v", collectionid))
+	collectionid += 1
+	require.NoError(t, err)
+	for _, tea := range teas {
+		require.NoError(t, teacoll.InsertOne(ctx, tea))
+	}
+
+	vendors, err := db.GetCollection(ctx, "testdb", fmt.Sprintf("testcollection%v", collectionid))
+	collectionid += 1
+	require.NoError(t, err)
+	require.NoError(t, vendors.InsertMany(ctx, []interface{}{
+		bson.D{{"code", "A"}, {"name", "Acme Teas"}},
+		bson.D{{"code", "B"}, {"name", "Best Leaf"}},
+		bson.D{{"code", "C"}, {"name", "Camellia Co"}},
+	}))
+
+	pipeline := []bson.D{
+		{{"$match", bson.D{{"type", bson.D{{"$in", bson.A{"Masala", "Assam"}}}}}}},
+		{{"$lookup", bson.D{
+			{"from", fmt.Sprintf("testcollection%v", collectionid-1)},
+			{"localField", "vendor"},
+			{"foreignField", "code"},
+			{"as", "vendors"},
+		}}},
+		{{"$project", bson.D{{"_id", 0}, {"type", 1}, {"vendors.name", 1}}}},
+		{{"$sort", bson.D{{"type", 1}}}},
+	}
+	cursor, err := teacoll.Aggregate(ctx, pipeline)
+	require.NoError(t, err)
+
+	var results []bson.D
+	require.NoError(t, cursor.All(ctx, &results))
+	require.Equal(t, []bson.D{
+		{{"type", "Assam"}, {"vendors", bson.A{}}},
+		{{"type", "Masala"}, {"vendors", bson.A{bson.D{{"name", "Acme Teas"}}, bson.D{{"name", "Camellia Co"}}}}},
+	}, results)
+}
+
+func TestAggregateInvalid(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	invalid := [][]bson.D{
+		{{{"$nonexistent", bson.D{}}}},
+		{{{"$limit", 0}}},
+		{{{"$skip", -1}}},
+		{{{"$group", bson.D{{"count", bson.D{{"$sum", 1}}}}}}},
+		{{{"$group", bson.D{{"_id", nil}, {"count", bson.D{{"$nonexistent", 1}}}}}}},
+		{{{"$unwind", "vendor"}}},
+		{{{"$lookup", bson.D{{"from", "vendors"}}}}},
+		{{{"$match", bson.D{}}, {"$limit", 1}}},
+	}
+	for _, pipeline := range invalid {
+		_, err := db.Aggregate(ctx, pipeline)
+		require.Error(t, err, "%v", pipeline)
+	}
+}
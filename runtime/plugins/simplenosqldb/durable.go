@@ -0,0 +1,128 @@
+package simplenosqldb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+)
+
+// A [SimpleNoSQLDB] that persists its contents to a directory, so that they survive restarts and crashes.
+//
+// Every change to a document or index is appended to a log file.  After a configurable number of
+// changes, the entire database is written to a snapshot file and the log is truncated.  On startup,
+// the snapshot and log are replayed to restore the database.
+//
+// How often the log is flushed to disk is controlled by an [FsyncPolicy], which trades off
+// durability against the cost of each write.
+//
+// The directory must not be used by more than one database at a time.
+type DurableNoSQLDB struct {
+	backend.NoSQLDatabase
+	db      *SimpleNoSQLDB
+	journal *journal
+}
+
+// Determines when the log of a [DurableNoSQLDB] is flushed to disk
+type FsyncPolicy int
+
+const (
+	FsyncAlways   FsyncPolicy = iota // Flush after every change; no acknowledged change is lost in a crash
+	FsyncInterval                    // Flush periodically; changes since the last flush can be lost in a crash
+	FsyncNever                       // Leave flushing to the operating system
+)
+
+// Parses the name of a policy, i.e. one of "always", "interval" or "never".  The empty string is always.
+func ParseFsyncPolicy(s string) (FsyncPolicy, error) {
+	switch strings.ToLower(s) {
+	case "", "always":
+		return FsyncAlways, nil
+	case "interval":
+		return FsyncInterval, nil
+	case "never":
+		return FsyncNever, nil
+	}
+	return FsyncAlways, fmt.Errorf("unknown fsync policy %q; expected always, interval or never", s)
+}
+
+const (
+	defaultFsyncInterval = time.Second
+	defaultSnapshotEvery = 10000
+)
+
+// Instantiates a [DurableNoSQLDB] that persists its contents to dir, restoring any contents
+// previously persisted there.
+//   - fsync is the name of an [FsyncPolicy] (see [ParseFsyncPolicy])
+//   - fsyncInterval is the period between flushes when fsync is "interval", e.g. "100ms".  Empty or 0 defaults to 1s.
+//   - snapshotEvery is the number of changes after which a snapshot is taken.  Empty or 0 defaults to 10000;
+//     a negative value disables automatic snapshots.
+func NewDurableNoSQLDB(ctx context.Context, dir string, fsync string, fsyncInterval string, snapshotEvery string) (*DurableNoSQLDB, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("a durable NoSQLDB requires a directory")
+	}
+	policy, err := ParseFsyncPolicy(fsync)
+	if err != nil {
+		return nil, err
+	}
+	interval := defaultFsyncInterval
+	if fsyncInterval != "" {
+		d, err := time.ParseDuration(fsyncInterval)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid fsync interval %q; expected a non-negative duration such as 100ms", fsyncInterval)
+		}
+		if d > 0 {
+			interval = d
+		}
+	}
+	every := defaultSnapshotEvery
+	if snapshotEvery != "" {
+		n, err := strconv.Atoi(snapshotEvery)
+		if err != nil {
+			return nil, fmt.Errorf("invalid snapshot interval %q; expected an integer", snapshotEvery)
+		}
+		if n < 0 {
+			every = 0
+		} else if n > 0 {
+			every = n
+		}
+	}
+
+	db, err := NewSimpleNoSQLDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	j, err := openJournal(dir, db, policy, interval, every)
+	if err != nil {
+		return nil, err
+	}
+	db.attach(j)
+	return &DurableNoSQLDB{db: db, journal: j}, nil
+}
+
+func (impl *DurableNoSQLDB) GetCollection(ctx context.Context, db_name string, collection_name string) (backend.NoSQLCollection, error) {
+	return impl.db.GetCollection(ctx, db_name, collection_name)
+}
+
+func (impl *DurableNoSQLDB) StartTransaction(ctx context.Context) (backend.NoSQLTransaction, error) {
+	return impl.db.StartTransaction(ctx)
+}
+
+// Writes a snapshot of the database and truncates the log
+func (impl *DurableNoSQLDB) Snapshot() error {
+	impl.db.lock.RLock()
+	defer impl.db.lock.RUnlock()
+	impl.journal.Lock()
+	defer impl.journal.Unlock()
+	if impl.journal.closed {
+		return fmt.Errorf("database %v is closed", impl.journal.dir)
+	}
+	return impl.journal.snapshot()
+}
+
+// Flushes the log to disk and closes it.  Subsequent changes to the database return an error.
+func (impl *DurableNoSQLDB) Close() error {
+	return impl.journal.close()
+}
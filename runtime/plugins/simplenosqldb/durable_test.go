@@ -0,0 +1,189 @@
+package simplenosqldb_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+	"github.com/blueprint-uservices/blueprint/runtime/plugins/simplenosqldb"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func openDurable(t *testing.T, dir string, fsync string, snapshotEvery string) (*simplenosqldb.DurableNoSQLDB, backend.NoSQLCollection) {
+	ctx := context.Background()
+	db, err := simplenosqldb.NewDurableNoSQLDB(ctx, dir, fsync, "10ms", snapshotEvery)
+	require.NoError(t, err)
+	coll, err := db.GetCollection(ctx, "testdb", "teas")
+	require.NoError(t, err)
+	return db, coll
+}
+
+func TestDurableRestart(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	for _, fsync := range []string{"always", "interval", "never"} {
+		t.Run(fsync, func(t *testing.T) {
+			dir := filepath.Join(dir, fsync)
+			db, coll := openDurable(t, dir, fsync, "")
+			for _, tea := range teas {
+				require.NoError(t, coll.InsertOne(ctx, tea))
+			}
+			_, err := coll.CreateIndex(ctx, bson.D{{"type", 1}}, backend.IndexOptions{Unique: true})
+			require.NoError(t, err)
+			_, err = coll.UpdateMany(ctx, bson.D{{"vendor", "A"}}, bson.D{{"$inc", bson.D{{"rating", 1}}}})
+			require.NoError(t, err)
+			require.NoError(t, coll.DeleteOne(ctx, bson.D{{"type", "Assam"}}))
+			require.NoError(t, db.Close())
+
+			// Changes after closing fail
+			require.Error(t, coll.InsertOne(ctx, newtea))
+
+			db, coll = openDurable(t, dir, fsync, "")
+			defer db.Close()
+			require.ElementsMatch(t, []string{"Masala", "English Breakfast", "Oolong", "Earl Grey"}, findTypes(t, coll, bson.D{}))
+			require.ElementsMatch(t, []string{"Masala", "Earl Grey"}, findTypes(t, coll, bson.D{{"rating", bson.D{{"$gte", 9}}}}))
+
+			// Indexes are restored too
+			err = coll.InsertOne(ctx, Tea{Type: "Oolong"})
+			require.True(t, errors.Is(err, backend.ErrDuplicateKey), "%v", err)
+		})
+	}
+}
+
+func TestDurableSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	db, coll := openDurable(t, dir, "always", "3")
+	for _, tea := range teas {
+		require.NoError(t, coll.InsertOne(ctx, tea))
+	}
+	_, err := coll.CreateIndex(ctx, bson.D{{"type", "text"}}, backend.IndexOptions{})
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "nosqldb.snapshot"))
+	require.NoError(t, err)
+	require.NoError(t, coll.DeleteMany(ctx, bson.D{{"rating", bson.D{{"$lt", 7}}}}))
+	require.NoError(t, db.Close())
+
+	db, coll = openDurable(t, dir, "always", "3")
+	require.ElementsMatch(t, []string{"Masala", "Oolong", "Earl Grey"}, findTypes(t, coll, bson.D{}))
+	require.Equal(t, []string{"Oolong"}, findTypes(t, coll, bson.D{{"$text", bson.D{{"$search", "oolong"}}}}))
+
+	// A snapshot can also be taken explicitly, after which the log is empty
+	_, err = coll.UpdateOne(ctx, bson.D{{"type", "Oolong"}}, bson.D{{"$set", bson.D{{"rating", 1}}}})
+	require.NoError(t, err)
+	require.NoError(t, db.Snapshot())
+	require.NoError(t, db.Close())
+
+	db, coll = openDurable(t, dir, "always", "-1")
+	defer db.Close()
+	require.Equal(t, []string{"Oolong"}, findTypes(t, coll, bson.D{{"rating", 1}}))
+	require.Len(t, findTypes(t, coll, bson.D{}), 3)
+}
+
+func TestDurableFailedWrites(t *testing.T) {
+	ctx := context.Background()
+	db, coll := openDurable(t, t.TempDir(), "always", "")
+	for _, tea := range teas {
+		require.NoError(t, coll.InsertOne(ctx, tea))
+	}
+	_, err := coll.CreateIndex(ctx, bson.D{{"type", 1}}, backend.IndexOptions{Unique: true})
+	require.NoError(t, err)
+	stream, err := coll.Watch(ctx, backend.WatchOptions{})
+	require.NoError(t, err)
+	defer stream.Close(ctx)
+	require.NoError(t, db.Close())
+
+	// Changes that can't be written to the log are not applied
+	require.Error(t, coll.InsertOne(ctx, newtea))
+	_, err = coll.UpdateMany(ctx, bson.D{}, bson.D{{"$set", bson.D{{"rating", 0}}}})
+	require.Error(t, err)
+	require.Error(t, coll.DeleteOne(ctx, bson.D{{"type", "Assam"}}))
+	require.Error(t, coll.DeleteMany(ctx, bson.D{}))
+	_, err = coll.CreateIndex(ctx, bson.D{{"rating", 1}}, backend.IndexOptions{})
+	require.Error(t, err)
+
+	require.ElementsMatch(t, teaTypes(teas), findTypes(t, coll, bson.D{}))
+	require.Empty(t, findTypes(t, coll, bson.D{{"rating", 0}}))
+	require.Empty(t, findTypes(t, coll, bson.D{{"type", newtea.Type}}))
+
+	// and are not reported to change streams
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = stream.Next(timeout)
+	require.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+}
+
+func TestDurableTornLog(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	db, coll := openDurable(t, dir, "always", "")
+	require.NoError(t, coll.InsertMany(ctx, []interface{}{teas[0], teas[1]}))
+	require.NoError(t, db.Close())
+
+	// Simulate a crash while appending a record
+	log, err := os.OpenFile(filepath.Join(dir, "nosqldb.log"), os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = log.Write([]byte{200, 0, 0, 0, 3, 'p'})
+	require.NoError(t, err)
+	require.NoError(t, log.Close())
+
+	db, coll = openDurable(t, dir, "always", "")
+	require.ElementsMatch(t, []string{"Masala", "English Breakfast"}, findTypes(t, coll, bson.D{}))
+	require.NoError(t, coll.InsertOne(ctx, teas[2]))
+	require.NoError(t, db.Close())
+
+	db, coll = openDurable(t, dir, "always", "")
+	defer db.Close()
+	require.ElementsMatch(t, []string{"Masala", "English Breakfast", "Oolong"}, findTypes(t, coll, bson.D{}))
+}
+
+func TestDurableStaleLog(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "nosqldb.log")
+
+	db, coll := openDurable(t, dir, "always", "-1")
+	require.NoError(t, coll.InsertMany(ctx, []interface{}{teas[0], teas[1]}))
+	stale, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	require.NoError(t, coll.DeleteOne(ctx, bson.D{{"type", teas[1].Type}}))
+	require.NoError(t, db.Snapshot())
+	require.NoError(t, db.Close())
+
+	// Simulate a crash after the snapshot was written but before the log was truncated
+	require.NoError(t, os.WriteFile(logPath, stale, 0644))
+
+	db, coll = openDurable(t, dir, "always", "-1")
+	defer db.Close()
+	require.Equal(t, []string{"Masala"}, findTypes(t, coll, bson.D{}))
+}
+
+func TestDurableInvalidConfig(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	invalid := [][]string{
+		{"", "always", "", ""},
+		{dir, "sometimes", "", ""},
+		{dir, "interval", "-1s", ""},
+		{dir, "interval", "often", ""},
+		{dir, "always", "", "ten"},
+	}
+	for _, args := range invalid {
+		_, err := simplenosqldb.NewDurableNoSQLDB(ctx, args[0], args[1], args[2], args[3])
+		require.Error(t, err, "%v", args)
+	}
+
+	// A corrupt snapshot is an error rather than silently losing data
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nosqldb.snapshot"), []byte{1, 2, 3}, 0644))
+	_, err := simplenosqldb.NewDurableNoSQLDB(ctx, dir, "always", "", "")
+	require.Error(t, err)
+}
@@ -0,0 +1,209 @@
+package simplenosqldb_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestTypeOperator(t *testing.T) {
+	_, db := MakeTestDB(t)
+
+	require.Len(t, findTypes(t, db, bson.D{{"rating", bson.D{{"$type", "int"}}}}), 5)
+	require.Empty(t, findTypes(t, db, bson.D{{"rating", bson.D{{"$type", "long"}}}}))
+	require.Len(t, findTypes(t, db, bson.D{{"packaging.length", bson.D{{"$type", 18}}}}), 5)
+	require.Len(t, findTypes(t, db, bson.D{{"type", bson.D{{"$type", bson.A{"number", 2}}}}}), 5)
+
+	// Arrays match "array", and the types of their elements
+	require.ElementsMatch(t, []string{"Masala", "Oolong", "Earl Grey"}, findTypes(t, db, bson.D{{"vendor", bson.D{{"$type", "array"}}}}))
+	require.ElementsMatch(t, []string{"Masala", "Oolong", "Earl Grey"}, findTypes(t, db, bson.D{{"vendor", bson.D{{"$type", "string"}}}}))
+	require.Len(t, findTypes(t, db, bson.D{{"sizes", bson.D{{"$type", "int"}}}}), 5)
+
+	// Can be combined with other operators
+	require.Equal(t, []string{"Earl Grey"}, findTypes(t, db, bson.D{{"sizes", bson.D{{"$type", "int"}, {"$gt", 16}}}}))
+}
+
+func TestNin(t *testing.T) {
+	_, db := MakeTestDB(t)
+
+	require.Equal(t, []string{"Masala"}, findTypes(t, db, bson.D{{"sizes", bson.D{{"$nin", bson.A{16, 32}}}}}))
+
+	// Documents without the field match
+	require.ElementsMatch(t, []string{"English Breakfast", "Oolong", "Assam"}, findTypes(t, db, bson.D{{"vendor", bson.D{{"$nin", bson.A{"A"}}}}}))
+
+	require.Empty(t, findTypes(t, db, bson.D{{"sizes", bson.D{{"$nin", bson.A{16, 32}}, {"$gt", 20}}}}))
+	require.Len(t, findTypes(t, db, bson.D{{"sizes", bson.D{{"$nin", bson.A{}}}}}), 5)
+}
+
+func TestMod(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	require.ElementsMatch(t, []string{"Masala", "English Breakfast", "Earl Grey"}, findTypes(t, db, bson.D{{"rating", bson.D{{"$mod", bson.A{2, 0}}}}}))
+	require.ElementsMatch(t, []string{"Masala", "Assam"}, findTypes(t, db, bson.D{{"rating", bson.D{{"$mod", bson.A{5.5, 0}}}}}))
+	require.Equal(t, []string{"Earl Grey"}, findTypes(t, db, bson.D{{"sizes", bson.D{{"$mod", bson.A{10, 2}}}}}))
+
+	for _, invalid := range []any{bson.A{0, 1}, bson.A{2}, bson.A{"2", 0}, 2} {
+		_, err := db.FindMany(ctx, bson.D{{"rating", bson.D{{"$mod", invalid}}}})
+		require.Error(t, err, "%v", invalid)
+	}
+}
+
+func TestExpr(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	// Compare fields of the same document
+	require.Equal(t, []string{"Masala"}, findTypes(t, db, bson.D{{"$expr", bson.D{{"$gt", bson.A{"$packaging.width", "$packaging.length"}}}}}))
+
+	// Arithmetic
+	require.ElementsMatch(t, []string{"Oolong", "Assam"}, findTypes(t, db, bson.D{{"$expr", bson.D{{"$eq", bson.A{bson.D{{"$mod", bson.A{"$rating", 2}}}, 1}}}}}))
+	require.ElementsMatch(t, []string{"Masala", "Assam"}, findTypes(t, db, bson.D{{"$expr", bson.D{{"$gte", bson.A{
+		bson.D{{"$multiply", bson.A{"$packaging.length", "$packaging.width"}}}, 40,
+	}}}}}))
+	require.ElementsMatch(t, []string{"English Breakfast", "Oolong"}, findTypes(t, db, bson.D{{"$expr", bson.D{{"$and", bson.A{
+		bson.D{{"$lt", bson.A{"$rating", 8}}},
+		bson.D{{"$gt", bson.A{bson.D{{"$add", bson.A{"$rating", 2}}}, 7}}},
+	}}}}}))
+	require.Equal(t, []string{"Assam"}, findTypes(t, db, bson.D{{"$expr", bson.D{{"$cond", bson.D{
+		{"if", bson.D{{"$eq", bson.A{"$packaging.kind", "Cardboard"}}}},
+		{"then", true},
+		{"else", bson.D{{"$divide", bson.A{"$rating", 0}}}},
+	}}}}}))
+
+	// A missing field is not equal to null, and is less than all other values
+	require.Empty(t, findTypes(t, db, bson.D{{"$expr", bson.D{{"$eq", bson.A{"$nonexistent", nil}}}}}))
+	require.Len(t, findTypes(t, db, bson.D{{"$expr", bson.D{{"$lt", bson.A{"$nonexistent", nil}}}}}), 5)
+
+	// Null literals can be compared with expressions that evaluate to null
+	require.Len(t, findTypes(t, db, bson.D{{"$expr", bson.D{{"$eq", bson.A{bson.D{{"$add", bson.A{"$type", 1}}}, nil}}}}}), 5)
+	require.Empty(t, findTypes(t, db, bson.D{{"$expr", bson.D{{"$ne", bson.A{nil, bson.D{{"$literal", nil}}}}}}}))
+
+	// Can be combined with other conditions
+	require.Equal(t, []string{"Earl Grey"}, findTypes(t, db, bson.D{{"vendor", "A"}, {"$expr", bson.D{{"$lt", bson.A{"$rating", 10}}}}}))
+
+	invalid := []bson.D{
+		{{"$expr", bson.D{{"$subtract", bson.A{1}}}}},
+		{{"$expr", bson.D{{"$nonexistent", 1}}}},
+		{{"$expr", bson.D{{"$cond", bson.D{{"if", true}, {"then", 1}}}}}},
+		{{"rating", bson.D{{"$expr", bson.D{{"$eq", bson.A{"$rating", 1}}}}}}},
+	}
+	for _, filter := range invalid {
+		_, err := db.FindMany(ctx, filter)
+		require.Error(t, err, "%v", filter)
+	}
+}
+
+func TestExprArithmetic(t *testing.T) {
+	ctx, db := getDB(t)
+	coll, err := db.GetCollection(ctx, "testdb", fmt.Sprintf("testcollection%v", collectionid))
+	collectionid += 1
+	require.NoError(t, err)
+	require.NoError(t, coll.InsertOne(ctx, bson.D{{"a", int32(2147483647)}, {"b", int64(3)}, {"c", 1.5}, {"s", "x"}}))
+
+	pipeline := []bson.D{{{"$project", bson.D{
+		{"_id", 0},
+		{"int", bson.D{{"$add", bson.A{int32(1), int32(2)}}}},
+		{"overflow", bson.D{{"$add", bson.A{"$a", int32(1)}}}},
+		{"long", bson.D{{"$multiply", bson.A{int32(2), "$b"}}}},
+		{"double", bson.D{{"$subtract", bson.A{"$b", "$c"}}}},
+		{"divide", bson.D{{"$divide", bson.A{"$b", int32(2)}}}},
+		{"mod", bson.D{{"$mod", bson.A{"$b", int32(2)}}}},
+		{"abs", bson.D{{"$abs", -4.5}}},
+		{"null", bson.D{{"$add", bson.A{"$s", int32(1)}}}},
+		{"cmp", bson.D{{"$cmp", bson.A{"$s", "$b"}}}},
+		{"not", bson.D{{"$not", bson.A{0}}}},
+	}}}}
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	require.NoError(t, err)
+
+	var results []bson.D
+	require.NoError(t, cursor.All(ctx, &results))
+	require.Equal(t, []bson.D{{
+		{"int", int32(3)},
+		{"overflow", int64(2147483648)},
+		{"long", int64(6)},
+		{"double", 1.5},
+		{"divide", 1.5},
+		{"mod", int64(1)},
+		{"abs", 4.5},
+		{"null", nil},
+		{"cmp", int32(1)},
+		{"not", true},
+	}}, results)
+}
+
+func TestTextSearch(t *testing.T) {
+	ctx, db := getDB(t)
+	coll, err := db.GetCollection(ctx, "testdb", fmt.Sprintf("testcollection%v", collectionid))
+	collectionid += 1
+	require.NoError(t, err)
+	require.NoError(t, coll.InsertMany(ctx, []interface{}{
+		bson.D{{"name", "Earl Grey"}, {"description", "Black tea flavoured with bergamot"}},
+		bson.D{{"name", "Sencha"}, {"description", "Japanese green tea"}},
+		bson.D{{"name", "Gunpowder"}, {"description", "Chinese green tea rolled into pellets"}},
+		bson.D{{"name", "Lapsang Souchong"}, {"description", "Smoked black tea"}, {"tags", bson.A{"smoky"}}},
+	}))
+
+	search := func(filter bson.D) []string {
+		cursor, err := coll.FindMany(ctx, filter)
+		require.NoError(t, err)
+		var results []named
+		require.NoError(t, cursor.All(ctx, &results))
+		var names []string
+		for _, result := range results {
+			names = append(names, result.Name)
+		}
+		return names
+	}
+	text := func(s string) bson.D {
+		return bson.D{{"$text", bson.D{{"$search", s}}}}
+	}
+
+	// $text requires a text index
+	_, err = coll.FindMany(ctx, text("green"))
+	require.Error(t, err)
+
+	name, err := coll.CreateIndex(ctx, bson.D{{"name", "text"}, {"description", "text"}}, backend.IndexOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "name_text_description_text", name)
+
+	require.ElementsMatch(t, []string{"Sencha", "Gunpowder"}, search(text("green")))
+	require.ElementsMatch(t, []string{"Sencha", "Gunpowder", "Earl Grey"}, search(text("GREEN bergamot")))
+	require.ElementsMatch(t, []string{"Earl Grey", "Lapsang Souchong"}, search(text("tea -green")))
+	require.ElementsMatch(t, []string{"Gunpowder"}, search(text(`"green tea rolled" sencha`)))
+	require.ElementsMatch(t, []string{"Lapsang Souchong"}, search(text("souchong")))
+	require.Empty(t, search(text("smoky")))
+	require.Empty(t, search(bson.D{{"$text", bson.D{{"$search", "Green"}, {"$caseSensitive", true}}}}))
+	require.Equal(t, []string{"Sencha"}, search(bson.D{{"$text", bson.D{{"$search", "tea"}}}, {"name", bson.D{{"$regex", "^S"}}}}))
+
+	// A collection has at most one text index
+	_, err = coll.CreateIndex(ctx, bson.D{{"name", "text"}, {"description", "text"}}, backend.IndexOptions{})
+	require.NoError(t, err)
+	_, err = coll.CreateIndex(ctx, bson.D{{"tags", "text"}}, backend.IndexOptions{})
+	require.Error(t, err)
+	_, err = coll.CreateIndex(ctx, bson.D{{"tags", "text"}, {"rating", 1}}, backend.IndexOptions{})
+	require.Error(t, err)
+
+	_, err = coll.FindMany(ctx, bson.D{{"$text", bson.D{{"$search", 1}}}})
+	require.Error(t, err)
+	_, err = coll.FindMany(ctx, bson.D{{"name", bson.D{{"$text", bson.D{{"$search", "tea"}}}}}})
+	require.Error(t, err)
+}
+
+func TestTextSearchWildcard(t *testing.T) {
+	ctx, db := getDB(t)
+	coll, err := db.GetCollection(ctx, "testdb", fmt.Sprintf("testcollection%v", collectionid))
+	collectionid += 1
+	require.NoError(t, err)
+
+	for _, tea := range teas {
+		require.NoError(t, coll.InsertOne(ctx, tea))
+	}
+	_, err = coll.CreateIndex(ctx, bson.D{{"$**", "text"}}, backend.IndexOptions{})
+	require.NoError(t, err)
+
+	require.ElementsMatch(t, []string{"Masala", "Assam"}, findTypes(t, coll, bson.D{{"$text", bson.D{{"$search", "paper cardboard"}}}}))
+	require.ElementsMatch(t, []string{"English Breakfast"}, findTypes(t, coll, bson.D{{"$text", bson.D{{"$search", "breakfast"}}}}))
+}
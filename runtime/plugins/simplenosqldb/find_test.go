@@ -0,0 +1,202 @@
+package simplenosqldb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type named struct {
+	Name string
+}
+
+func teaTypes(gotteas []Tea) []string {
+	var types []string
+	for _, tea := range gotteas {
+		types = append(types, tea.Type)
+	}
+	return types
+}
+
+func TestFindSort(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	cursor, err := db.FindManyWithOptions(ctx, bson.D{}, backend.FindOptions{Sort: bson.D{{"rating", -1}}})
+	require.NoError(t, err)
+	gotteas := []Tea{}
+	require.NoError(t, cursor.All(ctx, &gotteas))
+	require.Equal(t, []string{"Masala", "Earl Grey", "Oolong", "English Breakfast", "Assam"}, teaTypes(gotteas))
+
+	cursor, err = db.FindManyWithOptions(ctx, bson.D{}, backend.FindOptions{Sort: bson.D{{"type", 1}}})
+	require.NoError(t, err)
+	gotteas = []Tea{}
+	require.NoError(t, cursor.All(ctx, &gotteas))
+	require.Equal(t, []string{"Assam", "Earl Grey", "English Breakfast", "Masala", "Oolong"}, teaTypes(gotteas))
+}
+
+func TestFindSortNested(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	// Teas without packaging have a zero length, so sort by type to break ties
+	cursor, err := db.FindManyWithOptions(ctx, bson.D{}, backend.FindOptions{Sort: bson.D{{"packaging.length", -1}, {"type", 1}}})
+	require.NoError(t, err)
+	gotteas := []Tea{}
+	require.NoError(t, cursor.All(ctx, &gotteas))
+	require.Equal(t, []string{"Assam", "Masala", "Earl Grey", "English Breakfast", "Oolong"}, teaTypes(gotteas))
+}
+
+func TestFindSortArray(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	// Ascending sorts use the smallest element of an array
+	cursor, err := db.FindManyWithOptions(ctx, bson.D{}, backend.FindOptions{Sort: bson.D{{"sizes", 1}, {"type", 1}}})
+	require.NoError(t, err)
+	gotteas := []Tea{}
+	require.NoError(t, cursor.All(ctx, &gotteas))
+	require.Equal(t, []string{"English Breakfast", "Masala", "Oolong", "Assam", "Earl Grey"}, teaTypes(gotteas))
+
+	// Descending sorts use the largest element of an array
+	cursor, err = db.FindManyWithOptions(ctx, bson.D{}, backend.FindOptions{Sort: bson.D{{"sizes", -1}, {"type", 1}}})
+	require.NoError(t, err)
+	gotteas = []Tea{}
+	require.NoError(t, cursor.All(ctx, &gotteas))
+	require.Equal(t, []string{"Earl Grey", "Assam", "English Breakfast", "Oolong", "Masala"}, teaTypes(gotteas))
+}
+
+func TestFindSkipLimit(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	sort := bson.D{{"rating", 1}}
+	cursor, err := db.FindManyWithOptions(ctx, bson.D{}, backend.FindOptions{Sort: sort, Skip: 1, Limit: 2})
+	require.NoError(t, err)
+	gotteas := []Tea{}
+	require.NoError(t, cursor.All(ctx, &gotteas))
+	require.Equal(t, []string{"English Breakfast", "Oolong"}, teaTypes(gotteas))
+
+	cursor, err = db.FindManyWithOptions(ctx, bson.D{}, backend.FindOptions{Sort: sort, Skip: 3})
+	require.NoError(t, err)
+	gotteas = []Tea{}
+	require.NoError(t, cursor.All(ctx, &gotteas))
+	require.Equal(t, []string{"Earl Grey", "Masala"}, teaTypes(gotteas))
+
+	cursor, err = db.FindManyWithOptions(ctx, bson.D{}, backend.FindOptions{Sort: sort, Skip: 10})
+	require.NoError(t, err)
+	gotteas = []Tea{}
+	require.NoError(t, cursor.All(ctx, &gotteas))
+	require.Empty(t, gotteas)
+
+	cursor, err = db.FindManyWithOptions(ctx, bson.D{{"rating", bson.D{{"$gte", 7}}}}, backend.FindOptions{Sort: sort, Limit: 10})
+	require.NoError(t, err)
+	gotteas = []Tea{}
+	require.NoError(t, cursor.All(ctx, &gotteas))
+	require.Equal(t, []string{"Oolong", "Earl Grey", "Masala"}, teaTypes(gotteas))
+}
+
+func TestFindProjection(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	// The projection applies to the sorted, skipped and limited results
+	opts := backend.FindOptions{Sort: bson.D{{"rating", 1}}, Skip: 1, Limit: 2, Projection: bson.D{{"_id", 0}, {"type", 1}, {"rating", 1}}}
+	cursor, err := db.FindManyWithOptions(ctx, bson.D{}, opts)
+	require.NoError(t, err)
+	var results []bson.D
+	require.NoError(t, cursor.All(ctx, &results))
+	require.Equal(t, []bson.D{
+		{{"type", "English Breakfast"}, {"rating", int32(6)}},
+		{{"type", "Oolong"}, {"rating", int32(7)}},
+	}, results)
+
+	_, err = db.FindManyWithOptions(ctx, bson.D{}, backend.FindOptions{Projection: bson.D{{"type", 1}, {"sizes", 0}}})
+	require.Error(t, err)
+}
+
+func TestFindSortMixedTypes(t *testing.T) {
+	ctx, db := getDB(t)
+	coll, err := db.GetCollection(ctx, "testdb", "mixedtypes")
+	require.NoError(t, err)
+	require.NoError(t, coll.DeleteMany(ctx, bson.D{}))
+
+	date := primitive.NewDateTimeFromTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	docs := []interface{}{
+		bson.D{{"name", "date"}, {"v", date}},
+		bson.D{{"name", "true"}, {"v", true}},
+		bson.D{{"name", "false"}, {"v", false}},
+		bson.D{{"name", "objectid"}, {"v", primitive.NewObjectID()}},
+		bson.D{{"name", "array"}, {"v", bson.A{bson.A{1}}}},
+		bson.D{{"name", "object"}, {"v", bson.D{{"a", 1}}}},
+		bson.D{{"name", "string"}, {"v", "abc"}},
+		bson.D{{"name", "double"}, {"v", 2.5}},
+		bson.D{{"name", "long"}, {"v", int64(10)}},
+		bson.D{{"name", "int"}, {"v", int32(3)}},
+		bson.D{{"name", "null"}, {"v", nil}},
+		bson.D{{"name", "missing"}},
+		bson.D{{"name", "empty"}, {"v", bson.A{}}},
+		bson.D{{"name", "minkey"}, {"v", primitive.MinKey{}}},
+		bson.D{{"name", "maxkey"}, {"v", primitive.MaxKey{}}},
+	}
+	require.NoError(t, coll.InsertMany(ctx, docs))
+
+	cursor, err := coll.FindManyWithOptions(ctx, bson.D{}, backend.FindOptions{Sort: bson.D{{"v", 1}, {"name", 1}}})
+	require.NoError(t, err)
+	var got []named
+	require.NoError(t, cursor.All(ctx, &got))
+
+	var names []string
+	for _, n := range got {
+		names = append(names, n.Name)
+	}
+	require.Equal(t, []string{
+		"minkey", "empty", "missing", "null", "double", "int", "long", "string",
+		"object", "array", "objectid", "false", "true", "date", "maxkey",
+	}, names)
+}
+
+func TestFindInvalidOptions(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	_, err := db.FindManyWithOptions(ctx, bson.D{}, backend.FindOptions{Sort: bson.D{{"rating", 2}}})
+	require.Error(t, err)
+
+	_, err = db.FindManyWithOptions(ctx, bson.D{}, backend.FindOptions{Skip: -1})
+	require.Error(t, err)
+}
+
+func TestCountDocuments(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	count, err := db.CountDocuments(ctx, bson.D{})
+	require.NoError(t, err)
+	require.Equal(t, int64(5), count)
+
+	count, err = db.CountDocuments(ctx, bson.D{{"rating", bson.D{{"$gte", 7}}}})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), count)
+
+	count, err = db.CountDocuments(ctx, bson.D{{"type", "Darjeeling"}})
+	require.NoError(t, err)
+	require.Equal(t, int64(0), count)
+}
+
+func TestDistinct(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	values, err := db.Distinct(ctx, "vendor", bson.D{})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []interface{}{"A", "B", "C"}, values)
+
+	values, err = db.Distinct(ctx, "sizes", bson.D{{"rating", bson.D{{"$lt", 8}}}})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []interface{}{int32(4), int32(8), int32(16)}, values)
+
+	values, err = db.Distinct(ctx, "packaging.kind", bson.D{})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []interface{}{"Paper", "Cardboard", ""}, values)
+
+	values, err = db.Distinct(ctx, "nonexistent", bson.D{})
+	require.NoError(t, err)
+	require.Empty(t, values)
+}
@@ -0,0 +1,129 @@
+package simplenosqldb_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func findTypes(t *testing.T, db backend.NoSQLCollection, filter bson.D) []string {
+	ctx, _ := getDB(t)
+	cursor, err := db.FindMany(ctx, filter)
+	require.NoError(t, err)
+	gotteas := []Tea{}
+	require.NoError(t, cursor.All(ctx, &gotteas))
+	return teaTypes(gotteas)
+}
+
+func TestIndexLookup(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	name, err := db.CreateIndex(ctx, bson.D{{"type", 1}}, backend.IndexOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "type_1", name)
+
+	require.Equal(t, []string{"Oolong"}, findTypes(t, db, bson.D{{"type", "Oolong"}}))
+	require.ElementsMatch(t, []string{"Masala", "Assam"}, findTypes(t, db, bson.D{{"type", bson.D{{"$in", bson.A{"Masala", "Assam", "Darjeeling"}}}}}))
+	require.Empty(t, findTypes(t, db, bson.D{{"type", "Darjeeling"}}))
+
+	// Predicates on other fields are still applied to the index results
+	require.Empty(t, findTypes(t, db, bson.D{{"type", "Oolong"}, {"rating", 10}}))
+}
+
+func TestIndexRange(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	_, err := db.CreateIndex(ctx, bson.D{{"rating", -1}}, backend.IndexOptions{})
+	require.NoError(t, err)
+
+	require.ElementsMatch(t, []string{"Masala", "Earl Grey", "Oolong"}, findTypes(t, db, bson.D{{"rating", bson.D{{"$gte", 7}}}}))
+	require.ElementsMatch(t, []string{"English Breakfast", "Oolong"}, findTypes(t, db, bson.D{{"rating", bson.D{{"$gt", 5}, {"$lt", 8}}}}))
+	require.Empty(t, findTypes(t, db, bson.D{{"rating", bson.D{{"$gt", 10}}}}))
+}
+
+func TestIndexCompound(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	name, err := db.CreateIndex(ctx, bson.D{{"vendor", 1}, {"rating", -1}}, backend.IndexOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "vendor_1_rating_-1", name)
+
+	// vendor is an array, so the index is multikey
+	require.ElementsMatch(t, []string{"Masala", "Oolong"}, findTypes(t, db, bson.D{{"vendor", "C"}}))
+	require.Equal(t, []string{"Masala"}, findTypes(t, db, bson.D{{"vendor", "C"}, {"rating", bson.D{{"$gt", 7}}}}))
+	require.ElementsMatch(t, []string{"Masala", "Earl Grey"}, findTypes(t, db, bson.D{{"vendor", "A"}}))
+}
+
+func TestIndexUnique(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	_, err := db.CreateIndex(ctx, bson.D{{"type", 1}}, backend.IndexOptions{Unique: true})
+	require.NoError(t, err)
+
+	err = db.InsertOne(ctx, Tea{Type: "Oolong", Rating: 3})
+	require.True(t, errors.Is(err, backend.ErrDuplicateKey), "%v", err)
+
+	_, err = db.UpdateOne(ctx, bson.D{{"type", "Assam"}}, bson.D{{"$set", bson.D{{"type", "Masala"}, {"rating", 1}}}})
+	require.True(t, errors.Is(err, backend.ErrDuplicateKey), "%v", err)
+
+	// The failed update leaves the document unchanged
+	var tea Tea
+	result, err := db.FindOne(ctx, bson.D{{"type", "Assam"}})
+	require.NoError(t, err)
+	found, err := result.One(ctx, &tea)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, 5, tea.Rating)
+
+	_, err = db.ReplaceOne(ctx, bson.D{{"type", "Assam"}}, Tea{Type: "Oolong"})
+	require.True(t, errors.Is(err, backend.ErrDuplicateKey), "%v", err)
+
+	// Deleted documents are removed from the index
+	require.NoError(t, db.DeleteOne(ctx, bson.D{{"type", "Oolong"}}))
+	require.NoError(t, db.InsertOne(ctx, Tea{Type: "Oolong", Rating: 3}))
+
+	count, err := db.CountDocuments(ctx, bson.D{})
+	require.NoError(t, err)
+	require.Equal(t, int64(5), count)
+}
+
+func TestIndexDuplicateID(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	require.NoError(t, db.InsertOne(ctx, bson.D{{"_id", "tea1"}, {"type", "Darjeeling"}}))
+	err := db.InsertOne(ctx, bson.D{{"_id", "tea1"}, {"type", "Sencha"}})
+	require.True(t, errors.Is(err, backend.ErrDuplicateKey), "%v", err)
+
+	require.Equal(t, []string{"Darjeeling"}, findTypes(t, db, bson.D{{"_id", "tea1"}}))
+}
+
+func TestCreateIndexExisting(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	// Several teas share a vendor, so a unique index cannot be built
+	_, err := db.CreateIndex(ctx, bson.D{{"vendor", 1}}, backend.IndexOptions{Unique: true})
+	require.True(t, errors.Is(err, backend.ErrDuplicateKey), "%v", err)
+
+	// The failed index is not kept
+	require.NoError(t, db.InsertOne(ctx, Tea{Type: "Darjeeling", Vendor: []string{"A"}}))
+
+	// Creating the same index twice is a no-op
+	name, err := db.CreateIndex(ctx, bson.D{{"vendor", 1}}, backend.IndexOptions{Name: "byvendor"})
+	require.NoError(t, err)
+	require.Equal(t, "byvendor", name)
+	_, err = db.CreateIndex(ctx, bson.D{{"vendor", 1}}, backend.IndexOptions{Name: "byvendor"})
+	require.NoError(t, err)
+
+	// But not with a different name, options or keys
+	_, err = db.CreateIndex(ctx, bson.D{{"vendor", 1}}, backend.IndexOptions{Name: "other"})
+	require.Error(t, err)
+	_, err = db.CreateIndex(ctx, bson.D{{"vendor", 1}}, backend.IndexOptions{Name: "byvendor", Unique: true})
+	require.Error(t, err)
+	_, err = db.CreateIndex(ctx, bson.D{{"type", 1}}, backend.IndexOptions{Name: "byvendor"})
+	require.Error(t, err)
+	_, err = db.CreateIndex(ctx, bson.D{{"type", 2}}, backend.IndexOptions{})
+	require.Error(t, err)
+}
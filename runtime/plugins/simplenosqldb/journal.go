@@ -0,0 +1,475 @@
+package simplenosqldb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/exp/slog"
+)
+
+/*
+The on-disk format of a [DurableNoSQLDB].
+
+The database directory contains a snapshot file and a log file.  Both are sequences of BSON-encoded
+records.  The first record of each file is a header with a generation number; the remaining records
+describe changes to documents and indexes:
+  - put sets the document with _id id to doc, inserting it if it doesn't exist
+  - delete removes the document with _id id
+  - index creates an index
+  - transaction applies the put and delete records of a committed transaction, all or none of
+    which are in the file
+
+A snapshot of generation g contains the records needed to rebuild the entire database, and the log
+of generation g contains the changes made since that snapshot.  Taking a snapshot writes the snapshot
+of generation g+1 to a temporary file, renames it over the previous snapshot, and then starts a new
+log of generation g+1.  If the process crashes before the new log is started, the stale log of
+generation g is discarded on startup.
+
+Records are idempotent, so replaying a log is safe even if some of its records are already reflected
+in the snapshot.
+*/
+
+const (
+	snapshotFile = "nosqldb.snapshot"
+	logFile      = "nosqldb.log"
+
+	opHeader      = "header"
+	opPut         = "put"
+	opDelete      = "delete"
+	opIndex       = "index"
+	opTransaction = "transaction"
+)
+
+type record struct {
+	Op         string   `bson:"op"`
+	Generation int64    `bson:"gen,omitempty"`
+	Database   string   `bson:"db,omitempty"`
+	Collection string   `bson:"coll,omitempty"`
+	ID         any      `bson:"id,omitempty"`
+	Document   bson.D   `bson:"doc,omitempty"`
+	Keys       bson.D   `bson:"keys,omitempty"`
+	Name       string   `bson:"name,omitempty"`
+	Unique     bool     `bson:"unique,omitempty"`
+	Writes     []record `bson:"writes,omitempty"`
+}
+
+// Appends the changes made to a [SimpleNoSQLDB] to the log file, and periodically snapshots the database.
+type journal struct {
+	sync.Mutex
+	dir           string
+	db            *SimpleNoSQLDB
+	file          *os.File
+	fsync         FsyncPolicy
+	snapshotEvery int   // Records after which to take a snapshot; 0 to never snapshot automatically
+	generation    int64 // Generation of the current snapshot and log
+	records       int   // Records appended since the last snapshot
+	dirty         bool  // Whether records have been written since the last fsync
+	closed        bool
+	done          chan struct{}
+	stopped       sync.WaitGroup
+}
+
+// Replays the snapshot and log in dir into db, then opens the log for appending
+func openJournal(dir string, db *SimpleNoSQLDB, fsync FsyncPolicy, fsyncInterval time.Duration, snapshotEvery int) (*journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	j := &journal{dir: dir, db: db, fsync: fsync, snapshotEvery: snapshotEvery}
+
+	// Replay the snapshot, which is always complete because it is written to a temporary file and renamed
+	snapshotPath := filepath.Join(dir, snapshotFile)
+	if _, err := os.Stat(snapshotPath); err == nil {
+		j.generation, _, err = replay(snapshotPath, db, 0)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load snapshot %v: %w", snapshotPath, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	// Replay the log.  A crash can leave a partially written record at the end of the log, which is discarded.
+	logPath := filepath.Join(dir, logFile)
+	if _, err := os.Stat(logPath); err == nil {
+		generation, replayed, err := replayLog(logPath, db, j.generation)
+		if err != nil {
+			return nil, fmt.Errorf("unable to replay log %v: %w", logPath, err)
+		}
+		if generation >= j.generation {
+			j.generation, j.records = generation, replayed
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(logPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	j.file = file
+	if j.records == 0 {
+		// The log is empty or stale
+		if err := j.resetLog(); err != nil {
+			file.Close()
+			return nil, err
+		}
+	} else if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if fsync == FsyncInterval {
+		j.done = make(chan struct{})
+		j.stopped.Add(1)
+		go j.syncPeriodically(fsyncInterval)
+	}
+	return j, nil
+}
+
+// Replays the records of the log at path into db, returning the log's generation and the number of
+// records replayed.  A log older than generation is stale and is not replayed.
+func replayLog(path string, db *SimpleNoSQLDB, generation int64) (int64, int, error) {
+	logGeneration, replayed, err := replay(path, db, generation)
+	var torn *tornRecordError
+	if errors.As(err, &torn) {
+		slog.Warn(fmt.Sprintf("Discarding partially written record at offset %v of %v", torn.offset, path))
+		if err := os.Truncate(path, torn.offset); err != nil {
+			return 0, 0, err
+		}
+		return logGeneration, replayed, nil
+	}
+	return logGeneration, replayed, err
+}
+
+type tornRecordError struct {
+	offset int64
+}
+
+func (e *tornRecordError) Error() string {
+	return fmt.Sprintf("incomplete record at offset %v", e.offset)
+}
+
+// Replays the records of the file at path into db, returning the file's generation and the number
+// of records replayed.  If the file's generation is lower than minGeneration, its records are not
+// replayed.  If the file ends with an incomplete record, the records before it are replayed
+// and a *tornRecordError is returned.
+func replay(path string, db *SimpleNoSQLDB, minGeneration int64) (int64, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var generation int64
+	offset := int64(0)
+	replayed := 0
+	for i := 0; ; i++ {
+		rec, size, err := readRecord(r)
+		if err == io.EOF {
+			return generation, replayed, nil
+		} else if err == io.ErrUnexpectedEOF {
+			return generation, replayed, &tornRecordError{offset: offset}
+		} else if err != nil {
+			return generation, replayed, err
+		}
+		offset += size
+
+		if i == 0 {
+			if rec.Op != opHeader {
+				return generation, replayed, fmt.Errorf("expected a header record but found %v", rec.Op)
+			}
+			generation = rec.Generation
+			if generation < minGeneration {
+				return generation, 0, nil
+			}
+			continue
+		}
+		if err := db.apply(rec); err != nil {
+			return generation, replayed, fmt.Errorf("unable to replay %v record at offset %v: %w", rec.Op, offset-size, err)
+		}
+		replayed++
+	}
+}
+
+// Reads one record and returns its size in bytes.  Returns io.EOF if there are no more records and
+// io.ErrUnexpectedEOF if the record is incomplete.
+func readRecord(r io.Reader) (record, int64, error) {
+	var rec record
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return rec, 0, err
+	}
+	size := int64(binary.LittleEndian.Uint32(length[:]))
+	if size < 5 {
+		return rec, 0, io.ErrUnexpectedEOF
+	}
+	bytes := make([]byte, size)
+	copy(bytes, length[:])
+	if _, err := io.ReadFull(r, bytes[4:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return rec, 0, err
+	}
+	if err := bson.Unmarshal(bytes, &rec); err != nil {
+		return rec, 0, io.ErrUnexpectedEOF
+	}
+	return rec, size, nil
+}
+
+func writeRecord(w io.Writer, rec record) error {
+	bytes, err := bson.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(bytes)
+	return err
+}
+
+// Appends rec to the log, taking a snapshot if enough records have been appended since the last one.
+// The change that rec records must already have been applied to the database, because the snapshot
+// replaces the log.
+func (j *journal) append(rec record) error {
+	j.Lock()
+	defer j.Unlock()
+	if j.closed {
+		return fmt.Errorf("database %v is closed", j.dir)
+	}
+	if err := writeRecord(j.file, rec); err != nil {
+		return err
+	}
+	if j.fsync == FsyncAlways {
+		if err := j.file.Sync(); err != nil {
+			return err
+		}
+	} else {
+		j.dirty = true
+	}
+	j.records++
+	if j.snapshotEvery > 0 && j.records >= j.snapshotEvery {
+		// rec is already in the log, so the change must not fail; the snapshot is retried on the next append
+		if err := j.snapshot(); err != nil {
+			slog.Warn(fmt.Sprintf("Unable to snapshot %v: %v", j.dir, err))
+		}
+	}
+	return nil
+}
+
+// Writes a snapshot of the database and starts a new log.  Must be called with the lock held.
+func (j *journal) snapshot() error {
+	tmpPath := filepath.Join(j.dir, snapshotFile+".tmp")
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = writeRecord(w, record{Op: opHeader, Generation: j.generation + 1})
+	if err == nil {
+		err = j.db.writeSnapshot(w)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, filepath.Join(j.dir, snapshotFile))
+	}
+	if err == nil {
+		err = syncDir(j.dir)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("unable to write snapshot: %w", err)
+	}
+
+	j.generation++
+	return j.resetLog()
+}
+
+// Truncates the log and writes the header of the current generation
+func (j *journal) resetLog() error {
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := j.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := writeRecord(j.file, record{Op: opHeader, Generation: j.generation}); err != nil {
+		return err
+	}
+	j.records = 0
+	j.dirty = false
+	return j.file.Sync()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func (j *journal) syncPeriodically(interval time.Duration) {
+	defer j.stopped.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.done:
+			return
+		case <-ticker.C:
+			j.Lock()
+			if j.dirty && !j.closed {
+				if err := j.file.Sync(); err != nil {
+					slog.Error(fmt.Sprintf("Unable to sync log in %v: %v", j.dir, err))
+				} else {
+					j.dirty = false
+				}
+			}
+			j.Unlock()
+		}
+	}
+}
+
+func (j *journal) close() error {
+	if j.done != nil {
+		close(j.done)
+		j.stopped.Wait()
+	}
+	j.Lock()
+	defer j.Unlock()
+	if j.closed {
+		return nil
+	}
+	j.closed = true
+	err := j.file.Sync()
+	if closeErr := j.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Writes the records needed to rebuild the database
+func (impl *SimpleNoSQLDB) writeSnapshot(w io.Writer) error {
+	for _, dbName := range sortedKeys(impl.collections) {
+		collections := impl.collections[dbName]
+		for _, name := range sortedKeys(collections) {
+			coll := collections[name]
+			for _, index := range coll.indexes {
+				if index.Name() == "_id_" {
+					continue
+				}
+				if err := writeRecord(w, record{Op: opIndex, Database: dbName, Collection: name, Keys: index.Keys(), Name: index.Name(), Unique: index.Unique()}); err != nil {
+					return err
+				}
+			}
+			if coll.text != nil {
+				if err := writeRecord(w, record{Op: opIndex, Database: dbName, Collection: name, Keys: coll.text.Keys(), Name: coll.text.Name()}); err != nil {
+					return err
+				}
+			}
+			for _, item := range coll.items {
+				if err := writeRecord(w, record{Op: opPut, Database: dbName, Collection: name, ID: documentID(*item), Document: *item}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Starts recording the changes to the database and its collections in j
+func (impl *SimpleNoSQLDB) attach(j *journal) {
+	impl.journal = j
+	for _, collections := range impl.collections {
+		for _, coll := range collections {
+			coll.journal = j
+		}
+	}
+}
+
+// Applies a put, delete, index or transaction record to the database
+func (impl *SimpleNoSQLDB) apply(rec record) error {
+	if rec.Op == opTransaction {
+		for _, write := range rec.Writes {
+			if err := impl.apply(write); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	coll, err := impl.collection(rec.Database, rec.Collection)
+	if err != nil {
+		return err
+	}
+	switch rec.Op {
+	case opPut:
+		_, err := coll.put(rec.Document)
+		return err
+	case opDelete:
+		coll.remove(rec.ID)
+		return nil
+	case opIndex:
+		_, err := coll.createIndex(rec.Keys, backend.IndexOptions{Name: rec.Name, Unique: rec.Unique})
+		return err
+	}
+	return fmt.Errorf("unknown record type %v", rec.Op)
+}
+
+// Records the new value of the document with _id id, if the database is durable
+func (db *SimpleCollection) logPut(id any, d bson.D) error {
+	if db.journal == nil {
+		return nil
+	}
+	return db.journal.append(record{Op: opPut, Database: db.dbName, Collection: db.name, ID: id, Document: d})
+}
+
+// Records the deletion of the document with _id id, if the database is durable
+func (db *SimpleCollection) logDelete(id any) error {
+	if db.journal == nil {
+		return nil
+	}
+	return db.journal.append(record{Op: opDelete, Database: db.dbName, Collection: db.name, ID: id})
+}
+
+// Records the writes of a committed transaction, if the database is durable
+func (impl *SimpleNoSQLDB) logTransaction(writes []record) error {
+	if impl.journal == nil || len(writes) == 0 {
+		return nil
+	}
+	return impl.journal.append(record{Op: opTransaction, Writes: writes})
+}
+
+// Records the creation of an index, if the database is durable
+func (db *SimpleCollection) logIndex(keys bson.D, name string, unique bool) error {
+	if db.journal == nil {
+		return nil
+	}
+	return db.journal.append(record{Op: opIndex, Database: db.dbName, Collection: db.name, Keys: keys, Name: name, Unique: unique})
+}
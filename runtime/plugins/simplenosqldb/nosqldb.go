@@ -2,13 +2,19 @@
 //
 // Only a small set of common basic filter and update operators are supported, but typically this is sufficient
 // for most applications and enables writing service-level unit tests.
+//
+// Transactions have snapshot isolation; see [SimpleTransaction].
+//
+// A [DurableNoSQLDB] additionally persists its contents to a directory, so that they survive restarts.
 package simplenosqldb
 
 import (
 	"context"
 	"fmt"
 	"reflect"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
 	"github.com/blueprint-uservices/blueprint/runtime/plugins/simplenosqldb/query"
@@ -25,11 +31,27 @@ type (
 	// Only a small set of common basic filter and update operators are supported, but typically this is sufficient
 	// for most applications and enables writing service-level unit tests.
 	SimpleNoSQLDB struct {
+		lock        sync.RWMutex // Guards the collections and their documents
 		collections map[string]map[string]*SimpleCollection
+		journal     *journal // Records changes to the database, if it is durable
+		version     uint64   // Advanced by every write, so that transactions can tell which collections changed after they started
 	}
 
 	SimpleCollection struct {
-		items []bson.D
+		dbName   string
+		name     string
+		items    []*bson.D
+		indexes  []*query.SecondaryIndex
+		text     *query.TextIndex             // The collection's text index, if any, used by $text
+		database map[string]*SimpleCollection // The collections of the same database, used by $lookup
+		journal  *journal
+		changes  *changeLog    // Recent changes, for change streams
+		lock     *sync.RWMutex // The lock of the database or transaction that the collection belongs to
+		writes   *writeSet     // The writes made by the transaction that the collection belongs to, if any
+
+		tx        *SimpleTransaction // The transaction that the collection belongs to, if any
+		version   uint64             // The version of the database when the collection was last written
+		dbVersion *uint64            // The version of the database that the collection belongs to
 	}
 
 	SimpleCursor struct {
@@ -45,6 +67,13 @@ func NewSimpleNoSQLDB(ctx context.Context) (*SimpleNoSQLDB, error) {
 }
 
 func (impl *SimpleNoSQLDB) GetCollection(ctx context.Context, db_name string, collection_name string) (backend.NoSQLCollection, error) {
+	impl.lock.Lock()
+	defer impl.lock.Unlock()
+	return impl.collection(db_name, collection_name)
+}
+
+// Returns the named collection, creating it if it doesn't exist
+func (impl *SimpleNoSQLDB) collection(db_name string, collection_name string) (*SimpleCollection, error) {
 	db, dbExists := impl.collections[db_name]
 	if !dbExists {
 		db = make(map[string]*SimpleCollection)
@@ -53,13 +82,45 @@ func (impl *SimpleNoSQLDB) GetCollection(ctx context.Context, db_name string, co
 
 	collection, collectionExists := db[collection_name]
 	if !collectionExists {
-		collection = &SimpleCollection{}
+		var err error
+		collection, err = newCollection(db_name, collection_name, db)
+		if err != nil {
+			return nil, err
+		}
+		collection.journal = impl.journal
+		collection.lock = &impl.lock
+		collection.dbVersion = &impl.version
 		db[collection_name] = collection
 	}
 
 	return collection, nil
 }
 
+// Creates an empty collection and adds it to database
+func newCollection(db_name string, collection_name string, database map[string]*SimpleCollection) (*SimpleCollection, error) {
+	collection := &SimpleCollection{dbName: db_name, name: collection_name, database: database, changes: newChangeLog()}
+	// As in MongoDB, every collection has a unique index on _id
+	idIndex, err := query.NewSecondaryIndex("_id_", bson.D{{"_id", 1}}, true)
+	if err != nil {
+		return nil, err
+	}
+	collection.indexes = append(collection.indexes, idIndex)
+	database[collection_name] = collection
+	return collection, nil
+}
+
+// Locks the collection for reading, and returns a function that unlocks it
+func (db *SimpleCollection) rlock() func() {
+	db.lock.RLock()
+	return db.lock.RUnlock
+}
+
+// Locks the collection for writing, and returns a function that unlocks it
+func (db *SimpleCollection) wlock() func() {
+	db.lock.Lock()
+	return db.lock.Unlock
+}
+
 func (c *SimpleCursor) One(ctx context.Context, obj interface{}) (bool, error) {
 	if len(c.results) == 0 {
 		return false, nil
@@ -96,8 +157,16 @@ func (c *SimpleCursor) All(ctx context.Context, obj interface{}) error {
 }
 
 func (db *SimpleCollection) InsertOne(ctx context.Context, document interface{}) error {
+	defer db.wlock()()
+	return db.insertOne(document)
+}
+
+func (db *SimpleCollection) insertOne(document interface{}) error {
 	d, isD := document.(bson.D)
-	if !isD {
+	if isD {
+		// Stored documents are never modified in place, so don't keep the caller's document
+		d = copyDocument(d)
+	} else {
 		var err error
 		d, err = toBson(document)
 		if err != nil {
@@ -115,13 +184,22 @@ func (db *SimpleCollection) InsertOne(ctx context.Context, document interface{})
 		d = append(bson.D{{"_id", primitive.NewObjectID()}}, d...)
 	}
 
-	db.items = append(db.items, d)
+	if err := db.index(&d); err != nil {
+		return err
+	}
+	db.items = append(db.items, &d)
+	if err := db.logPut(documentID(d), d); err != nil {
+		db.delete(&d)
+		return err
+	}
+	db.changed(backend.ChangeInsert, documentID(d), d)
 	return nil
 }
 
 func (db *SimpleCollection) InsertMany(ctx context.Context, documents []interface{}) error {
+	defer db.wlock()()
 	for _, d := range documents {
-		err := db.InsertOne(ctx, d)
+		err := db.insertOne(d)
 		if err != nil {
 			return err
 		}
@@ -130,7 +208,8 @@ func (db *SimpleCollection) InsertMany(ctx context.Context, documents []interfac
 }
 
 func (db *SimpleCollection) FindOne(ctx context.Context, filter bson.D, projection ...bson.D) (backend.NoSQLCursor, error) {
-	query, err := query.ParseFilter(filter)
+	defer db.rlock()()
+	query, err := db.parseFilter(filter)
 	if err != nil {
 		return nil, err
 	}
@@ -138,9 +217,9 @@ func (db *SimpleCollection) FindOne(ctx context.Context, filter bson.D, projecti
 		fmt.Printf("---- FindOne\n%v\n", query)
 	}
 	cursor := &SimpleCursor{}
-	for _, item := range db.items {
-		if query.Apply(item) {
-			cursor.results = append(cursor.results, item)
+	for _, item := range db.candidates(filter) {
+		if query.Apply(*item) {
+			cursor.results = append(cursor.results, *item)
 			if verbose {
 				fmt.Printf("MATCH: %v\n", item)
 			}
@@ -160,7 +239,12 @@ func SetVerbose(enabled bool) bool {
 }
 
 func (db *SimpleCollection) FindMany(ctx context.Context, filter bson.D, projection ...bson.D) (backend.NoSQLCursor, error) {
-	query, err := query.ParseFilter(filter)
+	defer db.rlock()()
+	return db.findMany(filter)
+}
+
+func (db *SimpleCollection) findMany(filter bson.D) (*SimpleCursor, error) {
+	query, err := db.parseFilter(filter)
 	if err != nil {
 		return nil, err
 	}
@@ -168,9 +252,9 @@ func (db *SimpleCollection) FindMany(ctx context.Context, filter bson.D, project
 		fmt.Printf("---- FindMany\n%v\n", query)
 	}
 	cursor := &SimpleCursor{}
-	for _, item := range db.items {
-		if query.Apply(item) {
-			cursor.results = append(cursor.results, item)
+	for _, item := range db.candidates(filter) {
+		if query.Apply(*item) {
+			cursor.results = append(cursor.results, *item)
 			if verbose {
 				fmt.Printf("MATCH: %v\n", item)
 			}
@@ -183,14 +267,128 @@ func (db *SimpleCollection) FindMany(ctx context.Context, filter bson.D, project
 	return cursor, nil
 }
 
+func (db *SimpleCollection) FindManyWithOptions(ctx context.Context, filter bson.D, opts backend.FindOptions) (backend.NoSQLCursor, error) {
+	defer db.rlock()()
+	if opts.Skip < 0 {
+		return nil, fmt.Errorf("invalid skip %v; must not be negative", opts.Skip)
+	}
+	if opts.Limit < 0 {
+		return nil, fmt.Errorf("invalid limit %v; must not be negative", opts.Limit)
+	}
+	sort, err := query.ParseSort(opts.Sort)
+	if err != nil {
+		return nil, err
+	}
+	var projection *query.Pipeline
+	if opts.Projection != nil {
+		projection, err = query.ParsePipeline([]bson.D{{{Key: "$project", Value: opts.Projection}}})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cursor, err := db.findMany(filter)
+	if err != nil {
+		return nil, err
+	}
+	results := cursor.results
+	sort.Apply(results)
+	if opts.Skip >= int64(len(results)) {
+		results = nil
+	} else {
+		results = results[opts.Skip:]
+	}
+	if opts.Limit > 0 && opts.Limit < int64(len(results)) {
+		results = results[:opts.Limit]
+	}
+	if projection != nil {
+		results, err = projection.Apply(results, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &SimpleCursor{results: results}, nil
+}
+
+func (db *SimpleCollection) CountDocuments(ctx context.Context, filter bson.D) (int64, error) {
+	defer db.rlock()()
+	query, err := db.parseFilter(filter)
+	if err != nil {
+		return 0, err
+	}
+	count := int64(0)
+	for _, item := range db.candidates(filter) {
+		if query.Apply(*item) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (db *SimpleCollection) Distinct(ctx context.Context, field string, filter bson.D) ([]interface{}, error) {
+	defer db.rlock()()
+	filterOp, err := db.parseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	var matches []bson.D
+	for _, item := range db.candidates(filter) {
+		if filterOp.Apply(*item) {
+			matches = append(matches, *item)
+		}
+	}
+	return query.Distinct(matches, field), nil
+}
+
+func (db *SimpleCollection) Aggregate(ctx context.Context, pipeline []bson.D) (backend.NoSQLCursor, error) {
+	defer db.rlock()()
+	p, err := query.ParsePipeline(pipeline)
+	if err != nil {
+		return nil, err
+	}
+	if verbose {
+		fmt.Printf("---- Aggregate\n%v\n", p)
+	}
+	var lookupErr error
+	results, err := p.Apply(db.documents(), func(name string) []bson.D {
+		if db.tx != nil {
+			// The transaction may not have accessed the collection yet
+			collection, err := db.tx.collection(db.dbName, name)
+			if err != nil {
+				lookupErr = err
+				return nil
+			}
+			return collection.documents()
+		}
+		if collection, exists := db.database[name]; exists {
+			return collection.documents()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if lookupErr != nil {
+		return nil, lookupErr
+	}
+	return &SimpleCursor{results: results}, nil
+}
+
 func (db *SimpleCollection) DeleteOne(ctx context.Context, filter bson.D) error {
-	query, err := query.ParseFilter(filter)
+	defer db.wlock()()
+	query, err := db.parseFilter(filter)
 	if err != nil {
 		return err
 	}
-	for i, item := range db.items {
-		if query.Apply(item) {
-			db.items = append(db.items[:i], db.items[i+1:]...)
+	for _, item := range db.candidates(filter) {
+		if query.Apply(*item) {
+			id := documentID(*item)
+			undo := db.remove(id)
+			if err := db.logDelete(id); err != nil {
+				undo()
+				return err
+			}
+			db.changed(backend.ChangeDelete, id, nil)
 			return nil
 		}
 	}
@@ -198,34 +396,67 @@ func (db *SimpleCollection) DeleteOne(ctx context.Context, filter bson.D) error
 }
 
 func (db *SimpleCollection) DeleteMany(ctx context.Context, filter bson.D) error {
-	query, err := query.ParseFilter(filter)
+	defer db.wlock()()
+	query, err := db.parseFilter(filter)
 	if err != nil {
 		return err
 	}
-	copyrangebegin := 0
-	newitems := make([]bson.D, 0, len(db.items))
-	for i, item := range db.items {
-		if query.Apply(item) {
-			if i > copyrangebegin {
-				newitems = append(newitems, db.items[copyrangebegin:i]...)
-			}
-			copyrangebegin = i + 1
+	deleted := make(map[*bson.D]bool)
+	for _, item := range db.candidates(filter) {
+		if query.Apply(*item) {
+			db.unindex(item)
+			deleted[item] = true
 		}
 	}
-	if copyrangebegin < len(db.items) {
-		newitems = append(newitems, db.items[copyrangebegin:len(db.items)]...)
+	if len(deleted) == 0 {
+		return nil
+	}
+	newitems := make([]*bson.D, 0, len(db.items)-len(deleted))
+	var removed []*bson.D
+	for _, item := range db.items {
+		if deleted[item] {
+			removed = append(removed, item)
+		} else {
+			newitems = append(newitems, item)
+		}
 	}
+	original := db.items
 	db.items = newitems
-	return nil
 
+	// If a deletion can't be journaled, restore that document and the ones after it
+	for i, item := range removed {
+		if err = db.logDelete(documentID(*item)); err != nil {
+			for _, item := range removed[i:] {
+				db.index(item)
+				deleted[item] = false
+			}
+			db.items = make([]*bson.D, 0, len(original))
+			for _, item := range original {
+				if !deleted[item] {
+					db.items = append(db.items, item)
+				}
+			}
+			removed = removed[:i]
+			break
+		}
+	}
+	for _, item := range removed {
+		db.changed(backend.ChangeDelete, documentID(*item), nil)
+	}
+	return err
 }
 
 func (db *SimpleCollection) UpdateOne(ctx context.Context, filter bson.D, update bson.D) (int, error) {
-	filterOp, err := query.ParseFilter(filter)
+	return db.UpdateOneWithOptions(ctx, filter, update, backend.UpdateOptions{})
+}
+
+func (db *SimpleCollection) UpdateOneWithOptions(ctx context.Context, filter bson.D, update bson.D, opts backend.UpdateOptions) (int, error) {
+	defer db.wlock()()
+	filterOp, err := db.parseFilter(filter)
 	if err != nil {
 		return 0, err
 	}
-	updateOp, err := query.ParseUpdate(update)
+	updateOp, err := query.ParseUpdateWithOptions(update, query.UpdateOptions{Filter: filter, ArrayFilters: opts.ArrayFilters})
 	if err != nil {
 		return 0, err
 	}
@@ -234,27 +465,35 @@ func (db *SimpleCollection) UpdateOne(ctx context.Context, filter bson.D, update
 		fmt.Printf("---- UpdateOne\n%v\n%v\n", filter, update)
 	}
 
-	for i := range db.items {
-		if filterOp.Apply(db.items[i]) {
+	for _, item := range db.candidates(filter) {
+		if filterOp.Apply(*item) {
 			if verbose {
-				fmt.Printf("MATCH: %v\n", db.items[i])
+				fmt.Printf("MATCH: %v\n", *item)
 			}
-			return 1, updateOp.Apply(&db.items[i])
+			return 1, db.modify(item, backend.ChangeUpdate, updateOp.Apply)
 		} else {
 			if verbose {
-				fmt.Printf("      %v\n", db.items[i])
+				fmt.Printf("      %v\n", *item)
 			}
 		}
 	}
+	if opts.Upsert {
+		return 1, db.upsert(filter, update, opts)
+	}
 	return 0, nil
 }
 
 func (db *SimpleCollection) UpdateMany(ctx context.Context, filter bson.D, update bson.D) (int, error) {
-	filterOp, err := query.ParseFilter(filter)
+	return db.UpdateManyWithOptions(ctx, filter, update, backend.UpdateOptions{})
+}
+
+func (db *SimpleCollection) UpdateManyWithOptions(ctx context.Context, filter bson.D, update bson.D, opts backend.UpdateOptions) (int, error) {
+	defer db.wlock()()
+	filterOp, err := db.parseFilter(filter)
 	if err != nil {
 		return 0, err
 	}
-	updateOp, err := query.ParseUpdate(update)
+	updateOp, err := query.ParseUpdateWithOptions(update, query.UpdateOptions{Filter: filter, ArrayFilters: opts.ArrayFilters})
 	if err != nil {
 		return 0, err
 	}
@@ -265,34 +504,58 @@ func (db *SimpleCollection) UpdateMany(ctx context.Context, filter bson.D, updat
 	}
 
 	updated := 0
-	for i := range db.items {
-		if filterOp.Apply(db.items[i]) {
+	for _, item := range db.candidates(filter) {
+		if filterOp.Apply(*item) {
 			if verbose {
-				fmt.Printf("UPDATING: %v\n", db.items[i])
+				fmt.Printf("UPDATING: %v\n", *item)
 			}
-			err := updateOp.Apply(&db.items[i])
+			err := db.modify(item, backend.ChangeUpdate, updateOp.Apply)
 			if err != nil {
 				return updated, err
 			}
 			if verbose {
-				fmt.Printf("      --> %v\n", db.items[i])
+				fmt.Printf("      --> %v\n", *item)
 			}
 			updated += 1
 		} else {
 			if verbose {
-				fmt.Printf("          %v\n", db.items[i])
+				fmt.Printf("          %v\n", *item)
 			}
 		}
 	}
+	if updated == 0 && opts.Upsert {
+		return 1, db.upsert(filter, update, opts)
+	}
 	return updated, nil
 }
 
+// Inserts a document built from the equality conditions of filter, with update and any
+// $setOnInsert fields applied
+func (db *SimpleCollection) upsert(filter bson.D, update bson.D, opts backend.UpdateOptions) error {
+	doc, err := query.UpsertDocument(filter)
+	if err != nil {
+		return err
+	}
+	updateOp, err := query.ParseUpdateWithOptions(update, query.UpdateOptions{Filter: filter, ArrayFilters: opts.ArrayFilters, Insert: true})
+	if err != nil {
+		return err
+	}
+	if err := updateOp.Apply(&doc); err != nil {
+		return err
+	}
+	if verbose {
+		fmt.Printf("UPSERTING: %v\n", doc)
+	}
+	return db.insertOne(doc)
+}
+
 func (db *SimpleCollection) Upsert(ctx context.Context, filter bson.D, document interface{}) (bool, error) {
-	updatedCount, err := db.ReplaceOne(ctx, filter, document)
+	defer db.wlock()()
+	updatedCount, err := db.replaceOne(filter, document)
 	if updatedCount == 1 || err != nil {
 		return true, err
 	}
-	return false, db.InsertOne(ctx, document)
+	return false, db.insertOne(document)
 }
 
 func (db *SimpleCollection) UpsertID(ctx context.Context, id primitive.ObjectID, document interface{}) (bool, error) {
@@ -305,29 +568,36 @@ func (db *SimpleCollection) UpsertID(ctx context.Context, id primitive.ObjectID,
 }
 
 func (db *SimpleCollection) ReplaceOne(ctx context.Context, filter bson.D, replacement interface{}) (int, error) {
-	query, err := query.ParseFilter(filter)
+	defer db.wlock()()
+	return db.replaceOne(filter, replacement)
+}
+
+func (db *SimpleCollection) replaceOne(filter bson.D, replacement interface{}) (int, error) {
+	query, err := db.parseFilter(filter)
 	if err != nil {
 		return 0, err
 	}
-	for i, item := range db.items {
-		if query.Apply(item) {
-			db.items[i], err = toBson(replacement)
-			return 1, err
+	for _, item := range db.candidates(filter) {
+		if query.Apply(*item) {
+			return 1, db.replace(item, replacement)
 		}
 	}
 	return 0, nil
 }
 
 func (db *SimpleCollection) ReplaceMany(ctx context.Context, filter bson.D, replacements ...interface{}) (int, error) {
-	query, err := query.ParseFilter(filter)
+	defer db.wlock()()
+	query, err := db.parseFilter(filter)
 	if err != nil {
 		return 0, nil
 	}
 	updateCount := 0
-	for i := 0; updateCount < len(replacements) && i < len(db.items); i++ {
-		if query.Apply(db.items[i]) {
-			db.items[i], err = toBson(replacements[updateCount])
-			if err != nil {
+	for _, item := range db.candidates(filter) {
+		if updateCount >= len(replacements) {
+			break
+		}
+		if query.Apply(*item) {
+			if err := db.replace(item, replacements[updateCount]); err != nil {
 				return updateCount, err
 			}
 			updateCount++
@@ -336,6 +606,277 @@ func (db *SimpleCollection) ReplaceMany(ctx context.Context, filter bson.D, repl
 	return updateCount, nil
 }
 
+func (db *SimpleCollection) CreateIndex(ctx context.Context, keys bson.D, opts backend.IndexOptions) (string, error) {
+	if db.writes != nil {
+		return "", fmt.Errorf("indexes cannot be created in a transaction")
+	}
+	defer db.wlock()()
+	return db.createIndex(keys, opts)
+}
+
+func (db *SimpleCollection) createIndex(keys bson.D, opts backend.IndexOptions) (string, error) {
+	name := opts.Name
+	if name == "" {
+		name = query.IndexName(keys)
+	}
+	if query.IsTextIndex(keys) {
+		return db.createTextIndex(name, keys, opts)
+	}
+	if db.text != nil && db.text.Name() == name {
+		return "", fmt.Errorf("index %v already exists with different keys", db.text)
+	}
+	for _, existing := range db.indexes {
+		if existing.HasKeys(keys) {
+			if existing.Unique() == opts.Unique && existing.Name() == name {
+				return name, nil
+			}
+			return "", fmt.Errorf("index %v already exists with different options or name", existing)
+		} else if existing.Name() == name {
+			return "", fmt.Errorf("index %v already exists with different keys", existing)
+		}
+	}
+
+	index, err := query.NewSecondaryIndex(name, keys, opts.Unique)
+	if err != nil {
+		return "", err
+	}
+	for _, item := range db.items {
+		if err := index.Insert(item); err != nil {
+			return "", err
+		}
+	}
+	db.indexes = append(db.indexes, index)
+	if err := db.logIndex(keys, name, opts.Unique); err != nil {
+		db.indexes = db.indexes[:len(db.indexes)-1]
+		return "", err
+	}
+	return name, nil
+}
+
+// A collection can have at most one text index
+func (db *SimpleCollection) createTextIndex(name string, keys bson.D, opts backend.IndexOptions) (string, error) {
+	if opts.Unique {
+		return "", fmt.Errorf("text index %v cannot be unique", name)
+	}
+	if db.text != nil {
+		if db.text.HasKeys(keys) && db.text.Name() == name {
+			return name, nil
+		}
+		return "", fmt.Errorf("collection already has text index %v", db.text)
+	}
+	for _, existing := range db.indexes {
+		if existing.Name() == name {
+			return "", fmt.Errorf("index %v already exists with different keys", existing)
+		}
+	}
+	text, err := query.NewTextIndex(name, keys)
+	if err != nil {
+		return "", err
+	}
+	db.text = text
+	if err := db.logIndex(keys, name, false); err != nil {
+		db.text = nil
+		return "", err
+	}
+	return name, nil
+}
+
+func (db *SimpleCollection) parseFilter(filter bson.D) (query.Filter, error) {
+	return query.ParseFilterWithTextIndex(filter, db.text)
+}
+
+// Returns the documents that might match filter, using an index if possible
+func (db *SimpleCollection) candidates(filter bson.D) []*bson.D {
+	plan := query.PlanQuery(filter, db.indexes)
+	if plan == nil {
+		return db.items
+	}
+	if verbose {
+		fmt.Printf("PLAN: %v\n", plan)
+	}
+	return plan.Documents()
+}
+
+// Returns the documents of the collection
+func (db *SimpleCollection) documents() []bson.D {
+	docs := make([]bson.D, 0, len(db.items))
+	for _, item := range db.items {
+		docs = append(docs, *item)
+	}
+	return docs
+}
+
+// Adds item to all indexes.  If a unique index rejects item, item is not added to any index.
+func (db *SimpleCollection) index(item *bson.D) error {
+	for i, index := range db.indexes {
+		if err := index.Insert(item); err != nil {
+			for _, added := range db.indexes[:i] {
+				added.Remove(item)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *SimpleCollection) unindex(item *bson.D) {
+	for _, index := range db.indexes {
+		index.Remove(item)
+	}
+}
+
+// Removes item from the collection and its indexes
+func (db *SimpleCollection) delete(item *bson.D) {
+	db.unindex(item)
+	for i := range db.items {
+		if db.items[i] == item {
+			db.items = append(db.items[:i], db.items[i+1:]...)
+			break
+		}
+	}
+}
+
+// Sets the document with the same _id as d to d, inserting d if there is no such document.
+// Returns a function that undoes the change.
+func (db *SimpleCollection) put(d bson.D) (func(), error) {
+	item := db.findByID(documentID(d))
+	if item == nil {
+		item = &d
+		if err := db.index(item); err != nil {
+			return nil, err
+		}
+		db.items = append(db.items, item)
+		return func() { db.delete(item) }, nil
+	}
+	original := *item
+	db.unindex(item)
+	*item = d
+	if err := db.index(item); err != nil {
+		*item = original
+		db.index(item)
+		return nil, err
+	}
+	return func() {
+		db.unindex(item)
+		*item = original
+		db.index(item)
+	}, nil
+}
+
+// Removes the document with the given _id, if there is one.  Returns a function that undoes the change.
+func (db *SimpleCollection) remove(id any) func() {
+	for i, item := range db.items {
+		if reflect.DeepEqual(documentID(*item), id) {
+			db.delete(item)
+			return func() {
+				db.index(item)
+				db.items = slices.Insert(db.items, i, item)
+			}
+		}
+	}
+	return func() {}
+}
+
+// Returns the document with the given _id, or nil if there is none
+func (db *SimpleCollection) findByID(id any) *bson.D {
+	for _, item := range db.candidates(bson.D{{"_id", id}}) {
+		if reflect.DeepEqual(documentID(*item), id) {
+			return item
+		}
+	}
+	return nil
+}
+
+func documentID(d bson.D) any {
+	for _, e := range d {
+		if e.Key == "_id" {
+			return e.Value
+		}
+	}
+	return nil
+}
+
+// Modifies item using apply and updates the indexes.  If apply fails, a unique index rejects the
+// modified item or the change can't be journaled, item keeps its original value.  operationType is
+// the kind of change reported to change streams.
+//
+// apply modifies a copy of item, because documents are never modified in place; transactions can
+// still be reading the original.
+func (db *SimpleCollection) modify(item *bson.D, operationType string, apply func(itemRef any) error) error {
+	original := *item
+	updated := copyDocument(original)
+	if err := apply(&updated); err != nil {
+		return err
+	}
+	db.unindex(item)
+	*item = updated
+	if err := db.index(item); err != nil {
+		*item = original
+		db.index(item)
+		return err
+	}
+	if err := db.logPut(documentID(original), updated); err != nil {
+		db.unindex(item)
+		*item = original
+		db.index(item)
+		return err
+	}
+	db.changed(operationType, documentID(original), updated)
+	return nil
+}
+
+// Replaces item with replacement.  As in MongoDB, the replacement keeps the _id of item.
+func (db *SimpleCollection) replace(item *bson.D, replacement interface{}) error {
+	d, err := toBson(replacement)
+	if err != nil {
+		return err
+	}
+	var id any
+	for _, e := range *item {
+		if e.Key == "_id" {
+			id = e.Value
+		}
+	}
+	hasId := false
+	for _, e := range d {
+		if e.Key == "_id" {
+			hasId = true
+			if !reflect.DeepEqual(e.Value, id) {
+				return fmt.Errorf("replacement cannot change the _id of a document from %v to %v", id, e.Value)
+			}
+		}
+	}
+	if !hasId && id != nil {
+		d = append(bson.D{{"_id", id}}, d...)
+	}
+	return db.modify(item, backend.ChangeReplace, func(itemRef any) error {
+		*itemRef.(*bson.D) = d
+		return nil
+	})
+}
+
+func copyDocument(d bson.D) bson.D {
+	copied := make(bson.D, len(d))
+	for i, e := range d {
+		copied[i] = bson.E{Key: e.Key, Value: copyValue(e.Value)}
+	}
+	return copied
+}
+
+func copyValue(v any) any {
+	switch value := v.(type) {
+	case bson.D:
+		return copyDocument(value)
+	case bson.A:
+		copied := make(bson.A, len(value))
+		for i, elem := range value {
+			copied[i] = copyValue(elem)
+		}
+		return copied
+	}
+	return v
+}
+
 func toBson(document any) (bson.D, error) {
 	bytes, err := bson.Marshal(document)
 	if err != nil {
@@ -357,7 +898,7 @@ func fromBson(d bson.D, dst any) error {
 func (db *SimpleCollection) String() string {
 	var strs []string
 	for i := range db.items {
-		strs = append(strs, fmt.Sprintf("%v", db.items[i]))
+		strs = append(strs, fmt.Sprintf("%v", *db.items[i]))
 	}
 	return strings.Join(strs, "\n")
 }
@@ -0,0 +1,719 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/*
+Simple evaluation of aggregation pipelines
+
+https://www.mongodb.com/docs/manual/core/aggregation-pipeline/
+*/
+
+// Returns the documents of another collection in the same database, used by $lookup.
+// Returns nil if the collection does not exist.
+type Collections func(name string) []bson.D
+
+// A stage of an aggregation pipeline
+type Stage interface {
+	// Applies the stage to the output of the previous stage.  Implementations must not
+	// modify items or the documents in items.
+	Apply(items []bson.D, collections Collections) ([]bson.D, error)
+	String() string
+}
+
+// An aggregation pipeline; a sequence of stages
+type Pipeline struct {
+	stages []Stage
+}
+
+type (
+	matchStage struct {
+		filter Filter
+	}
+
+	projectStage struct {
+		projection *projection
+	}
+
+	groupStage struct {
+		id     Expression
+		fields []string
+		ops    []string
+		exprs  []Expression
+	}
+
+	sortStage struct {
+		sort *Sort
+	}
+
+	limitStage struct {
+		n int64
+	}
+
+	skipStage struct {
+		n int64
+	}
+
+	unwindStage struct {
+		path                       []string
+		includeArrayIndex          string
+		preserveNullAndEmptyArrays bool
+	}
+
+	lookupStage struct {
+		from         string
+		localField   []string
+		foreignField []string
+		as           string
+	}
+)
+
+// Parses an aggregation pipeline.  The supported stages are $match, $project, $group, $sort,
+// $limit, $skip, $unwind and $lookup.  $group supports the $sum, $avg, $min, $max and $push
+// accumulators.  See [ParseExpression] for the supported expressions.
+func ParsePipeline(pipeline []bson.D) (*Pipeline, error) {
+	p := &Pipeline{}
+	for _, d := range pipeline {
+		if len(d) != 1 {
+			return nil, fmt.Errorf("a pipeline stage must have exactly one field; found %v", d)
+		}
+		stage, err := parseStage(d[0])
+		if err != nil {
+			return nil, err
+		}
+		p.stages = append(p.stages, stage)
+	}
+	return p, nil
+}
+
+func parseStage(e bson.E) (Stage, error) {
+	switch e.Key {
+	case "$match":
+		d, isD := e.Value.(bson.D)
+		if !isD {
+			return nil, fmt.Errorf("$match expects a bson.D filter; found %v", e.Value)
+		}
+		filter, err := ParseFilter(d)
+		return &matchStage{filter: filter}, err
+	case "$project":
+		d, isD := e.Value.(bson.D)
+		if !isD {
+			return nil, fmt.Errorf("$project expects a bson.D specification; found %v", e.Value)
+		}
+		projection, err := parseProjection(d)
+		return &projectStage{projection: projection}, err
+	case "$group":
+		return parseGroup(e.Value)
+	case "$sort":
+		d, isD := e.Value.(bson.D)
+		if !isD || len(d) == 0 {
+			return nil, fmt.Errorf("$sort expects a non-empty bson.D specification; found %v", e.Value)
+		}
+		sort, err := ParseSort(d)
+		return &sortStage{sort: sort}, err
+	case "$limit":
+		n, isInt := intValue(e.Value)
+		if !isInt || n <= 0 {
+			return nil, fmt.Errorf("$limit expects a positive integer; found %v", e.Value)
+		}
+		return &limitStage{n: n}, nil
+	case "$skip":
+		n, isInt := intValue(e.Value)
+		if !isInt || n < 0 {
+			return nil, fmt.Errorf("$skip expects a non-negative integer; found %v", e.Value)
+		}
+		return &skipStage{n: n}, nil
+	case "$unwind":
+		return parseUnwind(e.Value)
+	case "$lookup":
+		return parseLookup(e.Value)
+	}
+	return nil, fmt.Errorf("unsupported pipeline stage %v", e.Key)
+}
+
+func parseGroup(spec any) (Stage, error) {
+	d, isD := spec.(bson.D)
+	if !isD {
+		return nil, fmt.Errorf("$group expects a bson.D specification; found %v", spec)
+	}
+	g := &groupStage{}
+	for _, e := range d {
+		if e.Key == "_id" {
+			id, err := ParseExpression(e.Value)
+			if err != nil {
+				return nil, err
+			}
+			g.id = id
+			continue
+		}
+		if strings.HasPrefix(e.Key, "$") || strings.Contains(e.Key, ".") {
+			return nil, fmt.Errorf("invalid $group field name %v", e.Key)
+		}
+		acc, isD := e.Value.(bson.D)
+		if !isD || len(acc) != 1 {
+			return nil, fmt.Errorf("$group field %v must specify exactly one accumulator; found %v", e.Key, e.Value)
+		}
+		if _, supported := accumulators[acc[0].Key]; !supported {
+			return nil, fmt.Errorf("unsupported accumulator %v for $group field %v", acc[0].Key, e.Key)
+		}
+		expr, err := ParseExpression(acc[0].Value)
+		if err != nil {
+			return nil, err
+		}
+		g.fields = append(g.fields, e.Key)
+		g.ops = append(g.ops, acc[0].Key)
+		g.exprs = append(g.exprs, expr)
+	}
+	if g.id == nil {
+		return nil, fmt.Errorf("$group specification %v must include an _id", d)
+	}
+	return g, nil
+}
+
+func parseUnwind(spec any) (Stage, error) {
+	u := &unwindStage{}
+	var path any
+	switch v := spec.(type) {
+	case string:
+		path = v
+	case bson.D:
+		for _, e := range v {
+			switch e.Key {
+			case "path":
+				path = e.Value
+			case "includeArrayIndex":
+				name, isString := e.Value.(string)
+				if !isString || name == "" || strings.HasPrefix(name, "$") {
+					return nil, fmt.Errorf("invalid $unwind includeArrayIndex %v", e.Value)
+				}
+				u.includeArrayIndex = name
+			case "preserveNullAndEmptyArrays":
+				preserve, isBool := e.Value.(bool)
+				if !isBool {
+					return nil, fmt.Errorf("invalid $unwind preserveNullAndEmptyArrays %v", e.Value)
+				}
+				u.preserveNullAndEmptyArrays = preserve
+			default:
+				return nil, fmt.Errorf("unsupported $unwind option %v", e.Key)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("$unwind expects a field path or a bson.D specification; found %v", spec)
+	}
+	s, isString := path.(string)
+	if !isString || len(s) < 2 || !strings.HasPrefix(s, "$") {
+		return nil, fmt.Errorf("$unwind expects a field path prefixed with $; found %v", path)
+	}
+	u.path = strings.Split(s[1:], ".")
+	return u, nil
+}
+
+func parseLookup(spec any) (Stage, error) {
+	d, isD := spec.(bson.D)
+	if !isD {
+		return nil, fmt.Errorf("$lookup expects a bson.D specification; found %v", spec)
+	}
+	l := &lookupStage{}
+	var localField, foreignField string
+	for _, e := range d {
+		value, isString := e.Value.(string)
+		if !isString {
+			return nil, fmt.Errorf("$lookup %v must be a string; found %v", e.Key, e.Value)
+		}
+		switch e.Key {
+		case "from":
+			l.from = value
+		case "localField":
+			localField = value
+		case "foreignField":
+			foreignField = value
+		case "as":
+			l.as = value
+		default:
+			return nil, fmt.Errorf("unsupported $lookup option %v", e.Key)
+		}
+	}
+	if l.from == "" || localField == "" || foreignField == "" || l.as == "" {
+		return nil, fmt.Errorf("$lookup requires from, localField, foreignField and as; found %v", d)
+	}
+	l.localField = strings.Split(localField, ".")
+	l.foreignField = strings.Split(foreignField, ".")
+	return l, nil
+}
+
+// Applies each stage of the pipeline in turn.  Does not modify items.
+func (p *Pipeline) Apply(items []bson.D, collections Collections) ([]bson.D, error) {
+	var err error
+	for _, stage := range p.stages {
+		items, err = stage.Apply(items, collections)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+func (p *Pipeline) String() string {
+	var strs []string
+	for _, stage := range p.stages {
+		strs = append(strs, stage.String())
+	}
+	return strings.Join(strs, " | ")
+}
+
+func (s *matchStage) Apply(items []bson.D, collections Collections) ([]bson.D, error) {
+	var results []bson.D
+	for _, item := range items {
+		if s.filter.Apply(item) {
+			results = append(results, item)
+		}
+	}
+	return results, nil
+}
+
+func (s *projectStage) Apply(items []bson.D, collections Collections) ([]bson.D, error) {
+	results := make([]bson.D, 0, len(items))
+	for _, item := range items {
+		results = append(results, s.projection.apply(item))
+	}
+	return results, nil
+}
+
+func (s *groupStage) Apply(items []bson.D, collections Collections) ([]bson.D, error) {
+	type group struct {
+		id   any
+		accs []accumulator
+	}
+	var groups []*group
+	for _, item := range items {
+		id, _ := s.id.Evaluate(item)
+		var g *group
+		for _, existing := range groups {
+			if Compare(id, existing.id) == 0 {
+				g = existing
+				break
+			}
+		}
+		if g == nil {
+			g = &group{id: id}
+			for _, op := range s.ops {
+				g.accs = append(g.accs, accumulators[op]())
+			}
+			groups = append(groups, g)
+		}
+		for i, expr := range s.exprs {
+			g.accs[i].add(expr.Evaluate(item))
+		}
+	}
+
+	results := make([]bson.D, 0, len(groups))
+	for _, g := range groups {
+		d := bson.D{{Key: "_id", Value: g.id}}
+		for i, acc := range g.accs {
+			d = append(d, bson.E{Key: s.fields[i], Value: acc.result()})
+		}
+		results = append(results, d)
+	}
+	return results, nil
+}
+
+func (s *sortStage) Apply(items []bson.D, collections Collections) ([]bson.D, error) {
+	results := append([]bson.D(nil), items...)
+	s.sort.Apply(results)
+	return results, nil
+}
+
+func (s *limitStage) Apply(items []bson.D, collections Collections) ([]bson.D, error) {
+	if s.n < int64(len(items)) {
+		return items[:s.n], nil
+	}
+	return items, nil
+}
+
+func (s *skipStage) Apply(items []bson.D, collections Collections) ([]bson.D, error) {
+	if s.n >= int64(len(items)) {
+		return nil, nil
+	}
+	return items[s.n:], nil
+}
+
+func (s *unwindStage) Apply(items []bson.D, collections Collections) ([]bson.D, error) {
+	var results []bson.D
+	for _, item := range items {
+		value, exists := getPath(item, s.path)
+		a, isA := value.(bson.A)
+		switch {
+		case isA && len(a) > 0:
+			for i, elem := range a {
+				unwound := setPath(item, s.path, elem)
+				if s.includeArrayIndex != "" {
+					unwound = setPath(unwound, []string{s.includeArrayIndex}, int64(i))
+				}
+				results = append(results, unwound)
+			}
+		case !exists || value == nil || isA:
+			// Missing, null and empty arrays produce no output unless preserved
+			if s.preserveNullAndEmptyArrays {
+				if s.includeArrayIndex != "" {
+					item = setPath(item, []string{s.includeArrayIndex}, nil)
+				}
+				results = append(results, item)
+			}
+		default:
+			// A non-array value is treated as a single element array
+			if s.includeArrayIndex != "" {
+				item = setPath(item, []string{s.includeArrayIndex}, nil)
+			}
+			results = append(results, item)
+		}
+	}
+	return results, nil
+}
+
+func (s *lookupStage) Apply(items []bson.D, collections Collections) ([]bson.D, error) {
+	foreign := collections(s.from)
+	results := make([]bson.D, 0, len(items))
+	for _, item := range items {
+		local := lookupValues(item, s.localField, nil)
+		matches := bson.A{}
+		for _, f := range foreign {
+			if anyEqual(local, lookupValues(f, s.foreignField, nil)) {
+				matches = append(matches, f)
+			}
+		}
+		results = append(results, setPath(item, strings.Split(s.as, "."), matches))
+	}
+	return results, nil
+}
+
+func anyEqual(as, bs []any) bool {
+	for _, a := range as {
+		for _, b := range bs {
+			if Compare(a, b) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns a copy of doc with the field at path set to value, creating documents as needed.
+// Documents along the path are copied rather than modified.
+func setPath(doc bson.D, path []string, value any) bson.D {
+	result := make(bson.D, 0, len(doc)+1)
+	found := false
+	for _, e := range doc {
+		if e.Key == path[0] {
+			found = true
+			if len(path) == 1 {
+				e.Value = value
+			} else {
+				sub, _ := e.Value.(bson.D)
+				e.Value = setPath(sub, path[1:], value)
+			}
+		}
+		result = append(result, e)
+	}
+	if !found {
+		if len(path) == 1 {
+			result = append(result, bson.E{Key: path[0], Value: value})
+		} else {
+			result = append(result, bson.E{Key: path[0], Value: setPath(nil, path[1:], value)})
+		}
+	}
+	return result
+}
+
+func (s *matchStage) String() string {
+	return fmt.Sprintf("$match(%v)", s.filter)
+}
+
+func (s *projectStage) String() string {
+	return fmt.Sprintf("$project(%v)", s.projection)
+}
+
+func (s *groupStage) String() string {
+	strs := []string{fmt.Sprintf("_id: %v", s.id)}
+	for i := range s.fields {
+		strs = append(strs, fmt.Sprintf("%v: %v(%v)", s.fields[i], s.ops[i], s.exprs[i]))
+	}
+	return fmt.Sprintf("$group(%v)", strings.Join(strs, ", "))
+}
+
+func (s *sortStage) String() string {
+	return fmt.Sprintf("$%v", s.sort)
+}
+
+func (s *limitStage) String() string {
+	return fmt.Sprintf("$limit(%v)", s.n)
+}
+
+func (s *skipStage) String() string {
+	return fmt.Sprintf("$skip(%v)", s.n)
+}
+
+func (s *unwindStage) String() string {
+	return fmt.Sprintf("$unwind($%v)", strings.Join(s.path, "."))
+}
+
+func (s *lookupStage) String() string {
+	return fmt.Sprintf("$lookup(%v.%v = %v as %v)", s.from, strings.Join(s.foreignField, "."), strings.Join(s.localField, "."), s.as)
+}
+
+/*
+Projections for the $project stage
+
+https://www.mongodb.com/docs/manual/reference/operator/aggregation/project/
+*/
+
+// A projection either includes fields, or excludes fields.  Inclusion projections can also
+// add computed fields.  _id is included unless it is explicitly excluded.
+type projection struct {
+	exclude   bool
+	excludeID bool
+	root      *projectionNode
+}
+
+// Projects the fields of a document.  A field is either included, excluded, computed,
+// or has a nested projection of its own fields.
+type projectionNode struct {
+	names  []string
+	fields map[string]*projectionNode
+	expr   Expression
+}
+
+func parseProjection(spec bson.D) (*projection, error) {
+	p := &projection{root: &projectionNode{fields: make(map[string]*projectionNode)}}
+	includes, excludes := 0, 0
+	var parse func(node *projectionNode, spec bson.D, prefix string) error
+	parse = func(node *projectionNode, spec bson.D, prefix string) error {
+		for _, e := range spec {
+			if e.Key == "" || strings.HasPrefix(e.Key, "$") {
+				return fmt.Errorf("invalid $project field %q", prefix+e.Key)
+			}
+			// Dotted keys are equivalent to nested projections
+			path := strings.Split(e.Key, ".")
+			parent := node
+			for _, name := range path[:len(path)-1] {
+				parent = parent.child(name)
+			}
+			name := path[len(path)-1]
+			if prefix == "" && e.Key == "_id" {
+				if include, isBool := projectionFlag(e.Value); isBool && !include {
+					p.excludeID = true
+					continue
+				}
+			}
+
+			if include, isFlag := projectionFlag(e.Value); isFlag {
+				if include {
+					includes++
+					parent.child(name)
+				} else {
+					excludes++
+					parent.child(name).expr = nil
+					parent.fields[name].fields = nil
+				}
+				continue
+			}
+			if d, isD := e.Value.(bson.D); isD && (len(d) == 0 || !strings.HasPrefix(d[0].Key, "$")) {
+				if len(d) == 0 {
+					return fmt.Errorf("$project field %v has an empty specification", prefix+e.Key)
+				}
+				if err := parse(parent.child(name), d, prefix+e.Key+"."); err != nil {
+					return err
+				}
+				continue
+			}
+			expr, err := ParseExpression(e.Value)
+			if err != nil {
+				return err
+			}
+			includes++
+			parent.child(name).expr = expr
+		}
+		return nil
+	}
+	if err := parse(p.root, spec, ""); err != nil {
+		return nil, err
+	}
+	if includes > 0 && excludes > 0 {
+		return nil, fmt.Errorf("$project %v cannot mix inclusion and exclusion of fields other than _id", spec)
+	}
+	p.exclude = includes == 0
+	return p, nil
+}
+
+// Returns whether v is an inclusion or exclusion flag, i.e. a boolean or a number
+func projectionFlag(v any) (include bool, isFlag bool) {
+	if b, isBool := v.(bool); isBool {
+		return b, true
+	}
+	if f, isNumber := floatValue(v); isNumber {
+		return f != 0, true
+	}
+	return false, false
+}
+
+func (n *projectionNode) child(name string) *projectionNode {
+	if n.fields == nil {
+		n.fields = make(map[string]*projectionNode)
+	}
+	child, exists := n.fields[name]
+	if !exists {
+		child = &projectionNode{}
+		n.fields[name] = child
+		n.names = append(n.names, name)
+	}
+	return child
+}
+
+func (p *projection) apply(doc bson.D) bson.D {
+	var result bson.D
+	if p.exclude {
+		result = p.root.exclude(doc)
+	} else {
+		result = p.root.include(doc, doc)
+		// _id is included by default, and is the first field
+		if !p.excludeID {
+			if _, projected := p.root.fields["_id"]; !projected {
+				for _, e := range doc {
+					if e.Key == "_id" {
+						result = append(bson.D{e}, result...)
+						break
+					}
+				}
+			}
+		}
+	}
+	if p.excludeID {
+		for i, e := range result {
+			if e.Key == "_id" {
+				result = append(result[:i:i], result[i+1:]...)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// Returns the included fields of doc, followed by any computed fields that are not in doc
+func (n *projectionNode) include(doc bson.D, root bson.D) bson.D {
+	result := bson.D{}
+	seen := make(map[string]bool)
+	for _, e := range doc {
+		child, projected := n.fields[e.Key]
+		if !projected {
+			continue
+		}
+		seen[e.Key] = true
+		switch {
+		case child.expr != nil:
+			if value, exists := child.expr.Evaluate(root); exists {
+				result = append(result, bson.E{Key: e.Key, Value: value})
+			}
+		case len(child.fields) > 0:
+			if value, include := child.includeValue(e.Value, root); include {
+				result = append(result, bson.E{Key: e.Key, Value: value})
+			}
+		default:
+			result = append(result, e)
+		}
+	}
+	for _, name := range n.names {
+		child := n.fields[name]
+		if seen[name] {
+			continue
+		}
+		if child.expr != nil {
+			if value, exists := child.expr.Evaluate(root); exists {
+				result = append(result, bson.E{Key: name, Value: value})
+			}
+		} else if child.hasComputedFields() {
+			result = append(result, bson.E{Key: name, Value: child.include(bson.D{}, root)})
+		}
+	}
+	return result
+}
+
+func (n *projectionNode) includeValue(value any, root bson.D) (any, bool) {
+	switch v := value.(type) {
+	case bson.D:
+		return n.include(v, root), true
+	case bson.A:
+		a := bson.A{}
+		for _, elem := range v {
+			if projected, include := n.includeValue(elem, root); include {
+				a = append(a, projected)
+			}
+		}
+		return a, true
+	}
+	return nil, n.hasComputedFields()
+}
+
+func (n *projectionNode) hasComputedFields() bool {
+	for _, child := range n.fields {
+		if child.expr != nil || child.hasComputedFields() {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the fields of doc that are not excluded
+func (n *projectionNode) exclude(doc bson.D) bson.D {
+	result := bson.D{}
+	for _, e := range doc {
+		child, projected := n.fields[e.Key]
+		if !projected {
+			result = append(result, e)
+		} else if len(child.fields) > 0 {
+			result = append(result, bson.E{Key: e.Key, Value: child.excludeValue(e.Value)})
+		}
+	}
+	return result
+}
+
+func (n *projectionNode) excludeValue(value any) any {
+	switch v := value.(type) {
+	case bson.D:
+		return n.exclude(v)
+	case bson.A:
+		a := bson.A{}
+		for _, elem := range v {
+			a = append(a, n.excludeValue(elem))
+		}
+		return a
+	}
+	return value
+}
+
+func (p *projection) String() string {
+	var strs []string
+	var describe func(n *projectionNode, prefix string)
+	describe = func(n *projectionNode, prefix string) {
+		for _, name := range n.names {
+			child := n.fields[name]
+			switch {
+			case child.expr != nil:
+				strs = append(strs, fmt.Sprintf("%v%v: %v", prefix, name, child.expr))
+			case len(child.fields) > 0:
+				describe(child, prefix+name+".")
+			case p.exclude:
+				strs = append(strs, fmt.Sprintf("%v%v: 0", prefix, name))
+			default:
+				strs = append(strs, fmt.Sprintf("%v%v: 1", prefix, name))
+			}
+		}
+	}
+	describe(p.root, "")
+	if p.excludeID {
+		strs = append(strs, "_id: 0")
+	}
+	return strings.Join(strs, ", ")
+}
@@ -0,0 +1,617 @@
+package query
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+Aggregation expressions and accumulators
+
+https://www.mongodb.com/docs/manual/meta/aggregation-quick-reference/#expressions
+*/
+
+// An aggregation expression, evaluated against a document.
+type Expression interface {
+	// Evaluates the expression against doc.  Returns false if the expression
+	// evaluates to a missing value, e.g. a path to a field that does not exist.
+	Evaluate(doc bson.D) (any, bool)
+	String() string
+}
+
+type (
+	literal struct {
+		value any
+	}
+
+	fieldPath struct {
+		path []string
+	}
+
+	rootVariable struct{}
+
+	documentExpr struct {
+		fields []string
+		exprs  []Expression
+	}
+
+	arrayExpr struct {
+		exprs []Expression
+	}
+
+	operatorExpr struct {
+		operator string
+		args     []Expression
+		eval     func(args []any) any
+	}
+
+	// The value of an operator argument that evaluates to a missing value
+	missingValue struct{}
+)
+
+type expressionOperator struct {
+	minArgs int
+	maxArgs int // -1 if unbounded
+	eval    func(args []any) any
+}
+
+var expressionOperators = map[string]expressionOperator{
+	"$add":      {0, -1, evalAdd},
+	"$subtract": {2, 2, evalSubtract},
+	"$multiply": {0, -1, evalMultiply},
+	"$divide":   {2, 2, evalDivide},
+	"$mod":      {2, 2, evalMod},
+	"$abs":      {1, 1, evalAbs},
+	"$eq":       {2, 2, comparison(func(c int) bool { return c == 0 })},
+	"$ne":       {2, 2, comparison(func(c int) bool { return c != 0 })},
+	"$gt":       {2, 2, comparison(func(c int) bool { return c > 0 })},
+	"$gte":      {2, 2, comparison(func(c int) bool { return c >= 0 })},
+	"$lt":       {2, 2, comparison(func(c int) bool { return c < 0 })},
+	"$lte":      {2, 2, comparison(func(c int) bool { return c <= 0 })},
+	"$cmp":      {2, 2, func(args []any) any { return int32(compareArgs(args[0], args[1])) }},
+	"$and":      {0, -1, evalAnd},
+	"$or":       {0, -1, evalOr},
+	"$not":      {1, 1, func(args []any) any { return !truthy(args[0]) }},
+	"$cond":     {3, 3, evalCond},
+}
+
+// Parses an aggregation expression.  Supported expressions are field paths such as "$packaging.kind",
+// the $$ROOT and $$CURRENT variables, { $literal: <value> }, the arithmetic operators $add, $subtract,
+// $multiply, $divide, $mod and $abs, the comparison operators $eq, $ne, $gt, $gte, $lt, $lte and $cmp,
+// the boolean operators $and, $or and $not, $cond, and documents, arrays and literals composed of
+// other expressions.
+//
+// Where MongoDB would fail with an error, e.g. when adding a string to a number or dividing by zero,
+// operators evaluate to null.
+func ParseExpression(expr any) (Expression, error) {
+	switch v := expr.(type) {
+	case string:
+		if strings.HasPrefix(v, "$$") {
+			switch v {
+			case "$$ROOT", "$$CURRENT":
+				return &rootVariable{}, nil
+			}
+			return nil, fmt.Errorf("unsupported variable %v", v)
+		}
+		if strings.HasPrefix(v, "$") {
+			if len(v) == 1 {
+				return nil, fmt.Errorf("invalid field path %q", v)
+			}
+			return &fieldPath{path: strings.Split(v[1:], ".")}, nil
+		}
+		return &literal{value: v}, nil
+	case bson.D:
+		if len(v) > 0 && strings.HasPrefix(v[0].Key, "$") {
+			if len(v) != 1 {
+				return nil, fmt.Errorf("an expression operator must be the only field in %v", v)
+			}
+			switch v[0].Key {
+			case "$literal":
+				value, err := normalize(v[0].Value)
+				return &literal{value: value}, err
+			}
+			if op, isOperator := expressionOperators[v[0].Key]; isOperator {
+				return parseOperatorExpression(v[0].Key, op, v[0].Value)
+			}
+			return nil, fmt.Errorf("unsupported expression operator %v", v[0].Key)
+		}
+		d := &documentExpr{}
+		for _, e := range v {
+			if strings.HasPrefix(e.Key, "$") || strings.Contains(e.Key, ".") {
+				return nil, fmt.Errorf("invalid field name %v in expression %v", e.Key, v)
+			}
+			fieldExpr, err := ParseExpression(e.Value)
+			if err != nil {
+				return nil, err
+			}
+			d.fields = append(d.fields, e.Key)
+			d.exprs = append(d.exprs, fieldExpr)
+		}
+		return d, nil
+	case bson.A:
+		a := &arrayExpr{}
+		for _, e := range v {
+			elemExpr, err := ParseExpression(e)
+			if err != nil {
+				return nil, err
+			}
+			a.exprs = append(a.exprs, elemExpr)
+		}
+		return a, nil
+	case bson.M, bson.E:
+		return nil, fmt.Errorf("expressions must be composed of bson.D, bson.A, or value literals; found %v", v)
+	default:
+		value, err := normalize(v)
+		return &literal{value: value}, err
+	}
+}
+
+// Operator arguments are either an array of expressions, or a single expression.
+// $cond arguments can also be a document with if, then and else fields.
+func parseOperatorExpression(operator string, op expressionOperator, value any) (Expression, error) {
+	args, isA := value.(bson.A)
+	if !isA {
+		args = bson.A{value}
+	}
+	if d, isD := value.(bson.D); isD && operator == "$cond" {
+		args = bson.A{}
+		for _, field := range []string{"if", "then", "else"} {
+			for _, e := range d {
+				if e.Key == field {
+					args = append(args, e.Value)
+				}
+			}
+		}
+		if len(d) != 3 || len(args) != 3 {
+			return nil, fmt.Errorf("$cond requires if, then and else fields; found %v", d)
+		}
+	}
+	if len(args) < op.minArgs || (op.maxArgs >= 0 && len(args) > op.maxArgs) {
+		return nil, fmt.Errorf("wrong number of arguments for %v; found %v", operator, value)
+	}
+	e := &operatorExpr{operator: operator, eval: op.eval}
+	for _, arg := range args {
+		argExpr, err := ParseExpression(arg)
+		if err != nil {
+			return nil, err
+		}
+		e.args = append(e.args, argExpr)
+	}
+	return e, nil
+}
+
+// Converts golang values to the values they have when stored in a document, e.g. int to int32
+func normalize(value any) (any, error) {
+	if value == nil {
+		// An untyped nil can't be marshalled, but it is stored as null, i.e. nil
+		return nil, nil
+	}
+	t, data, err := bson.MarshalValue(value)
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	err = bson.UnmarshalValue(t, data, &v)
+	return v, err
+}
+
+func (e *literal) Evaluate(doc bson.D) (any, bool) {
+	return e.value, true
+}
+
+// Returns the value at path.  If the path traverses an array, the result is an array
+// of the values of the remaining path in each element of the array.
+func (e *fieldPath) Evaluate(doc bson.D) (any, bool) {
+	return getPath(doc, e.path)
+}
+
+func getPath(item any, path []string) (any, bool) {
+	if len(path) == 0 {
+		return item, true
+	}
+	switch v := item.(type) {
+	case bson.D:
+		for _, e := range v {
+			if e.Key == path[0] {
+				return getPath(e.Value, path[1:])
+			}
+		}
+	case bson.A:
+		values := bson.A{}
+		for _, elem := range v {
+			if _, isD := elem.(bson.D); isD {
+				if value, exists := getPath(elem, path); exists {
+					values = append(values, value)
+				}
+			}
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+func (e *rootVariable) Evaluate(doc bson.D) (any, bool) {
+	return doc, true
+}
+
+func (e *documentExpr) Evaluate(doc bson.D) (any, bool) {
+	d := bson.D{}
+	for i, expr := range e.exprs {
+		if value, exists := expr.Evaluate(doc); exists {
+			d = append(d, bson.E{Key: e.fields[i], Value: value})
+		}
+	}
+	return d, true
+}
+
+func (e *arrayExpr) Evaluate(doc bson.D) (any, bool) {
+	a := bson.A{}
+	for _, expr := range e.exprs {
+		value, _ := expr.Evaluate(doc)
+		a = append(a, value)
+	}
+	return a, true
+}
+
+func (e *operatorExpr) Evaluate(doc bson.D) (any, bool) {
+	args := make([]any, len(e.args))
+	for i, arg := range e.args {
+		if value, exists := arg.Evaluate(doc); exists {
+			args[i] = value
+		} else {
+			args[i] = missingValue{}
+		}
+	}
+	result := e.eval(args)
+	if _, isMissing := result.(missingValue); isMissing {
+		return nil, false
+	}
+	return result, true
+}
+
+func (e *literal) String() string {
+	return fmt.Sprintf("%v", e.value)
+}
+
+func (e *fieldPath) String() string {
+	return "$" + strings.Join(e.path, ".")
+}
+
+func (e *rootVariable) String() string {
+	return "$$ROOT"
+}
+
+func (e *documentExpr) String() string {
+	var strs []string
+	for i, expr := range e.exprs {
+		strs = append(strs, fmt.Sprintf("%v: %v", e.fields[i], expr))
+	}
+	return fmt.Sprintf("{%v}", strings.Join(strs, ", "))
+}
+
+func (e *arrayExpr) String() string {
+	var strs []string
+	for _, expr := range e.exprs {
+		strs = append(strs, expr.String())
+	}
+	return fmt.Sprintf("[%v]", strings.Join(strs, ", "))
+}
+
+func (e *operatorExpr) String() string {
+	var strs []string
+	for _, arg := range e.args {
+		strs = append(strs, arg.String())
+	}
+	return fmt.Sprintf("%v(%v)", e.operator, strings.Join(strs, ", "))
+}
+
+// Numeric types in increasing order of precedence; an arithmetic operator returns
+// the type of its highest-precedence argument
+const (
+	kindInt = iota
+	kindLong
+	kindDouble
+)
+
+func numericKind(v any) (int, bool) {
+	switch n := v.(type) {
+	case int8, int16, int32:
+		return kindInt, true
+	case int:
+		if n >= math.MinInt32 && n <= math.MaxInt32 {
+			return kindInt, true
+		}
+		return kindLong, true
+	case int64:
+		return kindLong, true
+	case float32, float64:
+		return kindDouble, true
+	}
+	return 0, false
+}
+
+// Applies an arithmetic operator to two numbers.  An int result that overflows becomes a long,
+// and a long result that overflows becomes a double.  Returns nil if either value is not a number.
+func arithmetic(a, b any, intOp func(x, y int64) (int64, bool), floatOp func(x, y float64) float64) any {
+	aKind, aIsNumber := numericKind(a)
+	bKind, bIsNumber := numericKind(b)
+	if !aIsNumber || !bIsNumber {
+		return nil
+	}
+	if kind := max(aKind, bKind); kind != kindDouble {
+		x, _ := intValue(a)
+		y, _ := intValue(b)
+		if r, ok := intOp(x, y); ok {
+			if kind == kindInt && r >= math.MinInt32 && r <= math.MaxInt32 {
+				return int32(r)
+			}
+			return r
+		}
+	}
+	x, _ := floatValue(a)
+	y, _ := floatValue(b)
+	return floatOp(x, y)
+}
+
+func addInts(x, y int64) (int64, bool) {
+	r := x + y
+	return r, (y >= 0) == (r >= x)
+}
+
+func subtractInts(x, y int64) (int64, bool) {
+	r := x - y
+	return r, (y >= 0) == (r <= x)
+}
+
+func multiplyInts(x, y int64) (int64, bool) {
+	if x == 0 || y == 0 {
+		return 0, true
+	}
+	r := x * y
+	return r, r/y == x && !(x == -1 && y == math.MinInt64) && !(y == -1 && x == math.MinInt64)
+}
+
+func modInts(x, y int64) (int64, bool) {
+	return x % y, true
+}
+
+// Adds numbers, and at most one date to which the sum is added as milliseconds
+func evalAdd(args []any) any {
+	var sum any = int32(0)
+	var date *primitive.DateTime
+	for _, arg := range args {
+		if d, isDate := arg.(primitive.DateTime); isDate && date == nil {
+			date = &d
+		} else if sum = arithmetic(sum, arg, addInts, func(x, y float64) float64 { return x + y }); sum == nil {
+			return nil
+		}
+	}
+	if date != nil {
+		ms, _ := floatValue(sum)
+		return *date + primitive.DateTime(math.Round(ms))
+	}
+	return sum
+}
+
+// Subtracts numbers, a number of milliseconds from a date, or two dates to get the
+// difference in milliseconds
+func evalSubtract(args []any) any {
+	if a, isDate := args[0].(primitive.DateTime); isDate {
+		if b, isDate := args[1].(primitive.DateTime); isDate {
+			return int64(a - b)
+		}
+		if ms, isNumber := floatValue(args[1]); isNumber {
+			return a - primitive.DateTime(math.Round(ms))
+		}
+		return nil
+	}
+	return arithmetic(args[0], args[1], subtractInts, func(x, y float64) float64 { return x - y })
+}
+
+func evalMultiply(args []any) any {
+	var product any = int32(1)
+	for _, arg := range args {
+		if product = arithmetic(product, arg, multiplyInts, func(x, y float64) float64 { return x * y }); product == nil {
+			return nil
+		}
+	}
+	return product
+}
+
+// Division always returns a double
+func evalDivide(args []any) any {
+	_, aIsNumber := numericKind(args[0])
+	_, bIsNumber := numericKind(args[1])
+	x, _ := floatValue(args[0])
+	y, _ := floatValue(args[1])
+	if !aIsNumber || !bIsNumber || y == 0 {
+		return nil
+	}
+	return x / y
+}
+
+func evalMod(args []any) any {
+	if y, isNumber := floatValue(args[1]); !isNumber || y == 0 {
+		return nil
+	}
+	return arithmetic(args[0], args[1], modInts, math.Mod)
+}
+
+func evalAbs(args []any) any {
+	kind, isNumber := numericKind(args[0])
+	if !isNumber {
+		return nil
+	}
+	if kind == kindDouble {
+		f, _ := floatValue(args[0])
+		return math.Abs(f)
+	}
+	if x, _ := intValue(args[0]); x < 0 {
+		return arithmetic(int32(0), args[0], subtractInts, func(x, y float64) float64 { return x - y })
+	}
+	return args[0]
+}
+
+func comparison(test func(c int) bool) func(args []any) any {
+	return func(args []any) any {
+		return test(compareArgs(args[0], args[1]))
+	}
+}
+
+// Compares values in the BSON comparison order; a missing value is less than all other values
+func compareArgs(a, b any) int {
+	_, aMissing := a.(missingValue)
+	_, bMissing := b.(missingValue)
+	if aMissing || bMissing {
+		return cmp.Compare(boolRank(!aMissing), boolRank(!bMissing))
+	}
+	return Compare(a, b)
+}
+
+func evalAnd(args []any) any {
+	for _, arg := range args {
+		if !truthy(arg) {
+			return false
+		}
+	}
+	return true
+}
+
+func evalOr(args []any) any {
+	for _, arg := range args {
+		if truthy(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+func evalCond(args []any) any {
+	if truthy(args[0]) {
+		return args[1]
+	}
+	return args[2]
+}
+
+// Accumulates the values of a group in a $group stage
+type accumulator interface {
+	add(value any, exists bool)
+	result() any
+}
+
+type (
+	// $sum ignores non-numeric values
+	sumAccumulator struct {
+		intSum     int64
+		floatSum   float64
+		isFloat    bool
+		isLong     bool
+		overflowed bool
+	}
+
+	// $avg ignores non-numeric values, and is null if there are none
+	avgAccumulator struct {
+		sum   float64
+		count int
+	}
+
+	// $min and $max ignore null and missing values
+	minMaxAccumulator struct {
+		value any
+		found bool
+		max   bool
+	}
+
+	// $push ignores missing values
+	pushAccumulator struct {
+		values bson.A
+	}
+)
+
+var accumulators = map[string]func() accumulator{
+	"$sum":  func() accumulator { return &sumAccumulator{} },
+	"$avg":  func() accumulator { return &avgAccumulator{} },
+	"$min":  func() accumulator { return &minMaxAccumulator{} },
+	"$max":  func() accumulator { return &minMaxAccumulator{max: true} },
+	"$push": func() accumulator { return &pushAccumulator{values: bson.A{}} },
+}
+
+func (a *sumAccumulator) add(value any, exists bool) {
+	switch v := value.(type) {
+	case int32:
+		a.addInt(int64(v))
+	case int64:
+		a.isLong = true
+		a.addInt(v)
+	default:
+		if f, isFloat := floatValue(value); isFloat {
+			a.isFloat = true
+			a.floatSum += f
+		}
+	}
+}
+
+func (a *sumAccumulator) addInt(v int64) {
+	if (v > 0 && a.intSum > math.MaxInt64-v) || (v < 0 && a.intSum < math.MinInt64-v) {
+		a.overflowed = true
+	}
+	a.intSum += v
+	a.floatSum += float64(v)
+}
+
+func (a *sumAccumulator) result() any {
+	if a.isFloat || a.overflowed {
+		return a.floatSum
+	}
+	if a.isLong || a.intSum > math.MaxInt32 || a.intSum < math.MinInt32 {
+		return a.intSum
+	}
+	return int32(a.intSum)
+}
+
+func (a *avgAccumulator) add(value any, exists bool) {
+	if f, isNumber := floatValue(value); isNumber {
+		a.sum += f
+		a.count++
+	}
+}
+
+func (a *avgAccumulator) result() any {
+	if a.count == 0 {
+		return nil
+	}
+	return a.sum / float64(a.count)
+}
+
+func (a *minMaxAccumulator) add(value any, exists bool) {
+	if !exists || typeRank(value) == rankNull {
+		return
+	}
+	if !a.found {
+		a.value, a.found = value, true
+		return
+	}
+	c := Compare(value, a.value)
+	if (a.max && c > 0) || (!a.max && c < 0) {
+		a.value = value
+	}
+}
+
+func (a *minMaxAccumulator) result() any {
+	return a.value
+}
+
+func (a *pushAccumulator) add(value any, exists bool) {
+	if exists {
+		a.values = append(a.values, value)
+	}
+}
+
+func (a *pushAccumulator) result() any {
+	return a.values
+}
@@ -2,12 +2,15 @@ package query
 
 import (
 	"fmt"
+	"math"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 /*
@@ -79,6 +82,20 @@ type (
 	elemMatch struct {
 		queries []Filter
 	}
+
+	bsonType struct {
+		aliases []string
+		types   map[string]struct{}
+	}
+
+	mod struct {
+		divisor   int64
+		remainder int64
+	}
+
+	expr struct {
+		expr Expression
+	}
 )
 
 const (
@@ -185,6 +202,27 @@ func ElemMatch(queries ...Filter) Filter {
 	return &elemMatch{queries: queries}
 }
 
+// Matches values whose BSON type has one of the given aliases, e.g. "string" or "long".
+// An array matches if "array" is one of the aliases, or if any of its elements match.
+func Type(aliases ...string) Filter {
+	f := &bsonType{aliases: aliases, types: make(map[string]struct{})}
+	for _, alias := range aliases {
+		f.types[alias] = struct{}{}
+	}
+	return f
+}
+
+// Matches numbers whose value modulo divisor equals remainder.  Doubles are truncated
+// towards zero before the modulo is computed.
+func Mod(divisor int64, remainder int64) Filter {
+	return &mod{divisor: divisor, remainder: remainder}
+}
+
+// Matches documents for which the aggregation expression e evaluates to true
+func Expr(e Expression) Filter {
+	return &expr{expr: e}
+}
+
 func (f *selectFilter) Apply(item any) bool {
 	if d, isD := item.(bson.D); isD {
 		for _, e := range d {
@@ -337,6 +375,43 @@ outer:
 	return false
 }
 
+func (f *bsonType) Apply(item any) bool {
+	if a, isA := item.(bson.A); isA {
+		if _, matches := f.types["array"]; matches {
+			return true
+		}
+		for _, e := range a {
+			if _, matches := f.types[typeAlias(e)]; matches {
+				return true
+			}
+		}
+		return false
+	}
+	_, matches := f.types[typeAlias(item)]
+	return matches
+}
+
+func (f *mod) Apply(item any) bool {
+	v, isInt := intValue(item)
+	if !isInt {
+		fv, isFloat := floatValue(item)
+		if !isFloat || math.IsNaN(fv) || math.IsInf(fv, 0) {
+			return false
+		}
+		v = int64(fv)
+	}
+	return v%f.divisor == f.remainder
+}
+
+func (f *expr) Apply(item any) bool {
+	d, isD := item.(bson.D)
+	if !isD {
+		return false
+	}
+	value, exists := f.expr.Evaluate(d)
+	return exists && truthy(value)
+}
+
 func (f *selectFilter) String() string {
 	return fmt.Sprintf(".%v %v", f.fieldName, f.next.String())
 }
@@ -426,6 +501,88 @@ func (f *elemMatch) String() string {
 	return fmt.Sprintf("elemMatch(%v)", strings.Join(queryStrings, ", "))
 }
 
+func (f *bsonType) String() string {
+	return fmt.Sprintf("type(%v)", strings.Join(f.aliases, ", "))
+}
+
+func (f *mod) String() string {
+	return fmt.Sprintf("mod %v = %v", f.divisor, f.remainder)
+}
+
+func (f *expr) String() string {
+	return fmt.Sprintf("expr(%v)", f.expr)
+}
+
+// Returns the alias of the BSON type of item, as used by $type, e.g. "string" or "long"
+func typeAlias(item any) string {
+	switch v := item.(type) {
+	case float32, float64:
+		return "double"
+	case string:
+		return "string"
+	case bson.D, bson.M:
+		return "object"
+	case bson.A:
+		return "array"
+	case primitive.Binary, []byte:
+		return "binData"
+	case primitive.Undefined:
+		return "undefined"
+	case primitive.ObjectID:
+		return "objectId"
+	case bool:
+		return "bool"
+	case primitive.DateTime, time.Time:
+		return "date"
+	case nil, primitive.Null:
+		return "null"
+	case primitive.Regex:
+		return "regex"
+	case primitive.DBPointer:
+		return "dbPointer"
+	case primitive.JavaScript:
+		return "javascript"
+	case primitive.Symbol:
+		return "symbol"
+	case primitive.CodeWithScope:
+		return "javascriptWithScope"
+	case int8, int16, int32:
+		return "int"
+	case int:
+		if v >= math.MinInt32 && v <= math.MaxInt32 {
+			return "int"
+		}
+		return "long"
+	case primitive.Timestamp:
+		return "timestamp"
+	case int64:
+		return "long"
+	case primitive.Decimal128:
+		return "decimal"
+	case primitive.MinKey:
+		return "minKey"
+	case primitive.MaxKey:
+		return "maxKey"
+	default:
+		return ""
+	}
+}
+
+// Returns whether a value is considered true by aggregation expressions.  null, undefined,
+// missing values, false and zero are false; all other values are true.
+func truthy(item any) bool {
+	switch v := item.(type) {
+	case nil, primitive.Null, primitive.Undefined, missingValue:
+		return false
+	case bool:
+		return v
+	}
+	if f, isNumber := floatValue(item); isNumber {
+		return f != 0
+	}
+	return true
+}
+
 func intValue(item any) (int64, bool) {
 	switch v := item.(type) {
 	case int:
@@ -0,0 +1,462 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+Secondary indexes and query planning
+
+https://www.mongodb.com/docs/manual/indexes/
+*/
+
+// An index over one or more fields of the documents of a collection.
+//
+// Documents are identified by pointer, and a document must not be modified while it is in
+// an index; to modify a document, remove it from the index, modify it, then insert it again.
+//
+// As in MongoDB, if an indexed field is an array then each element of the array is indexed,
+// and a document that is missing an indexed field is indexed as null.
+type SecondaryIndex struct {
+	name    string
+	spec    bson.D // The keys the index was created with
+	keys    []sortKey
+	unique  bool
+	entries []indexEntry // Ordered by key, then by insertion order
+}
+
+type indexEntry struct {
+	key []any
+	doc *bson.D
+}
+
+// Creates an empty index over the fields in keys, e.g. bson.D{{"type", 1}, {"rating", -1}}.
+// If name is empty, a name is derived from keys in the same way as MongoDB, e.g. "type_1_rating_-1".
+// A unique index rejects documents whose indexed fields are equal to those of another document.
+func NewSecondaryIndex(name string, keys bson.D, unique bool) (*SecondaryIndex, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("an index requires at least one key")
+	}
+	s, err := ParseSort(keys)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = IndexName(keys)
+	}
+	return &SecondaryIndex{name: name, spec: keys, keys: s.keys, unique: unique}, nil
+}
+
+// Returns the default name of an index over keys, e.g. "type_1_rating_-1"
+func IndexName(keys bson.D) string {
+	var parts []string
+	for _, e := range keys {
+		parts = append(parts, fmt.Sprintf("%v_%v", e.Key, e.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+func (ix *SecondaryIndex) Name() string {
+	return ix.name
+}
+
+// Returns the keys the index was created with, e.g. bson.D{{"type", 1}, {"rating", -1}}
+func (ix *SecondaryIndex) Keys() bson.D {
+	return ix.spec
+}
+
+// Returns whether ix indexes the same fields in the same directions as keys
+func (ix *SecondaryIndex) HasKeys(keys bson.D) bool {
+	s, err := ParseSort(keys)
+	return err == nil && reflect.DeepEqual(s.keys, ix.keys)
+}
+
+func (ix *SecondaryIndex) Unique() bool {
+	return ix.unique
+}
+
+// Returns the number of entries in the index.  A document has one entry for each element
+// of an indexed array field.
+func (ix *SecondaryIndex) Len() int {
+	return len(ix.entries)
+}
+
+// Adds doc to the index.  Returns an error wrapping [backend.ErrDuplicateKey] if the index is unique
+// and another document in the index has the same key, in which case doc is not added.
+func (ix *SecondaryIndex) Insert(doc *bson.D) error {
+	keys, err := ix.keysOf(*doc)
+	if err != nil {
+		return err
+	}
+	if ix.unique {
+		for _, key := range keys {
+			i, j := ix.equalRange(key)
+			for ; i < j; i++ {
+				if ix.entries[i].doc != doc {
+					return fmt.Errorf("%w: collection index %v dup key %v", backend.ErrDuplicateKey, ix.name, ix.describeKey(key))
+				}
+			}
+		}
+	}
+	for _, key := range keys {
+		_, j := ix.equalRange(key)
+		ix.entries = append(ix.entries, indexEntry{})
+		copy(ix.entries[j+1:], ix.entries[j:])
+		ix.entries[j] = indexEntry{key: key, doc: doc}
+	}
+	return nil
+}
+
+// Removes doc from the index.  doc must not have been modified since it was inserted.
+func (ix *SecondaryIndex) Remove(doc *bson.D) {
+	keys, err := ix.keysOf(*doc)
+	if err != nil {
+		return
+	}
+	for _, key := range keys {
+		i, j := ix.equalRange(key)
+		for ; i < j; i++ {
+			if ix.entries[i].doc == doc {
+				ix.entries = append(ix.entries[:i], ix.entries[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Returns the keys that doc is indexed by; one key for each element of an indexed array field
+func (ix *SecondaryIndex) keysOf(doc bson.D) ([][]any, error) {
+	values := make([][]any, len(ix.keys))
+	arrayField := -1
+	for i, k := range ix.keys {
+		for _, v := range lookupValues(doc, k.path, nil) {
+			duplicate := false
+			for _, existing := range values[i] {
+				if Compare(v, existing) == 0 {
+					duplicate = true
+					break
+				}
+			}
+			if !duplicate {
+				values[i] = append(values[i], v)
+			}
+		}
+		if len(values[i]) > 1 {
+			if arrayField >= 0 {
+				return nil, fmt.Errorf("cannot index parallel arrays %v and %v in index %v",
+					strings.Join(ix.keys[arrayField].path, "."), strings.Join(k.path, "."), ix.name)
+			}
+			arrayField = i
+		}
+	}
+
+	keys := [][]any{{}}
+	for i := range ix.keys {
+		var extended [][]any
+		for _, key := range keys {
+			for _, v := range values[i] {
+				extended = append(extended, append(append([]any(nil), key...), v))
+			}
+		}
+		keys = extended
+	}
+	return keys, nil
+}
+
+// Compares the first len(key) fields of an entry's key to key, in index order
+func (ix *SecondaryIndex) compare(entryKey []any, key []any) int {
+	for i := range key {
+		c := Compare(entryKey[i], key[i])
+		if ix.keys[i].descending {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// Returns the range [i, j) of entries whose key starts with key
+func (ix *SecondaryIndex) equalRange(key []any) (int, int) {
+	i := sort.Search(len(ix.entries), func(n int) bool { return ix.compare(ix.entries[n].key, key) >= 0 })
+	j := sort.Search(len(ix.entries), func(n int) bool { return ix.compare(ix.entries[n].key, key) > 0 })
+	return i, j
+}
+
+func (ix *SecondaryIndex) describeKey(key []any) string {
+	var strs []string
+	for i, v := range key {
+		strs = append(strs, fmt.Sprintf("%v: %v", strings.Join(ix.keys[i].path, "."), v))
+	}
+	return fmt.Sprintf("{ %v }", strings.Join(strs, ", "))
+}
+
+func (ix *SecondaryIndex) String() string {
+	if ix.unique {
+		return fmt.Sprintf("%v(unique)", ix.name)
+	}
+	return ix.name
+}
+
+// A plan for finding the documents that might match a filter using an index
+type Plan struct {
+	index  *SecondaryIndex
+	points [][]any     // Values of the equality-matched prefix of the index key; one per combination of $in values
+	bounds *valueRange // An optional range of values for the index field following the prefix
+}
+
+// Bounds on the values of a field.  As in MongoDB, a range only includes values of the same type
+// as its bounds, e.g. { $gt: 5 } does not include strings.
+type valueRange struct {
+	lower, upper                   any
+	hasLower, hasUpper             bool
+	lowerInclusive, upperInclusive bool
+}
+
+// The conditions on one field of a filter that can be answered by an index
+type predicates struct {
+	eq     []any // Non-nil if the field must equal one of these values
+	bounds *valueRange
+}
+
+// Chooses the index that most narrows the documents that might match filter, or returns
+// nil if no index can be used.  The planner uses equality, $eq, $in, $gt, $gte, $lt and $lte
+// conditions on indexed fields, including conditions within a top-level $and.  Other conditions
+// are not used by the planner, so documents found using the plan must still be checked
+// against the filter.
+func PlanQuery(filter bson.D, indexes []*SecondaryIndex) *Plan {
+	preds := make(map[string]*predicates)
+	collectPredicates(filter, preds)
+
+	var best *Plan
+	bestScore := 0
+	for _, ix := range indexes {
+		plan := &Plan{index: ix, points: [][]any{{}}}
+		score := 0
+		for _, k := range ix.keys {
+			p, exists := preds[strings.Join(k.path, ".")]
+			if !exists {
+				break
+			}
+			if p.eq != nil {
+				var points [][]any
+				for _, point := range plan.points {
+					for _, v := range p.eq {
+						points = append(points, append(append([]any(nil), point...), v))
+					}
+				}
+				plan.points = points
+				score += 2
+				continue
+			}
+			plan.bounds = p.bounds
+			score += 1
+			break
+		}
+		if score > bestScore || (score == bestScore && score > 0 && ix.unique && !best.index.unique) {
+			best, bestScore = plan, score
+		}
+	}
+	return best
+}
+
+func collectPredicates(filter bson.D, preds map[string]*predicates) {
+	for _, e := range filter {
+		if e.Key == "$and" {
+			if a, isA := e.Value.(bson.A); isA {
+				for _, clause := range a {
+					if d, isD := clause.(bson.D); isD {
+						collectPredicates(d, preds)
+					}
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(e.Key, "$") {
+			continue
+		}
+
+		get := func() *predicates {
+			p, exists := preds[e.Key]
+			if !exists {
+				p = &predicates{}
+				preds[e.Key] = p
+			}
+			return p
+		}
+		if d, isD := e.Value.(bson.D); isD && len(d) > 0 && strings.HasPrefix(d[0].Key, "$") {
+			for _, op := range d {
+				switch op.Key {
+				case "$eq":
+					if indexable(op.Value) {
+						get().equals([]any{op.Value})
+					}
+				case "$in":
+					v := reflect.ValueOf(op.Value)
+					if v.Kind() != reflect.Slice || v.Len() == 0 {
+						continue
+					}
+					values := make([]any, 0, v.Len())
+					for i := 0; i < v.Len(); i++ {
+						if !indexable(v.Index(i).Interface()) {
+							values = nil
+							break
+						}
+						values = append(values, v.Index(i).Interface())
+					}
+					if values != nil {
+						get().equals(values)
+					}
+				case "$gt", "$gte", "$lt", "$lte":
+					if indexable(op.Value) {
+						get().constrain(op.Key, op.Value)
+					}
+				}
+			}
+		} else if indexable(e.Value) {
+			get().equals([]any{e.Value})
+		}
+	}
+}
+
+// Arrays, documents and regular expressions match in ways that an index lookup does not capture
+func indexable(v any) bool {
+	switch v.(type) {
+	case bson.A, bson.D, bson.M, primitive.Regex:
+		return false
+	}
+	return true
+}
+
+func (p *predicates) equals(values []any) {
+	if p.eq == nil {
+		p.eq = values
+		return
+	}
+	// Intersect with the existing values
+	var intersection []any
+	for _, v := range p.eq {
+		for _, w := range values {
+			if Compare(v, w) == 0 {
+				intersection = append(intersection, v)
+				break
+			}
+		}
+	}
+	if intersection == nil {
+		intersection = []any{}
+	}
+	p.eq = intersection
+}
+
+func (p *predicates) constrain(op string, value any) {
+	if p.bounds == nil {
+		p.bounds = &valueRange{}
+	}
+	r := p.bounds
+	switch op {
+	case "$gt", "$gte":
+		inclusive := op == "$gte"
+		if c := Compare(value, r.lower); !r.hasLower || c > 0 || (c == 0 && !inclusive) {
+			r.lower, r.hasLower, r.lowerInclusive = value, true, inclusive
+		}
+	case "$lt", "$lte":
+		inclusive := op == "$lte"
+		if c := Compare(value, r.upper); !r.hasUpper || c < 0 || (c == 0 && !inclusive) {
+			r.upper, r.hasUpper, r.upperInclusive = value, true, inclusive
+		}
+	}
+}
+
+// Returns -1 if v is below the range, 0 if it is within the range, or 1 if it is above the range
+func (r *valueRange) position(v any) int {
+	rank := typeRank(v)
+	if r.hasLower {
+		if lowerRank := typeRank(r.lower); rank < lowerRank {
+			return -1
+		} else if rank > lowerRank {
+			return 1
+		}
+		if c := Compare(v, r.lower); c < 0 || (c == 0 && !r.lowerInclusive) {
+			return -1
+		}
+	}
+	if r.hasUpper {
+		if upperRank := typeRank(r.upper); rank > upperRank {
+			return 1
+		} else if rank < upperRank {
+			return -1
+		}
+		if c := Compare(v, r.upper); c > 0 || (c == 0 && !r.upperInclusive) {
+			return 1
+		}
+	}
+	return 0
+}
+
+// Returns the documents that might match the filter, in index order and without duplicates
+func (p *Plan) Documents() []*bson.D {
+	var docs []*bson.D
+	seen := make(map[*bson.D]bool)
+	ix := p.index
+	for _, point := range p.points {
+		i, j := ix.equalRange(point)
+		if p.bounds != nil {
+			// Within the entries that match point, the entries within bounds are contiguous
+			field := len(point)
+			descending := ix.keys[field].descending
+			before := func(n int) bool {
+				pos := p.bounds.position(ix.entries[n].key[field])
+				return (!descending && pos < 0) || (descending && pos > 0)
+			}
+			after := func(n int) bool {
+				pos := p.bounds.position(ix.entries[n].key[field])
+				return (!descending && pos > 0) || (descending && pos < 0)
+			}
+			start := i + sort.Search(j-i, func(n int) bool { return !before(i + n) })
+			end := i + sort.Search(j-i, func(n int) bool { return after(i + n) })
+			i, j = start, end
+		}
+		for ; i < j; i++ {
+			if doc := ix.entries[i].doc; !seen[doc] {
+				seen[doc] = true
+				docs = append(docs, doc)
+			}
+		}
+	}
+	return docs
+}
+
+func (p *Plan) String() string {
+	var conditions []string
+	for _, point := range p.points {
+		conditions = append(conditions, p.index.describeKey(point))
+	}
+	s := fmt.Sprintf("IXSCAN %v %v", p.index.name, strings.Join(conditions, " "))
+	if b := p.bounds; b != nil && len(p.points) > 0 {
+		field := strings.Join(p.index.keys[len(p.points[0])].path, ".")
+		if b.hasLower {
+			op := ">"
+			if b.lowerInclusive {
+				op = ">="
+			}
+			s += fmt.Sprintf(" %v %v %v", field, op, b.lower)
+		}
+		if b.hasUpper {
+			op := "<"
+			if b.upperInclusive {
+				op = "<="
+			}
+			s += fmt.Sprintf(" %v %v %v", field, op, b.upper)
+		}
+	}
+	return s
+}
@@ -2,6 +2,7 @@ package query
 
 import (
 	"fmt"
+	"math"
 	"reflect"
 	"strings"
 
@@ -13,7 +14,13 @@ Simple BSON query parser
 */
 
 func ParseFilter(filter bson.D) (Filter, error) {
-	return parseQuery(filter)
+	return parseQuery(filter, nil)
+}
+
+// Parses a filter for a collection with a text index, which is searched by $text queries.
+// If text is nil then $text queries are an error.
+func ParseFilterWithTextIndex(filter bson.D, text *TextIndex) (Filter, error) {
+	return parseQuery(filter, text)
 }
 
 var arrayOperators = map[string]struct{}{}
@@ -24,14 +31,14 @@ func init() {
 	}
 }
 
-func parseQueries(a bson.A) ([]Filter, error) {
+func parseQueries(a bson.A, text *TextIndex) ([]Filter, error) {
 	var filters []Filter
 	for _, v := range a {
 		d, isD := v.(bson.D)
 		if !isD {
 			return nil, fmt.Errorf("invalid query %v; expected a bson.D", v)
 		}
-		filter, err := parseQuery(d)
+		filter, err := parseQuery(d, text)
 		if err != nil {
 			return nil, err
 		}
@@ -40,10 +47,10 @@ func parseQueries(a bson.A) ([]Filter, error) {
 	return filters, nil
 }
 
-func parseQuery(d bson.D) (Filter, error) {
+func parseQuery(d bson.D, text *TextIndex) (Filter, error) {
 	var filters []Filter
 	for _, e := range d {
-		filter, err := parseFilterCondition(e)
+		filter, err := parseFilterCondition(e, text)
 		if err != nil {
 			return nil, err
 		}
@@ -134,13 +141,24 @@ func parseArrayValues(a bson.A) (Filter, error) {
 /*
 A root condition of a filter document
 */
-func parseFilterCondition(e bson.E) (Filter, error) {
+func parseFilterCondition(e bson.E, text *TextIndex) (Filter, error) {
 	/*
-		A root condition of a filter document can contain operators, but only logical operators
+		A root condition of a filter document can contain operators, but only logical operators,
+		$expr and $text
 	*/
-	if f, err := parseLogicalOperator(e); f != nil || err != nil {
+	if f, err := parseLogicalOperator(e, text); f != nil || err != nil {
 		return f, err
 	}
+	switch e.Key {
+	case "$expr":
+		expr, err := ParseExpression(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		return Expr(expr), nil
+	case "$text":
+		return parseTextSearch(e.Value, text)
+	}
 	if strings.HasPrefix(e.Key, "$") {
 		return nil, fmt.Errorf("encountered unexpected condition key %v in %v", e.Key, e)
 	}
@@ -164,19 +182,25 @@ func parseFilterCondition(e bson.E) (Filter, error) {
 				return Lookup(e.Key, Broadcast(filter)), err
 			}
 
-			// Array operators can't mix with regular value operators
-			if filter, err := parseArrayOperators(v); err != nil || filter != nil {
-				return Lookup(e.Key, filter), err
-			}
-
 			// $exists: false is a special case
 			if filter, err := parseExistsOperators(e.Key, v); err != nil || filter != nil {
 				return filter, err
 			}
 
+			// $type and $nin apply to the field as a whole rather than to each array element
+			fieldFilters, v, err := parseFieldOperators(e.Key, v)
+			if err != nil || len(v) == 0 {
+				return And(fieldFilters...), err
+			}
+
+			// Array operators can't mix with regular value operators
+			if filter, err := parseArrayOperators(v); err != nil || filter != nil {
+				return And(append(fieldFilters, Lookup(e.Key, filter))...), err
+			}
+
 			// We have regular value operators
 			filter, err := parseValueOperators(v)
-			return Lookup(e.Key, Broadcast(filter)), err
+			return And(append(fieldFilters, Lookup(e.Key, Broadcast(filter)))...), err
 		}
 	case bson.A:
 		{
@@ -196,7 +220,7 @@ func parseFilterCondition(e bson.E) (Filter, error) {
 /*
 If the element has a logical operator as key, parses it, or returns nil.
 */
-func parseLogicalOperator(e bson.E) (Filter, error) {
+func parseLogicalOperator(e bson.E, text *TextIndex) (Filter, error) {
 	switch e.Key {
 	case "$and":
 		{
@@ -204,7 +228,7 @@ func parseLogicalOperator(e bson.E) (Filter, error) {
 			if !isA {
 				return nil, fmt.Errorf(`invalid query: "$and" key must correspond to a bson.A value: %v`, e)
 			}
-			filters, err := parseQueries(a)
+			filters, err := parseQueries(a, text)
 			return And(filters...), err
 		}
 	case "$not":
@@ -213,7 +237,7 @@ func parseLogicalOperator(e bson.E) (Filter, error) {
 			if !isD {
 				return nil, fmt.Errorf(`invalid query: "$not" key must correspond to a bson.D value: %v`, e)
 			}
-			filter, err := parseQuery(d)
+			filter, err := parseQuery(d, text)
 			return Not(filter), err
 		}
 	case "$or":
@@ -222,7 +246,7 @@ func parseLogicalOperator(e bson.E) (Filter, error) {
 			if !isA {
 				return nil, fmt.Errorf(`invalid query: "$or" key must correspond to a bson.A value: %v`, e)
 			}
-			filters, err := parseQueries(a)
+			filters, err := parseQueries(a, text)
 			return Or(filters...), err
 		}
 	case "$nor":
@@ -231,7 +255,7 @@ func parseLogicalOperator(e bson.E) (Filter, error) {
 			if !isA {
 				return nil, fmt.Errorf(`invalid query: "$nor" key must correspond to a bson.A value: %v`, e)
 			}
-			filters, err := parseQueries(a)
+			filters, err := parseQueries(a, text)
 			return Not(Or(filters...)), err
 		}
 	default:
@@ -291,7 +315,7 @@ func parseArrayOperator(e bson.E) (Filter, error) {
 			if !isD {
 				return nil, fmt.Errorf("$elemMatch must be a bson.D but got %v", e)
 			}
-			filter, err := parseQuery(d)
+			filter, err := parseQuery(d, nil)
 			return Broadcast(filter), err
 		}
 	case "$size":
@@ -318,6 +342,82 @@ func parseExistsOperators(key string, d bson.D) (Filter, error) {
 	return nil, nil
 }
 
+/*
+Parses the $type and $nin operators of the condition on a field, returning filters
+for them and the remaining operators.
+
+$type matches the type of the field, or the type of any of its elements if it is an array.
+$nin matches if the field does not exist, or neither it nor any of its elements are in the
+specified values.
+*/
+func parseFieldOperators(key string, d bson.D) ([]Filter, bson.D, error) {
+	var filters []Filter
+	var remaining bson.D
+	for _, e := range d {
+		switch e.Key {
+		case "$type":
+			filter, err := parseTypeOperator(e.Value)
+			if err != nil {
+				return nil, nil, err
+			}
+			filters = append(filters, Lookup(key, filter))
+		case "$nin":
+			filter, err := parseValueOperator(bson.E{Key: "$in", Value: e.Value})
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid $nin: %w", err)
+			}
+			filters = append(filters, Not(Lookup(key, Broadcast(filter))))
+		default:
+			remaining = append(remaining, e)
+		}
+	}
+	return filters, remaining, nil
+}
+
+var typeCodes = map[int64]string{
+	1: "double", 2: "string", 3: "object", 4: "array", 5: "binData", 6: "undefined", 7: "objectId",
+	8: "bool", 9: "date", 10: "null", 11: "regex", 12: "dbPointer", 13: "javascript", 14: "symbol",
+	15: "javascriptWithScope", 16: "int", 17: "timestamp", 18: "long", 19: "decimal", -1: "minKey",
+	127: "maxKey",
+}
+
+// The value of $type is a type alias or number, or an array of them
+func parseTypeOperator(value any) (Filter, error) {
+	types, isA := value.(bson.A)
+	if !isA {
+		types = bson.A{value}
+	}
+	var aliases []string
+	for _, t := range types {
+		if code, isInt := intValue(t); isInt {
+			alias, exists := typeCodes[code]
+			if !exists {
+				return nil, fmt.Errorf("unknown $type code %v", code)
+			}
+			aliases = append(aliases, alias)
+		} else if alias, isStr := t.(string); isStr {
+			if alias == "number" {
+				aliases = append(aliases, "double", "int", "long", "decimal")
+				continue
+			}
+			found := false
+			for _, known := range typeCodes {
+				found = found || known == alias
+			}
+			if !found {
+				return nil, fmt.Errorf("unknown $type alias %q", alias)
+			}
+			aliases = append(aliases, alias)
+		} else {
+			return nil, fmt.Errorf("$type requires a type alias or number but got %v", t)
+		}
+	}
+	if len(aliases) == 0 {
+		return nil, fmt.Errorf("$type requires at least one type")
+	}
+	return Type(aliases...), nil
+}
+
 /*
 Parses a value that has some operators in it
 */
@@ -367,11 +467,26 @@ func parseValueOperator(e bson.E) (Filter, error) {
 			}
 			return Or(filters...), nil
 		}
-	case "$nin":
+	case "$mod":
 		{
-			return nil, fmt.Errorf("$nin not implemented; use $nor and $in instead")
-			// filter, err := parseValueOperator(bson.E{"$in", e.Value})
-			// return Not(filter), err
+			a, isA := e.Value.(bson.A)
+			if !isA || len(a) != 2 {
+				return nil, fmt.Errorf("$mod requires a bson.A of [divisor, remainder] but got %v", e.Value)
+			}
+			var args [2]int64
+			for i, v := range a {
+				if n, isInt := intValue(v); isInt {
+					args[i] = n
+				} else if f, isFloat := floatValue(v); isFloat && !math.IsNaN(f) && !math.IsInf(f, 0) {
+					args[i] = int64(f)
+				} else {
+					return nil, fmt.Errorf("$mod requires numeric arguments but got %v", e.Value)
+				}
+			}
+			if args[0] == 0 {
+				return nil, fmt.Errorf("$mod divisor cannot be 0")
+			}
+			return Mod(args[0], args[1]), nil
 		}
 	case "$regex":
 		{
@@ -380,14 +495,10 @@ func parseValueOperator(e bson.E) (Filter, error) {
 			}
 			return nil, fmt.Errorf("$regex value must be string but got %v", e.Value)
 		}
-	case "$text":
-		fallthrough
+	case "$text", "$expr":
+		return nil, fmt.Errorf("%v can only be used at the top level of a filter", e.Key)
 	case "$where": // not supported
 		fallthrough
-	case "$type": // not supported
-		fallthrough
-	case "$expr": // not supported
-		fallthrough
 	default:
 		return nil, fmt.Errorf("unsupported operator %v", e)
 	}
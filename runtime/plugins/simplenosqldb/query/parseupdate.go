@@ -3,71 +3,198 @@ package query
 import (
 	"fmt"
 	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Options for parsing an update
+type UpdateOptions struct {
+	// The filter that selected the document being updated, used to resolve the $ positional operator
+	Filter bson.D
+
+	// Filters for the $[<identifier>] positional operator, e.g. bson.D{{"elem.grade", bson.D{{"$gte", 85}}}}
+	// selects the array elements updated by $[elem]
+	ArrayFilters []bson.D
+
+	// Whether the update is applied to a newly upserted document.  $setOnInsert is ignored otherwise.
+	Insert bool
+}
+
+type updateParser struct {
+	query        bson.D
+	arrayFilters map[string]Filter
+	used         map[string]bool
+}
+
+// The field identifier of array elements matched by the $ positional operator
+const positionalElement = "element"
+
+var identifierPattern = regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`)
+
 func ParseUpdate(update bson.D) (Update, error) {
+	return ParseUpdateWithOptions(update, UpdateOptions{})
+}
+
+// Parses an update that may use the positional operators $, $[] and $[<identifier>], or $setOnInsert
+func ParseUpdateWithOptions(update bson.D, opts UpdateOptions) (Update, error) {
+	p := &updateParser{query: opts.Filter, arrayFilters: make(map[string]Filter), used: make(map[string]bool)}
+	for _, d := range opts.ArrayFilters {
+		identifier, filter, err := parseArrayFilter(d)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := p.arrayFilters[identifier]; exists {
+			return nil, fmt.Errorf("found multiple array filters with the same top-level field name %v", identifier)
+		}
+		p.arrayFilters[identifier] = filter
+	}
+
 	var updates []Update
 	for _, op := range update {
+		var opUpdates []Update
+		var err error
 		switch op.Key {
 		case "$set":
-			{
-				sets, err := parseSet(op.Value)
-				if err != nil {
-					return nil, err
-				}
-				updates = append(updates, sets...)
+			opUpdates, err = p.parseSet(op.Value)
+		case "$setOnInsert":
+			opUpdates, err = p.parseSet(op.Value)
+			if !opts.Insert {
+				opUpdates = nil
 			}
 		case "$unset":
-			{
-				unsets, err := parseUnset(op.Value)
-				if err != nil {
-					return nil, err
-				}
-				updates = append(updates, unsets...)
-			}
+			opUpdates, err = p.parseUnset(op.Value)
 		case "$inc":
-			{
-				incs, err := parseInc(op.Value)
-				if err != nil {
-					return nil, err
-				}
-				updates = append(updates, incs...)
-			}
+			opUpdates, err = p.parseInc(op.Value)
+		case "$mul":
+			opUpdates, err = p.parseMul(op.Value)
+		case "$min", "$max":
+			opUpdates, err = p.parseMinMax(op.Key, op.Value)
+		case "$rename":
+			opUpdates, err = parseRename(op.Value)
+		case "$currentDate":
+			opUpdates, err = p.parseCurrentDate(op.Value)
 		case "$push":
-			{
-				pushes, err := parsePush(op.Value)
-				if err != nil {
-					return nil, err
-				}
-				updates = append(updates, pushes...)
-			}
+			opUpdates, err = p.parsePush(op.Value)
+		case "$pop":
+			opUpdates, err = p.parsePop(op.Value)
 		case "$pull":
-			{
-				pulls, err := parsePull(op.Value)
-				if err != nil {
-					return nil, err
-				}
-				updates = append(updates, pulls...)
-			}
+			opUpdates, err = p.parsePull(op.Value)
 		case "$addToSet":
-			{
-				adds, err := parseAddToSet(op.Value)
-				if err != nil {
-					return nil, err
-				}
-				updates = append(updates, adds...)
-			}
+			opUpdates, err = p.parseAddToSet(op.Value)
 		default:
 			return nil, fmt.Errorf("unsupported update op %v", op.Key)
 		}
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, opUpdates...)
+	}
+
+	for identifier := range p.arrayFilters {
+		if !p.used[identifier] {
+			return nil, fmt.Errorf("the array filter for identifier %v was not used in the update %v", identifier, update)
+		}
 	}
 	return UpdateAll(updates), nil
 }
 
-func parseSet(args any) ([]Update, error) {
+// An array filter is a query whose fields all begin with the same identifier, e.g.
+// bson.D{{"elem.grade", bson.D{{"$gte", 85}}}, {"elem.std", bson.D{{"$lt", 5}}}}
+func parseArrayFilter(d bson.D) (string, Filter, error) {
+	identifier := ""
+	for _, e := range d {
+		fieldIdentifier, _, _ := strings.Cut(e.Key, ".")
+		if identifier != "" && fieldIdentifier != identifier {
+			return "", nil, fmt.Errorf("an array filter must use a single top-level field name; found %v", d)
+		}
+		identifier = fieldIdentifier
+	}
+	if !identifierPattern.MatchString(identifier) {
+		return "", nil, fmt.Errorf("invalid array filter identifier %q in %v; must begin with a lowercase letter and contain only letters and digits", identifier, d)
+	}
+	filter, err := parseQuery(d, nil)
+	return identifier, filter, err
+}
+
+/*
+Builds an update of the field at selector, e.g. "grades.$[elem].std".  Missing fields are
+created if createIfAbsent is true.
+
+Fields of selector can be array indexes, or the positional operators $, $[] and $[<identifier>].
+*/
+func (p *updateParser) path(selector string, update Update, createIfAbsent bool) (Update, error) {
+	splits := strings.Split(selector, ".")
+	if strings.HasPrefix(splits[0], "$") {
+		return nil, fmt.Errorf("invalid update path %v; cannot begin with an operator", selector)
+	}
+	for i := len(splits) - 1; i >= 0; i-- {
+		field := splits[i]
+		if j, err := strconv.Atoi(field); err == nil {
+			update = UpdateIndex(j, update, createIfAbsent)
+		} else if field == "$" {
+			filter, err := p.positionalFilter(strings.Join(splits[:i], "."))
+			if err != nil {
+				return nil, err
+			}
+			update = UpdateFirstMatch(positionalElement, filter, update)
+		} else if field == "$[]" {
+			update = UpdateAllElements(update)
+		} else if strings.HasPrefix(field, "$[") && strings.HasSuffix(field, "]") {
+			identifier := field[2 : len(field)-1]
+			filter, exists := p.arrayFilters[identifier]
+			if !exists {
+				return nil, fmt.Errorf("no array filter found for identifier %v in path %v", identifier, selector)
+			}
+			p.used[identifier] = true
+			update = UpdateMatchingElements(identifier, filter, update)
+		} else if field == "" || strings.HasPrefix(field, "$") {
+			return nil, fmt.Errorf("invalid field %q in update path %v", field, selector)
+		} else {
+			update = UpdateField(field, update, createIfAbsent)
+			if i != 0 {
+				update = BroadcastUpdate(update) // broadcast in case the field is an array type
+			}
+		}
+	}
+	return update, nil
+}
+
+// Returns a filter that matches the elements of the array at path that were matched by the
+// query, as required by the $ positional operator.  The filter is built from the query's
+// conditions on path and its subfields.
+func (p *updateParser) positionalFilter(path string) (Filter, error) {
+	var conditions bson.D
+	var collect func(d bson.D)
+	collect = func(d bson.D) {
+		for _, e := range d {
+			if e.Key == "$and" {
+				if a, isA := e.Value.(bson.A); isA {
+					for _, q := range a {
+						if qd, isD := q.(bson.D); isD {
+							collect(qd)
+						}
+					}
+				}
+			} else if e.Key == path {
+				conditions = append(conditions, bson.E{Key: positionalElement, Value: e.Value})
+			} else if strings.HasPrefix(e.Key, path+".") {
+				conditions = append(conditions, bson.E{Key: positionalElement + e.Key[len(path):], Value: e.Value})
+			}
+		}
+	}
+	collect(p.query)
+	if len(conditions) == 0 {
+		return nil, fmt.Errorf("the positional operator did not find the match needed from the query; the query must include a condition on %v", path)
+	}
+	return parseQuery(conditions, nil)
+}
+
+func (p *updateParser) parseSet(args any) ([]Update, error) {
 	d, isD := args.(bson.D)
 	if !isD {
 		return nil, fmt.Errorf("invalid $set operator; expected a bson.D, got %v", args)
@@ -78,41 +205,69 @@ func parseSet(args any) ([]Update, error) {
 		if err != nil {
 			return nil, err
 		}
-		updates = append(updates, UpdatePath(e.Key, update))
+		update, err = p.path(e.Key, update, true)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, update)
 	}
 	return updates, nil
 }
 
-func parseUnset(args any) ([]Update, error) {
+func (p *updateParser) parseUnset(args any) ([]Update, error) {
 	d, isD := args.(bson.D)
 	if !isD {
 		return nil, fmt.Errorf("invalid $unset operator; expected a bson.D, got %v", args)
 	}
 	var updates []Update
 	for _, e := range d {
-		updates = append(updates, UnsetPath(e.Key))
+		// Unsetting an array element sets it to null
+		splits := strings.Split(e.Key, ".")
+		last := splits[len(splits)-1]
+		var update Update
+		var err error
+		if i, err := strconv.Atoi(last); err == nil {
+			update = UnsetElement(i)
+			splits = splits[:len(splits)-1]
+		} else if strings.HasPrefix(last, "$") {
+			update, err = SetValue(nil)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			update = UnsetField(last)
+			splits = splits[:len(splits)-1]
+		}
+		if len(splits) > 0 {
+			update, err = p.path(strings.Join(splits, "."), update, false)
+			if err != nil {
+				return nil, err
+			}
+		}
+		updates = append(updates, update)
 	}
 	return updates, nil
 }
 
-func parseInc(args any) ([]Update, error) {
+func (p *updateParser) parseInc(args any) ([]Update, error) {
 	d, isD := args.(bson.D)
 	if !isD {
 		return nil, fmt.Errorf("invalid $inc operator; expected a bson.D, got %v", args)
 	}
 	var updates []Update
 	for _, e := range d {
+		var update Update
 		switch v := e.Value.(type) {
 		case int:
-			updates = append(updates, UpdatePath(e.Key, IncInt(int64(v))))
+			update = IncInt(int64(v))
 		case int64:
-			updates = append(updates, UpdatePath(e.Key, IncInt(v)))
+			update = IncInt(v)
 		case int32:
-			updates = append(updates, UpdatePath(e.Key, IncInt(int64(v))))
+			update = IncInt(int64(v))
 		case int16:
-			updates = append(updates, UpdatePath(e.Key, IncInt(int64(v))))
+			update = IncInt(int64(v))
 		case int8:
-			updates = append(updates, UpdatePath(e.Key, IncInt(int64(v))))
+			update = IncInt(int64(v))
 		// case float64:
 		// 	updates = append(updates, IncFloat(v))
 		// case float32:
@@ -120,36 +275,218 @@ func parseInc(args any) ([]Update, error) {
 		default:
 			return nil, fmt.Errorf("invalid $inc argument; expect an int, got %v %v", reflect.TypeOf(e.Value), e.Value)
 		}
+		update, err := p.path(e.Key, update, true)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, update)
+	}
+	return updates, nil
+}
+
+func (p *updateParser) parseMul(args any) ([]Update, error) {
+	d, isD := args.(bson.D)
+	if !isD {
+		return nil, fmt.Errorf("invalid $mul operator; expected a bson.D, got %v", args)
+	}
+	var updates []Update
+	for _, e := range d {
+		update, err := Multiply(e.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid $mul argument: %w", err)
+		}
+		update, err = p.path(e.Key, update, true)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, update)
+	}
+	return updates, nil
+}
+
+func (p *updateParser) parseMinMax(op string, args any) ([]Update, error) {
+	d, isD := args.(bson.D)
+	if !isD {
+		return nil, fmt.Errorf("invalid %v operator; expected a bson.D, got %v", op, args)
+	}
+	var updates []Update
+	for _, e := range d {
+		var update Update
+		var err error
+		if op == "$min" {
+			update, err = MinValue(e.Value)
+		} else {
+			update, err = MaxValue(e.Value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		update, err = p.path(e.Key, update, true)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, update)
+	}
+	return updates, nil
+}
+
+func parseRename(args any) ([]Update, error) {
+	d, isD := args.(bson.D)
+	if !isD {
+		return nil, fmt.Errorf("invalid $rename operator; expected a bson.D, got %v", args)
+	}
+	var updates []Update
+	for _, e := range d {
+		to, isStr := e.Value.(string)
+		if !isStr {
+			return nil, fmt.Errorf("invalid $rename argument; expected a string field name, got %v", e.Value)
+		}
+		if strings.Contains(e.Key, "$") || strings.Contains(to, "$") {
+			return nil, fmt.Errorf("$rename does not support positional operators; got %v", e)
+		}
+		if e.Key == to || strings.HasPrefix(to, e.Key+".") || strings.HasPrefix(e.Key, to+".") {
+			return nil, fmt.Errorf("$rename source and destination cannot overlap; got %v", e)
+		}
+		updates = append(updates, Rename(e.Key, to))
+	}
+	return updates, nil
+}
+
+// The value of a $currentDate field is true, or { $type: "date" } or { $type: "timestamp" }
+func (p *updateParser) parseCurrentDate(args any) ([]Update, error) {
+	d, isD := args.(bson.D)
+	if !isD {
+		return nil, fmt.Errorf("invalid $currentDate operator; expected a bson.D, got %v", args)
+	}
+	now := time.Now()
+	var updates []Update
+	for _, e := range d {
+		var value any
+		switch v := e.Value.(type) {
+		case bool:
+			value = primitive.NewDateTimeFromTime(now)
+		case bson.D:
+			if len(v) == 1 && v[0].Key == "$type" && v[0].Value == "date" {
+				value = primitive.NewDateTimeFromTime(now)
+			} else if len(v) == 1 && v[0].Key == "$type" && v[0].Value == "timestamp" {
+				value = primitive.Timestamp{T: uint32(now.Unix()), I: 1}
+			}
+		}
+		if value == nil {
+			return nil, fmt.Errorf("invalid $currentDate argument; expected true or a $type of date or timestamp, got %v", e.Value)
+		}
+		update, err := SetValue(value)
+		if err != nil {
+			return nil, err
+		}
+		update, err = p.path(e.Key, update, true)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, update)
 	}
 	return updates, nil
 }
 
-func parsePush(args any) ([]Update, error) {
+func (p *updateParser) parsePush(args any) ([]Update, error) {
 	d, isD := args.(bson.D)
 	if !isD {
 		return nil, fmt.Errorf("invalid $push operator; expected a bson.D, got %v", args)
 	}
 	var updates []Update
 	for _, e := range d {
-		// Check that the value isn't a bunch of modifiers; not currently implemented
-		if ed, eIsD := e.Value.(bson.D); eIsD {
-			for _, e2 := range ed {
-				if strings.HasPrefix(e2.Key, "$") {
-					return nil, fmt.Errorf("modifiers not currently supported for $push operation; got %v", e2)
+		var update Update
+		var err error
+		if ed, eIsD := e.Value.(bson.D); eIsD && len(ed) > 0 && strings.HasPrefix(ed[0].Key, "$") {
+			update, err = parsePushModifiers(ed)
+		} else {
+			update, err = PushValue(e.Value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		update, err = p.path(e.Key, update, true)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, update)
+	}
+	return updates, nil
+}
+
+// Parses the $each, $position, $sort and $slice modifiers of a $push operation
+func parsePushModifiers(d bson.D) (Update, error) {
+	var values bson.A
+	var position, slice *int
+	var sort *Sort
+	var sortDir int
+	hasEach := false
+	for _, e := range d {
+		switch e.Key {
+		case "$each":
+			v := reflect.ValueOf(e.Value)
+			if v.Kind() != reflect.Slice {
+				return nil, fmt.Errorf("$each requires a bson.A value or a slice, but got %v", e.Value)
+			}
+			for i := 0; i < v.Len(); i++ {
+				values = append(values, v.Index(i).Interface())
+			}
+			hasEach = true
+		case "$position", "$slice":
+			n, isInt := intValue(e.Value)
+			if !isInt {
+				return nil, fmt.Errorf("%v requires an integer value but got %v", e.Key, e.Value)
+			}
+			i := int(n)
+			if e.Key == "$position" {
+				position = &i
+			} else {
+				slice = &i
+			}
+		case "$sort":
+			if spec, isD := e.Value.(bson.D); isD {
+				s, err := ParseSort(spec)
+				if err != nil {
+					return nil, err
 				}
+				sort = s
+			} else if dir, isNumber := floatValue(e.Value); isNumber && (dir == 1 || dir == -1) {
+				sortDir = int(dir)
+			} else {
+				return nil, fmt.Errorf("$sort requires 1, -1, or a sort specification but got %v", e.Value)
 			}
+		default:
+			return nil, fmt.Errorf("unsupported modifier for $push operation %v", e.Key)
 		}
+	}
+	if !hasEach {
+		return nil, fmt.Errorf("$push modifiers require $each; got %v", d)
+	}
+	return PushEach(values, position, slice, sort, sortDir)
+}
 
-		update, err := PushValue(e.Value)
+// The value of a $pop field is 1 to remove the last element, or -1 to remove the first element
+func (p *updateParser) parsePop(args any) ([]Update, error) {
+	d, isD := args.(bson.D)
+	if !isD {
+		return nil, fmt.Errorf("invalid $pop operator; expected a bson.D, got %v", args)
+	}
+	var updates []Update
+	for _, e := range d {
+		dir, isNumber := floatValue(e.Value)
+		if !isNumber || (dir != 1 && dir != -1) {
+			return nil, fmt.Errorf("invalid $pop argument; expected 1 or -1, got %v", e.Value)
+		}
+		update, err := p.path(e.Key, Pop(dir == -1), false)
 		if err != nil {
 			return nil, err
 		}
-		updates = append(updates, UpdatePath(e.Key, update))
+		updates = append(updates, update)
 	}
 	return updates, nil
 }
 
-func parseAddToSet(args any) ([]Update, error) {
+func (p *updateParser) parseAddToSet(args any) ([]Update, error) {
 	d, isD := args.(bson.D)
 	if !isD {
 		return nil, fmt.Errorf("invalid $addToSet operator; expected a bson.D, got %v", args)
@@ -169,12 +506,16 @@ func parseAddToSet(args any) ([]Update, error) {
 		if err != nil {
 			return nil, err
 		}
-		updates = append(updates, UpdatePath(e.Key, update))
+		update, err = p.path(e.Key, update, true)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, update)
 	}
 	return updates, nil
 }
 
-func parsePull(args any) ([]Update, error) {
+func (p *updateParser) parsePull(args any) ([]Update, error) {
 	d, isD := args.(bson.D)
 	if !isD {
 		return nil, fmt.Errorf("invalid $pull operator; expected a bson.D, got %v", args)
@@ -194,7 +535,7 @@ func parsePull(args any) ([]Update, error) {
 		var err error
 		switch v := e.Value.(type) {
 		case bson.D:
-			filter, err = parseQuery(v)
+			filter, err = parseQuery(v, nil)
 		default:
 			filter = Equals(v)
 		}
@@ -206,7 +547,59 @@ func parsePull(args any) ([]Update, error) {
 		if err != nil {
 			return nil, err
 		}
-		updates = append(updates, UpdatePath(e.Key, update))
+		update, err = p.path(e.Key, update, true)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, update)
 	}
 	return updates, nil
 }
+
+// Returns the document inserted by an upsert when no documents match filter.  The document
+// contains the fields that filter compares for equality, e.g. { type: "Oolong" } for both
+// { type: "Oolong" } and { type: { $eq: "Oolong" } }.  The update is then applied to it.
+func UpsertDocument(filter bson.D) (bson.D, error) {
+	doc := bson.D{}
+	err := addEqualityFields(&doc, filter)
+	return doc, err
+}
+
+func addEqualityFields(doc *bson.D, filter bson.D) error {
+	for _, e := range filter {
+		if e.Key == "$and" {
+			a, _ := e.Value.(bson.A)
+			for _, q := range a {
+				if d, isD := q.(bson.D); isD {
+					if err := addEqualityFields(doc, d); err != nil {
+						return err
+					}
+				}
+			}
+			continue
+		} else if strings.HasPrefix(e.Key, "$") {
+			continue
+		}
+
+		value, isEquality := e.Value, true
+		if d, isD := e.Value.(bson.D); isD && len(d) > 0 && strings.HasPrefix(d[0].Key, "$") {
+			isEquality = false
+			for _, op := range d {
+				if op.Key == "$eq" {
+					value, isEquality = op.Value, true
+				}
+			}
+		}
+		if !isEquality {
+			continue
+		}
+		set, err := SetValue(value)
+		if err != nil {
+			return err
+		}
+		if err := UpdatePath(e.Key, set).Apply(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
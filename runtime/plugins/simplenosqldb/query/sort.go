@@ -0,0 +1,432 @@
+package query
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+Sorting and comparison of BSON values, following MongoDB's comparison order
+
+https://www.mongodb.com/docs/manual/reference/bson-type-comparison-order/
+*/
+
+// A sort specification, e.g. parsed from bson.D{{"rating", -1}, {"name", 1}}
+type Sort struct {
+	keys []sortKey
+}
+
+type sortKey struct {
+	path       []string
+	descending bool
+}
+
+// An empty array sorts before null and missing fields
+type emptyArray struct{}
+
+// Parses a sort specification.  Each field of spec is a (possibly dotted) field name
+// and a direction of 1 for ascending or -1 for descending.
+func ParseSort(spec bson.D) (*Sort, error) {
+	s := &Sort{}
+	for _, e := range spec {
+		if e.Key == "" || strings.HasPrefix(e.Key, "$") {
+			return nil, fmt.Errorf("invalid sort field %q in %v", e.Key, spec)
+		}
+		dir, isNumber := floatValue(e.Value)
+		if !isNumber || (dir != 1 && dir != -1) {
+			return nil, fmt.Errorf("invalid sort direction %v for field %v; expected 1 or -1", e.Value, e.Key)
+		}
+		s.keys = append(s.keys, sortKey{path: strings.Split(e.Key, "."), descending: dir == -1})
+	}
+	return s, nil
+}
+
+// Sorts items in place.  Items that compare equal retain their relative order.
+func (s *Sort) Apply(items []bson.D) {
+	if len(s.keys) == 0 {
+		return
+	}
+	keys := make([][]any, len(items))
+	for i, item := range items {
+		keys[i] = make([]any, len(s.keys))
+		for j, k := range s.keys {
+			keys[i][j] = k.value(item)
+		}
+	}
+	sort.Stable(&sorter{s, items, keys})
+}
+
+func (s *Sort) String() string {
+	var strs []string
+	for _, k := range s.keys {
+		dir := 1
+		if k.descending {
+			dir = -1
+		}
+		strs = append(strs, fmt.Sprintf("%v: %v", strings.Join(k.path, "."), dir))
+	}
+	return fmt.Sprintf("sort(%v)", strings.Join(strs, ", "))
+}
+
+type sorter struct {
+	s     *Sort
+	items []bson.D
+	keys  [][]any
+}
+
+func (s *sorter) Len() int { return len(s.items) }
+func (s *sorter) Swap(i, j int) {
+	s.items[i], s.items[j] = s.items[j], s.items[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+func (s *sorter) Less(i, j int) bool {
+	for k, key := range s.s.keys {
+		c := Compare(s.keys[i][k], s.keys[j][k])
+		if key.descending {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+	}
+	return false
+}
+
+// Returns the value that item sorts by.  If the field is an array, or is reached through
+// an array, ascending sorts use the smallest value and descending sorts use the largest.
+func (k sortKey) value(item bson.D) any {
+	values := lookupValues(item, k.path, nil)
+	if len(values) == 0 {
+		return nil
+	}
+	key := values[0]
+	for _, v := range values[1:] {
+		c := Compare(v, key)
+		if (k.descending && c > 0) || (!k.descending && c < 0) {
+			key = v
+		}
+	}
+	return key
+}
+
+// Appends the values of the field at path to values.  Arrays are flattened, so an array value
+// contributes each of its elements, and a missing field contributes null.
+func lookupValues(item any, path []string, values []any) []any {
+	if len(path) == 0 {
+		if a, isA := item.(bson.A); isA {
+			if len(a) == 0 {
+				return append(values, emptyArray{})
+			}
+			return append(values, a...)
+		}
+		return append(values, item)
+	}
+
+	switch v := item.(type) {
+	case bson.D:
+		for _, e := range v {
+			if e.Key == path[0] {
+				return lookupValues(e.Value, path[1:], values)
+			}
+		}
+	case bson.A:
+		if i, err := strconv.Atoi(path[0]); err == nil {
+			if i >= 0 && i < len(v) {
+				return lookupValues(v[i], path[1:], values)
+			}
+			return append(values, nil)
+		}
+		if len(v) == 0 {
+			return append(values, nil)
+		}
+		for _, e := range v {
+			values = lookupValues(e, path, values)
+		}
+		return values
+	}
+	return append(values, nil)
+}
+
+// Returns the distinct values of the field selected by selector across items.  Arrays are
+// flattened, so an array value contributes each of its elements.  Values are returned in the
+// order they are first seen; items where the field is missing contribute no values.
+func Distinct(items []bson.D, selector string) []any {
+	path := strings.Split(selector, ".")
+	var distinct []any
+	for _, item := range items {
+		for _, v := range lookupValues(item, path, nil) {
+			if v == nil {
+				continue
+			}
+			if _, isEmpty := v.(emptyArray); isEmpty {
+				continue
+			}
+			seen := false
+			for _, d := range distinct {
+				if Compare(v, d) == 0 {
+					seen = true
+					break
+				}
+			}
+			if !seen {
+				distinct = append(distinct, v)
+			}
+		}
+	}
+	return distinct
+}
+
+// Compares two BSON values using MongoDB's comparison order, returning -1, 0 or 1.
+//
+// Values of different types are ordered MinKey < null < numbers < strings < objects < arrays
+// < binary data < ObjectId < booleans < dates < timestamps < regular expressions < MaxKey.
+// Numbers of different types are compared by value.  Objects and arrays are compared
+// element by element.
+func Compare(a, b any) int {
+	ra, rb := typeRank(a), typeRank(b)
+	if ra != rb {
+		return cmp.Compare(ra, rb)
+	}
+
+	switch ra {
+	case rankNumber:
+		return compareNumbers(a, b)
+	case rankString:
+		return strings.Compare(stringValue(a), stringValue(b))
+	case rankObject:
+		return compareDocuments(documentValue(a), documentValue(b))
+	case rankArray:
+		return compareArrays(arrayValue(a), arrayValue(b))
+	case rankBinary:
+		ba, bb := binaryValue(a), binaryValue(b)
+		if len(ba.Data) != len(bb.Data) {
+			return cmp.Compare(len(ba.Data), len(bb.Data))
+		}
+		if ba.Subtype != bb.Subtype {
+			return cmp.Compare(ba.Subtype, bb.Subtype)
+		}
+		return bytes.Compare(ba.Data, bb.Data)
+	case rankObjectID:
+		oa, ob := a.(primitive.ObjectID), b.(primitive.ObjectID)
+		return bytes.Compare(oa[:], ob[:])
+	case rankBool:
+		ba, bb := a.(bool), b.(bool)
+		if ba == bb {
+			return 0
+		} else if bb {
+			return -1
+		}
+		return 1
+	case rankDate:
+		return cmp.Compare(dateValue(a), dateValue(b))
+	case rankTimestamp:
+		ta, tb := a.(primitive.Timestamp), b.(primitive.Timestamp)
+		if ta.T != tb.T {
+			return cmp.Compare(ta.T, tb.T)
+		}
+		return cmp.Compare(ta.I, tb.I)
+	case rankRegex:
+		ra, rb := a.(primitive.Regex), b.(primitive.Regex)
+		if c := strings.Compare(ra.Pattern, rb.Pattern); c != 0 {
+			return c
+		}
+		return strings.Compare(ra.Options, rb.Options)
+	case rankOther:
+		return strings.Compare(fmt.Sprintf("%T%v", a, a), fmt.Sprintf("%T%v", b, b))
+	}
+	return 0
+}
+
+const (
+	rankMinKey = iota
+	rankEmptyArray
+	rankNull
+	rankNumber
+	rankString
+	rankObject
+	rankArray
+	rankBinary
+	rankObjectID
+	rankBool
+	rankDate
+	rankTimestamp
+	rankRegex
+	rankOther
+	rankMaxKey
+)
+
+func typeRank(v any) int {
+	switch v.(type) {
+	case primitive.MinKey:
+		return rankMinKey
+	case emptyArray:
+		return rankEmptyArray
+	case nil, primitive.Null, primitive.Undefined:
+		return rankNull
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, primitive.Decimal128:
+		return rankNumber
+	case string, primitive.Symbol:
+		return rankString
+	case bson.D, bson.M:
+		return rankObject
+	case bson.A:
+		return rankArray
+	case primitive.Binary, []byte:
+		return rankBinary
+	case primitive.ObjectID:
+		return rankObjectID
+	case bool:
+		return rankBool
+	case primitive.DateTime, time.Time:
+		return rankDate
+	case primitive.Timestamp:
+		return rankTimestamp
+	case primitive.Regex:
+		return rankRegex
+	case primitive.MaxKey:
+		return rankMaxKey
+	default:
+		return rankOther
+	}
+}
+
+// Compares numbers of any type by value.  NaN is equal to NaN and less than all other numbers.
+func compareNumbers(a, b any) int {
+	ia, aIsInt := intValue(a)
+	ib, bIsInt := intValue(b)
+	if aIsInt && bIsInt {
+		return cmp.Compare(ia, ib)
+	}
+	fa, fb := numberValue(a), numberValue(b)
+	if fa == nil || fb == nil {
+		return cmp.Compare(boolRank(fa != nil), boolRank(fb != nil))
+	}
+	return fa.Cmp(fb)
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Converts any numeric type to a big.Float so that it can be compared exactly.  Returns nil for NaN.
+func numberValue(v any) *big.Float {
+	switch n := v.(type) {
+	case uint:
+		return new(big.Float).SetUint64(uint64(n))
+	case uint8:
+		return new(big.Float).SetUint64(uint64(n))
+	case uint16:
+		return new(big.Float).SetUint64(uint64(n))
+	case uint32:
+		return new(big.Float).SetUint64(uint64(n))
+	case uint64:
+		return new(big.Float).SetUint64(n)
+	case float32:
+		return floatNumber(float64(n))
+	case float64:
+		return floatNumber(n)
+	case primitive.Decimal128:
+		if n.IsNaN() {
+			return nil
+		}
+		if inf := n.IsInf(); inf != 0 {
+			return new(big.Float).SetInf(inf < 0)
+		}
+		f, _, err := big.ParseFloat(n.String(), 10, 128, big.ToNearestEven)
+		if err != nil {
+			return nil
+		}
+		return f
+	}
+	if i, isInt := intValue(v); isInt {
+		return new(big.Float).SetInt64(i)
+	}
+	return nil
+}
+
+func floatNumber(f float64) *big.Float {
+	if math.IsNaN(f) {
+		return nil
+	}
+	return big.NewFloat(f)
+}
+
+func stringValue(v any) string {
+	if s, isSymbol := v.(primitive.Symbol); isSymbol {
+		return string(s)
+	}
+	return v.(string)
+}
+
+func documentValue(v any) bson.D {
+	if m, isM := v.(bson.M); isM {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		d := make(bson.D, 0, len(m))
+		for _, k := range keys {
+			d = append(d, bson.E{Key: k, Value: m[k]})
+		}
+		return d
+	}
+	return v.(bson.D)
+}
+
+func arrayValue(v any) bson.A {
+	return v.(bson.A)
+}
+
+func binaryValue(v any) primitive.Binary {
+	if b, isBytes := v.([]byte); isBytes {
+		return primitive.Binary{Data: b}
+	}
+	return v.(primitive.Binary)
+}
+
+func dateValue(v any) int64 {
+	if t, isTime := v.(time.Time); isTime {
+		return int64(primitive.NewDateTimeFromTime(t))
+	}
+	return int64(v.(primitive.DateTime))
+}
+
+// Compares fields pairwise by type, then name, then value.  A prefix sorts first.
+func compareDocuments(a, b bson.D) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := cmp.Compare(typeRank(a[i].Value), typeRank(b[i].Value)); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a[i].Key, b[i].Key); c != 0 {
+			return c
+		}
+		if c := Compare(a[i].Value, b[i].Value); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+// Compares elements pairwise.  A prefix sorts first.
+func compareArrays(a, b bson.A) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := Compare(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(a), len(b))
+}
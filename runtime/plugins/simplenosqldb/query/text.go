@@ -0,0 +1,238 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/*
+Text indexes and basic $text search
+
+https://www.mongodb.com/docs/manual/core/indexes/index-types/index-text/
+*/
+
+// A text index over one or more string fields of the documents of a collection, e.g.
+// bson.D{{"description", "text"}}, or bson.D{{"$**", "text"}} to index all string fields.
+// A collection can have at most one text index, which is searched by $text queries.
+//
+// Unlike MongoDB, text is matched by whole words without stemming, stop words or
+// diacritic folding.
+type TextIndex struct {
+	name   string
+	keys   bson.D
+	fields [][]string // nil if the index covers all string fields
+}
+
+type textSearch struct {
+	index         *TextIndex
+	search        string
+	terms         []string
+	negated       []string
+	phrases       []string
+	caseSensitive bool
+}
+
+// Returns whether keys specify a text index
+func IsTextIndex(keys bson.D) bool {
+	for _, e := range keys {
+		if e.Value == "text" {
+			return true
+		}
+	}
+	return false
+}
+
+// Creates a text index over the fields in keys, e.g. bson.D{{"name", "text"}, {"description", "text"}}.
+// If name is empty, a name is derived from keys in the same way as MongoDB, e.g. "name_text_description_text".
+func NewTextIndex(name string, keys bson.D) (*TextIndex, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("an index requires at least one key")
+	}
+	ix := &TextIndex{name: name, keys: keys}
+	for _, e := range keys {
+		if e.Value != "text" {
+			return nil, fmt.Errorf("compound text indexes are not supported; found %v: %v in %v", e.Key, e.Value, keys)
+		}
+		if e.Key == "$**" {
+			if len(keys) != 1 {
+				return nil, fmt.Errorf("a wildcard text index cannot have other fields; found %v", keys)
+			}
+			ix.fields = nil
+		} else if e.Key == "" || strings.HasPrefix(e.Key, "$") {
+			return nil, fmt.Errorf("invalid text index field %q in %v", e.Key, keys)
+		} else {
+			ix.fields = append(ix.fields, strings.Split(e.Key, "."))
+		}
+	}
+	if ix.name == "" {
+		ix.name = IndexName(keys)
+	}
+	return ix, nil
+}
+
+func (ix *TextIndex) Name() string {
+	return ix.name
+}
+
+// Returns the keys the index was created with, e.g. bson.D{{"description", "text"}}
+func (ix *TextIndex) Keys() bson.D {
+	return ix.keys
+}
+
+// Returns whether ix indexes the same fields as keys
+func (ix *TextIndex) HasKeys(keys bson.D) bool {
+	return reflect.DeepEqual(keys, ix.keys)
+}
+
+func (ix *TextIndex) String() string {
+	return fmt.Sprintf("%v %v", ix.name, ix.keys)
+}
+
+// Returns the strings in the indexed fields of doc
+func (ix *TextIndex) indexedStrings(doc bson.D) []string {
+	var values []any
+	if ix.fields == nil {
+		values = allValues(doc, values)
+	}
+	for _, path := range ix.fields {
+		values = lookupValues(doc, path, values)
+	}
+	var strs []string
+	for _, value := range values {
+		if s, isStr := value.(string); isStr {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
+
+// Appends all values in item, recursing into documents and arrays
+func allValues(item any, values []any) []any {
+	switch v := item.(type) {
+	case bson.D:
+		for _, e := range v {
+			values = allValues(e.Value, values)
+		}
+	case bson.A:
+		for _, e := range v {
+			values = allValues(e, values)
+		}
+	default:
+		values = append(values, v)
+	}
+	return values
+}
+
+var phrasePattern = regexp.MustCompile(`"[^"]*"`)
+
+// Parses the value of a $text operator, e.g. bson.D{{"$search", "green -black \"earl grey\""}}.
+// A document matches if it contains all of the quoted phrases or, if there are none, any of the
+// terms; and contains none of the terms prefixed with -.  $language and $diacriticSensitive are
+// accepted but ignored.
+func parseTextSearch(value any, index *TextIndex) (Filter, error) {
+	d, isD := value.(bson.D)
+	if !isD {
+		return nil, fmt.Errorf("$text requires a bson.D value but got %v", value)
+	}
+	if index == nil {
+		return nil, fmt.Errorf("$text requires a text index on the collection")
+	}
+	f := &textSearch{index: index}
+	hasSearch := false
+	for _, e := range d {
+		switch e.Key {
+		case "$search":
+			search, isStr := e.Value.(string)
+			if !isStr {
+				return nil, fmt.Errorf("$search requires a string value but got %v", e.Value)
+			}
+			f.search, hasSearch = search, true
+		case "$caseSensitive":
+			caseSensitive, isBool := e.Value.(bool)
+			if !isBool {
+				return nil, fmt.Errorf("$caseSensitive requires a bool value but got %v", e.Value)
+			}
+			f.caseSensitive = caseSensitive
+		case "$language", "$diacriticSensitive":
+		default:
+			return nil, fmt.Errorf("unsupported $text option %v", e.Key)
+		}
+	}
+	if !hasSearch {
+		return nil, fmt.Errorf("$text requires a $search string; found %v", d)
+	}
+
+	search := f.fold(f.search)
+	for _, phrase := range phrasePattern.FindAllString(search, -1) {
+		if phrase = strings.Trim(phrase, `"`); phrase != "" {
+			f.phrases = append(f.phrases, phrase)
+		}
+	}
+	for _, term := range strings.Fields(phrasePattern.ReplaceAllString(search, " ")) {
+		if strings.HasPrefix(term, "-") {
+			f.negated = append(f.negated, words(term[1:])...)
+		} else {
+			f.terms = append(f.terms, words(term)...)
+		}
+	}
+	return f, nil
+}
+
+// Splits s into words of letters and digits
+func words(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+}
+
+func (f *textSearch) fold(s string) string {
+	if f.caseSensitive {
+		return s
+	}
+	return strings.ToLower(s)
+}
+
+func (f *textSearch) Apply(item any) bool {
+	d, isD := item.(bson.D)
+	if !isD {
+		return false
+	}
+	strs := f.index.indexedStrings(d)
+	found := make(map[string]struct{})
+	for i, s := range strs {
+		strs[i] = f.fold(s)
+		for _, word := range words(strs[i]) {
+			found[word] = struct{}{}
+		}
+	}
+	for _, term := range f.negated {
+		if _, exists := found[term]; exists {
+			return false
+		}
+	}
+	if len(f.phrases) > 0 {
+	phrases:
+		for _, phrase := range f.phrases {
+			for _, s := range strs {
+				if strings.Contains(s, phrase) {
+					continue phrases
+				}
+			}
+			return false
+		}
+		return true
+	}
+	for _, term := range f.terms {
+		if _, exists := found[term]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *textSearch) String() string {
+	return fmt.Sprintf("text(%v, %q)", f.index.name, f.search)
+}
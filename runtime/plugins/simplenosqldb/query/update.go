@@ -3,6 +3,7 @@ package query
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -67,9 +68,50 @@ type (
 	broadcastupdate struct {
 		update Update
 	}
+
+	minmax struct {
+		t     bsontype.Type
+		value []byte
+		max   bool
+	}
+
+	mul struct {
+		factor any
+	}
+
+	pop struct {
+		first bool
+	}
+
+	pusheach struct {
+		t        bsontype.Type
+		values   []byte
+		position *int
+		slice    *int
+		sort     *Sort // nil if sorting by element value, or not sorting
+		sortDir  int   // 1 or -1 if sorting by element value; 0 otherwise
+	}
+
+	rename struct {
+		from string
+		to   string
+	}
+
+	// Updates array elements.  If filter is nil, updates all elements.  Otherwise, updates each element
+	// matched by filter, which is applied to a document with the element as the field identifier.
+	positionalupdate struct {
+		identifier string
+		filter     Filter
+		first      bool // Only update the first matching element
+		update     Update
+	}
 )
 
 func SetValue(value any) (Update, error) {
+	if value == nil {
+		// An untyped nil can't be marshalled, so store it as null
+		return &set{t: bson.TypeNull}, nil
+	}
 	t, v, err := bson.MarshalValue(value)
 	return &set{t: t, value: v}, err
 }
@@ -100,6 +142,45 @@ func IncInt(amount int64) Update {
 	return &incint{amount: amount}
 }
 
+// Sets the value to value if the value is missing or value is less than it
+func MinValue(value any) (Update, error) {
+	t, v, err := bson.MarshalValue(value)
+	return &minmax{t: t, value: v}, err
+}
+
+// Sets the value to value if the value is missing or value is greater than it
+func MaxValue(value any) (Update, error) {
+	t, v, err := bson.MarshalValue(value)
+	return &minmax{t: t, value: v, max: true}, err
+}
+
+// Multiplies a number by factor.  A missing value is set to zero.
+func Multiply(factor any) (Update, error) {
+	if _, isNumber := numericKind(factor); !isNumber {
+		return nil, fmt.Errorf("cannot multiply by non-numeric value %v", factor)
+	}
+	return &mul{factor: factor}, nil
+}
+
+// Removes the first or last element of an array
+func Pop(first bool) Update {
+	return &pop{first: first}
+}
+
+// Inserts values into an array at position, or at the end if position is nil, then sorts the array
+// using sort or sortDir, then keeps the first slice elements, or the last -slice elements if slice
+// is negative.
+func PushEach(values bson.A, position *int, slice *int, sort *Sort, sortDir int) (Update, error) {
+	t, v, err := bson.MarshalValue(values)
+	return &pusheach{t: t, values: v, position: position, slice: slice, sort: sort, sortDir: sortDir}, err
+}
+
+// Moves the value of a field to another field, replacing any existing value.  Does nothing if
+// the field does not exist.
+func Rename(from string, to string) Update {
+	return &rename{from: from, to: to}
+}
+
 func UpdateField(fieldName string, update Update, createIfAbsent bool) Update {
 	return &updatefield{fieldName: fieldName, update: update, createIfAbsent: createIfAbsent}
 }
@@ -163,6 +244,24 @@ func BroadcastUpdate(update Update) Update {
 	return &broadcastupdate{update: update}
 }
 
+// Applies update to the first element of an array matched by filter, as for the $ positional operator.
+// filter is applied to a document with the element as the field identifier.  Returns an error if no
+// element matches.
+func UpdateFirstMatch(identifier string, filter Filter, update Update) Update {
+	return &positionalupdate{identifier: identifier, filter: filter, first: true, update: update}
+}
+
+// Applies update to all elements of an array, as for the $[] positional operator
+func UpdateAllElements(update Update) Update {
+	return &positionalupdate{update: update}
+}
+
+// Applies update to the elements of an array matched by filter, as for the $[<identifier>] positional
+// operator.  filter is applied to a document with the element as the field identifier.
+func UpdateMatchingElements(identifier string, filter Filter, update Update) Update {
+	return &positionalupdate{identifier: identifier, filter: filter, update: update}
+}
+
 func (s *set) Apply(itemRef any) error {
 	var v any
 	err := bson.UnmarshalValue(s.t, s.value, &v)
@@ -180,6 +279,9 @@ func (s *set) Apply(itemRef any) error {
 		return fmt.Errorf("set unable to apply update to non-interface type %v", reflect.TypeOf(dst_val))
 	}
 
+	if v == nil {
+		return backend.SetZero(itemRef)
+	}
 	dst_val.Set(reflect.ValueOf(v))
 
 	return nil
@@ -445,6 +547,218 @@ func (b *broadcastupdate) Apply(itemRef any) error {
 	return nil
 }
 
+func (m *minmax) Apply(itemRef any) error {
+	var v any
+	err := bson.UnmarshalValue(m.t, m.value, &v)
+	if err != nil {
+		return err
+	}
+
+	itemVal, err := backend.GetPointerValue(itemRef)
+	if err != nil {
+		return err
+	}
+
+	c := Compare(v, itemVal)
+	if itemVal == nil || (m.max && c > 0) || (!m.max && c < 0) {
+		return assign(v, itemRef)
+	}
+	return nil
+}
+
+func (m *mul) Apply(itemRef any) error {
+	itemVal, err := backend.GetPointerValue(itemRef)
+	if err != nil {
+		return err
+	}
+
+	if itemVal == nil {
+		itemVal = int32(0)
+	}
+
+	result := arithmetic(itemVal, m.factor, multiplyInts, func(x, y float64) float64 { return x * y })
+	if result == nil {
+		return fmt.Errorf("mul unable to multiply non-numeric value %v", itemVal)
+	}
+	return backend.CopyResult(result, itemRef)
+}
+
+func (p *pop) Apply(itemRef any) error {
+	itemVal, err := backend.GetPointerValue(itemRef)
+	if err != nil || itemVal == nil {
+		return err
+	}
+
+	a, isA := itemVal.(bson.A)
+	if !isA {
+		return fmt.Errorf("pop expected a bson.A but instead found a %v %v", reflect.TypeOf(itemVal), itemVal)
+	}
+
+	if len(a) == 0 {
+		return nil
+	}
+	if p.first {
+		return backend.CopyResult(append(bson.A{}, a[1:]...), itemRef)
+	}
+	return backend.CopyResult(append(bson.A{}, a[:len(a)-1]...), itemRef)
+}
+
+func (p *pusheach) Apply(itemRef any) error {
+	var values bson.A
+	err := bson.UnmarshalValue(p.t, p.values, &values)
+	if err != nil {
+		return err
+	}
+
+	itemVal, err := backend.GetPointerValue(itemRef)
+	if err != nil {
+		return err
+	}
+
+	if itemVal == nil {
+		itemVal = bson.A{}
+	}
+
+	a, isA := itemVal.(bson.A)
+	if !isA {
+		return fmt.Errorf("push expected a bson.A but instead found a %v %v", reflect.TypeOf(itemVal), itemVal)
+	}
+
+	// A negative position counts back from the end of the array
+	position := len(a)
+	if p.position != nil {
+		position = *p.position
+		if position < 0 {
+			position = max(len(a)+position, 0)
+		}
+		position = min(position, len(a))
+	}
+	updated := append(bson.A{}, a[:position]...)
+	updated = append(updated, values...)
+	updated = append(updated, a[position:]...)
+
+	if p.sort != nil || p.sortDir != 0 {
+		sortElements(updated, p.sort, p.sortDir)
+	}
+
+	if p.slice != nil {
+		if n := *p.slice; n >= 0 && n < len(updated) {
+			updated = updated[:n]
+		} else if n < 0 && -n < len(updated) {
+			updated = updated[len(updated)+n:]
+		}
+	}
+	return backend.CopyResult(updated, itemRef)
+}
+
+// Sorts a stably.  If s is nil, sorts by the value of the elements in direction dir.  Otherwise sorts
+// by the fields in s; elements that are not documents are treated as documents without those fields.
+func sortElements(a bson.A, s *Sort, dir int) {
+	type element struct {
+		value any
+		keys  []any
+	}
+	elements := make([]element, len(a))
+	for i, v := range a {
+		elements[i].value = v
+		if s != nil {
+			d, _ := v.(bson.D)
+			for _, k := range s.keys {
+				elements[i].keys = append(elements[i].keys, k.value(d))
+			}
+		}
+	}
+	sort.SliceStable(elements, func(i, j int) bool {
+		if s == nil {
+			return dir*Compare(elements[i].value, elements[j].value) < 0
+		}
+		for k, key := range s.keys {
+			c := Compare(elements[i].keys[k], elements[j].keys[k])
+			if key.descending {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	for i := range elements {
+		a[i] = elements[i].value
+	}
+}
+
+func (r *rename) Apply(itemRef any) error {
+	itemVal, err := backend.GetPointerValue(itemRef)
+	if err != nil {
+		return err
+	}
+
+	// Find the value to move; $rename does not traverse arrays
+	value, exists := itemVal, true
+	for _, fieldName := range strings.Split(r.from, ".") {
+		d, isD := value.(bson.D)
+		if !isD {
+			return nil
+		}
+		value, exists = nil, false
+		for _, e := range d {
+			if e.Key == fieldName {
+				value, exists = e.Value, true
+			}
+		}
+		if !exists {
+			return nil
+		}
+	}
+
+	if err := UnsetPath(r.from).Apply(itemRef); err != nil {
+		return err
+	}
+	set, err := SetValue(value)
+	if err != nil {
+		return err
+	}
+	return UpdatePath(r.to, set).Apply(itemRef)
+}
+
+func (p *positionalupdate) Apply(itemRef any) error {
+	itemVal, err := backend.GetPointerValue(itemRef)
+	if err != nil {
+		return err
+	}
+
+	a, isA := itemVal.(bson.A)
+	if !isA {
+		return fmt.Errorf("cannot apply %v to non-array value %v", p.operator(), itemVal)
+	}
+
+	matched := false
+	for i := range a {
+		if p.filter == nil || p.filter.Apply(bson.D{{Key: p.identifier, Value: a[i]}}) {
+			matched = true
+			if err := p.update.Apply(&a[i]); err != nil {
+				return err
+			}
+			if p.first {
+				break
+			}
+		}
+	}
+	if p.first && !matched {
+		return fmt.Errorf("the positional operator did not find the match needed from the query")
+	}
+	return nil
+}
+
+// Copies value to itemRef, which may be nil
+func assign(value any, itemRef any) error {
+	if value == nil {
+		return backend.SetZero(itemRef)
+	}
+	return backend.CopyResult(value, itemRef)
+}
+
 func (s *set) String() string {
 	var v interface{}
 	bson.UnmarshalValue(s.t, s.value, &v)
@@ -495,6 +809,49 @@ func (a *updateall) String() string {
 	return strings.Join(strs, "; ")
 }
 
+func (m *minmax) String() string {
+	var v interface{}
+	bson.UnmarshalValue(m.t, m.value, &v)
+	if m.max {
+		return fmt.Sprintf("max %v", v)
+	}
+	return fmt.Sprintf("min %v", v)
+}
+
+func (m *mul) String() string {
+	return fmt.Sprintf(" *= %v", m.factor)
+}
+
+func (p *pop) String() string {
+	if p.first {
+		return "pop first"
+	}
+	return "pop last"
+}
+
+func (p *pusheach) String() string {
+	var v interface{}
+	bson.UnmarshalValue(p.t, p.values, &v)
+	return fmt.Sprintf("push each %v", v)
+}
+
+func (r *rename) String() string {
+	return fmt.Sprintf("rename %v to %v", r.from, r.to)
+}
+
+func (p *positionalupdate) operator() string {
+	if p.filter == nil {
+		return "$[]"
+	} else if p.first {
+		return "$"
+	}
+	return fmt.Sprintf("$[%v]", p.identifier)
+}
+
+func (p *positionalupdate) String() string {
+	return fmt.Sprintf("%v %v", p.operator(), p.update)
+}
+
 func (b *broadcastupdate) String() string {
 	return fmt.Sprintf("broadcast %v ", b.update)
 }
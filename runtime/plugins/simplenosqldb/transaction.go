@@ -0,0 +1,260 @@
+package simplenosqldb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Implements the [backend.NoSQLTransaction] interface for a [SimpleNoSQLDB] with snapshot isolation.
+//
+// Starting a transaction only records the version of the database.  The first time the transaction
+// accesses a collection, directly or through $lookup, it takes a snapshot of the collection's
+// documents and indexes, and builds a private copy of the collection from it; the transaction's reads
+// and writes go to the private copy.  Documents are never modified in place, so the snapshot only
+// copies references to them.  If the collection has been written since the transaction started, its
+// contents no longer match the snapshot the transaction should see, so the access fails with an
+// error wrapping [backend.ErrTransactionConflict] and the transaction should be retried.
+//
+// Commit checks that none of the documents written by the transaction have been written by
+// another transaction that committed in the meantime (first committer wins), and then applies the
+// transaction's writes to the database while holding the database's lock.
+type SimpleTransaction struct {
+	lock        sync.RWMutex // Guards the documents of the private collections
+	db          *SimpleNoSQLDB
+	version     uint64                                  // The version of the database when the transaction started
+	collections map[string]map[string]*SimpleCollection // Private collections, by database and name
+	done        bool                                    // Whether the transaction has been committed or aborted
+
+	// Guards collections and done.  Private collections can be created by $lookup while lock is
+	// held for reading, so they are added under a lock of their own.
+	collectionsLock sync.Mutex
+}
+
+// The writes made by a transaction to one collection
+type writeSet struct {
+	base   map[string]bson.D // The documents of the collection when the transaction started, by _id
+	writes map[string]*write // The writes to each document, by _id
+	order  []string          // The _ids of the written documents, in the order they were first written
+}
+
+type write struct {
+	id            any
+	operationType string // The kind of the last write
+}
+
+func (impl *SimpleNoSQLDB) StartTransaction(ctx context.Context) (backend.NoSQLTransaction, error) {
+	impl.lock.RLock()
+	defer impl.lock.RUnlock()
+	return &SimpleTransaction{
+		db:          impl,
+		version:     impl.version,
+		collections: make(map[string]map[string]*SimpleCollection),
+	}, nil
+}
+
+func (tx *SimpleTransaction) GetCollection(ctx context.Context, db_name string, collection_name string) (backend.NoSQLCollection, error) {
+	return tx.collection(db_name, collection_name)
+}
+
+// Returns the transaction's private copy of a collection, creating it from a snapshot of the
+// collection on first access
+func (tx *SimpleTransaction) collection(db_name string, collection_name string) (*SimpleCollection, error) {
+	tx.collectionsLock.Lock()
+	defer tx.collectionsLock.Unlock()
+	if tx.done {
+		return nil, fmt.Errorf("transaction has already been committed or aborted")
+	}
+	db, exists := tx.collections[db_name]
+	if !exists {
+		db = make(map[string]*SimpleCollection)
+		tx.collections[db_name] = db
+	}
+	if collection, exists := db[collection_name]; exists {
+		return collection, nil
+	}
+
+	tx.db.lock.RLock()
+	defer tx.db.lock.RUnlock()
+	committed := tx.db.collections[db_name][collection_name]
+	if committed != nil && committed.version > tx.version {
+		return nil, fmt.Errorf("collection %v.%v was written after the transaction started: %w", db_name, collection_name, backend.ErrTransactionConflict)
+	}
+
+	collection, err := newCollection(db_name, collection_name, db)
+	if err != nil {
+		return nil, err
+	}
+	collection.lock = &tx.lock
+	collection.tx = tx
+	collection.writes = &writeSet{base: make(map[string]bson.D), writes: make(map[string]*write)}
+	if committed == nil {
+		return collection, nil
+	}
+	for _, index := range committed.indexes {
+		if _, err := collection.createIndex(index.Keys(), backend.IndexOptions{Name: index.Name(), Unique: index.Unique()}); err != nil {
+			return nil, err
+		}
+	}
+	if committed.text != nil {
+		if _, err := collection.createIndex(committed.text.Keys(), backend.IndexOptions{Name: committed.text.Name()}); err != nil {
+			return nil, err
+		}
+	}
+	for _, d := range committed.documents() {
+		item := d
+		if err := collection.index(&item); err != nil {
+			return nil, err
+		}
+		collection.items = append(collection.items, &item)
+		collection.writes.base[idKey(documentID(d))] = d
+	}
+	return collection, nil
+}
+
+// Advances the version of the database that the collection belongs to, and records it as the
+// version in which the collection was last written
+func (db *SimpleCollection) written() {
+	*db.dbVersion++
+	db.version = *db.dbVersion
+}
+
+// Returns a key for the _id id that can be used in maps
+func idKey(id any) string {
+	return fmt.Sprintf("%#v", id)
+}
+
+// Reports a change to the document with _id id to change streams, or, if the collection belongs
+// to a transaction, adds it to the transaction's writes.
+func (db *SimpleCollection) changed(operationType string, id any, doc bson.D) {
+	if db.writes == nil {
+		db.written()
+		db.changes.record(operationType, id, doc)
+		return
+	}
+	key := idKey(id)
+	w, exists := db.writes.writes[key]
+	if !exists {
+		w = &write{id: id}
+		db.writes.writes[key] = w
+		db.writes.order = append(db.writes.order, key)
+	}
+	w.operationType = operationType
+}
+
+func (tx *SimpleTransaction) Commit(ctx context.Context) error {
+	tx.lock.Lock()
+	defer tx.lock.Unlock()
+	tx.collectionsLock.Lock()
+	defer tx.collectionsLock.Unlock()
+	if tx.done {
+		return fmt.Errorf("transaction has already been committed or aborted")
+	}
+	tx.done = true
+
+	tx.db.lock.Lock()
+	defer tx.db.lock.Unlock()
+
+	// Check for conflicts before changing anything
+	type change struct {
+		private   *SimpleCollection
+		committed *SimpleCollection
+	}
+	var changes []change
+	for _, dbName := range sortedKeys(tx.collections) {
+		for _, name := range sortedKeys(tx.collections[dbName]) {
+			private := tx.collections[dbName][name]
+			if len(private.writes.order) == 0 {
+				continue
+			}
+			committed, err := tx.db.collection(dbName, name)
+			if err != nil {
+				return err
+			}
+			for _, key := range private.writes.order {
+				id := private.writes.writes[key].id
+				base, existed := private.writes.base[key]
+				current := committed.findByID(id)
+				if existed != (current != nil) || (current != nil && !sameDocument(base, *current)) {
+					return fmt.Errorf("document %v in %v.%v was written by another transaction: %w", id, dbName, name, backend.ErrTransactionConflict)
+				}
+			}
+			changes = append(changes, change{private, committed})
+		}
+	}
+
+	// Apply the writes, undoing them all if any fails
+	var undo []func()
+	var records []record
+	for _, c := range changes {
+		for _, key := range c.private.writes.order {
+			id := c.private.writes.writes[key].id
+			if item := c.private.findByID(id); item != nil {
+				undoPut, err := c.committed.put(*item)
+				if err != nil {
+					for i := len(undo) - 1; i >= 0; i-- {
+						undo[i]()
+					}
+					return err
+				}
+				undo = append(undo, undoPut)
+				records = append(records, record{Op: opPut, Database: c.committed.dbName, Collection: c.committed.name, ID: id, Document: *item})
+			} else {
+				undo = append(undo, c.committed.remove(id))
+				records = append(records, record{Op: opDelete, Database: c.committed.dbName, Collection: c.committed.name, ID: id})
+			}
+		}
+	}
+
+	if err := tx.db.logTransaction(records); err != nil {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+		return err
+	}
+
+	// Report the net change to each document
+	for _, c := range changes {
+		c.committed.written()
+		for _, key := range c.private.writes.order {
+			w := c.private.writes.writes[key]
+			_, existed := c.private.writes.base[key]
+			item := c.private.findByID(w.id)
+			switch {
+			case item == nil && existed:
+				c.committed.changes.record(backend.ChangeDelete, w.id, nil)
+			case item == nil:
+				// Inserted and then deleted by the transaction
+			case !existed:
+				c.committed.changes.record(backend.ChangeInsert, w.id, *item)
+			case w.operationType == backend.ChangeUpdate:
+				c.committed.changes.record(backend.ChangeUpdate, w.id, *item)
+			default:
+				c.committed.changes.record(backend.ChangeReplace, w.id, *item)
+			}
+		}
+	}
+	return nil
+}
+
+// Returns true if a and b are the same stored document.  Documents are never modified in place,
+// so a document that has been written since a was read is a different document.
+func sameDocument(a bson.D, b bson.D) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+func (tx *SimpleTransaction) Abort(ctx context.Context) error {
+	tx.lock.Lock()
+	defer tx.lock.Unlock()
+	tx.collectionsLock.Lock()
+	defer tx.collectionsLock.Unlock()
+	if tx.done {
+		return fmt.Errorf("transaction has already been committed or aborted")
+	}
+	tx.done = true
+	tx.collections = nil
+	return nil
+}
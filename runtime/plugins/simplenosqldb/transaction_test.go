@@ -0,0 +1,341 @@
+package simplenosqldb_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Returns a database and the name of a new collection containing teas
+func makeTransactionDB(t *testing.T) (context.Context, backend.NoSQLDatabase, string) {
+	ctx, db := getDB(t)
+	name := fmt.Sprintf("testcollection%v", collectionid)
+	collectionid += 1
+	coll, err := db.GetCollection(ctx, "testdb", name)
+	require.NoError(t, err)
+	for _, tea := range teas {
+		require.NoError(t, coll.InsertOne(ctx, tea))
+	}
+	return ctx, db, name
+}
+
+func txCollection(t *testing.T, tx backend.NoSQLTransaction, name string) backend.NoSQLCollection {
+	coll, err := tx.GetCollection(context.Background(), "testdb", name)
+	require.NoError(t, err)
+	return coll
+}
+
+func TestTransactionCommit(t *testing.T) {
+	ctx, db, name := makeTransactionDB(t)
+	coll, err := db.GetCollection(ctx, "testdb", name)
+	require.NoError(t, err)
+
+	tx, err := db.StartTransaction(ctx)
+	require.NoError(t, err)
+	txColl := txCollection(t, tx, name)
+	require.NoError(t, txColl.InsertOne(ctx, newtea))
+	_, err = txColl.UpdateOne(ctx, bson.D{{"type", "Oolong"}}, bson.D{{"$set", bson.D{{"rating", 1}}}})
+	require.NoError(t, err)
+	require.NoError(t, txColl.DeleteOne(ctx, bson.D{{"type", "Assam"}}))
+
+	// The transaction sees its own writes, but nobody else does until it commits
+	require.ElementsMatch(t, []string{"Masala", "English Breakfast", "Oolong", "Earl Grey", "Scottish Breakfast"}, findTypes(t, txColl, bson.D{}))
+	require.Equal(t, []string{"Oolong"}, findTypes(t, txColl, bson.D{{"rating", 1}}))
+	require.ElementsMatch(t, []string{"Masala", "English Breakfast", "Oolong", "Assam", "Earl Grey"}, findTypes(t, coll, bson.D{}))
+	require.Empty(t, findTypes(t, coll, bson.D{{"rating", 1}}))
+
+	require.NoError(t, tx.Commit(ctx))
+	require.ElementsMatch(t, []string{"Masala", "English Breakfast", "Oolong", "Earl Grey", "Scottish Breakfast"}, findTypes(t, coll, bson.D{}))
+	require.Equal(t, []string{"Oolong"}, findTypes(t, coll, bson.D{{"rating", 1}}))
+
+	// A transaction can only be finished once
+	require.Error(t, tx.Commit(ctx))
+	require.Error(t, tx.Abort(ctx))
+}
+
+func TestTransactionAbort(t *testing.T) {
+	ctx, db, name := makeTransactionDB(t)
+	coll, err := db.GetCollection(ctx, "testdb", name)
+	require.NoError(t, err)
+
+	tx, err := db.StartTransaction(ctx)
+	require.NoError(t, err)
+	txColl := txCollection(t, tx, name)
+	require.NoError(t, txColl.InsertOne(ctx, newtea))
+	require.NoError(t, txColl.DeleteMany(ctx, bson.D{}))
+	require.Empty(t, findTypes(t, txColl, bson.D{}))
+	require.NoError(t, tx.Abort(ctx))
+
+	require.ElementsMatch(t, []string{"Masala", "English Breakfast", "Oolong", "Assam", "Earl Grey"}, findTypes(t, coll, bson.D{}))
+	require.Error(t, tx.Commit(ctx))
+}
+
+func TestTransactionSnapshot(t *testing.T) {
+	ctx, db, name := makeTransactionDB(t)
+	coll, err := db.GetCollection(ctx, "testdb", name)
+	require.NoError(t, err)
+
+	tx, err := db.StartTransaction(ctx)
+	require.NoError(t, err)
+	defer tx.Abort(ctx)
+	txColl := txCollection(t, tx, name)
+	require.Len(t, findTypes(t, txColl, bson.D{}), 5)
+
+	// Changes committed after the transaction started are not visible to it
+	require.NoError(t, coll.InsertOne(ctx, newtea))
+	_, err = coll.UpdateOne(ctx, bson.D{{"type", "Masala"}}, bson.D{{"$set", bson.D{{"rating", 1}}}})
+	require.NoError(t, err)
+	require.NoError(t, coll.DeleteOne(ctx, bson.D{{"type", "Assam"}}))
+
+	require.ElementsMatch(t, []string{"Masala", "English Breakfast", "Oolong", "Assam", "Earl Grey"}, findTypes(t, txColl, bson.D{}))
+	require.Empty(t, findTypes(t, txColl, bson.D{{"rating", 1}}))
+	count, err := txColl.CountDocuments(ctx, bson.D{{"vendor", "A"}})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+}
+
+func TestTransactionLazySnapshot(t *testing.T) {
+	ctx, db, name := makeTransactionDB(t)
+	other := fmt.Sprintf("testcollection%v", collectionid)
+	collectionid += 1
+	otherColl, err := db.GetCollection(ctx, "testdb", other)
+	require.NoError(t, err)
+	for _, tea := range teas {
+		require.NoError(t, otherColl.InsertOne(ctx, tea))
+	}
+
+	// Collections are snapshotted when the transaction first accesses them, including by $lookup
+	tx, err := db.StartTransaction(ctx)
+	require.NoError(t, err)
+	cursor, err := txCollection(t, tx, name).Aggregate(ctx, []bson.D{
+		{{"$match", bson.D{{"type", "Masala"}}}},
+		{{"$lookup", bson.D{{"from", other}, {"localField", "type"}, {"foreignField", "type"}, {"as", "same"}}}},
+		{{"$project", bson.D{{"_id", 0}, {"type", 1}, {"same.type", 1}}}},
+	})
+	require.NoError(t, err)
+	var results []bson.D
+	require.NoError(t, cursor.All(ctx, &results))
+	require.Equal(t, []bson.D{{{"type", "Masala"}, {"same", bson.A{bson.D{{"type", "Masala"}}}}}}, results)
+
+	// Writes to collections the transaction has already accessed are not visible to it
+	require.NoError(t, otherColl.DeleteMany(ctx, bson.D{}))
+	require.Len(t, findTypes(t, txCollection(t, tx, other), bson.D{}), 5)
+	require.NoError(t, tx.Abort(ctx))
+
+	// A collection written after the transaction started, but before the transaction accessed it,
+	// can't be snapshotted as it was when the transaction started
+	tx, err = db.StartTransaction(ctx)
+	require.NoError(t, err)
+	defer tx.Abort(ctx)
+	require.NoError(t, otherColl.InsertOne(ctx, newtea))
+	_, err = tx.GetCollection(ctx, "testdb", other)
+	require.True(t, errors.Is(err, backend.ErrTransactionConflict), "%v", err)
+	_, err = txCollection(t, tx, name).Aggregate(ctx, []bson.D{{{"$lookup", bson.D{{"from", other}, {"localField", "type"}, {"foreignField", "type"}, {"as", "same"}}}}})
+	require.True(t, errors.Is(err, backend.ErrTransactionConflict), "%v", err)
+}
+
+func TestTransactionConflict(t *testing.T) {
+	ctx, db, name := makeTransactionDB(t)
+	coll, err := db.GetCollection(ctx, "testdb", name)
+	require.NoError(t, err)
+
+	first, err := db.StartTransaction(ctx)
+	require.NoError(t, err)
+	second, err := db.StartTransaction(ctx)
+	require.NoError(t, err)
+
+	_, err = txCollection(t, first, name).UpdateOne(ctx, bson.D{{"type", "Oolong"}}, bson.D{{"$inc", bson.D{{"rating", 1}}}})
+	require.NoError(t, err)
+	require.NoError(t, first.Commit(ctx))
+
+	// The second transaction writes the same document, so the first committer wins
+	secondColl, err := second.GetCollection(ctx, "testdb", name)
+	if err == nil {
+		_, err = secondColl.UpdateOne(ctx, bson.D{{"type", "Oolong"}}, bson.D{{"$inc", bson.D{{"rating", 10}}}})
+	}
+	if err == nil {
+		err = second.Commit(ctx)
+	} else {
+		second.Abort(ctx)
+	}
+	require.True(t, errors.Is(err, backend.ErrTransactionConflict), "%v", err)
+
+	require.Equal(t, []string{"Oolong"}, findTypes(t, coll, bson.D{{"type", "Oolong"}, {"rating", 8}}))
+
+	// Transactions that write different documents don't conflict
+	first, err = db.StartTransaction(ctx)
+	require.NoError(t, err)
+	second, err = db.StartTransaction(ctx)
+	require.NoError(t, err)
+	require.NoError(t, txCollection(t, first, name).DeleteOne(ctx, bson.D{{"type", "Masala"}}))
+	require.NoError(t, txCollection(t, second, name).DeleteOne(ctx, bson.D{{"type", "Assam"}}))
+	require.NoError(t, first.Commit(ctx))
+	require.NoError(t, second.Commit(ctx))
+	require.ElementsMatch(t, []string{"English Breakfast", "Oolong", "Earl Grey"}, findTypes(t, coll, bson.D{}))
+}
+
+func TestTransactionUniqueIndex(t *testing.T) {
+	ctx, db, name := makeTransactionDB(t)
+	coll, err := db.GetCollection(ctx, "testdb", name)
+	require.NoError(t, err)
+	_, err = coll.CreateIndex(ctx, bson.D{{"type", 1}}, backend.IndexOptions{Unique: true})
+	require.NoError(t, err)
+
+	tx, err := db.StartTransaction(ctx)
+	require.NoError(t, err)
+	txColl := txCollection(t, tx, name)
+	_, err = txColl.UpdateOne(ctx, bson.D{{"type", "Oolong"}}, bson.D{{"$set", bson.D{{"rating", 1}}}})
+	require.NoError(t, err)
+	require.NoError(t, txColl.InsertOne(ctx, Tea{Type: "Sencha"}))
+
+	// Indexes created before the transaction started apply within it
+	err = txColl.InsertOne(ctx, Tea{Type: "Assam"})
+	require.True(t, errors.Is(err, backend.ErrDuplicateKey), "%v", err)
+
+	// If committing would violate a unique index, none of the transaction's writes are applied
+	require.NoError(t, coll.InsertOne(ctx, Tea{Type: "Sencha"}))
+	err = tx.Commit(ctx)
+	require.Error(t, err)
+	require.Empty(t, findTypes(t, coll, bson.D{{"rating", 1}}))
+	count, err := coll.CountDocuments(ctx, bson.D{{"type", "Sencha"}})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+}
+
+func TestWithTransaction(t *testing.T) {
+	ctx, db, name := makeTransactionDB(t)
+	coll, err := db.GetCollection(ctx, "testdb", name)
+	require.NoError(t, err)
+
+	// Concurrent read-modify-write transactions conflict and are retried, so no increment is lost
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := backend.WithTransaction(ctx, db, func(ctx context.Context, tx backend.NoSQLTransaction) error {
+				coll, err := tx.GetCollection(ctx, "testdb", name)
+				if err != nil {
+					return err
+				}
+				cursor, err := coll.FindOne(ctx, bson.D{{"type", "Oolong"}})
+				if err != nil {
+					return err
+				}
+				var tea Tea
+				if _, err := cursor.One(ctx, &tea); err != nil {
+					return err
+				}
+				_, err = coll.UpdateOne(ctx, bson.D{{"type", "Oolong"}}, bson.D{{"$set", bson.D{{"rating", tea.Rating + 1}}}})
+				return err
+			})
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, []string{"Oolong"}, findTypes(t, coll, bson.D{{"rating", 15}}))
+
+	// Other errors abort the transaction and are returned without retrying
+	failure := errors.New("out of stock")
+	attempts := 0
+	err = backend.WithTransaction(ctx, db, func(ctx context.Context, tx backend.NoSQLTransaction) error {
+		attempts++
+		if err := txCollection(t, tx, name).DeleteMany(ctx, bson.D{}); err != nil {
+			return err
+		}
+		return failure
+	})
+	require.Equal(t, failure, err)
+	require.Equal(t, 1, attempts)
+	require.Len(t, findTypes(t, coll, bson.D{}), 5)
+}
+
+func TestTransactionChangeEvents(t *testing.T) {
+	ctx, db, name := makeTransactionDB(t)
+	coll, err := db.GetCollection(ctx, "testdb", name)
+	require.NoError(t, err)
+	stream, err := coll.Watch(ctx, backend.WatchOptions{})
+	require.NoError(t, err)
+	defer stream.Close(ctx)
+
+	tx, err := db.StartTransaction(ctx)
+	require.NoError(t, err)
+	txColl := txCollection(t, tx, name)
+	require.NoError(t, txColl.InsertOne(ctx, newtea))
+	require.NoError(t, txColl.DeleteOne(ctx, bson.D{{"type", "Scottish Breakfast"}}))
+	_, err = txColl.UpdateOne(ctx, bson.D{{"type", "Oolong"}}, bson.D{{"$set", bson.D{{"rating", 1}}}})
+	require.NoError(t, err)
+	_, err = txColl.UpdateOne(ctx, bson.D{{"type", "Oolong"}}, bson.D{{"$set", bson.D{{"rating", 2}}}})
+	require.NoError(t, err)
+	_, err = txColl.Watch(ctx, backend.WatchOptions{})
+	require.Error(t, err)
+	require.NoError(t, tx.Commit(ctx))
+
+	// Only the net change to each document is reported
+	update := nextEvent(t, stream)
+	require.Equal(t, backend.ChangeUpdate, update.OperationType)
+	require.Equal(t, int32(2), field(update.FullDocument, "rating"))
+	require.NoError(t, coll.DeleteOne(ctx, bson.D{{"type", "Masala"}}))
+	require.Equal(t, backend.ChangeDelete, nextEvent(t, stream).OperationType)
+}
+
+func TestDurableTransaction(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	db, coll := openDurable(t, dir, "always", "")
+	require.NoError(t, coll.InsertMany(ctx, []interface{}{teas[0], teas[1], teas[2]}))
+	err := backend.WithTransaction(ctx, db, func(ctx context.Context, tx backend.NoSQLTransaction) error {
+		coll, err := tx.GetCollection(ctx, "testdb", "teas")
+		if err != nil {
+			return err
+		}
+		if err := coll.DeleteOne(ctx, bson.D{{"type", "Masala"}}); err != nil {
+			return err
+		}
+		if _, err := coll.UpdateMany(ctx, bson.D{}, bson.D{{"$inc", bson.D{{"rating", 1}}}}); err != nil {
+			return err
+		}
+		orders, err := tx.GetCollection(ctx, "testdb", "orders")
+		if err != nil {
+			return err
+		}
+		return orders.InsertOne(ctx, bson.D{{"tea", "Oolong"}})
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	db, coll = openDurable(t, dir, "always", "")
+	defer db.Close()
+	require.ElementsMatch(t, []string{"English Breakfast", "Oolong"}, findTypes(t, coll, bson.D{{"rating", bson.D{{"$gte", 7}}}}))
+	require.Len(t, findTypes(t, coll, bson.D{}), 2)
+	orders, err := db.GetCollection(ctx, "testdb", "orders")
+	require.NoError(t, err)
+	count, err := orders.CountDocuments(ctx, bson.D{})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+}
+
+func TestDurableTransactionUnloggedCommit(t *testing.T) {
+	ctx := context.Background()
+	db, coll := openDurable(t, t.TempDir(), "always", "")
+	require.NoError(t, coll.InsertMany(ctx, []interface{}{teas[0], teas[1]}))
+
+	tx, err := db.StartTransaction(ctx)
+	require.NoError(t, err)
+	txColl, err := tx.GetCollection(ctx, "testdb", "teas")
+	require.NoError(t, err)
+	require.NoError(t, txColl.DeleteOne(ctx, bson.D{{"type", teas[0].Type}}))
+	require.NoError(t, txColl.InsertOne(ctx, teas[2]))
+	require.NoError(t, db.Close())
+
+	// A transaction that can't be written to the log is not applied
+	require.Error(t, tx.Commit(ctx))
+	require.ElementsMatch(t, []string{teas[0].Type, teas[1].Type}, findTypes(t, coll, bson.D{}))
+}
@@ -0,0 +1,292 @@
+package simplenosqldb_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func makeCollection(t *testing.T, docs ...interface{}) (context.Context, backend.NoSQLCollection) {
+	ctx, db := getDB(t)
+	coll, err := db.GetCollection(ctx, "testdb", fmt.Sprintf("testcollection%v", collectionid))
+	collectionid += 1
+	require.NoError(t, err)
+	require.NoError(t, coll.InsertMany(ctx, docs))
+	return ctx, coll
+}
+
+// Returns the first document matching filter, without its _id
+func getDocument(t *testing.T, coll backend.NoSQLCollection, filter bson.D) bson.D {
+	ctx := context.Background()
+	cursor, err := coll.FindOne(ctx, filter)
+	require.NoError(t, err)
+	var d bson.D
+	found, err := cursor.One(ctx, &d)
+	require.NoError(t, err)
+	require.True(t, found, "no document matches %v", filter)
+	var result bson.D
+	for _, e := range d {
+		if e.Key != "_id" {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+func TestMinMaxMul(t *testing.T) {
+	ctx, coll := makeCollection(t, bson.D{{"name", "a"}, {"n", int32(10)}, {"s", "x"}})
+	filter := bson.D{{"name", "a"}}
+
+	_, err := coll.UpdateOne(ctx, filter, bson.D{{"$min", bson.D{{"n", int32(8)}, {"low", int32(1)}}}, {"$max", bson.D{{"high", 2.5}}}})
+	require.NoError(t, err)
+	require.Equal(t, bson.D{{"name", "a"}, {"n", int32(8)}, {"s", "x"}, {"low", int32(1)}, {"high", 2.5}}, getDocument(t, coll, filter))
+
+	// Values that don't change the minimum or maximum are ignored
+	_, err = coll.UpdateOne(ctx, filter, bson.D{{"$min", bson.D{{"low", int32(5)}}}, {"$max", bson.D{{"n", int32(3)}, {"high", int32(2)}}}})
+	require.NoError(t, err)
+	require.Equal(t, bson.D{{"name", "a"}, {"n", int32(8)}, {"s", "x"}, {"low", int32(1)}, {"high", 2.5}}, getDocument(t, coll, filter))
+
+	// Multiplying promotes to the wider type, and a missing field becomes zero
+	_, err = coll.UpdateOne(ctx, filter, bson.D{{"$mul", bson.D{{"n", int64(3)}, {"high", int32(2)}, {"missing", 1.5}}}})
+	require.NoError(t, err)
+	require.Equal(t, bson.D{{"name", "a"}, {"n", int64(24)}, {"s", "x"}, {"low", int32(1)}, {"high", 5.0}, {"missing", 0.0}}, getDocument(t, coll, filter))
+
+	// Multiplying a string fails, and leaves the document unchanged
+	_, err = coll.UpdateOne(ctx, filter, bson.D{{"$mul", bson.D{{"n", int32(2)}, {"s", int32(2)}}}})
+	require.Error(t, err)
+	require.Equal(t, int64(24), getDocument(t, coll, filter)[1].Value)
+
+	_, err = coll.UpdateOne(ctx, filter, bson.D{{"$mul", bson.D{{"n", "2"}}}})
+	require.Error(t, err)
+}
+
+func TestRename(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+	filter := bson.D{{"type", "Assam"}}
+
+	_, err := db.UpdateOne(ctx, filter, bson.D{{"$rename", bson.D{{"packaging.kind", "kind"}, {"nonexistent", "other"}}}})
+	require.NoError(t, err)
+	require.Equal(t, bson.D{
+		{"type", "Assam"},
+		{"rating", int32(5)},
+		{"packaging", bson.D{{"length", int64(8)}, {"width", int64(5)}}},
+		{"sizes", bson.A{int32(16)}},
+		{"kind", "Cardboard"},
+	}, getDocument(t, db, filter))
+
+	// Renaming replaces an existing field
+	_, err = db.UpdateOne(ctx, filter, bson.D{{"$rename", bson.D{{"kind", "rating"}}}})
+	require.NoError(t, err)
+	require.Equal(t, "Cardboard", getDocument(t, db, filter)[1].Value)
+
+	for _, invalid := range []bson.D{{{"type", "type"}}, {{"packaging", "packaging.kind"}}, {{"type", 1}}, {{"sizes.$", "size"}}} {
+		_, err = db.UpdateOne(ctx, filter, bson.D{{"$rename", invalid}})
+		require.Error(t, err, "%v", invalid)
+	}
+}
+
+func TestPop(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+	filter := bson.D{{"type", "English Breakfast"}}
+
+	_, err := db.UpdateOne(ctx, filter, bson.D{{"$pop", bson.D{{"sizes", 1}}}})
+	require.NoError(t, err)
+	require.Equal(t, bson.A{int32(4), int32(8)}, getDocument(t, db, filter)[3].Value)
+
+	_, err = db.UpdateOne(ctx, filter, bson.D{{"$pop", bson.D{{"sizes", -1}}}})
+	require.NoError(t, err)
+	require.Equal(t, bson.A{int32(8)}, getDocument(t, db, filter)[3].Value)
+
+	// Popping a missing field does nothing
+	_, err = db.UpdateOne(ctx, filter, bson.D{{"$pop", bson.D{{"vendor", 1}}}})
+	require.NoError(t, err)
+	require.Len(t, getDocument(t, db, filter), 4)
+
+	_, err = db.UpdateOne(ctx, filter, bson.D{{"$pop", bson.D{{"sizes", 2}}}})
+	require.Error(t, err)
+	_, err = db.UpdateOne(ctx, filter, bson.D{{"$pop", bson.D{{"type", 1}}}})
+	require.Error(t, err)
+}
+
+func TestCurrentDate(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+	filter := bson.D{{"type", "Oolong"}}
+
+	before := time.Now().Add(-time.Second)
+	_, err := db.UpdateOne(ctx, filter, bson.D{{"$currentDate", bson.D{
+		{"modified", true},
+		{"packaging.checked", bson.D{{"$type", "date"}}},
+		{"stamp", bson.D{{"$type", "timestamp"}}},
+	}}})
+	require.NoError(t, err)
+
+	doc := getDocument(t, db, filter)
+	modified, isDate := doc[len(doc)-2].Value.(primitive.DateTime)
+	require.True(t, isDate, "%v", doc)
+	require.True(t, modified.Time().After(before))
+	_, isTimestamp := doc[len(doc)-1].Value.(primitive.Timestamp)
+	require.True(t, isTimestamp, "%v", doc)
+
+	_, err = db.UpdateOne(ctx, filter, bson.D{{"$currentDate", bson.D{{"modified", bson.D{{"$type", "string"}}}}}})
+	require.Error(t, err)
+}
+
+func TestPushModifiers(t *testing.T) {
+	ctx, coll := makeCollection(t, bson.D{{"name", "a"}, {"scores", bson.A{int32(5), int32(2)}}})
+	filter := bson.D{{"name", "a"}}
+
+	push := func(modifiers bson.D) bson.A {
+		_, err := coll.UpdateOne(ctx, filter, bson.D{{"$push", bson.D{{"scores", modifiers}}}})
+		require.NoError(t, err)
+		return getDocument(t, coll, filter)[1].Value.(bson.A)
+	}
+
+	require.Equal(t, bson.A{int32(1), int32(2), int32(3)}, push(bson.D{{"$each", bson.A{3, 1}}, {"$sort", 1}, {"$slice", 3}}))
+	require.Equal(t, bson.A{int32(9), int32(1), int32(2), int32(3)}, push(bson.D{{"$each", bson.A{9}}, {"$position", 0}}))
+	require.Equal(t, bson.A{int32(9), int32(1), int32(7), int32(2), int32(3)}, push(bson.D{{"$each", bson.A{7}}, {"$position", -2}}))
+	require.Equal(t, bson.A{int32(2), int32(1)}, push(bson.D{{"$each", bson.A{}}, {"$sort", -1}, {"$slice", -2}}))
+	require.Equal(t, bson.A{int32(2), int32(1), int32(4), int32(5)}, push(bson.D{{"$each", bson.A{4, 5}}}))
+
+	// Documents can be sorted by their fields
+	ctx, coll = makeCollection(t, bson.D{{"name", "a"}})
+	require.Equal(t, bson.A{
+		bson.D{{"player", "c"}, {"score", int32(9)}},
+		bson.D{{"player", "a"}, {"score", int32(7)}},
+	}, push(bson.D{
+		{"$each", bson.A{bson.D{{"player", "a"}, {"score", 7}}, bson.D{{"player", "b"}, {"score", 3}}, bson.D{{"player", "c"}, {"score", 9}}}},
+		{"$sort", bson.D{{"score", -1}}},
+		{"$slice", 2},
+	}))
+
+	invalid := []bson.D{
+		{{"$slice", 2}},
+		{{"$each", bson.A{1}}, {"$nonexistent", 1}},
+		{{"$each", 1}},
+		{{"$each", bson.A{1}}, {"$sort", 2}},
+		{{"$each", bson.A{1}}, {"$position", "first"}},
+	}
+	for _, modifiers := range invalid {
+		_, err := coll.UpdateOne(ctx, filter, bson.D{{"$push", bson.D{{"scores", modifiers}}}})
+		require.Error(t, err, "%v", modifiers)
+	}
+}
+
+func TestUpsertWithOptions(t *testing.T) {
+	ctx, coll := makeCollection(t, bson.D{{"name", "a"}})
+
+	filter := bson.D{{"name", "b"}, {"packaging.kind", bson.D{{"$eq", "Paper"}}}, {"rating", bson.D{{"$gt", 1}}}}
+	update := bson.D{{"$set", bson.D{{"rating", int32(3)}}}, {"$setOnInsert", bson.D{{"created", true}}}}
+
+	// Without upsert, nothing is inserted
+	updated, err := coll.UpdateOneWithOptions(ctx, filter, update, backend.UpdateOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 0, updated)
+
+	updated, err = coll.UpdateOneWithOptions(ctx, filter, update, backend.UpdateOptions{Upsert: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, updated)
+	require.Equal(t, bson.D{
+		{"name", "b"},
+		{"packaging", bson.D{{"kind", "Paper"}}},
+		{"rating", int32(3)},
+		{"created", true},
+	}, getDocument(t, coll, bson.D{{"name", "b"}}))
+
+	// $setOnInsert is ignored when updating an existing document
+	update = bson.D{{"$set", bson.D{{"rating", int32(4)}}}, {"$setOnInsert", bson.D{{"created", false}}}}
+	updated, err = coll.UpdateOneWithOptions(ctx, filter, update, backend.UpdateOptions{Upsert: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, updated)
+	require.Equal(t, bson.D{
+		{"name", "b"},
+		{"packaging", bson.D{{"kind", "Paper"}}},
+		{"rating", int32(4)},
+		{"created", true},
+	}, getDocument(t, coll, bson.D{{"name", "b"}}))
+
+	updated, err = coll.UpdateManyWithOptions(ctx, bson.D{{"name", "c"}}, bson.D{{"$inc", bson.D{{"count", 1}}}}, backend.UpdateOptions{Upsert: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, updated)
+	require.Equal(t, bson.D{{"name", "c"}, {"count", int64(1)}}, getDocument(t, coll, bson.D{{"name", "c"}}))
+
+	count, err := coll.CountDocuments(ctx, bson.D{})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), count)
+}
+
+func TestPositionalUpdates(t *testing.T) {
+	ctx, coll := makeCollection(t, bson.D{
+		{"name", "s"},
+		{"scores", bson.A{int32(70), int32(80), int32(90)}},
+		{"grades", bson.A{
+			bson.D{{"grade", int32(80)}, {"mean", int32(75)}},
+			bson.D{{"grade", int32(85)}, {"mean", int32(90)}},
+			bson.D{{"grade", int32(85)}, {"mean", int32(85)}},
+		}},
+	})
+	get := func(field int) bson.A {
+		return getDocument(t, coll, bson.D{{"name", "s"}})[field].Value.(bson.A)
+	}
+
+	// $ updates the first element matched by the query
+	_, err := coll.UpdateOne(ctx, bson.D{{"name", "s"}, {"scores", 80}}, bson.D{{"$set", bson.D{{"scores.$", 82}}}})
+	require.NoError(t, err)
+	require.Equal(t, bson.A{int32(70), int32(82), int32(90)}, get(1))
+
+	_, err = coll.UpdateOne(ctx, bson.D{{"grades.grade", 85}}, bson.D{{"$set", bson.D{{"grades.$.std", 6}}}})
+	require.NoError(t, err)
+	require.Equal(t, bson.D{{"grade", int32(85)}, {"mean", int32(90)}, {"std", int32(6)}}, get(2)[1])
+
+	_, err = coll.UpdateOne(ctx, bson.D{{"grades", bson.D{{"$elemMatch", bson.D{{"grade", 85}, {"mean", bson.D{{"$lt", 90}}}}}}}}, bson.D{{"$inc", bson.D{{"grades.$.grade", 1}}}})
+	require.NoError(t, err)
+	require.Equal(t, bson.D{{"grade", int32(86)}, {"mean", int32(85)}}, get(2)[2])
+
+	// $[] updates all elements
+	_, err = coll.UpdateOne(ctx, bson.D{{"name", "s"}}, bson.D{{"$inc", bson.D{{"scores.$[]", 1}}}})
+	require.NoError(t, err)
+	require.Equal(t, bson.A{int32(71), int32(83), int32(91)}, get(1))
+
+	// $[<identifier>] updates the elements matched by an array filter
+	_, err = coll.UpdateManyWithOptions(ctx, bson.D{{"name", "s"}}, bson.D{{"$set", bson.D{{"grades.$[elem].passed", true}, {"scores.$[s]", 100}}}}, backend.UpdateOptions{
+		ArrayFilters: []bson.D{
+			{{"elem.grade", bson.D{{"$gte", 85}}}, {"elem.mean", bson.D{{"$gt", 80}}}},
+			{{"s", bson.D{{"$gt", 80}}}},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, bson.A{
+		bson.D{{"grade", int32(80)}, {"mean", int32(75)}},
+		bson.D{{"grade", int32(85)}, {"mean", int32(90)}, {"std", int32(6)}, {"passed", true}},
+		bson.D{{"grade", int32(86)}, {"mean", int32(85)}, {"passed", true}},
+	}, get(2))
+	require.Equal(t, bson.A{int32(71), int32(100), int32(100)}, get(1))
+
+	// Unsetting an element sets it to null
+	_, err = coll.UpdateOne(ctx, bson.D{{"scores", 71}}, bson.D{{"$unset", bson.D{{"scores.$", ""}}}})
+	require.NoError(t, err)
+	require.Equal(t, bson.A{nil, int32(100), int32(100)}, get(1))
+
+	invalid := []struct {
+		filter       bson.D
+		update       bson.D
+		arrayFilters []bson.D
+	}{
+		{bson.D{{"name", "s"}}, bson.D{{"$set", bson.D{{"scores.$", 1}}}}, nil},
+		{bson.D{{"name", "s"}}, bson.D{{"$set", bson.D{{"scores.$[x]", 1}}}}, nil},
+		{bson.D{{"name", "s"}}, bson.D{{"$set", bson.D{{"scores.$[]", 1}}}}, []bson.D{{{"x", 1}}}},
+		{bson.D{{"name", "s"}}, bson.D{{"$set", bson.D{{"scores.$[X]", 1}}}}, []bson.D{{{"X", 1}}}},
+		{bson.D{{"name", "s"}}, bson.D{{"$set", bson.D{{"name.$[]", 1}}}}, nil},
+		{bson.D{{"name", "s"}}, bson.D{{"$set", bson.D{{"$[]", 1}}}}, nil},
+	}
+	for _, u := range invalid {
+		_, err := coll.UpdateOneWithOptions(ctx, u.filter, u.update, backend.UpdateOptions{ArrayFilters: u.arrayFilters})
+		require.Error(t, err, "%v", u.update)
+	}
+	require.Equal(t, "s", getDocument(t, coll, bson.D{{"name", "s"}})[0].Value)
+}
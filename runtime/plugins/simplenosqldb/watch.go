@@ -0,0 +1,134 @@
+package simplenosqldb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// The minimum number of recent changes retained by each collection, so that change streams can be
+// resumed.  Like the size of MongoDB's oplog, this bounds how far behind a change stream can fall.
+var changeHistory = 10000
+
+// Sets the minimum number of recent changes retained by each collection; returns the previous value
+func SetChangeHistory(events int) int {
+	before := changeHistory
+	changeHistory = events
+	return before
+}
+
+// The recent changes to a collection.  Changes are only retained once the collection has been watched.
+type changeLog struct {
+	sync.Mutex
+	watched bool
+	events  []backend.NoSQLChangeEvent
+	first   uint64        // Sequence number of events[0]
+	next    uint64        // Sequence number of the next event
+	notify  chan struct{} // Closed and replaced when an event is recorded
+}
+
+// Implements the [backend.NoSQLChangeStream] interface for a [SimpleCollection]
+type SimpleChangeStream struct {
+	changes *changeLog
+	next    uint64 // Sequence number of the next event to return
+	closed  chan struct{}
+	close   sync.Once
+}
+
+func newChangeLog() *changeLog {
+	return &changeLog{first: 1, next: 1, notify: make(chan struct{})}
+}
+
+// Records a change to the document with _id id, if the collection has been watched.  doc is copied.
+func (c *changeLog) record(operationType string, id any, doc bson.D) {
+	c.Lock()
+	defer c.Unlock()
+	if !c.watched {
+		return
+	}
+	event := backend.NoSQLChangeEvent{
+		OperationType: operationType,
+		DocumentKey:   copyValue(id),
+		ResumeToken:   strconv.FormatUint(c.next, 16),
+	}
+	if doc != nil {
+		event.FullDocument = copyDocument(doc)
+	}
+	c.events = append(c.events, event)
+	c.next++
+	// Discard old events in batches, so that recording an event takes amortized constant time
+	if len(c.events) >= 2*changeHistory {
+		dropped := len(c.events) - changeHistory
+		c.events = append([]backend.NoSQLChangeEvent(nil), c.events[dropped:]...)
+		c.first += uint64(dropped)
+	}
+	close(c.notify)
+	c.notify = make(chan struct{})
+}
+
+func (db *SimpleCollection) Watch(ctx context.Context, opts backend.WatchOptions) (backend.NoSQLChangeStream, error) {
+	if db.writes != nil {
+		return nil, fmt.Errorf("collections cannot be watched in a transaction")
+	}
+	c := db.changes
+	c.Lock()
+	defer c.Unlock()
+	c.watched = true
+
+	stream := &SimpleChangeStream{changes: c, next: c.next, closed: make(chan struct{})}
+	if opts.ResumeAfter != "" {
+		seq, err := strconv.ParseUint(opts.ResumeAfter, 16, 64)
+		if err != nil || seq == 0 || seq >= c.next {
+			return nil, fmt.Errorf("invalid resume token %q", opts.ResumeAfter)
+		}
+		if seq+1 < c.first {
+			return nil, fmt.Errorf("cannot resume after %q; the event is no longer retained", opts.ResumeAfter)
+		}
+		stream.next = seq + 1
+	}
+	return stream, nil
+}
+
+func (s *SimpleChangeStream) Next(ctx context.Context) (backend.NoSQLChangeEvent, error) {
+	for {
+		select {
+		case <-s.closed:
+			return backend.NoSQLChangeEvent{}, backend.ErrChangeStreamClosed
+		default:
+		}
+
+		s.changes.Lock()
+		if s.next < s.changes.first {
+			s.changes.Unlock()
+			return backend.NoSQLChangeEvent{}, fmt.Errorf("change stream fell more than %v events behind", changeHistory)
+		}
+		if s.next < s.changes.next {
+			event := s.changes.events[s.next-s.changes.first]
+			s.next++
+			s.changes.Unlock()
+			if event.FullDocument != nil {
+				event.FullDocument = copyDocument(event.FullDocument)
+			}
+			return event, nil
+		}
+		notify := s.changes.notify
+		s.changes.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return backend.NoSQLChangeEvent{}, ctx.Err()
+		case <-s.closed:
+			return backend.NoSQLChangeEvent{}, backend.ErrChangeStreamClosed
+		case <-notify:
+		}
+	}
+}
+
+func (s *SimpleChangeStream) Close(ctx context.Context) error {
+	s.close.Do(func() { close(s.closed) })
+	return nil
+}
@@ -0,0 +1,165 @@
+package simplenosqldb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+	"github.com/blueprint-uservices/blueprint/runtime/plugins/simplenosqldb"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func nextEvent(t *testing.T, stream backend.NoSQLChangeStream) backend.NoSQLChangeEvent {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	event, err := stream.Next(ctx)
+	require.NoError(t, err)
+	return event
+}
+
+func field(d bson.D, key string) any {
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value
+		}
+	}
+	return nil
+}
+
+func TestWatch(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	stream, err := db.Watch(ctx, backend.WatchOptions{})
+	require.NoError(t, err)
+	defer stream.Close(ctx)
+
+	require.NoError(t, db.InsertOne(ctx, newtea))
+	_, err = db.UpdateOne(ctx, bson.D{{"type", "Oolong"}}, bson.D{{"$set", bson.D{{"rating", 2}}}})
+	require.NoError(t, err)
+	_, err = db.ReplaceOne(ctx, bson.D{{"type", "Assam"}}, Tea{Type: "Darjeeling"})
+	require.NoError(t, err)
+	require.NoError(t, db.DeleteMany(ctx, bson.D{{"rating", bson.D{{"$gt", 7}}}}))
+
+	insert := nextEvent(t, stream)
+	require.Equal(t, backend.ChangeInsert, insert.OperationType)
+	require.Equal(t, "Scottish Breakfast", field(insert.FullDocument, "type"))
+	require.Equal(t, field(insert.FullDocument, "_id"), insert.DocumentKey)
+
+	update := nextEvent(t, stream)
+	require.Equal(t, backend.ChangeUpdate, update.OperationType)
+	require.Equal(t, "Oolong", field(update.FullDocument, "type"))
+	require.Equal(t, int32(2), field(update.FullDocument, "rating"))
+
+	replace := nextEvent(t, stream)
+	require.Equal(t, backend.ChangeReplace, replace.OperationType)
+	require.Equal(t, "Darjeeling", field(replace.FullDocument, "type"))
+
+	var deleted []any
+	for i := 0; i < 3; i++ {
+		event := nextEvent(t, stream)
+		require.Equal(t, backend.ChangeDelete, event.OperationType)
+		require.Nil(t, event.FullDocument)
+		deleted = append(deleted, event.DocumentKey)
+	}
+	require.Contains(t, deleted, insert.DocumentKey)
+
+	// Events are copies, unaffected by later changes
+	_, err = db.UpdateOne(ctx, bson.D{{"type", "Oolong"}}, bson.D{{"$set", bson.D{{"rating", 3}}}})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), field(update.FullDocument, "rating"))
+}
+
+func TestWatchResume(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	stream, err := db.Watch(ctx, backend.WatchOptions{})
+	require.NoError(t, err)
+	for _, tea := range []string{"Darjeeling", "Sencha", "Gunpowder"} {
+		require.NoError(t, db.InsertOne(ctx, Tea{Type: tea}))
+	}
+	first := nextEvent(t, stream)
+	require.Equal(t, "Darjeeling", field(first.FullDocument, "type"))
+	require.NoError(t, stream.Close(ctx))
+
+	resumed, err := db.Watch(ctx, backend.WatchOptions{ResumeAfter: first.ResumeToken})
+	require.NoError(t, err)
+	defer resumed.Close(ctx)
+	require.Equal(t, "Sencha", field(nextEvent(t, resumed).FullDocument, "type"))
+	last := nextEvent(t, resumed)
+	require.Equal(t, "Gunpowder", field(last.FullDocument, "type"))
+
+	// Resuming after the last event waits for the next change
+	latest, err := db.Watch(ctx, backend.WatchOptions{ResumeAfter: last.ResumeToken})
+	require.NoError(t, err)
+	defer latest.Close(ctx)
+	require.NoError(t, db.DeleteOne(ctx, bson.D{{"type", "Sencha"}}))
+	require.Equal(t, backend.ChangeDelete, nextEvent(t, latest).OperationType)
+
+	for _, invalid := range []string{"zzz", "0", "ffffff"} {
+		_, err := db.Watch(ctx, backend.WatchOptions{ResumeAfter: invalid})
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestWatchWaits(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+
+	stream, err := db.Watch(ctx, backend.WatchOptions{})
+	require.NoError(t, err)
+
+	// Next returns when the context is done if there are no changes
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = stream.Next(timeout)
+	require.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+
+	events := make(chan backend.NoSQLChangeEvent)
+	go func() {
+		event, err := stream.Next(ctx)
+		if err == nil {
+			events <- event
+		}
+		close(events)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, db.InsertOne(ctx, newtea))
+	select {
+	case event := <-events:
+		require.Equal(t, backend.ChangeInsert, event.OperationType)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for change event")
+	}
+
+	// Closing the stream interrupts Next
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		stream.Close(ctx)
+	}()
+	_, err = stream.Next(ctx)
+	require.True(t, errors.Is(err, backend.ErrChangeStreamClosed), "%v", err)
+}
+
+func TestWatchHistory(t *testing.T) {
+	ctx, db := MakeTestDB(t)
+	defer simplenosqldb.SetChangeHistory(simplenosqldb.SetChangeHistory(2))
+
+	stream, err := db.Watch(ctx, backend.WatchOptions{})
+	require.NoError(t, err)
+	defer stream.Close(ctx)
+	require.NoError(t, db.InsertOne(ctx, Tea{Type: "Darjeeling"}))
+	first := nextEvent(t, stream)
+
+	// A stream that falls too far behind fails
+	for i := 0; i < 4; i++ {
+		_, err := db.UpdateOne(ctx, bson.D{{"type", "Darjeeling"}}, bson.D{{"$inc", bson.D{{"rating", 1}}}})
+		require.NoError(t, err)
+	}
+	_, err = stream.Next(ctx)
+	require.Error(t, err)
+
+	_, err = db.Watch(ctx, backend.WatchOptions{ResumeAfter: first.ResumeToken})
+	require.Error(t, err)
+}
@@ -0,0 +1,66 @@
+package simplequeue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+)
+
+// A [SimpleQueue] whose capacity, visibility timeout and maximum number of deliveries are configured
+// when it is instantiated.
+type ConfiguredQueue struct {
+	backend.Queue
+	q *SimpleQueue
+}
+
+// Instantiates a [ConfiguredQueue] named name.
+//   - capacity is the maximum number of items in the queue, including unacknowledged items; "0" means
+//     the queue is unbounded.
+//   - visibilityTimeout is a duration such as "30s" after which unacknowledged items are redelivered.
+//   - maxDeliveries is the number of times an item is delivered before it is moved to the dead-letter
+//     queue; "0" means items are redelivered until they are acknowledged.
+//
+// Empty values leave the defaults of a [SimpleQueue].
+func NewConfiguredQueue(ctx context.Context, name string, capacity string, visibilityTimeout string, maxDeliveries string) (*ConfiguredQueue, error) {
+	n, timeout, deliveries := DefaultCapacity, DefaultVisibilityTimeout, DefaultMaxDeliveries
+	var err error
+	if capacity != "" {
+		if n, err = strconv.Atoi(capacity); err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid capacity %q for queue %v; expected a non-negative integer", capacity, name)
+		}
+	}
+	if visibilityTimeout != "" {
+		if timeout, err = time.ParseDuration(visibilityTimeout); err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid visibility timeout %q for queue %v; expected a positive duration", visibilityTimeout, name)
+		}
+	}
+	if maxDeliveries != "" {
+		if deliveries, err = strconv.Atoi(maxDeliveries); err != nil || deliveries < 0 {
+			return nil, fmt.Errorf("invalid maximum number of deliveries %q for queue %v; expected a non-negative integer", maxDeliveries, name)
+		}
+	}
+	return &ConfiguredQueue{q: newSimpleQueue(n, timeout, deliveries)}, nil
+}
+
+// Returns the queue's dead-letter queue; see [SimpleQueue.DeadLetters].
+func (q *ConfiguredQueue) DeadLetters() *SimpleQueue {
+	return q.q.DeadLetters()
+}
+
+// Push implements backend.Queue.
+func (q *ConfiguredQueue) Push(ctx context.Context, item interface{}) (bool, error) {
+	return q.q.Push(ctx, item)
+}
+
+// Pop implements backend.Queue.
+func (q *ConfiguredQueue) Pop(ctx context.Context, dst interface{}) (bool, error) {
+	return q.q.Pop(ctx, dst)
+}
+
+// PopDelivery implements backend.Queue.
+func (q *ConfiguredQueue) PopDelivery(ctx context.Context, dst interface{}) (backend.QueueDelivery, bool, error) {
+	return q.q.PopDelivery(ctx, dst)
+}
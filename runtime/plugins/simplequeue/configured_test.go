@@ -0,0 +1,29 @@
+package simplequeue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend/backendtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfiguredQueue(t *testing.T) {
+	ctx := context.Background()
+	q, err := NewConfiguredQueue(ctx, "q", "0", "100ms", "2")
+	require.NoError(t, err)
+	backendtest.TestQueue(t, q, q.DeadLetters(), 100*time.Millisecond, 2)
+
+	// Empty values leave the defaults
+	q, err = NewConfiguredQueue(ctx, "q", "", "", "")
+	require.NoError(t, err)
+	require.Equal(t, DefaultCapacity, q.q.capacity)
+	require.Equal(t, DefaultVisibilityTimeout, q.q.visibilityTimeout)
+	require.Equal(t, DefaultMaxDeliveries, q.q.maxDeliveries)
+
+	for _, args := range [][3]string{{"-1", "", ""}, {"ten", "", ""}, {"", "0s", ""}, {"", "soon", ""}, {"", "", "-2"}} {
+		_, err := NewConfiguredQueue(ctx, "q", args[0], args[1], args[2])
+		require.Error(t, err, args)
+	}
+}
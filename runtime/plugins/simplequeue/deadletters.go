@@ -0,0 +1,42 @@
+package simplequeue
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+)
+
+// The dead-letter queue of a [SimpleQueue] or [ConfiguredQueue] as a [backend.Queue] of its own, so that
+// services can consume the items that were dead-lettered.  See [SimpleQueue.DeadLetters].
+type DeadLetterQueue struct {
+	backend.Queue
+	q *SimpleQueue
+}
+
+// Instantiates the [DeadLetterQueue] of queue, which must be a [SimpleQueue] or a [ConfiguredQueue].
+func NewDeadLetterQueue(ctx context.Context, queue backend.Queue) (*DeadLetterQueue, error) {
+	switch q := queue.(type) {
+	case *SimpleQueue:
+		return &DeadLetterQueue{q: q.DeadLetters()}, nil
+	case *ConfiguredQueue:
+		return &DeadLetterQueue{q: q.DeadLetters()}, nil
+	default:
+		return nil, fmt.Errorf("%T is not a simple queue and has no dead-letter queue", queue)
+	}
+}
+
+// Push implements backend.Queue.
+func (q *DeadLetterQueue) Push(ctx context.Context, item interface{}) (bool, error) {
+	return q.q.Push(ctx, item)
+}
+
+// Pop implements backend.Queue.
+func (q *DeadLetterQueue) Pop(ctx context.Context, dst interface{}) (bool, error) {
+	return q.q.Pop(ctx, dst)
+}
+
+// PopDelivery implements backend.Queue.
+func (q *DeadLetterQueue) PopDelivery(ctx context.Context, dst interface{}) (backend.QueueDelivery, bool, error) {
+	return q.q.PopDelivery(ctx, dst)
+}
@@ -0,0 +1,28 @@
+package simplequeue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend/backendtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetterQueue(t *testing.T) {
+	ctx := context.Background()
+	q, err := NewConfiguredQueue(ctx, "q", "0", "100ms", "2")
+	require.NoError(t, err)
+	deadLetters, err := NewDeadLetterQueue(ctx, q)
+	require.NoError(t, err)
+	backendtest.TestQueue(t, q, deadLetters, 100*time.Millisecond, 2)
+
+	simple, err := NewSimpleQueue(ctx)
+	require.NoError(t, err)
+	deadLetters, err = NewDeadLetterQueue(ctx, simple)
+	require.NoError(t, err)
+	require.Same(t, simple.DeadLetters(), deadLetters.q)
+
+	_, err = NewDeadLetterQueue(ctx, deadLetters)
+	require.Error(t, err)
+}
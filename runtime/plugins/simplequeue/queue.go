@@ -1,65 +1,222 @@
-// Package simplequeue implements an simple in-memory [backend.Queue] that internally
-// uses a golang channel of capacity 10 for passing items from producer to consumer.
+// Package simplequeue implements an simple in-memory [backend.Queue] that holds at most 10 items.
 //
-// Calls to [backend.Queue.Push] will block once the queue capacity reaches 10.
+// Calls to [backend.Queue.Push] will block once the queue capacity reaches 10.  Items popped with
+// [backend.Queue.PopDelivery] count towards the capacity until they are acknowledged.
+//
+// Unacknowledged items are redelivered after a visibility timeout of 30 seconds, and items are moved
+// to the queue's in-memory dead-letter queue, see [SimpleQueue.DeadLetters], after 5 deliveries.  A
+// [ConfiguredQueue] can be used to configure the capacity, visibility timeout and number of deliveries, and a
+// [DeadLetterQueue] exposes the dead-letter queue as a queue of its own.
 package simplequeue
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
 )
 
-// A simple chan-based queue that implements the [backend.Queue] interface
+// The default settings of a [SimpleQueue]
+const (
+	DefaultCapacity          = 10
+	DefaultVisibilityTimeout = 30 * time.Second
+	DefaultMaxDeliveries     = 5
+)
+
+// A simple in-memory queue that implements the [backend.Queue] interface
 type SimpleQueue struct {
 	backend.Queue
-	q chan any
+
+	capacity          int // 0 means unbounded
+	visibilityTimeout time.Duration
+	maxDeliveries     int          // 0 means unlimited
+	deadLetters       *SimpleQueue // nil for a dead-letter queue
+
+	mu      sync.Mutex
+	items   []*message    // items waiting to be popped, front first
+	size    int           // items waiting to be popped and unacknowledged deliveries
+	changed chan struct{} // closed when items or size change
 }
 
-// Instantiates a [backend.Queue] that internally uses a golang channel of capacity 10.
+// An item in the queue
+type message struct {
+	item       any
+	deliveries int
+}
+
+// Instantiates a [backend.Queue] that holds at most 10 items.
 //
 // Calls to [q.Push] will block once the queue capacity reaches 10.
 func NewSimpleQueue(ctx context.Context) (q *SimpleQueue, err error) {
-	return newSimpleQueueWithCapacity(10), nil
+	return newSimpleQueue(DefaultCapacity, DefaultVisibilityTimeout, DefaultMaxDeliveries), nil
 }
 
 // Instantiates a [simpleQueue] with the specified capacity.
 func newSimpleQueueWithCapacity(capacity int) *SimpleQueue {
-	return &SimpleQueue{
-		q: make(chan any, capacity),
+	return newSimpleQueue(capacity, DefaultVisibilityTimeout, DefaultMaxDeliveries)
+}
+
+// Instantiates a [SimpleQueue] with the specified settings and an unbounded dead-letter queue
+func newSimpleQueue(capacity int, visibilityTimeout time.Duration, maxDeliveries int) *SimpleQueue {
+	q := &SimpleQueue{
+		capacity:          capacity,
+		visibilityTimeout: visibilityTimeout,
+		maxDeliveries:     maxDeliveries,
+		changed:           make(chan struct{}),
 	}
+	q.deadLetters = &SimpleQueue{
+		visibilityTimeout: visibilityTimeout,
+		changed:           make(chan struct{}),
+	}
+	return q
+}
+
+// Returns the queue to which items that were delivered too many times, or that were rejected without
+// being requeued, are moved.
+//
+// The dead-letter queue is unbounded.  Its items are redelivered any number of times, and items
+// rejected without being requeued are discarded.
+func (q *SimpleQueue) DeadLetters() *SimpleQueue {
+	return q.deadLetters
 }
 
 // Pop implements backend.Queue.
 func (q *SimpleQueue) Pop(ctx context.Context, dst interface{}) (bool, error) {
-	select {
-	case v := <-q.q:
-		return true, backend.CopyResult(v, dst)
-	default:
-		{
-			select {
-			case v := <-q.q:
-				return true, backend.CopyResult(v, dst)
-			case <-ctx.Done():
-				return false, nil
-			}
-		}
+	if !q.wait(ctx, func() bool { return len(q.items) > 0 }) {
+		return false, nil
 	}
+	defer q.mu.Unlock()
+	msg := q.popFront()
+	q.size--
+	q.notify()
+	return true, backend.CopyResult(msg.item, dst)
+}
+
+// PopDelivery implements backend.Queue.
+func (q *SimpleQueue) PopDelivery(ctx context.Context, dst interface{}) (backend.QueueDelivery, bool, error) {
+	if !q.wait(ctx, func() bool { return len(q.items) > 0 }) {
+		return nil, false, nil
+	}
+	defer q.mu.Unlock()
+	msg := q.popFront()
+	msg.deliveries++
+	d := &delivery{q: q, msg: msg, deliveries: msg.deliveries}
+	if err := backend.CopyResult(msg.item, dst); err != nil {
+		q.settle(d, false, false)
+		return nil, true, err
+	}
+	d.timer = time.AfterFunc(q.visibilityTimeout, d.expire)
+	return d, true, nil
 }
 
 // Push implements backend.Queue.
 func (q *SimpleQueue) Push(ctx context.Context, item interface{}) (bool, error) {
-	select {
-	case q.q <- item:
-		return true, nil
+	if !q.wait(ctx, func() bool { return q.capacity == 0 || q.size < q.capacity }) {
+		return false, nil
+	}
+	defer q.mu.Unlock()
+	q.items = append(q.items, &message{item: item})
+	q.size++
+	q.notify()
+	return true, nil
+}
+
+// Waits until ready, which is called with q.mu held, returns true, or until ctx is done.  Returns
+// with q.mu held if ready returned true.
+//
+// ready is called at least once, so an item can be pushed or popped even if ctx is already done.
+func (q *SimpleQueue) wait(ctx context.Context, ready func() bool) bool {
+	q.mu.Lock()
+	for !ready() {
+		changed := q.changed
+		q.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+		q.mu.Lock()
+	}
+	return true
+}
+
+// Wakes up the calls waiting for the queue to change.  q.mu must be held.
+func (q *SimpleQueue) notify() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// Removes the item at the front of the queue.  q.mu must be held.
+func (q *SimpleQueue) popFront() *message {
+	msg := q.items[0]
+	q.items[0] = nil
+	q.items = q.items[1:]
+	return msg
+}
+
+// Ends delivery d.  Unless the item was acknowledged, it is returned to the front of the queue if
+// requeue is true and it can be delivered again, and is moved to the dead-letter queue otherwise.
+// q.mu must be held.
+func (q *SimpleQueue) settle(d *delivery, ack bool, requeue bool) error {
+	if d.done {
+		return backend.ErrDeliveryExpired
+	}
+	d.done = true
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+
+	switch {
+	case ack:
+		q.size--
+	case requeue && (q.maxDeliveries == 0 || d.deliveries < q.maxDeliveries):
+		q.items = append([]*message{d.msg}, q.items...)
 	default:
-		{
-			select {
-			case q.q <- item:
-				return true, nil
-			case <-ctx.Done():
-				return false, nil
-			}
+		q.size--
+		if q.deadLetters != nil {
+			q.deadLetters.mu.Lock()
+			q.deadLetters.items = append(q.deadLetters.items, &message{item: d.msg.item})
+			q.deadLetters.size++
+			q.deadLetters.notify()
+			q.deadLetters.mu.Unlock()
 		}
 	}
+	q.notify()
+	return nil
+}
+
+// An item popped with [SimpleQueue.PopDelivery]
+type delivery struct {
+	q          *SimpleQueue
+	msg        *message
+	deliveries int
+	timer      *time.Timer
+	done       bool // guarded by q.mu
+}
+
+// Ack implements backend.QueueDelivery
+func (d *delivery) Ack(ctx context.Context) error {
+	d.q.mu.Lock()
+	defer d.q.mu.Unlock()
+	return d.q.settle(d, true, false)
+}
+
+// Nack implements backend.QueueDelivery
+func (d *delivery) Nack(ctx context.Context, requeue bool) error {
+	d.q.mu.Lock()
+	defer d.q.mu.Unlock()
+	return d.q.settle(d, false, requeue)
+}
+
+// Deliveries implements backend.QueueDelivery
+func (d *delivery) Deliveries() int {
+	return d.deliveries
+}
+
+// Redelivers the item when the visibility timeout elapses
+func (d *delivery) expire() {
+	d.q.mu.Lock()
+	defer d.q.mu.Unlock()
+	d.q.settle(d, false, true)
 }
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend/backendtest"
 	"github.com/stretchr/testify/require"
 )
 
@@ -248,3 +249,57 @@ func TestTryTimeout(t *testing.T) {
 		require.Equal(t, second, rcv)
 	}
 }
+
+func TestConformance(t *testing.T) {
+	q := newSimpleQueue(DefaultCapacity, 100*time.Millisecond, 3)
+	backendtest.TestQueue(t, q, q.DeadLetters(), 100*time.Millisecond, 3)
+}
+
+func TestCapacityIncludesUnacknowledged(t *testing.T) {
+	ctx := context.Background()
+	q := newSimpleQueueWithCapacity(1)
+
+	success, err := q.Push(ctx, "first")
+	require.NoError(t, err)
+	require.True(t, success)
+
+	var rcv string
+	d, success, err := q.PopDelivery(ctx, &rcv)
+	require.NoError(t, err)
+	require.True(t, success)
+
+	{
+		// The queue is full until the item is acknowledged
+		timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		success, err := q.Push(timeoutCtx, "second")
+		require.NoError(t, err)
+		require.False(t, success)
+	}
+
+	require.NoError(t, d.Ack(ctx))
+	success, err = q.Push(ctx, "second")
+	require.NoError(t, err)
+	require.True(t, success)
+}
+
+func TestPopDeliveryWrongType(t *testing.T) {
+	ctx := context.Background()
+	q := newSimpleQueueWithCapacity(1)
+
+	success, err := q.Push(ctx, "hello")
+	require.NoError(t, err)
+	require.True(t, success)
+
+	// Items that can't be received are dead-lettered
+	var rcv int
+	_, success, err = q.PopDelivery(ctx, &rcv)
+	require.Error(t, err)
+	require.True(t, success)
+
+	var letter string
+	success, err = q.DeadLetters().Pop(ctx, &letter)
+	require.NoError(t, err)
+	require.True(t, success)
+	require.Equal(t, "hello", letter)
+}
@@ -0,0 +1,105 @@
+package sqlitereldb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
+	"github.com/blueprint-uservices/blueprint/runtime/core/migrate"
+)
+
+// A [SqliteRelDB] with a name.  Instances with the same name share a database.
+//
+// The database is either in-memory, or stored in a file in a configurable directory so that its
+// contents survive restarts.  When the database has no tables, such as when it is first created, it can
+// be initialized by a schema file containing SQL statements, e.g. to create tables and insert seed data.
+// Its schema can also be managed by versioned migrations; see [migrate].
+type NamedSqliteRelDB struct {
+	backend.RelationalDB
+	db *SqliteRelDB
+}
+
+// Instantiates a [NamedSqliteRelDB] with the given name.
+//   - If dir is empty, the database is in-memory, and is shared with the other instances in the process
+//     that have the same name.
+//   - Otherwise, the database is stored in the file name.db in dir, which is created if it doesn't exist.
+//   - If schema is non-empty, it is the path of a file of SQL statements that are executed when the
+//     database has no tables.  The statements are executed in a transaction, so if one fails, none of
+//     them are applied and an error is returned.
+//   - If migrations is non-empty, it is the name of migrations registered with [migrate.Register], which
+//     are applied after the schema using [migrate.Run] with the "sqlite" dialect.
+func NewNamedSqliteRelDB(ctx context.Context, name string, dir string, schema string, migrations string) (*NamedSqliteRelDB, error) {
+	if name == "" || strings.ContainsAny(name, "/\\?#%") {
+		return nil, fmt.Errorf("invalid database name %q", name)
+	}
+	if strings.ContainsAny(dir, "?#") {
+		return nil, fmt.Errorf("invalid database directory %q", dir)
+	}
+	var statements string
+	if schema != "" {
+		bytes, err := os.ReadFile(schema)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read schema for database %v: %w", name, err)
+		}
+		statements = string(bytes)
+	}
+
+	dsn := memoryDSN(name)
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		// Wait for locks held by other connections rather than failing immediately
+		dsn = "file:" + filepath.Join(dir, name+".db") + "?_busy_timeout=5000"
+	}
+	db, err := openSqliteRelDB(ctx, dsn, statements)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database %v: %w", name, err)
+	}
+	if migrations != "" {
+		if err := migrate.Run(ctx, name, db, migrations, "sqlite", nil); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return &NamedSqliteRelDB{db: db}, nil
+}
+
+// Exec implements backend.RelationalDB.
+func (s *NamedSqliteRelDB) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return s.db.Exec(ctx, query, args...)
+}
+
+// Query implements backend.RelationalDB.
+func (s *NamedSqliteRelDB) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return s.db.Query(ctx, query, args...)
+}
+
+// Get implements backend.RelationalDB.
+func (s *NamedSqliteRelDB) Get(ctx context.Context, dst interface{}, query string, args ...any) error {
+	return s.db.Get(ctx, dst, query, args...)
+}
+
+// Prepare implements backend.RelationalDB.
+func (s *NamedSqliteRelDB) Prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	return s.db.Prepare(ctx, query)
+}
+
+// Select implements backend.RelationalDB.
+func (s *NamedSqliteRelDB) Select(ctx context.Context, dst interface{}, query string, args ...any) error {
+	return s.db.Select(ctx, dst, query, args...)
+}
+
+// BeginTx implements backend.RelationalDB.
+func (s *NamedSqliteRelDB) BeginTx(ctx context.Context, opts backend.TxOptions) (backend.RelationalTx, error) {
+	return s.db.BeginTx(ctx, opts)
+}
+
+// Closes the database.  An in-memory database is discarded once all instances using it are closed.
+func (s *NamedSqliteRelDB) Close() error {
+	return s.db.Close()
+}
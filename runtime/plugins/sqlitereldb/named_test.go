@@ -0,0 +1,139 @@
+package sqlitereldb_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/blueprint-uservices/blueprint/runtime/core/migrate"
+	"github.com/blueprint-uservices/blueprint/runtime/plugins/sqlitereldb"
+	"github.com/stretchr/testify/require"
+)
+
+const schema = `
+CREATE TABLE teas (id INTEGER PRIMARY KEY, name TEXT);
+INSERT INTO teas (name) VALUES ('Oolong'), ('Sencha');
+`
+
+func teaNames(t *testing.T, db interface {
+	Select(ctx context.Context, dst interface{}, query string, args ...any) error
+}) []string {
+	var names []string
+	require.NoError(t, db.Select(context.Background(), &names, `SELECT name FROM teas ORDER BY id;`))
+	return names
+}
+
+func TestIsolatedInstances(t *testing.T) {
+	ctx := context.Background()
+
+	first, err := sqlitereldb.NewSqliteRelDB(ctx)
+	require.NoError(t, err)
+	second, err := sqlitereldb.NewSqliteRelDB(ctx)
+	require.NoError(t, err)
+	_, err = first.Exec(ctx, `CREATE TABLE teas (id INTEGER PRIMARY KEY, name TEXT);`)
+	require.NoError(t, err)
+	_, err = second.Exec(ctx, `CREATE TABLE teas (id INTEGER PRIMARY KEY, name TEXT);`)
+	require.NoError(t, err)
+	_, err = first.Exec(ctx, `INSERT INTO teas (name) VALUES ('Oolong');`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Oolong"}, teaNames(t, first))
+	require.Empty(t, teaNames(t, second))
+
+	// Instances with the same name share a database; instances with different names don't
+	a, err := sqlitereldb.NewNamedSqliteRelDB(ctx, "isolated_a", "", "", "")
+	require.NoError(t, err)
+	_, err = a.Exec(ctx, `CREATE TABLE teas (id INTEGER PRIMARY KEY, name TEXT);`)
+	require.NoError(t, err)
+	_, err = a.Exec(ctx, `INSERT INTO teas (name) VALUES ('Assam');`)
+	require.NoError(t, err)
+	alsoA, err := sqlitereldb.NewNamedSqliteRelDB(ctx, "isolated_a", "", "", "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"Assam"}, teaNames(t, alsoA))
+	b, err := sqlitereldb.NewNamedSqliteRelDB(ctx, "isolated_b", "", "", "")
+	require.NoError(t, err)
+	_, err = b.Exec(ctx, `SELECT * FROM teas;`)
+	require.Error(t, err)
+}
+
+func TestSchema(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	schemaFile := filepath.Join(dir, "schema.sql")
+	require.NoError(t, os.WriteFile(schemaFile, []byte(schema), 0644))
+
+	db, err := sqlitereldb.NewNamedSqliteRelDB(ctx, "schema_memory", "", schemaFile, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"Oolong", "Sencha"}, teaNames(t, db))
+
+	// The schema is only applied to a database with no tables, so seed data isn't inserted twice
+	again, err := sqlitereldb.NewNamedSqliteRelDB(ctx, "schema_memory", "", schemaFile, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"Oolong", "Sencha"}, teaNames(t, again))
+
+	// If the schema fails, none of it is applied
+	badSchema := filepath.Join(dir, "bad.sql")
+	require.NoError(t, os.WriteFile(badSchema, []byte(schema+"INSERT INTO nonexistent VALUES (1);"), 0644))
+	_, err = sqlitereldb.NewNamedSqliteRelDB(ctx, "schema_bad", "", badSchema, "")
+	require.Error(t, err)
+	db, err = sqlitereldb.NewNamedSqliteRelDB(ctx, "schema_bad", "", "", "")
+	require.NoError(t, err)
+	var tables int
+	require.NoError(t, db.Get(ctx, &tables, `SELECT count(*) FROM sqlite_master;`))
+	require.Zero(t, tables)
+
+	_, err = sqlitereldb.NewNamedSqliteRelDB(ctx, "schema_missing", "", filepath.Join(dir, "missing.sql"), "")
+	require.Error(t, err)
+}
+
+func TestFileBacked(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "data")
+	schemaFile := filepath.Join(t.TempDir(), "schema.sql")
+	require.NoError(t, os.WriteFile(schemaFile, []byte(schema), 0644))
+
+	db, err := sqlitereldb.NewNamedSqliteRelDB(ctx, "teas", dir, schemaFile, "")
+	require.NoError(t, err)
+	_, err = db.Exec(ctx, `INSERT INTO teas (name) VALUES ('Darjeeling');`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	_, err = os.Stat(filepath.Join(dir, "teas.db"))
+	require.NoError(t, err)
+
+	// The contents survive reopening, and the schema isn't applied again
+	db, err = sqlitereldb.NewNamedSqliteRelDB(ctx, "teas", dir, schemaFile, "")
+	require.NoError(t, err)
+	defer db.Close()
+	require.Equal(t, []string{"Oolong", "Sencha", "Darjeeling"}, teaNames(t, db))
+
+	for _, name := range []string{"", "a/b", "a?b"} {
+		_, err := sqlitereldb.NewNamedSqliteRelDB(ctx, name, dir, "", "")
+		require.Error(t, err, name)
+	}
+}
+
+func init() {
+	migrate.Register("sqlitereldb_teas", fstest.MapFS{
+		"1_create_teas.sqlite.up.sql": {Data: []byte(`CREATE TABLE teas (id INTEGER PRIMARY KEY, name TEXT);`)},
+		"1_create_teas.mysql.up.sql":  {Data: []byte(`CREATE TABLE teas (id INTEGER PRIMARY KEY AUTO_INCREMENT, name TEXT);`)},
+		"2_add_assam.up.sql":          {Data: []byte(`INSERT INTO teas (name) VALUES ('Assam');`)},
+	}, ".")
+}
+
+func TestMigrations(t *testing.T) {
+	ctx := context.Background()
+	// Migrations are applied after the schema, and only once
+	dir := t.TempDir()
+	schemaFile := filepath.Join(dir, "schema.sql")
+	require.NoError(t, os.WriteFile(schemaFile, []byte(`CREATE TABLE vendors (id INTEGER PRIMARY KEY);`), 0644))
+	for i := 0; i < 2; i++ {
+		db, err := sqlitereldb.NewNamedSqliteRelDB(ctx, "migrated_teas", dir, schemaFile, "sqlitereldb_teas")
+		require.NoError(t, err)
+		require.Equal(t, []string{"Assam"}, teaNames(t, db))
+		require.NoError(t, db.Close())
+	}
+
+	_, err := sqlitereldb.NewNamedSqliteRelDB(ctx, "unmigrated_teas", "", "", "nonexistent")
+	require.Error(t, err)
+}
@@ -1,6 +1,9 @@
 // Package sqlitereldb implements a [backend.RelationalDB] using the in-memory Golang
 // SQLite package [github.com/mattn/go-sqlite3].
 //
+// Every [SqliteRelDB] has its own in-memory database.  A [NamedSqliteRelDB] can instead be stored in
+// a file, and can be initialized with a schema when it is created.
+//
 // If you are directly running go code (e.g. not from a docker container), the go-sqlite3
 // package requires CGO_ENABLED=1 and you must have gcc installed.  See [https://github.com/mattn/go-sqlite3]
 // for more details about installation instructions.
@@ -9,10 +12,13 @@ package sqlitereldb
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
 
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
 	"github.com/jmoiron/sqlx"
-
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 // An in-memory relational DB that uses the go-sqlite3 package
@@ -20,36 +26,147 @@ type SqliteRelDB struct {
 	db *sqlx.DB
 }
 
-// Instantiates a new [SqliteRelDB] instance that stores query data in-memory
+// Numbers the databases of unnamed instances, so that each has its own database
+var anonymous atomic.Int64
+
+// Instantiates a new [SqliteRelDB] instance that stores query data in-memory.  Each instance has its own
+// database, which isn't shared with other instances.
 func NewSqliteRelDB(ctx context.Context) (*SqliteRelDB, error) {
-	db, err := sqlx.Open("sqlite3", "file:foobar?mode=memory&cache=shared")
+	return openSqliteRelDB(ctx, memoryDSN(fmt.Sprintf("anonymous/%d", anonymous.Add(1))), "")
+}
+
+// Opens the database at dsn.  If schema is non-empty and the database has no tables, the SQL statements
+// in schema are executed in a transaction to initialize the database.
+func openSqliteRelDB(ctx context.Context, dsn string, schema string) (*SqliteRelDB, error) {
+	db, err := sqlx.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, err
 	}
-	return &SqliteRelDB{db: db}, nil
+	s := &SqliteRelDB{db: db}
+	if schema == "" {
+		return s, nil
+	}
+	err = backend.WithTx(ctx, s, backend.TxOptions{}, func(ctx context.Context, tx backend.RelationalTx) error {
+		var tables int
+		if err := tx.Get(ctx, &tables, `SELECT count(*) FROM sqlite_master WHERE type = 'table';`); err != nil || tables > 0 {
+			return err
+		}
+		_, err := tx.Exec(ctx, schema)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to apply schema: %w", err)
+	}
+	return s, nil
+}
+
+// Returns the dsn of the in-memory database with the given name.  Connections with the same dsn share
+// the database, which exists until its last connection is closed.
+func memoryDSN(name string) string {
+	return "file:" + name + "?mode=memory&cache=shared"
+}
+
+// Closes the database.  An in-memory database is discarded once all instances using it are closed.
+func (s *SqliteRelDB) Close() error {
+	return s.db.Close()
 }
 
 // Exec implements backend.RelationalDB.
 func (s *SqliteRelDB) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
-	return s.db.ExecContext(ctx, query, args...)
+	result, err := s.db.ExecContext(ctx, query, args...)
+	return result, wrapError(err)
 }
 
 // Query implements backend.RelationalDB.
 func (s *SqliteRelDB) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
-	return s.db.QueryContext(ctx, query, args...)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	return rows, wrapError(err)
 }
 
 // Get implements backend.RelationalDB.
 func (s *SqliteRelDB) Get(ctx context.Context, dst interface{}, query string, args ...any) error {
-	return s.db.GetContext(ctx, dst, query, args...)
+	return wrapError(s.db.GetContext(ctx, dst, query, args...))
 }
 
 // Prepare implements backend.RelationalDB.
 func (s *SqliteRelDB) Prepare(ctx context.Context, query string) (*sql.Stmt, error) {
-	return s.db.Prepare(query)
+	stmt, err := s.db.Prepare(query)
+	return stmt, wrapError(err)
 }
 
 // Select implements backend.RelationalDB.
 func (s *SqliteRelDB) Select(ctx context.Context, dst interface{}, query string, args ...any) error {
-	return s.db.SelectContext(ctx, dst, query, args...)
+	return wrapError(s.db.SelectContext(ctx, dst, query, args...))
+}
+
+// BeginTx implements backend.RelationalDB.
+//
+// SQLite transactions are serializable, so every isolation level up to [sql.LevelSerializable] is
+// supported.  Read-only transactions are not enforced.
+//
+// Concurrent transactions that write the same table conflict, and fail with an error that wraps
+// [backend.ErrTransactionConflict].
+func (s *SqliteRelDB) BeginTx(ctx context.Context, opts backend.TxOptions) (backend.RelationalTx, error) {
+	if opts.Isolation > sql.LevelSerializable {
+		return nil, fmt.Errorf("sqlite does not support isolation level %v", opts.Isolation)
+	}
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return &SqliteTx{tx: tx}, nil
+}
+
+// A transaction started by [SqliteRelDB.BeginTx]
+type SqliteTx struct {
+	tx *sqlx.Tx
+}
+
+// Exec implements backend.RelationalTx.
+func (t *SqliteTx) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	result, err := t.tx.ExecContext(ctx, query, args...)
+	return result, wrapError(err)
+}
+
+// Query implements backend.RelationalTx.
+func (t *SqliteTx) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	rows, err := t.tx.QueryContext(ctx, query, args...)
+	return rows, wrapError(err)
+}
+
+// Get implements backend.RelationalTx.
+func (t *SqliteTx) Get(ctx context.Context, dst interface{}, query string, args ...any) error {
+	return wrapError(t.tx.GetContext(ctx, dst, query, args...))
+}
+
+// Prepare implements backend.RelationalTx.
+func (t *SqliteTx) Prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	stmt, err := t.tx.PrepareContext(ctx, query)
+	return stmt, wrapError(err)
+}
+
+// Select implements backend.RelationalTx.
+func (t *SqliteTx) Select(ctx context.Context, dst interface{}, query string, args ...any) error {
+	return wrapError(t.tx.SelectContext(ctx, dst, query, args...))
+}
+
+// Commit implements backend.RelationalTx.
+func (t *SqliteTx) Commit(ctx context.Context) error {
+	return wrapError(t.tx.Commit())
+}
+
+// Rollback implements backend.RelationalTx.
+func (t *SqliteTx) Rollback(ctx context.Context) error {
+	return t.tx.Rollback()
+}
+
+// Wraps sqlite's busy and locked errors, which are returned when concurrent transactions conflict,
+// with [backend.ErrTransactionConflict]
+func wrapError(err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked) {
+		return fmt.Errorf("%w: %w", backend.ErrTransactionConflict, err)
+	}
+	return err
 }
@@ -2,8 +2,12 @@ package sqlitereldb_test
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"sync"
 	"testing"
 
+	"github.com/blueprint-uservices/blueprint/runtime/core/backend"
 	"github.com/blueprint-uservices/blueprint/runtime/plugins/sqlitereldb"
 	"github.com/stretchr/testify/require"
 )
@@ -114,3 +118,103 @@ type Address struct {
 	Street string `db:"street"`
 	Number int    `db:"street_number"`
 }
+
+type Account struct {
+	ID      int `db:"id"`
+	Balance int `db:"balance"`
+}
+
+func makeAccounts(t *testing.T, table string) (context.Context, *sqlitereldb.SqliteRelDB) {
+	ctx := context.Background()
+	db, err := sqlitereldb.NewSqliteRelDB(ctx)
+	require.NoError(t, err)
+	_, err = db.Exec(ctx, `DROP TABLE IF EXISTS `+table+`;`)
+	require.NoError(t, err)
+	_, err = db.Exec(ctx, `CREATE TABLE `+table+` (id INTEGER PRIMARY KEY, balance INT);`)
+	require.NoError(t, err)
+	_, err = db.Exec(ctx, `INSERT INTO `+table+` (id, balance) VALUES (1, 100), (2, 0);`)
+	require.NoError(t, err)
+	return ctx, db
+}
+
+func TestTx(t *testing.T) {
+	ctx, db := makeAccounts(t, "tx_accounts")
+
+	tx, err := db.BeginTx(ctx, backend.TxOptions{})
+	require.NoError(t, err)
+	_, err = tx.Exec(ctx, `UPDATE tx_accounts SET balance = balance - 30 WHERE id = 1;`)
+	require.NoError(t, err)
+	_, err = tx.Exec(ctx, `UPDATE tx_accounts SET balance = balance + 30 WHERE id = 2;`)
+	require.NoError(t, err)
+
+	// The transaction sees its own writes
+	var accounts []Account
+	require.NoError(t, tx.Select(ctx, &accounts, `SELECT * FROM tx_accounts ORDER BY id;`))
+	require.Equal(t, []Account{{1, 70}, {2, 30}}, accounts)
+	require.NoError(t, tx.Commit(ctx))
+	require.True(t, errors.Is(tx.Commit(ctx), sql.ErrTxDone))
+
+	var account Account
+	require.NoError(t, db.Get(ctx, &account, `SELECT * FROM tx_accounts WHERE id = ?;`, 2))
+	require.Equal(t, Account{2, 30}, account)
+
+	// Rolled back changes are discarded
+	tx, err = db.BeginTx(ctx, backend.TxOptions{Isolation: sql.LevelSerializable})
+	require.NoError(t, err)
+	stmt, err := tx.Prepare(ctx, `DELETE FROM tx_accounts WHERE id = ?;`)
+	require.NoError(t, err)
+	_, err = stmt.ExecContext(ctx, 1)
+	require.NoError(t, err)
+	require.NoError(t, stmt.Close())
+	require.NoError(t, tx.Rollback(ctx))
+	require.NoError(t, db.Select(ctx, &accounts, `SELECT * FROM tx_accounts ORDER BY id;`))
+	require.Equal(t, []Account{{1, 70}, {2, 30}}, accounts)
+
+	_, err = db.BeginTx(ctx, backend.TxOptions{Isolation: sql.LevelLinearizable})
+	require.Error(t, err)
+}
+
+func TestWithTx(t *testing.T) {
+	ctx, db := makeAccounts(t, "withtx_accounts")
+
+	// Concurrent transfers conflict and are retried, so no update is lost
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := backend.WithTx(ctx, db, backend.TxOptions{}, func(ctx context.Context, tx backend.RelationalTx) error {
+				var balance int
+				if err := tx.Get(ctx, &balance, `SELECT balance FROM withtx_accounts WHERE id = 1;`); err != nil {
+					return err
+				}
+				if _, err := tx.Exec(ctx, `UPDATE withtx_accounts SET balance = ? WHERE id = 1;`, balance-10); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, `UPDATE withtx_accounts SET balance = balance + 10 WHERE id = 2;`)
+				return err
+			})
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	var accounts []Account
+	require.NoError(t, db.Select(ctx, &accounts, `SELECT * FROM withtx_accounts ORDER BY id;`))
+	require.Equal(t, []Account{{1, 20}, {2, 80}}, accounts)
+
+	// Other errors roll back the transaction and are returned without retrying
+	failure := errors.New("insufficient funds")
+	attempts := 0
+	err := backend.WithTx(ctx, db, backend.TxOptions{}, func(ctx context.Context, tx backend.RelationalTx) error {
+		attempts++
+		if _, err := tx.Exec(ctx, `DELETE FROM withtx_accounts;`); err != nil {
+			return err
+		}
+		return failure
+	})
+	require.Equal(t, failure, err)
+	require.Equal(t, 1, attempts)
+	require.NoError(t, db.Select(ctx, &accounts, `SELECT * FROM withtx_accounts ORDER BY id;`))
+	require.Len(t, accounts, 2)
+}
@@ -0,0 +1,138 @@
+package wiring
+
+import (
+	"testing"
+
+	"github.com/blueprint-uservices/blueprint/plugins/goproc"
+	"github.com/blueprint-uservices/blueprint/plugins/grpc"
+	"github.com/blueprint-uservices/blueprint/plugins/linuxcontainer"
+	"github.com/blueprint-uservices/blueprint/plugins/replicas"
+	"github.com/blueprint-uservices/blueprint/plugins/workflow"
+	wf "github.com/blueprint-uservices/blueprint/test/workflow/workflow"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeployReplicas(t *testing.T) {
+	spec := newWiringSpec("TestDeployReplicas")
+
+	leaf := workflow.Service[*wf.TestLeafServiceImpl](spec, "leaf")
+	nonleaf := workflow.Service[wf.TestNonLeafService](spec, "nonleaf", leaf)
+
+	leafctrs := replicas.Deploy(spec, leaf, 3)
+	assert.Equal(t, []string{"leaf_replica0_ctr", "leaf_replica1_ctr", "leaf_replica2_ctr"}, leafctrs)
+	grpc.Deploy(spec, nonleaf)
+	goproc.Deploy(spec, nonleaf)
+	nonleafctr := linuxcontainer.Deploy(spec, nonleaf)
+
+	app := assertBuildSuccess(t, spec, append(leafctrs, nonleafctr)...)
+
+	assertIR(t, app,
+		`TestDeployReplicas = BlueprintApplication() {
+			leaf.replicas = ReplicaSet(leaf_replica0, leaf_replica1, leaf_replica2)
+			leaf_replica0.grpc.addr
+			leaf_replica0.grpc.bind_addr = AddressConfig()
+			leaf_replica0.grpc.dial_addr = AddressConfig()
+			leaf_replica0_ctr = LinuxContainer(leaf_replica0.grpc.bind_addr) {
+				leaf_replica0_proc = GolangProcessNode(leaf_replica0.grpc.bind_addr) {
+					leaf = TestLeafService()
+					leaf_replica0.grpc_server = GRPCServer(leaf, leaf_replica0.grpc.bind_addr)
+					leaf_replica0_proc.logger = SLogger()
+					leaf_replica0_proc.stdoutmetriccollector = StdoutMetricCollector()
+				}
+			}
+			leaf_replica1.grpc.addr
+			leaf_replica1.grpc.bind_addr = AddressConfig()
+			leaf_replica1.grpc.dial_addr = AddressConfig()
+			leaf_replica1_ctr = LinuxContainer(leaf_replica1.grpc.bind_addr) {
+				leaf_replica1_proc = GolangProcessNode(leaf_replica1.grpc.bind_addr) {
+					leaf = TestLeafService()
+					leaf_replica1.grpc_server = GRPCServer(leaf, leaf_replica1.grpc.bind_addr)
+					leaf_replica1_proc.logger = SLogger()
+					leaf_replica1_proc.stdoutmetriccollector = StdoutMetricCollector()
+				}
+			}
+			leaf_replica2.grpc.addr
+			leaf_replica2.grpc.bind_addr = AddressConfig()
+			leaf_replica2.grpc.dial_addr = AddressConfig()
+			leaf_replica2_ctr = LinuxContainer(leaf_replica2.grpc.bind_addr) {
+				leaf_replica2_proc = GolangProcessNode(leaf_replica2.grpc.bind_addr) {
+					leaf = TestLeafService()
+					leaf_replica2.grpc_server = GRPCServer(leaf, leaf_replica2.grpc.bind_addr)
+					leaf_replica2_proc.logger = SLogger()
+					leaf_replica2_proc.stdoutmetriccollector = StdoutMetricCollector()
+				}
+			}
+			nonleaf.grpc.addr
+			nonleaf.grpc.bind_addr = AddressConfig()
+			nonleaf.handler.visibility
+			nonleaf_ctr = LinuxContainer(leaf_replica0.grpc.dial_addr, leaf_replica1.grpc.dial_addr, leaf_replica2.grpc.dial_addr, nonleaf.grpc.bind_addr) {
+				nonleaf_proc = GolangProcessNode(leaf_replica0.grpc.dial_addr, leaf_replica1.grpc.dial_addr, leaf_replica2.grpc.dial_addr, nonleaf.grpc.bind_addr) {
+					leaf.client = leaf.client.lb
+					leaf.client.lb = LoadBalancer(round_robin, leaf_replica0.grpc_client, leaf_replica1.grpc_client, leaf_replica2.grpc_client)
+					leaf_replica0.grpc_client = GRPCClient(leaf_replica0.grpc.dial_addr)
+					leaf_replica1.grpc_client = GRPCClient(leaf_replica1.grpc.dial_addr)
+					leaf_replica2.grpc_client = GRPCClient(leaf_replica2.grpc.dial_addr)
+					nonleaf = TestNonLeafService(leaf.client)
+					nonleaf.grpc_server = GRPCServer(nonleaf, nonleaf.grpc.bind_addr)
+					nonleaf_proc.logger = SLogger()
+					nonleaf_proc.stdoutmetriccollector = StdoutMetricCollector()
+				}
+			}
+		  }`)
+}
+
+func TestReplicate(t *testing.T) {
+	spec := newWiringSpec("TestReplicate")
+
+	leaf := workflow.Service[*wf.TestLeafServiceImpl](spec, "leaf")
+	nonleaf := workflow.Service[wf.TestNonLeafService](spec, "nonleaf", leaf)
+
+	leafreplicas := replicas.Replicate(spec, leaf, 2, "random")
+	assert.Equal(t, []string{"leaf_replica0", "leaf_replica1"}, leafreplicas)
+
+	leafprocs := []string{}
+	for _, replica := range leafreplicas {
+		grpc.Deploy(spec, replica)
+		leafprocs = append(leafprocs, goproc.Deploy(spec, replica))
+	}
+	grpc.Deploy(spec, nonleaf)
+	nonleafproc := goproc.Deploy(spec, nonleaf)
+
+	app := assertBuildSuccess(t, spec, append(leafprocs, nonleafproc)...)
+
+	assertIR(t, app,
+		`TestReplicate = BlueprintApplication() {
+			leaf.replicas = ReplicaSet(leaf_replica0, leaf_replica1)
+			leaf_replica0.grpc.addr
+			leaf_replica0.grpc.bind_addr = AddressConfig()
+			leaf_replica0.grpc.dial_addr = AddressConfig()
+			leaf_replica0_proc = GolangProcessNode(leaf_replica0.grpc.bind_addr) {
+				leaf = TestLeafService()
+				leaf_replica0.grpc_server = GRPCServer(leaf, leaf_replica0.grpc.bind_addr)
+				leaf_replica0_proc.logger = SLogger()
+				leaf_replica0_proc.stdoutmetriccollector = StdoutMetricCollector()
+			}
+			leaf_replica1.grpc.addr
+			leaf_replica1.grpc.bind_addr = AddressConfig()
+			leaf_replica1.grpc.dial_addr = AddressConfig()
+			leaf_replica1_proc = GolangProcessNode(leaf_replica1.grpc.bind_addr) {
+				leaf = TestLeafService()
+				leaf_replica1.grpc_server = GRPCServer(leaf, leaf_replica1.grpc.bind_addr)
+				leaf_replica1_proc.logger = SLogger()
+				leaf_replica1_proc.stdoutmetriccollector = StdoutMetricCollector()
+			}
+			nonleaf.grpc.addr
+			nonleaf.grpc.bind_addr = AddressConfig()
+			nonleaf.handler.visibility
+			nonleaf_proc = GolangProcessNode(leaf_replica0.grpc.dial_addr, leaf_replica1.grpc.dial_addr, nonleaf.grpc.bind_addr) {
+				leaf.client = leaf.client.lb
+				leaf.client.lb = LoadBalancer(random, leaf_replica0.grpc_client, leaf_replica1.grpc_client)
+				leaf_replica0.grpc_client = GRPCClient(leaf_replica0.grpc.dial_addr)
+				leaf_replica1.grpc_client = GRPCClient(leaf_replica1.grpc.dial_addr)
+				nonleaf = TestNonLeafService(leaf.client)
+				nonleaf.grpc_server = GRPCServer(nonleaf, nonleaf.grpc.bind_addr)
+				nonleaf_proc.logger = SLogger()
+				nonleaf_proc.stdoutmetriccollector = StdoutMetricCollector()
+			}
+		  }`)
+}
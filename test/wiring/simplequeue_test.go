@@ -0,0 +1,29 @@
+package wiring
+
+import (
+	"testing"
+
+	"github.com/blueprint-uservices/blueprint/plugins/goproc"
+	"github.com/blueprint-uservices/blueprint/plugins/simple"
+)
+
+func TestSimpleQueueDeadLetters(t *testing.T) {
+	spec := newWiringSpec("TestSimpleQueueDeadLetters")
+
+	queue := simple.Queue(spec, "my_queue")
+	myproc := goproc.CreateProcess(spec, "myproc", queue, queue+".dlq")
+
+	app := assertBuildSuccess(t, spec, myproc)
+
+	assertIR(t, app,
+		`TestSimpleQueueDeadLetters = BlueprintApplication() {
+			my_queue.backend.visibility
+			my_queue.dlq.backend.visibility
+			myproc = GolangProcessNode() {
+			  my_queue = SimpleQueue()
+			  my_queue.dlq = DeadLetterQueue()
+			  myproc.logger = SLogger()
+			  myproc.stdoutmetriccollector = StdoutMetricCollector()
+			}
+		  }`)
+}